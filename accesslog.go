@@ -0,0 +1,147 @@
+package gutenblog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Access log formats
+const (
+	AccessLogDefault  = ""         // Structured records through the site's logger
+	AccessLogCommon   = "common"   // NCSA Common Log Format
+	AccessLogCombined = "combined" // Common Log Format plus referer and user agent
+	AccessLogJSON     = "json"     // One JSON object per line
+)
+
+// responseRecorder wraps an http.ResponseWriter to record the status
+// code and number of bytes written for the access log.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *responseRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *responseRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// accessLogEntry is a single served request.
+type accessLogEntry struct {
+	Time      time.Time     `json:"time"`
+	RemoteIP  string        `json:"remote_ip"`
+	User      string        `json:"user,omitempty"`
+	Method    string        `json:"method"`
+	URL       string        `json:"url"`
+	Proto     string        `json:"proto"`
+	Status    int           `json:"status"`
+	Bytes     int64         `json:"bytes"`
+	Latency   time.Duration `json:"latency_ns"`
+	Referer   string        `json:"referer,omitempty"`
+	UserAgent string        `json:"user_agent,omitempty"`
+}
+
+// accessLog wraps next to log every request in the given format. Text
+// and JSON formats are written to w, or os.Stderr if w is nil, and the
+// default format to logger.
+func accessLog(next http.Handler, format string, w io.Writer, logger *slog.Logger) (http.Handler, error) {
+	switch format {
+	case AccessLogDefault, AccessLogCommon, AccessLogCombined, AccessLogJSON:
+	default:
+		return nil, fmt.Errorf("unknown access log format %q", format)
+	}
+
+	if w == nil {
+		w = os.Stderr
+	}
+
+	var mu sync.Mutex // Keep lines from concurrent requests intact
+	enc := json.NewEncoder(w)
+
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &responseRecorder{ResponseWriter: rw}
+		next.ServeHTTP(rec, r)
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		e := accessLogEntry{
+			Time:      start,
+			RemoteIP:  r.RemoteAddr,
+			Method:    r.Method,
+			URL:       r.URL.RequestURI(),
+			Proto:     r.Proto,
+			Status:    rec.status,
+			Bytes:     rec.bytes,
+			Latency:   time.Since(start),
+			Referer:   r.Referer(),
+			UserAgent: r.UserAgent(),
+		}
+		if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			e.RemoteIP = host
+		}
+		if user, _, ok := r.BasicAuth(); ok {
+			e.User = user
+		}
+
+		if format == AccessLogDefault {
+			logger.Info("request", "method", e.Method, "url", e.URL, "status", e.Status, "bytes", e.Bytes, "latency", e.Latency)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch format {
+		case AccessLogJSON:
+			enc.Encode(e)
+		case AccessLogCommon:
+			fmt.Fprintln(w, e.common())
+		case AccessLogCombined:
+			fmt.Fprintf(w, "%s %q %q\n", e.common(), e.Referer, e.UserAgent)
+		}
+	}), nil
+}
+
+// common formats the entry as a Common Log Format line.
+func (e accessLogEntry) common() string {
+	user := e.User
+	if user == "" {
+		user = "-"
+	}
+
+	bytes := "-"
+	if e.Bytes > 0 {
+		bytes = fmt.Sprint(e.Bytes)
+	}
+
+	return fmt.Sprintf("%s - %s [%s] \"%s %s %s\" %d %s",
+		e.RemoteIP, user, e.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		e.Method, e.URL, e.Proto, e.Status, bytes)
+}
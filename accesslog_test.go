@@ -0,0 +1,78 @@
+package gutenblog
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+)
+
+func TestAccessLog(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("hello"))
+	})
+
+	tests := []struct {
+		format string
+		path   string
+		want   *regexp.Regexp
+	}{
+		{
+			format: AccessLogCommon,
+			path:   "/",
+			want:   regexp.MustCompile(`^192\.0\.2\.1 - - \[.+\] "GET / HTTP/1\.1" 200 5\n$`),
+		},
+		{
+			format: AccessLogCombined,
+			path:   "/missing",
+			want:   regexp.MustCompile(`^192\.0\.2\.1 - - \[.+\] "GET /missing HTTP/1\.1" 404 19 "https://example\.com/" "test-agent"\n$`),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			h, err := accessLog(next, tt.format, &buf, gutenlog)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r := httptest.NewRequest("GET", tt.path, nil)
+			r.Header.Set("Referer", "https://example.com/")
+			r.Header.Set("User-Agent", "test-agent")
+			h.ServeHTTP(httptest.NewRecorder(), r)
+
+			if !tt.want.MatchString(buf.String()) {
+				t.Errorf("got %q, want match for %q", buf.String(), tt.want)
+			}
+		})
+	}
+
+	t.Run(AccessLogJSON, func(t *testing.T) {
+		var buf bytes.Buffer
+		h, err := accessLog(next, AccessLogJSON, &buf, gutenlog)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/?q=1", nil))
+
+		var e accessLogEntry
+		if err := json.Unmarshal(buf.Bytes(), &e); err != nil {
+			t.Fatalf("error decoding %q: %v", buf.String(), err)
+		}
+		if e.URL != "/?q=1" || e.Status != 200 || e.Bytes != 5 {
+			t.Errorf("got %+v", e)
+		}
+	})
+
+	if _, err := accessLog(next, "apache", nil, gutenlog); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,104 @@
+package gutenblog
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Site-wide artifacts (feeds, the permalink map, and registered
+// generators) only read the in-memory post model, so once the pages
+// are written they are produced concurrently in a separate stage.
+
+type artifact struct {
+	name string
+	run  func() error
+}
+
+// ArtifactError collects every artifact that failed during a build.
+type ArtifactError struct {
+	Errs []error
+}
+
+func (e *ArtifactError) Error() string {
+	msgs := make([]string, 0, len(e.Errs))
+	for _, err := range e.Errs {
+		msgs = append(msgs, err.Error())
+	}
+
+	return fmt.Sprintf("%d artifacts failed: %s", len(e.Errs), strings.Join(msgs, "; "))
+}
+
+func (e *ArtifactError) Unwrap() []error {
+	return e.Errs
+}
+
+// artifacts lists every artifact to generate for the site.
+func (s *Site) artifacts() []artifact {
+	var artifacts []artifact
+
+	for _, b := range s.blogs {
+		b := b
+		artifacts = append(artifacts, artifact{
+			name: fmt.Sprintf("feeds for %q", filepath.Base(b.name)),
+			run:  func() error { return s.writeFeeds(b) },
+		})
+	}
+
+	artifacts = append(artifacts, artifact{name: "permalinks", run: s.checkPermalinks})
+
+	if s.config.Highlight.Style != "" {
+		artifacts = append(artifacts, artifact{name: "highlight CSS", run: s.writeHighlightCSS})
+	}
+
+	out := dirFS(s.outDir)
+	for _, g := range registeredGenerators() {
+		g := g
+		artifacts = append(artifacts, artifact{
+			name: fmt.Sprintf("generator %q", g.Name()),
+			run:  func() error { return g.Generate(s, out) },
+		})
+	}
+
+	return artifacts
+}
+
+// generateArtifacts runs all artifacts concurrently and waits for
+// them to finish. Every failure is reported, not just the first.
+func (s *Site) generateArtifacts() error {
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+
+	for _, a := range s.artifacts() {
+		wg.Add(1)
+		go func(a artifact) {
+			defer wg.Done()
+
+			start := time.Now()
+			err := a.run()
+			s.logger.Debug("generated artifact", "artifact", a.name, "duration", time.Since(start))
+
+			if err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("error generating %s: %w", a.name, err))
+				mu.Unlock()
+			}
+		}(a)
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		sort.Slice(errs, func(i, j int) bool {
+			return errs[i].Error() < errs[j].Error()
+		})
+		return &ArtifactError{Errs: errs}
+	}
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package gutenblog
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// BasicAuth protects the server with HTTP basic authentication.
+// Credentials are either a single Username and Password or the
+// entries of an htpasswd file (bcrypt, {SHA}, or plain text).
+type BasicAuth struct {
+	Username string
+	Password string
+
+	// HtpasswdFile is the path to an htpasswd file. It is read once
+	// when the server starts.
+	HtpasswdFile string
+
+	// Realm is shown by browsers in the login prompt. Defaults to "gutenblog".
+	Realm string
+}
+
+// htpasswd maps usernames to password hashes
+type htpasswd map[string]string
+
+// credentials returns the accepted usernames and password hashes.
+func (a *BasicAuth) credentials() (htpasswd, error) {
+	creds := make(htpasswd)
+	if a.Username != "" {
+		creds[a.Username] = a.Password
+	}
+
+	if a.HtpasswdFile != "" {
+		f, err := os.Open(a.HtpasswdFile)
+		if err != nil {
+			return nil, fmt.Errorf("error opening htpasswd file: %w", err)
+		}
+		defer f.Close()
+
+		scanner := bufio.NewScanner(f)
+		for n := 1; scanner.Scan(); n++ {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+
+			user, hash, ok := strings.Cut(line, ":")
+			if !ok {
+				return nil, fmt.Errorf("error parsing htpasswd file %q: line %d: missing ':'", a.HtpasswdFile, n)
+			}
+
+			if strings.HasPrefix(hash, "$apr1$") {
+				return nil, fmt.Errorf("error parsing htpasswd file %q: line %d: MD5 hashes are not supported (use bcrypt)", a.HtpasswdFile, n)
+			}
+
+			creds[user] = hash
+		}
+
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("error reading htpasswd file: %w", err)
+		}
+	}
+
+	if len(creds) == 0 {
+		return nil, fmt.Errorf("basic auth requires a username or an htpasswd file")
+	}
+
+	return creds, nil
+}
+
+// check reports whether password matches the user's password hash.
+func (h htpasswd) check(user, password string) bool {
+	hash, ok := h[user]
+	if !ok {
+		return false
+	}
+
+	switch {
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	case strings.HasPrefix(hash, "{SHA}"):
+		sum := sha1.Sum([]byte(password))
+		want := strings.TrimPrefix(hash, "{SHA}")
+		return subtle.ConstantTimeCompare([]byte(base64.StdEncoding.EncodeToString(sum[:])), []byte(want)) == 1
+	default:
+		return subtle.ConstantTimeCompare([]byte(hash), []byte(password)) == 1
+	}
+}
+
+// middleware wraps next so only authenticated requests reach it.
+func (a *BasicAuth) middleware(next http.Handler) (http.Handler, error) {
+	creds, err := a.credentials()
+	if err != nil {
+		return nil, err
+	}
+
+	realm := a.Realm
+	if realm == "" {
+		realm = "gutenblog"
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Protected previews shouldn't show up in search results
+		w.Header().Set("X-Robots-Tag", "noindex, nofollow")
+
+		user, password, ok := r.BasicAuth()
+		if !ok || !creds.check(user, password) {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q, charset=\"UTF-8\"", realm))
+			http.Error(w, "401 Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}), nil
+}
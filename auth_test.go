@@ -0,0 +1,70 @@
+package gutenblog
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestBasicAuth(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("hunter2"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(t.TempDir(), ".htpasswd")
+	htpasswd := "# editors\n" +
+		"alice:" + string(hash) + "\n" +
+		"bob:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=\n" // "password"
+	if err := os.WriteFile(file, []byte(htpasswd), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	auth := &BasicAuth{Username: "carol", Password: "secret", HtpasswdFile: file}
+	h, err := auth.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		user     string
+		password string
+		want     int
+	}{
+		{"bcrypt", "alice", "hunter2", http.StatusOK},
+		{"sha", "bob", "password", http.StatusOK},
+		{"plain", "carol", "secret", http.StatusOK},
+		{"wrong password", "alice", "hunter3", http.StatusUnauthorized},
+		{"unknown user", "mallory", "secret", http.StatusUnauthorized},
+		{"no credentials", "", "", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			if tt.user != "" {
+				r.SetBasicAuth(tt.user, tt.password)
+			}
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != tt.want {
+				t.Errorf("got status %d, want %d", w.Code, tt.want)
+			}
+			if w.Header().Get("X-Robots-Tag") == "" {
+				t.Error("missing X-Robots-Tag")
+			}
+			if tt.want == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Error("missing WWW-Authenticate")
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package gutenblog
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// BuildInfo fingerprints a build so it's easy to tell which version of
+// a site is live. It is embedded as a comment in generated pages and
+// recorded in the URL map when enabled.
+type BuildInfo struct {
+	Version string    `json:"version"`          // gutenblog module version
+	Time    time.Time `json:"time"`             // When the build started
+	Commit  string    `json:"commit,omitempty"` // Git commit of the site's content, if any
+}
+
+func (b *BuildInfo) String() string {
+	s := fmt.Sprintf("gutenblog %s built %s", b.Version, b.Time.Format(time.RFC3339))
+	if b.Commit != "" {
+		s += " from " + b.Commit
+	}
+
+	return s
+}
+
+// SetBuildInfo overrides the build_info setting from the site config,
+// e.g. to omit the fingerprint for reproducible builds.
+func (s *Site) SetBuildInfo(enabled bool) {
+	s.config.BuildInfo = enabled
+}
+
+// newBuildInfo gathers the fingerprint for a build of the site.
+func (s *Site) newBuildInfo() *BuildInfo {
+	info := &BuildInfo{
+		Version: "(devel)",
+		Time:    time.Now().UTC().Truncate(time.Second),
+	}
+
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if bi.Main.Path == "github.com/anschwa/gutenblog" {
+			info.Version = bi.Main.Version
+		}
+
+		for _, dep := range bi.Deps {
+			if dep.Path == "github.com/anschwa/gutenblog" {
+				info.Version = dep.Version
+			}
+		}
+	}
+
+	// The content repo is optional, so ignore any errors
+	if out, err := exec.Command("git", "-C", s.rootDir, "rev-parse", "--short", "HEAD").Output(); err == nil {
+		info.Commit = strings.TrimSpace(string(out))
+	}
+
+	return info
+}
+
+// buildComment returns the HTML comment added to the head of generated
+// pages.
+func (s *Site) buildComment() string {
+	if s.build == nil {
+		return ""
+	}
+
+	// "--" isn't allowed inside of HTML comments
+	return "<!-- " + strings.ReplaceAll(s.build.String(), "--", "- -") + " -->"
+}
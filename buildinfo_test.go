@@ -0,0 +1,73 @@
+package gutenblog
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildInfo(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		s, err := New("examples/solo-blog", t.TempDir(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.SetBuildInfo(enabled)
+
+		if err := s.Build(); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, page := range []string{"index.html", filepath.Join("2022", "03", "21", "hello-world", "index.html")} {
+			b, err := os.ReadFile(filepath.Join(s.outDir, page))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Contains(string(b), "<!-- gutenblog "); got != enabled {
+				t.Errorf("%s: build comment: want %v; got %v", page, enabled, got)
+			}
+			if head, _, _ := strings.Cut(string(b), "</head>"); enabled && !strings.Contains(head, "<!-- gutenblog ") {
+				t.Errorf("%s: want the build comment in the head", page)
+			}
+			if !strings.HasSuffix(strings.TrimSpace(string(b)), "</html>") {
+				t.Errorf("%s: want nothing after </html>", page)
+			}
+		}
+
+		b, err := os.ReadFile(filepath.Join(s.outDir, urlMapFile))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var m urlMap
+		if err := json.Unmarshal(b, &m); err != nil {
+			t.Fatal(err)
+		}
+		if got := m.Build != nil; got != enabled {
+			t.Errorf("URL map build info: want %v; got %+v", enabled, m.Build)
+		}
+		if enabled && (m.Build.Version == "" || m.Build.Time.IsZero()) {
+			t.Errorf("want a version and build time; got %+v", m.Build)
+		}
+	}
+}
+
+func TestBuildComment(t *testing.T) {
+	s := &Site{build: &BuildInfo{
+		Version: "v1.2.3",
+		Time:    time.Date(2022, 3, 21, 12, 0, 0, 0, time.UTC),
+		Commit:  "abc--def",
+	}}
+
+	want := "<!-- gutenblog v1.2.3 built 2022-03-21T12:00:00Z from abc- -def -->"
+	if got := s.buildComment(); got != want {
+		t.Errorf("want %q; got %q", want, got)
+	}
+
+	s.build = nil
+	if got := s.buildComment(); got != "" {
+		t.Errorf("want no comment without build info; got %q", got)
+	}
+}
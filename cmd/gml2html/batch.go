@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// convertAll converts every GML file matched by args into outDir.
+// Errors are reported per file and don't stop the rest of the batch.
+func convertAll(args []string, outDir string, opts *options) error {
+	files, err := expand(args)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no .gml.txt files found")
+	}
+
+	base := commonDir(files)
+
+	jobs := make(chan string)
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed int
+	)
+
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for in := range jobs {
+				rel, err := filepath.Rel(base, in)
+				if err != nil {
+					rel = filepath.Base(in)
+				}
+				out := filepath.Join(outDir, strings.TrimSuffix(rel, ".gml.txt")+".html")
+
+				err = os.MkdirAll(filepath.Dir(out), 0755)
+				if err == nil {
+					err = convert(in, out, opts)
+				}
+
+				if err != nil {
+					log.Printf("%s: %v", in, err)
+
+					mu.Lock()
+					failed++
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	for _, f := range files {
+		jobs <- f
+	}
+	close(jobs)
+	wg.Wait()
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files failed to convert", failed, len(files))
+	}
+
+	return nil
+}
+
+// expand resolves files, directories, and glob patterns to a sorted
+// list of GML files.
+func expand(args []string) ([]string, error) {
+	seen := make(map[string]bool)
+	var files []string
+
+	add := func(p string) {
+		if !seen[p] {
+			seen[p] = true
+			files = append(files, p)
+		}
+	}
+
+	for _, arg := range args {
+		if !strings.ContainsAny(arg, "*?[") {
+			info, err := os.Stat(arg)
+			if err != nil {
+				return nil, err
+			}
+
+			if !info.IsDir() {
+				add(filepath.Clean(arg))
+				continue
+			}
+
+			// Every GML file in the directory
+			arg = filepath.Join(arg, "**", "*.gml.txt")
+		}
+
+		matches, err := glob(arg)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range matches {
+			add(m)
+		}
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+// glob is like filepath.Glob but "**" also matches any number of
+// directories.
+func glob(pattern string) ([]string, error) {
+	pattern = filepath.ToSlash(filepath.Clean(pattern))
+	if !strings.Contains(pattern, "**") {
+		return filepath.Glob(filepath.FromSlash(pattern))
+	}
+
+	// Walk from the last directory before the first wildcard
+	root := pattern[:strings.IndexAny(pattern, "*?[")]
+	if i := strings.LastIndex(root, "/"); i >= 0 {
+		root = root[:i]
+	} else {
+		root = "."
+	}
+
+	re, err := globRegexp(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []string
+	err = filepath.WalkDir(filepath.FromSlash(root), func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !d.IsDir() && re.MatchString(filepath.ToSlash(p)) {
+			matches = append(matches, p)
+		}
+
+		return nil
+	})
+
+	return matches, err
+}
+
+// globRegexp translates a slash separated glob pattern to a regexp.
+func globRegexp(pattern string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	if strings.HasPrefix(pattern, "./") {
+		pattern = pattern[2:]
+	}
+
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			if strings.HasPrefix(pattern[i:], "**/") {
+				b.WriteString("(?:.*/)?")
+				i += 2
+			} else if strings.HasPrefix(pattern[i:], "**") {
+				b.WriteString(".*")
+				i++
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			j := strings.IndexByte(pattern[i:], ']')
+			if j < 0 {
+				return nil, filepath.ErrBadPattern
+			}
+			class := pattern[i+1 : i+j]
+			if strings.HasPrefix(class, "^") || strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += j
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+
+	return regexp.Compile(b.String())
+}
+
+// commonDir returns the deepest directory containing every file.
+func commonDir(files []string) string {
+	dir := filepath.Dir(files[0])
+	for _, f := range files[1:] {
+		for !strings.HasPrefix(filepath.Dir(f)+string(filepath.Separator), dir+string(filepath.Separator)) && dir != "." && dir != string(filepath.Separator) {
+			dir = filepath.Dir(dir)
+		}
+	}
+
+	return dir
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/anschwa/gutenblog/gml"
+)
+
+func TestGlobRegexp(t *testing.T) {
+	tests := []struct {
+		pattern string
+		match   []string
+		noMatch []string
+	}{
+		{
+			pattern: "posts/*.gml.txt",
+			match:   []string{"posts/a.gml.txt"},
+			noMatch: []string{"posts/2022/a.gml.txt", "a.gml.txt", "posts/a.gml.txtx"},
+		},
+		{
+			pattern: "posts/**/*.gml.txt",
+			match:   []string{"posts/a.gml.txt", "posts/2022/a.gml.txt", "posts/2022/03/a.gml.txt"},
+			noMatch: []string{"drafts/a.gml.txt", "posts/a.txt"},
+		},
+		{
+			pattern: "posts/**",
+			match:   []string{"posts/a", "posts/2022/a.gml.txt"},
+			noMatch: []string{"drafts/a"},
+		},
+		{
+			pattern: "./posts/?.gml.txt",
+			match:   []string{"posts/a.gml.txt"},
+			noMatch: []string{"posts/ab.gml.txt", "posts//.gml.txt"},
+		},
+		{
+			pattern: "posts/[ab].gml.txt",
+			match:   []string{"posts/a.gml.txt", "posts/b.gml.txt"},
+			noMatch: []string{"posts/c.gml.txt"},
+		},
+		{
+			pattern: "posts/[!ab].gml.txt",
+			match:   []string{"posts/c.gml.txt"},
+			noMatch: []string{"posts/a.gml.txt"},
+		},
+		{
+			pattern: "posts/a+b.gml.txt",
+			match:   []string{"posts/a+b.gml.txt"},
+			noMatch: []string{"posts/aab.gml.txt"},
+		},
+	}
+
+	for _, tt := range tests {
+		re, err := globRegexp(tt.pattern)
+		if err != nil {
+			t.Errorf("%q: %v", tt.pattern, err)
+			continue
+		}
+
+		for _, p := range tt.match {
+			if !re.MatchString(p) {
+				t.Errorf("%q: want a match for %q", tt.pattern, p)
+			}
+		}
+		for _, p := range tt.noMatch {
+			if re.MatchString(p) {
+				t.Errorf("%q: want no match for %q", tt.pattern, p)
+			}
+		}
+	}
+
+	if _, err := globRegexp("posts/[ab.gml.txt"); err != filepath.ErrBadPattern {
+		t.Errorf("want filepath.ErrBadPattern for an unclosed class; got %v", err)
+	}
+}
+
+func TestCommonDir(t *testing.T) {
+	tests := []struct {
+		files []string
+		want  string
+	}{
+		{[]string{"posts/a.gml.txt"}, "posts"},
+		{[]string{"posts/a.gml.txt", "posts/b.gml.txt"}, "posts"},
+		{[]string{"posts/2022/a.gml.txt", "posts/2023/b.gml.txt"}, "posts"},
+		{[]string{"posts/2022/a.gml.txt", "posts/b.gml.txt"}, "posts"},
+		{[]string{"posts/a.gml.txt", "post/b.gml.txt"}, "."},
+		{[]string{"a.gml.txt", "posts/b.gml.txt"}, "."},
+		{[]string{"/site/posts/a.gml.txt", "/site/drafts/b.gml.txt"}, "/site"},
+		{[]string{"/posts/a.gml.txt", "/drafts/b.gml.txt"}, "/"},
+	}
+
+	for _, tt := range tests {
+		files := make([]string, len(tt.files))
+		for i, f := range tt.files {
+			files[i] = filepath.FromSlash(f)
+		}
+
+		if got := commonDir(files); got != filepath.FromSlash(tt.want) {
+			t.Errorf("%q: want %q; got %q", tt.files, tt.want, got)
+		}
+	}
+}
+
+func TestConvertAll(t *testing.T) {
+	dir := t.TempDir()
+	for name, src := range map[string]string{
+		"posts/hello.gml.txt":       hello,
+		"posts/2022/news.gml.txt":   "%title News\n\nNothing new.\n",
+		"posts/2022/broken.gml.txt": "%title Broken\n\n%nope\n",
+	} {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	out := t.TempDir()
+	err := convertAll([]string{filepath.Join(dir, "posts")}, out, &options{html: &gml.HTMLOptions{}})
+	if err == nil || !strings.Contains(err.Error(), "1 of 3 files failed") {
+		t.Errorf("want 1 of 3 files to fail; got %v", err)
+	}
+
+	for _, name := range []string{"hello.html", "2022/news.html"} {
+		if _, err := os.Stat(filepath.Join(out, filepath.FromSlash(name))); err != nil {
+			t.Errorf("want %s converted despite the broken file: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(out, "2022", "broken.html")); err == nil {
+		t.Error("want no output for the broken file")
+	}
+}
@@ -0,0 +1,176 @@
+// Command gml2html converts a GML document to HTML.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/anschwa/gutenblog/gml"
+)
+
+const usage = `usage: gml2html [flags] [file]
+       gml2html [flags] -out dir path...
+
+Convert a GML document to HTML. The document is read from file, or
+from stdin if file is "-" or omitted.
+
+With -out, convert every .gml.txt file found in the given files,
+directories, or glob patterns (which may use "**" to match any number
+of directories) into dir, mirroring the input directory structure.
+
+Flags:
+`
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("gml2html: ")
+
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+
+	outFlag := flag.String("o", "", "write the HTML to a file instead of stdout")
+	minify := flag.Bool("minify", false, "omit the whitespace between elements")
+	inlineHTML := flag.Bool("inline-html", false, "write HTML tags in the text as-is instead of escaping them")
+	sanitize := flag.Bool("sanitize", false, "keep only safe elements and attributes of the HTML in the text")
+	lenient := flag.Bool("lenient", false, "keep blocks with errors as text and print the errors as warnings")
+	standalone := flag.Bool("standalone", false, "write a complete HTML document instead of an <article> fragment")
+	css := flag.String("css", "", "stylesheet URL to link from a -standalone document")
+	outDir := flag.String("out", "", "convert many files into this directory")
+	flag.Parse()
+
+	opts := &options{
+		html:       &gml.HTMLOptions{Minified: *minify, InlineHTML: *inlineHTML, Sanitize: *sanitize},
+		lenient:    *lenient,
+		standalone: *standalone,
+		css:        *css,
+	}
+
+	if *outDir != "" {
+		if flag.NArg() == 0 || *outFlag != "" {
+			flag.Usage()
+			os.Exit(2)
+		}
+
+		if err := convertAll(flag.Args(), *outDir, opts); err != nil {
+			fatal(err)
+		}
+		return
+	}
+
+	if flag.NArg() > 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := convert(flag.Arg(0), *outFlag, opts); err != nil {
+		fatal(err)
+	}
+}
+
+// fatal logs err, followed by the line of a GML syntax error, and
+// exits.
+func fatal(err error) {
+	var perr *gml.ParseError
+	if errors.As(err, &perr) && perr.Context() != "" {
+		log.Fatalf("%v\n%s", err, perr.Context())
+	}
+
+	log.Fatal(err)
+}
+
+type options struct {
+	html       *gml.HTMLOptions
+	lenient    bool
+	standalone bool
+	css        string
+}
+
+var pageTmpl = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+{{- with .CSS}}
+<link rel="stylesheet" href="{{.}}">
+{{- end}}
+</head>
+<body>
+{{.Article}}
+</body>
+</html>
+`))
+
+// render converts a parsed document to HTML.
+func render(doc gml.Document, opts *options) (string, error) {
+	article := doc.HTML(opts.html)
+	if !opts.standalone {
+		return article + "\n", nil
+	}
+
+	var b strings.Builder
+	err := pageTmpl.Execute(&b, struct {
+		Title   string
+		CSS     string
+		Article template.HTML
+	}{
+		Title:   doc.Title(),
+		CSS:     opts.css,
+		Article: template.HTML(article),
+	})
+
+	return b.String(), err
+}
+
+// convert reads GML from the named file (or stdin for "" or "-") and
+// writes HTML to the named output file (or stdout for "").
+func convert(in, out string, opts *options) error {
+	var (
+		b   []byte
+		err error
+		dir = "." // Files read by the document are relative to it
+	)
+
+	if in == "" || in == "-" {
+		b, err = io.ReadAll(os.Stdin)
+	} else {
+		b, err = os.ReadFile(in)
+		dir = filepath.Dir(in)
+	}
+	if err != nil {
+		return fmt.Errorf("error reading input: %w", err)
+	}
+
+	doc, err := gml.ParseWithOptions(string(b), &gml.ParseOptions{FS: os.DirFS(dir), Strict: !opts.lenient})
+	if err != nil {
+		return err
+	}
+	for _, w := range doc.Warnings() {
+		log.Printf("%s: warning: %v", in, w)
+	}
+
+	html, err := render(doc, opts)
+	if err != nil {
+		return fmt.Errorf("error rendering HTML: %w", err)
+	}
+
+	if out == "" {
+		_, err = io.WriteString(os.Stdout, html)
+	} else {
+		err = os.WriteFile(out, []byte(html), 0644)
+	}
+	if err != nil {
+		return fmt.Errorf("error writing output: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/anschwa/gutenblog/gml"
+)
+
+const hello = "%title Hello\n\nHello, /world/.\n"
+
+// redirect points os.Stdin at a file holding stdin and os.Stdout at a
+// file whose contents are returned by the function it returns.
+func redirect(t *testing.T, stdin string) func() string {
+	t.Helper()
+	dir := t.TempDir()
+
+	in := filepath.Join(dir, "stdin")
+	if err := os.WriteFile(in, []byte(stdin), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := os.Open(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := os.Create(filepath.Join(dir, "stdout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldIn, oldOut := os.Stdin, os.Stdout
+	os.Stdin, os.Stdout = r, w
+	t.Cleanup(func() {
+		os.Stdin, os.Stdout = oldIn, oldOut
+		r.Close()
+		w.Close()
+	})
+
+	return func() string {
+		b, err := os.ReadFile(w.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	opts := &options{html: &gml.HTMLOptions{Minified: true}}
+	want := "<em>world</em>"
+
+	dir := t.TempDir()
+	in := filepath.Join(dir, "hello.gml.txt")
+	if err := os.WriteFile(in, []byte(hello), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("stdin", func(t *testing.T) {
+		for _, name := range []string{"", "-"} {
+			stdout := redirect(t, hello)
+			if err := convert(name, "", opts); err != nil {
+				t.Fatal(err)
+			}
+			if got := stdout(); !strings.Contains(got, want) {
+				t.Errorf("%q: want %q in:\n%s", name, want, got)
+			}
+		}
+	})
+
+	t.Run("file", func(t *testing.T) {
+		stdout := redirect(t, "")
+		if err := convert(in, "", opts); err != nil {
+			t.Fatal(err)
+		}
+		if got := stdout(); !strings.Contains(got, want) {
+			t.Errorf("want %q in:\n%s", want, got)
+		}
+	})
+
+	t.Run("output file", func(t *testing.T) {
+		stdout := redirect(t, "")
+		out := filepath.Join(dir, "hello.html")
+		if err := convert(in, out, &options{html: opts.html, standalone: true}); err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(b); !strings.HasPrefix(got, "<!DOCTYPE html>") || !strings.Contains(got, "<title>Hello</title>") || !strings.Contains(got, want) {
+			t.Errorf("want a standalone document with %q; got:\n%s", want, got)
+		}
+		if got := stdout(); got != "" {
+			t.Errorf("want nothing written to stdout; got %q", got)
+		}
+	})
+
+	t.Run("parse error", func(t *testing.T) {
+		stdout := redirect(t, "%title Hello\n\n%nope\n")
+		out := filepath.Join(dir, "broken.html")
+
+		err := convert("-", out, opts)
+		var perr *gml.ParseError
+		if !errors.As(err, &perr) {
+			t.Fatalf("want a *gml.ParseError; got %T: %v", err, err)
+		}
+		if perr.Line != 3 {
+			t.Errorf("want the error on line 3; got %d", perr.Line)
+		}
+		if _, err := os.Stat(out); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("want no output file; got %v", err)
+		}
+		if got := stdout(); got != "" {
+			t.Errorf("want nothing written to stdout; got %q", got)
+		}
+	})
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// context is the number of unchanged lines shown around each change
+const context = 3
+
+type edit struct {
+	op   byte // ' ', '-', or '+'
+	line string
+}
+
+// unifiedDiff returns a unified diff between old and new.
+func unifiedDiff(path, old, new string) string {
+	a := strings.SplitAfter(old, "\n")
+	b := strings.SplitAfter(new, "\n")
+	edits := diffLines(a, b)
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s (formatted)\n", path, path)
+
+	for i := 0; i < len(edits); {
+		// Find the next change
+		for i < len(edits) && edits[i].op == ' ' {
+			i++
+		}
+		if i == len(edits) {
+			break
+		}
+
+		// Extend the hunk until there's more than 2*context unchanged lines
+		start := max(i-context, 0)
+		end := i
+		for end < len(edits) {
+			if edits[end].op != ' ' {
+				end++
+				continue
+			}
+
+			run := end
+			for run < len(edits) && edits[run].op == ' ' {
+				run++
+			}
+			if run == len(edits) || run-end > 2*context {
+				end = min(end+context, len(edits))
+				break
+			}
+			end = run
+		}
+
+		// Line numbers of the hunk in each file
+		aLine, bLine := 1, 1
+		for _, e := range edits[:start] {
+			if e.op != '+' {
+				aLine++
+			}
+			if e.op != '-' {
+				bLine++
+			}
+		}
+
+		var aCount, bCount int
+		var hunk strings.Builder
+		for _, e := range edits[start:end] {
+			if e.op != '+' {
+				aCount++
+			}
+			if e.op != '-' {
+				bCount++
+			}
+
+			hunk.WriteByte(e.op)
+			hunk.WriteString(e.line)
+			if !strings.HasSuffix(e.line, "\n") {
+				hunk.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", aLine, aCount, bLine, bCount)
+		out.WriteString(hunk.String())
+		i = end
+	}
+
+	return out.String()
+}
+
+// diffLines finds the edits turning a into b using their longest
+// common subsequence.
+func diffLines(a, b []string) []edit {
+	// Drop the empty string after a trailing newline
+	if len(a) > 0 && a[len(a)-1] == "" {
+		a = a[:len(a)-1]
+	}
+	if len(b) > 0 && b[len(b)-1] == "" {
+		b = b[:len(b)-1]
+	}
+
+	// lcs[i][j] is the length of the LCS of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var edits []edit
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			edits = append(edits, edit{' ', a[i]})
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] > lcs[i+1][j]):
+			edits = append(edits, edit{'+', b[j]})
+			j++
+		default:
+			edits = append(edits, edit{'-', a[i]})
+			i++
+		}
+	}
+
+	return edits
+}
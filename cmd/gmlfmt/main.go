@@ -0,0 +1,111 @@
+// Command gmlfmt formats GML documents.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/anschwa/gutenblog/gml"
+)
+
+const usage = `usage: gmlfmt [flags] [file ...]
+
+Print GML documents in canonical form. Without files, gmlfmt formats
+stdin.
+
+Flags:
+`
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("gmlfmt: ")
+
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+
+	write := flag.Bool("w", false, "write the result to the source file instead of stdout")
+	diff := flag.Bool("d", false, "print diffs instead of the formatted documents")
+	list := flag.Bool("l", false, "list files whose formatting differs")
+	wrap := flag.Int("wrap", 0, "wrap paragraphs to this many characters (0 keeps line breaks)")
+	flag.Parse()
+
+	opts := &gml.FormatOptions{Wrap: *wrap}
+
+	if flag.NArg() == 0 {
+		if *write {
+			log.Fatal("can't use -w with stdin")
+		}
+
+		src, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if err := format("<stdin>", string(src), opts, *diff, *list, false); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	failed := false
+	for _, path := range flag.Args() {
+		src, err := os.ReadFile(path)
+		if err == nil {
+			err = format(path, string(src), opts, *diff, *list, *write)
+		}
+
+		if err != nil {
+			log.Printf("%s: %v", path, err)
+			failed = true
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// format formats src and reports the result according to the flags.
+func format(path, src string, opts *gml.FormatOptions, diff, list, write bool) error {
+	out, err := gml.Format(src, opts)
+	if err != nil {
+		return err
+	}
+
+	if out == src {
+		if !diff && !list && !write {
+			fmt.Print(out)
+		}
+		return nil
+	}
+
+	if list {
+		fmt.Println(path)
+	}
+
+	if write {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+
+		if err := os.WriteFile(path, []byte(out), info.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+
+	if diff {
+		fmt.Print(unifiedDiff(path, src, out))
+	}
+
+	if !diff && !list && !write {
+		fmt.Print(out)
+	}
+
+	return nil
+}
@@ -0,0 +1,57 @@
+// Command gmllint reports likely mistakes in GML documents.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/anschwa/gutenblog/gml"
+)
+
+const usage = `usage: gmllint [file ...]
+
+Report problems in GML documents as file:line: message. Without files,
+gmllint checks stdin. The exit status is 1 if any problems are found.
+`
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("gmllint: ")
+
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	found := false
+	lint := func(name, src string) {
+		for _, p := range gml.LintSource(src) {
+			fmt.Printf("%s:%d: %s\n", name, p.Line, p.Message)
+			found = true
+		}
+	}
+
+	if flag.NArg() == 0 {
+		src, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			log.Fatal(err)
+		}
+		lint("<stdin>", string(src))
+	}
+
+	for _, path := range flag.Args() {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		lint(path, string(src))
+	}
+
+	if found {
+		os.Exit(1)
+	}
+}
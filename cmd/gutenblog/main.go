@@ -0,0 +1,339 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/anschwa/gutenblog"
+)
+
+const usage = `usage: gutenblog [flags] <command> [args]
+
+Commands:
+  build   generate the site into the output directory
+  check   generate the site and fail if it contains broken links
+  doctor  check the site for problems without building it
+  serve   serve the site, regenerating it on each request unless -production
+  digest  print a draft digest post for a range of dates
+  import  convert Markdown files into new posts
+  import-site convert a Jekyll or Hugo site into a new site
+  hook    run the commands configured for a hook (e.g. after_deploy)
+  migrate preview or apply find and replace rewrites to post sources
+  rm      move posts or assets to the trash
+  trash   list the contents of the trash
+  restore move an entry in the trash back to where it was
+
+Flags:
+`
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("gutenblog: ")
+
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+
+	rootDir := flag.String("root", ".", "site root directory")
+	outDir := flag.String("out", "outDir", "output directory")
+	quiet := flag.Bool("q", false, "only log warnings and errors")
+	verbose := flag.Bool("v", false, "log every file that is written or copied")
+	jsonLogs := flag.Bool("json", false, "write logs as JSON")
+	reproducible := flag.Bool("reproducible", false, "omit the build fingerprint from generated pages")
+	flag.Parse()
+
+	level := slog.LevelInfo
+	switch {
+	case *quiet:
+		gutenblog.SetLogLevel(gutenblog.LogQuiet)
+		level = slog.LevelWarn
+	case *verbose:
+		gutenblog.SetLogLevel(gutenblog.LogVerbose)
+		level = slog.LevelDebug
+	}
+
+	var logger *slog.Logger
+	if *jsonLogs {
+		logger = slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+	}
+
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	cmd, args := flag.Arg(0), flag.Args()[1:]
+
+	// The doctor runs before loading the site because it checks for the
+	// problems that would stop the site from loading.
+	if cmd == "doctor" {
+		diags, err := gutenblog.Doctor(*rootDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, d := range diags {
+			fmt.Println(d)
+		}
+		if len(diags) > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Importing a site creates the site instead of loading one
+	if cmd == "import-site" {
+		if len(args) != 2 {
+			log.Fatal("usage: gutenblog import-site <src> <dst>")
+		}
+
+		imp, err := gutenblog.ImportSite(args[0], args[1])
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		for _, f := range imp.Posts {
+			fmt.Printf("%s\t%s\n", f.OldURL, f.NewURL)
+		}
+		for _, d := range imp.Issues {
+			log.Print(d)
+		}
+		log.Printf("imported %d posts from %s", len(imp.Posts), imp.Generator)
+		return
+	}
+
+	s, err := gutenblog.New(*rootDir, *outDir, logger)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *reproducible {
+		s.SetBuildInfo(false)
+	}
+
+	switch cmd {
+	case "build", "check":
+		if err := s.Build(); err != nil {
+			log.Fatal(err)
+		}
+
+		broken, err := s.CheckLinks()
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, l := range broken {
+			log.Print(l)
+		}
+
+		if cmd == "check" && len(broken) > 0 {
+			log.Fatalf("found %d broken links", len(broken))
+		}
+	case "serve":
+		fs := flag.NewFlagSet("serve", flag.ExitOnError)
+		addr := fs.String("addr", "localhost:8080", "address to listen on (or unix:/path/to/socket)")
+		production := fs.Bool("production", false, "build once and serve with caching instead of rebuilding on each request")
+		certFile := fs.String("cert", "", "TLS certificate file (serve HTTPS when set with -key)")
+		keyFile := fs.String("key", "", "TLS private key file")
+		autocertHosts := fs.String("autocert", "", "comma separated hostnames to get Let's Encrypt certificates for")
+		autocertDir := fs.String("autocert-cache", "", "directory to store Let's Encrypt certificates in (default: gutenblog/autocert in the user cache directory)")
+		autocertEmail := fs.String("autocert-email", "", "contact email for Let's Encrypt")
+		httpAddr := fs.String("http-addr", ":80", "address for the HTTP challenge and redirect listener used with -autocert")
+		auth := fs.String("auth", "", "require basic auth with the given user:password")
+		htpasswd := fs.String("htpasswd", "", "require basic auth with the users in an htpasswd file")
+		open := fs.Bool("open", false, "open the site in a web browser")
+		accessLog := fs.String("access-log", "", "access log format: common, combined, or json (default: the regular log)")
+		fs.Parse(args)
+
+		if (*certFile == "") != (*keyFile == "") {
+			log.Fatal("serve: -cert and -key must be used together")
+		}
+
+		opts := &gutenblog.ServeOptions{
+			Production: *production,
+			CertFile:   *certFile,
+			KeyFile:    *keyFile,
+
+			AccessLogFormat: *accessLog,
+			OpenBrowser:     *open,
+		}
+
+		if *auth != "" || *htpasswd != "" {
+			opts.Auth = &gutenblog.BasicAuth{HtpasswdFile: *htpasswd}
+			if *auth != "" {
+				user, password, ok := strings.Cut(*auth, ":")
+				if !ok {
+					log.Fatal("serve: -auth must be of the form user:password")
+				}
+				opts.Auth.Username, opts.Auth.Password = user, password
+			}
+		}
+
+		if *autocertHosts != "" {
+			if *certFile != "" {
+				log.Fatal("serve: -autocert can't be used with -cert and -key")
+			}
+
+			opts.Autocert = &gutenblog.AutocertOptions{
+				Hosts:    strings.Split(*autocertHosts, ","),
+				CacheDir: *autocertDir,
+				Email:    *autocertEmail,
+				HTTPAddr: *httpAddr,
+			}
+		}
+		if opts.Production {
+			if err := s.Build(); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		if err := s.ListenAndServe(*addr, opts); err != nil {
+			log.Fatal(err)
+		}
+	case "digest":
+		if err := digest(s, args); err != nil {
+			log.Fatal(err)
+		}
+	case "import":
+		fs := flag.NewFlagSet("import", flag.ExitOnError)
+		blog := fs.String("blog", "", "blog to add the posts to (for sites with multiple blogs)")
+		fs.Parse(args)
+
+		if fs.NArg() == 0 {
+			log.Fatal("usage: gutenblog import [-blog name] <file.md>...")
+		}
+
+		for _, md := range fs.Args() {
+			f, err := s.ImportMarkdown(*blog, md)
+			if err != nil {
+				log.Fatal(err)
+			}
+			fmt.Printf("%s\t%s\n", f.ID, f.URL)
+		}
+	case "migrate":
+		if err := migrate(s, args); err != nil {
+			log.Fatal(err)
+		}
+	case "rm":
+		for _, path := range args {
+			e, err := s.Trash(path)
+			if err != nil {
+				log.Fatal(err)
+			}
+			fmt.Printf("%s\t%s\n", e.ID, e.Path)
+		}
+	case "trash":
+		entries, err := s.ListTrash()
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, e := range entries {
+			fmt.Printf("%s\t%s\n", e.ID, e.Path)
+		}
+	case "restore":
+		if len(args) != 1 {
+			log.Fatal("usage: gutenblog restore <id>")
+		}
+
+		if _, err := s.Restore(args[0]); err != nil {
+			log.Fatal(err)
+		}
+	case "hook":
+		if len(args) != 1 {
+			log.Fatal("usage: gutenblog hook <name>")
+		}
+
+		if err := s.RunHook(args[0]); err != nil {
+			log.Fatal(err)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command: %q\n", cmd)
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+func digest(s *gutenblog.Site, args []string) error {
+	fs := flag.NewFlagSet("digest", flag.ExitOnError)
+	today := time.Now().Format("2006-01-02")
+	lastWeek := time.Now().AddDate(0, 0, -6).Format("2006-01-02")
+	fromFlag := fs.String("from", lastWeek, "first day to include (YYYY-MM-DD)")
+	toFlag := fs.String("to", today, "last day to include (YYYY-MM-DD)")
+	outFlag := fs.String("o", "", "write the draft to a file instead of stdout")
+	fs.Parse(args)
+
+	from, err := time.Parse("2006-01-02", *fromFlag)
+	if err != nil {
+		return fmt.Errorf("invalid -from date: %w", err)
+	}
+
+	to, err := time.Parse("2006-01-02", *toFlag)
+	if err != nil {
+		return fmt.Errorf("invalid -to date: %w", err)
+	}
+
+	draft, err := s.Digest(from, to)
+	if err != nil {
+		return fmt.Errorf("error generating digest: %w", err)
+	}
+
+	if *outFlag == "" {
+		fmt.Print(draft)
+		return nil
+	}
+
+	if err := os.WriteFile(*outFlag, []byte(draft), 0644); err != nil {
+		return fmt.Errorf("error writing digest: %w", err)
+	}
+
+	return nil
+}
+
+// rewriteFlags collects repeated -rewrite flags
+type rewriteFlags []gutenblog.Rewrite
+
+func (f *rewriteFlags) String() string {
+	return fmt.Sprint(*f)
+}
+
+func (f *rewriteFlags) Set(value string) error {
+	r, err := gutenblog.ParseRewrite(value)
+	if err != nil {
+		return err
+	}
+
+	*f = append(*f, r)
+	return nil
+}
+
+func migrate(s *gutenblog.Site, args []string) error {
+	var rewrites rewriteFlags
+
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	fs.Var(&rewrites, "rewrite", "rewrite rule of the form 'old=>new' (may be repeated)")
+	write := fs.Bool("w", false, "write changes to the source files instead of printing a diff")
+	fs.Parse(args)
+
+	if len(rewrites) == 0 {
+		return fmt.Errorf("migrate: at least one -rewrite is required")
+	}
+
+	changes, err := s.Migrate(rewrites, *write)
+	if err != nil {
+		return fmt.Errorf("error migrating posts: %w", err)
+	}
+
+	for _, c := range changes {
+		if *write {
+			log.Printf("rewrote %d lines in %q", len(c.Lines), c.Path)
+		} else {
+			fmt.Print(c.Diff())
+		}
+	}
+
+	return nil
+}
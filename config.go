@@ -0,0 +1,167 @@
+package gutenblog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// configFile is the name of the optional site configuration file
+// kept in the site's root directory.
+const configFile = "gutenblog.json"
+
+// Config holds the site-wide settings read from gutenblog.json. Every
+// field is optional so a site without a config file builds exactly
+// as it always has.
+type Config struct {
+	// Title is used as the feed title. Defaults to the blog's directory name.
+	Title string `json:"title"`
+
+	// URL is the public base URL of the site (e.g. "https://example.com").
+	// It is required for generating absolute links in feeds.
+	URL string `json:"url"`
+
+	// Author is the name feeds credit as their author. Defaults to the
+	// feed's title.
+	Author string `json:"author"`
+
+	// CopyPostDirs copies everything in a post's source directory
+	// (including the GML source) instead of only the files the post links to.
+	CopyPostDirs bool `json:"copy_post_dirs"`
+
+	// InlineHTML writes HTML tags written in the text of posts as-is
+	// instead of escaping them. Raw HTML is always allowed in %html
+	// blocks.
+	InlineHTML bool `json:"inline_html"`
+
+	// BuildInfo embeds a fingerprint of the build (gutenblog version,
+	// build time, and content commit) as a comment in generated pages
+	// and in the URL map. Leave it off for reproducible builds.
+	BuildInfo bool `json:"build_info"`
+
+	Feeds     FeedConfig      `json:"feeds"`
+	Hooks     HookConfig      `json:"hooks"`
+	Serve     ServeConfig     `json:"serve"`
+	Inject    InjectConfig    `json:"inject"`
+	Highlight HighlightConfig `json:"highlight"`
+	Math      MathConfig      `json:"math"`
+}
+
+// HighlightConfig controls the stylesheet for syntax highlighted code
+// blocks (e.g. "%pre go").
+type HighlightConfig struct {
+	// Style is the chroma style (e.g. "monokai" or "github") to write
+	// to /highlight.css, which is then linked from every page. Leave
+	// it empty to style code blocks yourself.
+	Style string `json:"style"`
+}
+
+// MathConfig controls how math (e.g. "%math" blocks and "$x^2$") is
+// typeset in the browser.
+type MathConfig struct {
+	// Renderer is "katex" or "mathjax". Its script and stylesheet are
+	// then added to every page. Leave it empty to typeset math
+	// yourself.
+	Renderer string `json:"renderer"`
+}
+
+// FeedConfig controls which Atom feeds are generated for each blog.
+type FeedConfig struct {
+	// Disable turns off the per-blog feed (and all variants).
+	Disable bool `json:"disable"`
+
+	// Years generates a feed for each year, e.g. /2024/feed.xml
+	Years bool `json:"years"`
+
+	// Tags generates a feed for each tag, e.g. /tags/go/feed.xml
+	Tags bool `json:"tags"`
+}
+
+// HookConfig lists shell commands to run around a build. Each command
+// is run with "sh -c" from the site's root directory.
+type HookConfig struct {
+	BeforeBuild []string `json:"before_build"`
+	AfterBuild  []string `json:"after_build"`
+	AfterDeploy []string `json:"after_deploy"`
+}
+
+// ServeConfig controls the development server.
+type ServeConfig struct {
+	// RebuildQuietPeriod debounces rebuilds: the site is rebuilt once
+	// no request has arrived for this long (e.g. "250ms"), so a burst
+	// of requests or saves shares a single rebuild. Rebuilds requested
+	// while another is running are always coalesced into one.
+	RebuildQuietPeriod Duration `json:"rebuild_quiet_period"`
+
+	// LockTTL is how long an editor's advisory lock on a post lasts
+	// without being renewed. Defaults to 5m.
+	LockTTL Duration `json:"lock_ttl"`
+}
+
+// lockTTL returns the configured lock TTL or the default.
+func (c *Config) lockTTL() time.Duration {
+	if c.Serve.LockTTL.Duration == 0 {
+		return 5 * time.Minute
+	}
+
+	return c.Serve.LockTTL.Duration
+}
+
+// Duration is a time.Duration that is written as a string (e.g. "1m30s") in JSON.
+type Duration struct{ time.Duration }
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string: %w", err)
+	}
+
+	dur, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	d.Duration = dur
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// InjectConfig holds raw HTML snippets (e.g. an analytics script tag)
+// that are added to every generated page so themes don't have to
+// template them manually.
+type InjectConfig struct {
+	Head string `json:"head"` // Inserted before </head>
+	Body string `json:"body"` // Inserted before </body>
+}
+
+// loadConfig reads the site configuration from rootDir. A missing
+// config file is not an error.
+func loadConfig(rootDir string) (*Config, error) {
+	cfg := &Config{}
+
+	path := filepath.Join(rootDir, configFile)
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading config %q: %w", path, err)
+	}
+
+	if err := json.Unmarshal(b, cfg); err != nil {
+		return nil, fmt.Errorf("error parsing config %q: %w", path, err)
+	}
+
+	if r := cfg.Math.Renderer; r != "" && mathScripts[r] == "" {
+		return nil, fmt.Errorf("error in config %q: unknown math renderer %q (want katex or mathjax)", path, r)
+	}
+
+	return cfg, nil
+}
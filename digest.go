@@ -0,0 +1,231 @@
+package gutenblog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// bookmarksFile lists the links saved for digests. It's kept in the
+// site's root directory as a JSON array of bookmarks.
+const bookmarksFile = "bookmarks.json"
+
+// bookmark is a link saved for a later digest.
+type bookmark struct {
+	URL   string `json:"url"`
+	Title string `json:"title"`
+	Date  string `json:"date"` // YYYY-MM-DD
+	Note  string `json:"note,omitempty"`
+}
+
+// Digest generates a draft GML post summarizing what changed between
+// from and to (inclusive): every post published, every bookmark saved
+// in bookmarks.json, and every data file (the CSV files posts read
+// with %csv) modified. Posts and bookmarks are listed with a link and
+// an excerpt so the author has something to edit rather than a blank
+// page.
+func (s *Site) Digest(from, to time.Time) (string, error) {
+	if to.Before(from) {
+		return "", fmt.Errorf("invalid date range: %s is before %s", to.Format("2006-01-02"), from.Format("2006-01-02"))
+	}
+
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "%%title Notes for %s to %s\n", from.Format("January 2, 2006"), to.Format("January 2, 2006"))
+	fmt.Fprintf(&b, "%%date %s\n", to.Format("2006-01-02"))
+
+	var found bool
+	for _, bl := range s.blogs {
+		posts := bl.postsBetween(from, to)
+		if len(posts) == 0 {
+			continue
+		}
+		found = true
+
+		b.WriteString("\n")
+		if s.multi {
+			fmt.Fprintf(&b, "* %s\n\n", filepath.Base(bl.name))
+		}
+
+		webRoot := s.webRoot(bl)
+		for _, p := range posts {
+			fmt.Fprintf(&b, "- [%s](%s)", escapeStyled(p.title), p.url(webRoot))
+			if excerpt := digestExcerpt(p); excerpt != "" {
+				fmt.Fprintf(&b, ": %s", excerpt)
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	bookmarks, err := s.bookmarksBetween(from, to)
+	if err != nil {
+		return "", err
+	}
+	if len(bookmarks) > 0 {
+		found = true
+
+		b.WriteString("\n* Bookmarks\n\n")
+		for _, bm := range bookmarks {
+			title := bm.Title
+			if title == "" {
+				title = bm.URL
+			}
+
+			fmt.Fprintf(&b, "- [%s](%s)", escapeStyled(title), bm.URL)
+			if note := strings.Join(strings.Fields(bm.Note), " "); note != "" {
+				fmt.Fprintf(&b, ": %s", escapeStyled(note))
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	files, err := s.dataFilesBetween(from, to)
+	if err != nil {
+		return "", err
+	}
+	if len(files) > 0 {
+		found = true
+
+		b.WriteString("\n* Data\n\n")
+		for _, f := range files {
+			fmt.Fprintf(&b, "- ~%s~\n", f)
+		}
+	}
+
+	if !found {
+		return "", fmt.Errorf("no posts, bookmarks, or data changes found between %s and %s", from.Format("2006-01-02"), to.Format("2006-01-02"))
+	}
+
+	return b.String(), nil
+}
+
+// dayRange returns the start of the day from falls on and the start of
+// the day after to, so whole days are compared and the time of day
+// doesn't exclude anything.
+func dayRange(from, to time.Time) (start, end time.Time) {
+	start = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	end = time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC).AddDate(0, 0, 1)
+	return start, end
+}
+
+// postsBetween returns the blog's posts published between from and to
+// (inclusive) sorted by date.
+func (b *blog) postsBetween(from, to time.Time) []*post {
+	from, to = dayRange(from, to)
+
+	var posts []*post
+	for _, p := range b.sortedPosts() {
+		if !p.date.Before(from) && p.date.Before(to) {
+			posts = append(posts, p)
+		}
+	}
+
+	return posts
+}
+
+// bookmarksBetween returns the bookmarks saved between from and to
+// (inclusive) sorted by date. A site without bookmarks.json has none.
+func (s *Site) bookmarksBetween(from, to time.Time) ([]bookmark, error) {
+	path := filepath.Join(s.rootDir, bookmarksFile)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %q: %w", path, err)
+	}
+
+	var all []bookmark
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, fmt.Errorf("error parsing %q: %w", path, err)
+	}
+
+	from, to = dayRange(from, to)
+
+	var bookmarks []bookmark
+	for _, bm := range all {
+		if bm.URL == "" {
+			return nil, fmt.Errorf("error parsing %q: bookmark %q has no url", path, bm.Title)
+		}
+
+		d, err := time.Parse("2006-01-02", bm.Date)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing %q: invalid date for %q: want YYYY-MM-DD; got %q", path, bm.URL, bm.Date)
+		}
+
+		if !d.Before(from) && d.Before(to) {
+			bookmarks = append(bookmarks, bm)
+		}
+	}
+
+	sort.SliceStable(bookmarks, func(i, j int) bool {
+		return bookmarks[i].Date < bookmarks[j].Date
+	})
+
+	return bookmarks, nil
+}
+
+// dataFilesBetween returns the data files in the blogs' posts
+// directories that were modified between from and to (inclusive),
+// relative to the site's root directory.
+func (s *Site) dataFilesBetween(from, to time.Time) ([]string, error) {
+	from, to = dayRange(from, to)
+
+	var files []string
+	for _, bl := range s.blogs {
+		postsDir := filepath.Join(bl.name, "posts")
+		err := filepath.WalkDir(postsDir, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() || !strings.EqualFold(filepath.Ext(p), ".csv") {
+				return nil
+			}
+
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			if mod := info.ModTime(); mod.Before(from) || !mod.Before(to) {
+				return nil
+			}
+
+			rel, err := filepath.Rel(s.rootDir, p)
+			if err != nil {
+				return err
+			}
+			files = append(files, filepath.ToSlash(rel))
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error finding data files in %q: %w", postsDir, err)
+		}
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+// styledMarkup is the punctuation that styles GML text.
+var styledMarkup = strings.NewReplacer(
+	`\`, `\\`, "[", `\[`, "]", `\]`, "/", `\/`, "*", `\*`, "~", `\~`,
+	"+", `\+`, "^", `\^`, "_", `\_`, "$", `\$`, "<", `\<`,
+)
+
+// escapeStyled escapes plain text, like a post's title, so it's written
+// as-is in styled text.
+func escapeStyled(s string) string {
+	return styledMarkup.Replace(s)
+}
+
+// digestExcerpt flattens the first paragraph of a post onto a single
+// line so it can be used as a list item.
+func digestExcerpt(p *post) string {
+	return strings.Join(strings.Fields(p.body.Excerpt()), " ")
+}
@@ -0,0 +1,159 @@
+package gutenblog
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anschwa/gutenblog/gml"
+)
+
+func TestDigest(t *testing.T) {
+	s, err := New("examples/solo-blog", t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	day := time.Date(2022, 3, 21, 0, 0, 0, 0, time.UTC)
+	draft, err := s.Digest(day.AddDate(0, 0, -7), day)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc, err := gml.Parse(draft)
+	if err != nil {
+		t.Fatalf("digest doesn't parse: %v\n%s", err, draft)
+	}
+
+	if got, want := doc.Title(), "Notes for March 14, 2022 to March 21, 2022"; got != want {
+		t.Errorf("title: want %q; got %q", want, got)
+	}
+	if got := doc.Date(); !got.Equal(day) {
+		t.Errorf("date: want %s; got %s", day, got)
+	}
+
+	// The draft renders without allowing inline HTML
+	want := `<li><a href="/2022/03/21/hello-world/index.html">Hello world</a>: Mi eget <em>mauris</em>`
+	if got := doc.HTML(nil); !strings.Contains(got, want) {
+		t.Errorf("want HTML containing:\n%s\ngot:\n%s", want, got)
+	}
+
+	if _, err := s.Digest(day, day.AddDate(0, 0, -1)); err == nil || !strings.Contains(err.Error(), "invalid date range") {
+		t.Errorf("want an invalid date range error; got %v", err)
+	}
+	if _, err := s.Digest(day.AddDate(0, 0, 1), day.AddDate(0, 0, 7)); err == nil || !strings.Contains(err.Error(), "no posts, bookmarks, or data changes found") {
+		t.Errorf("want a nothing found error; got %v", err)
+	}
+}
+
+func TestDigestMultiBlog(t *testing.T) {
+	s, err := New("examples/multi-blog", t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	day := time.Date(2022, 3, 21, 0, 0, 0, 0, time.UTC)
+	draft, err := s.Digest(day, day)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each blog's posts are listed under a heading of its own
+	for _, want := range []string{
+		"* bar\n\n- [Hello Bar](/blog/bar/2022/03/21/hello-bar/index.html)",
+		"* foo\n\n- [Hello Foo](/blog/foo/2022/03/21/hello-foo/index.html)",
+	} {
+		if !strings.Contains(draft, want) {
+			t.Errorf("want the draft to contain %q; got:\n%s", want, draft)
+		}
+	}
+
+	doc, err := gml.Parse(draft)
+	if err != nil {
+		t.Fatalf("digest doesn't parse: %v\n%s", err, draft)
+	}
+	if n := strings.Count(doc.HTML(nil), "<h2"); n != 2 {
+		t.Errorf("want 2 blog headings; got %d in:\n%s", n, doc.HTML(nil))
+	}
+}
+
+func TestDigestBookmarksAndData(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"posts/hello/hello.gml.txt": "%title Hello\n%date 2022-03-21\n\nHello\n",
+		bookmarksFile: `[
+			{"url": "https://example.com/b", "title": "Second", "date": "2023-01-02"},
+			{"url": "https://example.com/a", "title": "First *link*", "date": "2022-12-31", "note": "Worth\n  a read."},
+			{"url": "https://example.com/old", "title": "Old", "date": "2022-12-01"}
+		]`,
+	})
+
+	changed := filepath.Join(root, "posts", "hello", "scores.csv")
+	unchanged := filepath.Join(root, "posts", "hello", "old.csv")
+	for path, mod := range map[string]time.Time{
+		changed:   time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC),
+		unchanged: time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC),
+	} {
+		if err := os.WriteFile(path, []byte("a,b\n1,2\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mod, mod); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s, err := New(root, t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A range that crosses the new year has no posts but still has
+	// bookmarks and data changes
+	from := time.Date(2022, 12, 25, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2023, 1, 7, 0, 0, 0, 0, time.UTC)
+	draft, err := s.Digest(from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc, err := gml.Parse(draft)
+	if err != nil {
+		t.Fatalf("digest doesn't parse: %v\n%s", err, draft)
+	}
+	if got, want := doc.Title(), "Notes for December 25, 2022 to January 7, 2023"; got != want {
+		t.Errorf("title: want %q; got %q", want, got)
+	}
+
+	want := "* Bookmarks\n\n" +
+		"- [First \\*link\\*](https://example.com/a): Worth a read.\n" +
+		"- [Second](https://example.com/b)\n" +
+		"\n* Data\n\n" +
+		"- ~posts/hello/scores.csv~\n"
+	if !strings.HasSuffix(draft, want) {
+		t.Errorf("want the draft to end with:\n%s\ngot:\n%s", want, draft)
+	}
+
+	// Broken bookmarks are reported rather than skipped
+	if err := os.WriteFile(filepath.Join(root, bookmarksFile), []byte(`[{"url": "https://example.com/", "date": "Jan 2"}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Digest(from, to); err == nil || !strings.Contains(err.Error(), "invalid date") {
+		t.Errorf("want an invalid date error; got %v", err)
+	}
+}
+
+func TestEscapeStyled(t *testing.T) {
+	title := `Go 1.2: *fast* [or] /slow/?`
+
+	doc, err := gml.Parse("- [" + escapeStyled(title) + "](/a/)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `<ul><li><a href="/a/">Go 1.2: *fast* [or] /slow/?</a></li></ul>`
+	if got := doc.ExcerptHTML(1, &gml.HTMLOptions{Minified: true}); got != want {
+		t.Errorf("want:\t%q\n got:\t%q", want, got)
+	}
+}
@@ -0,0 +1,201 @@
+package gutenblog
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/anschwa/gutenblog/gml"
+)
+
+// Diagnosis is a problem found by Doctor.
+type Diagnosis struct {
+	Path    string // File or directory with the problem
+	Message string
+}
+
+func (d Diagnosis) String() string {
+	return fmt.Sprintf("%s: %s", d.Path, d.Message)
+}
+
+// Doctor checks the site in rootDir for problems that would break or
+// degrade a build: an ambiguous layout, missing or invalid templates,
+// posts that fail to parse, posts that would be published at the same
+// URL, and assets referenced by posts that don't exist. Unlike New,
+// it keeps going after a problem so everything is reported at once.
+func Doctor(rootDir string) ([]Diagnosis, error) {
+	var diags []Diagnosis
+	report := func(p, format string, args ...interface{}) {
+		diags = append(diags, Diagnosis{p, fmt.Sprintf(format, args...)})
+	}
+
+	solo := isDir(filepath.Join(rootDir, "posts"))
+	multi := isDir(filepath.Join(rootDir, "blog"))
+
+	switch {
+	case !solo && !multi:
+		report(rootDir, `site must have either a "posts" or "blog" directory`)
+		return diags, nil
+	case solo && multi:
+		report(rootDir, `site has both a "posts" and "blog" directory: it can't be both a solo and multi-blog site`)
+	}
+
+	var blogDirs []string
+	if solo {
+		blogDirs = append(blogDirs, rootDir)
+	}
+	if multi {
+		entries, err := os.ReadDir(filepath.Join(rootDir, "blog"))
+		if err != nil {
+			return nil, fmt.Errorf("error reading blogs: %w", err)
+		}
+
+		for _, e := range entries {
+			if e.IsDir() {
+				blogDirs = append(blogDirs, filepath.Join(rootDir, "blog", e.Name()))
+			}
+		}
+	}
+
+	www := filepath.Join(rootDir, "www")
+	for _, dir := range blogDirs {
+		diagnoseTemplates(dir, report)
+		if err := diagnosePosts(dir, www, report); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.SliceStable(diags, func(i, j int) bool {
+		return diags[i].Path < diags[j].Path
+	})
+
+	return diags, nil
+}
+
+// diagnoseTemplates checks that a blog's templates exist and parse. A
+// blog without a tmpl directory uses the default templates.
+func diagnoseTemplates(blogDir string, report func(p, format string, args ...interface{})) {
+	dir := filepath.Join(blogDir, "tmpl")
+	if !isDir(dir) {
+		return
+	}
+
+	var missing bool
+	for _, name := range []string{baseTmpl, homeTmpl, postTmpl} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			report(filepath.Join(dir, name), "missing template")
+			missing = true
+		}
+	}
+	if missing {
+		return
+	}
+
+	fsys := os.DirFS(dir)
+	for _, page := range []string{homeTmpl, postTmpl} {
+		if _, err := template.New(baseTmpl).Funcs(tmplFuncs(nil)).ParseFS(fsys, baseTmpl, page); err != nil {
+			report(filepath.Join(dir, page), "invalid template: %v", err)
+		}
+	}
+}
+
+// diagnosePosts checks every post in a blog.
+func diagnosePosts(blogDir, www string, report func(p, format string, args ...interface{})) error {
+	postsDir := filepath.Join(blogDir, "posts")
+	urls := make(map[string]string) // Post URL to source path
+
+	walkFn := func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !d.Type().IsRegular() || !strings.HasSuffix(p, ".gml.txt") {
+			return nil
+		}
+
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+
+		doc, err := gml.ParseWithOptions(string(b), &gml.ParseOptions{FS: newPostFS(p), Strict: true, AllErrors: true})
+		if err != nil {
+			var errs gml.ParseErrors
+			if !errors.As(err, &errs) {
+				report(p, "error parsing post: %v", err)
+				return nil
+			}
+			for _, err := range errs {
+				report(p, "error parsing post: %v", err)
+			}
+			return nil
+		}
+
+		if doc.Title() == "" {
+			report(p, "post has no %%title")
+		}
+		if doc.Date().IsZero() {
+			report(p, "post has no %%date")
+		}
+
+		postURL := (&post{title: doc.Title(), date: date{doc.Date()}}).url("/")
+		if other, ok := urls[postURL]; ok {
+			report(p, "post has the same URL as %s: %s", other, path.Dir(postURL))
+		} else {
+			urls[postURL] = p
+		}
+
+		for _, m := range reLinkAttr.FindAllStringSubmatch(doc.HTML(nil), -1) {
+			if missing, ok := missingAsset(filepath.Dir(p), www, m[1]); ok {
+				report(p, "missing asset %q (expected at %s)", m[1], missing)
+			}
+		}
+
+		return nil
+	}
+
+	if err := filepath.WalkDir(postsDir, walkFn); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("error checking posts in %q: %w", postsDir, err)
+	}
+
+	return nil
+}
+
+// missingAsset resolves a link found in a post to the file it needs:
+// relative links are copied from the post's directory and absolute
+// links are served from www. Links to other pages and sites are
+// ignored. It returns the expected path and true if the file is missing.
+func missingAsset(srcDir, www, link string) (string, bool) {
+	u, err := url.Parse(link)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.Path == "" {
+		return "", false
+	}
+
+	// Generated pages and feeds aren't assets
+	ext := path.Ext(u.Path)
+	if strings.HasSuffix(u.Path, "/") || ext == "" || ext == ".html" || ext == ".xml" {
+		return "", false
+	}
+
+	var p string
+	if strings.HasPrefix(u.Path, "/") {
+		p = filepath.Join(www, filepath.FromSlash(u.Path))
+	} else {
+		p = filepath.Join(srcDir, filepath.FromSlash(u.Path))
+	}
+
+	return p, !exists(p)
+}
+
+// isDir reports whether a directory exists at path
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
@@ -0,0 +1,55 @@
+package gutenblog
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDoctor(t *testing.T) {
+	root := t.TempDir()
+
+	files := map[string]string{
+		"posts/a/a.gml.txt":           "%title Hello\n%date 2022-03-21\n\n%figure\n<img src=\"missing.png\" alt=\"\">\n",
+		"posts/b/b.gml.txt":           "%title Hello\n%date 2022-03-21\n\n<img src=\"/assets/logo.png\" alt=\"\">\n",
+		"posts/c/c.gml.txt":           "%title Broken\n%date March 21\n\n%nope\n",
+		"tmpl/base.html.tmpl":         `{{define "base"}}{{template "content" .}}{{end}}`,
+		"tmpl/home.html.tmpl":         `{{define "content"}}{{if}}{{end}}`,
+		"www/assets/style.css":        "",
+		"blog/extra/posts/.gitkeep":   "",
+		"posts/a/unrelated-notes.txt": "",
+	}
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	diags, err := Doctor(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := func(name string) string {
+		return filepath.Join(root, filepath.FromSlash(name))
+	}
+
+	want := []Diagnosis{
+		{root, `site has both a "posts" and "blog" directory: it can't be both a solo and multi-blog site`},
+		{path("posts/a/a.gml.txt"), `missing asset "missing.png" (expected at ` + path("posts/a/missing.png") + `)`},
+		{path("posts/b/b.gml.txt"), "post has the same URL as " + path("posts/a/a.gml.txt") + ": /2022/03/21/hello"},
+		{path("posts/b/b.gml.txt"), `missing asset "/assets/logo.png" (expected at ` + path("www/assets/logo.png") + `)`},
+		{path("posts/c/c.gml.txt"), "error parsing post: gml: line 2, col 7: invalid date format: want: YYYY-MM-DD; got: March 21"},
+		{path("posts/c/c.gml.txt"), `error parsing post: gml: line 4, col 1: unrecognized keyword: "%nope"`},
+		{path("tmpl/post.html.tmpl"), "missing template"},
+	}
+
+	if !reflect.DeepEqual(want, diags) {
+		t.Errorf("\nwant:\t%v\n got:\t%v", want, diags)
+	}
+}
@@ -0,0 +1,313 @@
+package gutenblog
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/anschwa/gutenblog/gml"
+)
+
+// PreviewDiff is a rendered draft of a post along with what changed
+// compared to the currently published version.
+type PreviewDiff struct {
+	HTML     string        `json:"html"`
+	Metadata []FieldChange `json:"metadata"`
+	Blocks   []BlockChange `json:"blocks"`
+}
+
+// FieldChange is a metadata field whose value differs between versions.
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// BlockChange is a block that was inserted into or deleted from a
+// post. Index is the block's position in the version it belongs to.
+type BlockChange struct {
+	Op    string `json:"op"` // "insert" or "delete"
+	Index int    `json:"index"`
+	HTML  string `json:"html"`
+}
+
+// PreviewDiff renders modified GML source for the post served at
+// urlPath and compares it block by block with the published post.
+// Nothing is written to disk.
+func (s *Site) PreviewDiff(urlPath, source string) (*PreviewDiff, error) {
+	_, p, err := s.findPage(urlPath)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return nil, fmt.Errorf("%q is not a post", urlPath)
+	}
+
+	doc, err := parsePost(p.path, source)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing post: %w", err)
+	}
+
+	opts := s.htmlOptions()
+	diff := &PreviewDiff{
+		HTML:     doc.HTML(opts),
+		Metadata: diffMetadata(p.body, doc),
+		Blocks:   diffBlocks(p.body.BlocksHTML(opts), doc.BlocksHTML(opts)),
+	}
+
+	return diff, nil
+}
+
+func diffMetadata(old, new gml.Document) []FieldChange {
+	fields := []FieldChange{
+		{"title", old.Title(), new.Title()},
+		{"subtitle", old.Subtitle(), new.Subtitle()},
+		{"date", formatDate(old.Date()), formatDate(new.Date())},
+	}
+
+	var changes []FieldChange
+	for _, f := range fields {
+		if f.Old != f.New {
+			changes = append(changes, f)
+		}
+	}
+
+	return changes
+}
+
+func formatDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.Format("2006-01-02")
+}
+
+// diffBlocks finds the blocks deleted from a and inserted into b using
+// their longest common subsequence.
+func diffBlocks(a, b []string) []BlockChange {
+	// lcs[i][j] is the length of the LCS of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var changes []BlockChange
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] > lcs[i+1][j]):
+			changes = append(changes, BlockChange{Op: "insert", Index: j, HTML: b[j]})
+			j++
+		default:
+			changes = append(changes, BlockChange{Op: "delete", Index: i, HTML: a[i]})
+			i++
+		}
+	}
+
+	return changes
+}
+
+// handlePreviewDiff serves PreviewDiff as JSON. The draft GML is the
+// request body and the post is chosen by the "path" query parameter,
+// e.g. POST /api/preview-diff?path=/2022/03/21/hello-world/
+func (s *Site) handlePreviewDiff(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	source, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	diff, err := s.PreviewDiff(r.URL.Query().Get("path"), string(source))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(diff); err != nil {
+		s.logger.Error("error writing preview diff", "err", err)
+	}
+}
+
+// handlePreview renders the GML in the request body as a post page,
+// e.g. POST /preview?blog=foo (the blog is only needed on multi-blog
+// sites).
+func (s *Site) handlePreview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	source, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := s.RenderPreview(r.URL.Query().Get("blog"), string(source))
+	if errors.Is(err, os.ErrNotExist) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(page)
+}
+
+// PostSource returns the GML source of the post served at urlPath.
+func (s *Site) PostSource(urlPath string) (string, error) {
+	_, p, err := s.findPage(urlPath)
+	if err != nil {
+		return "", err
+	}
+	if p == nil {
+		return "", fmt.Errorf("%q is not a post", urlPath)
+	}
+
+	b, err := os.ReadFile(p.path)
+	if err != nil {
+		return "", fmt.Errorf("error reading post: %w", err)
+	}
+
+	return string(b), nil
+}
+
+// SavePost replaces the GML source of the post served at urlPath.
+// The source is parsed first so a post that doesn't parse is never
+// written. The site must be regenerated to publish the change.
+func (s *Site) SavePost(urlPath, source string) error {
+	_, p, err := s.findPage(urlPath)
+	if err != nil {
+		return err
+	}
+	if p == nil {
+		return fmt.Errorf("%q is not a post", urlPath)
+	}
+
+	if _, err := validatePost(p.path, source); err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(p.path, []byte(source)); err != nil {
+		return fmt.Errorf("error writing post: %w", err)
+	}
+
+	s.logger.Info("saved post", "path", p.path)
+	return nil
+}
+
+//go:embed editor/edit.html.tmpl
+var editTmplSource string
+
+var editTmpl = template.Must(template.New("edit").Parse(editTmplSource))
+
+// editLink is added to post pages by the development server.
+func editLink(urlPath string) string {
+	return fmt.Sprintf(`<a href="/_edit?path=%s" style="position:fixed;right:1em;bottom:1em">Edit</a>`,
+		template.HTMLEscapeString(url.QueryEscape(urlPath)))
+}
+
+// handleEdit serves the in-browser editor for the post chosen by the
+// "path" query parameter. GET shows the editor and POST saves the
+// submitted source, then calls saved (e.g. to rebuild the site) and
+// redirects back to the post.
+func (s *Site) handleEdit(w http.ResponseWriter, r *http.Request, locks *lockTable, saved func() error) {
+	urlPath := r.URL.Query().Get("path")
+
+	_, p, err := s.findPage(urlPath)
+	if err == nil && p == nil {
+		err = fmt.Errorf("%q is not a post: %w", urlPath, os.ErrNotExist)
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	data := struct {
+		Title  string
+		Path   string
+		Action string
+		Source string
+		Error  string
+	}{
+		Title:  p.title,
+		Path:   urlPath,
+		Action: r.URL.RequestURI(),
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	switch r.Method {
+	case http.MethodGet:
+		if data.Source, err = s.PostSource(urlPath); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	case http.MethodPost:
+		// Browsers submit textareas with CRLF line endings
+		data.Source = strings.ReplaceAll(r.PostFormValue("source"), "\r\n", "\n")
+
+		user := r.PostFormValue("user")
+		if name, _, ok := r.BasicAuth(); ok {
+			user = name
+		}
+
+		status := http.StatusSeeOther
+		if err := locks.check(urlPath, user); err != nil {
+			status, data.Error = http.StatusConflict, err.Error()
+		} else if err := s.SavePost(urlPath, data.Source); err != nil {
+			status, data.Error = http.StatusBadRequest, err.Error()
+		} else if err := saved(); err != nil {
+			status, data.Error = http.StatusInternalServerError, err.Error()
+		}
+
+		if status == http.StatusSeeOther {
+			http.Redirect(w, r, urlPath, status)
+			return
+		}
+		w.WriteHeader(status)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := editTmpl.Execute(w, data); err != nil {
+		s.logger.Error("error writing editor", "err", err)
+	}
+}
@@ -0,0 +1,92 @@
+package gutenblog
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDiffBlocks(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []string
+		want []BlockChange
+	}{
+		{"equal", []string{"a", "b"}, []string{"a", "b"}, nil},
+		{"insert", []string{"a", "c"}, []string{"a", "b", "c"}, []BlockChange{{"insert", 1, "b"}}},
+		{"delete", []string{"a", "b", "c"}, []string{"a", "c"}, []BlockChange{{"delete", 1, "b"}}},
+		{"replace", []string{"a", "b"}, []string{"a", "x"}, []BlockChange{{"delete", 1, "b"}, {"insert", 1, "x"}}},
+		{"empty", nil, []string{"a"}, []BlockChange{{"insert", 0, "a"}}},
+	}
+
+	for _, test := range tests {
+		if got := diffBlocks(test.a, test.b); !reflect.DeepEqual(test.want, got) {
+			t.Errorf("%s:\nwant:\t%#v\n got:\t%#v", test.name, test.want, got)
+		}
+	}
+}
+
+func TestPreviewDiff(t *testing.T) {
+	s, err := New("examples/solo-blog", t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diff, err := s.PreviewDiff("/2022/03/21/hello-world/", "%title Hello again\n%date 2022-03-21\n\n* Heading\n\nNew paragraph")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []FieldChange{{"title", "Hello world", "Hello again"}}; !reflect.DeepEqual(want, diff.Metadata) {
+		t.Errorf("metadata:\nwant:\t%#v\n got:\t%#v", want, diff.Metadata)
+	}
+
+	var inserted int
+	for _, c := range diff.Blocks {
+		if c.Op == "insert" {
+			inserted++
+		}
+	}
+
+	if inserted != 1 {
+		t.Errorf("want 1 inserted block; got: %#v", diff.Blocks)
+	}
+}
+
+func TestSavePost(t *testing.T) {
+	root := t.TempDir()
+	postDir := filepath.Join(root, "posts", "hello")
+	if err := os.MkdirAll(postDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	original := "%title Hello\n%date 2022-03-21\n\nFirst draft\n"
+	postPath := filepath.Join(postDir, "hello.gml.txt")
+	if err := os.WriteFile(postPath, []byte(original), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := New(root, t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const urlPath = "/2022/03/21/hello/"
+	if got, err := s.PostSource(urlPath); err != nil || got != original {
+		t.Fatalf("PostSource: got %q, %v", got, err)
+	}
+
+	if err := s.SavePost(urlPath, "%date March 21\n"); err == nil {
+		t.Error("want error saving a post that doesn't parse")
+	}
+
+	edited := "%title Hello\n%date 2022-03-21\n\nSecond draft\n"
+	if err := s.SavePost(urlPath, edited); err != nil {
+		t.Fatal(err)
+	}
+
+	if b, _ := os.ReadFile(postPath); string(b) != edited {
+		t.Errorf("want %q; got %q", edited, b)
+	}
+}
@@ -0,0 +1,186 @@
+package gutenblog
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anschwa/gutenblog/gml"
+)
+
+// Atom feeds (RFC 4287). Every blog gets a feed of all its posts and
+// the site config can ask for additional feeds scoped to a single
+// year or tag so readers can subscribe to only part of a blog.
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Links   []atomLink  `xml:"link"`
+	Updated string      `xml:"updated"`
+	Author  atomPerson  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Link    atomLink    `xml:"link"`
+	Updated string      `xml:"updated"`
+	Summary string      `xml:"summary,omitempty"`
+	Content atomContent `xml:"content"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// absURL prefixes a site path with the configured base URL.
+func (s *Site) absURL(path string) string {
+	return strings.TrimSuffix(s.config.URL, "/") + path
+}
+
+// writeFeeds writes the blog's main feed along with any year or tag
+// variants enabled in the site config.
+func (s *Site) writeFeeds(b *blog) error {
+	if s.config.Feeds.Disable {
+		return nil
+	}
+
+	title := s.config.Title
+	if title == "" {
+		title = filepath.Base(b.name)
+	}
+
+	if s.config.URL == "" {
+		s.logger.Warn("url is not set in the site config: feed IDs and links are relative, which most feed readers reject", "blog", b.name)
+	}
+
+	posts := b.sortedPosts()
+	if err := s.writeFeed(b, "feed.xml", title, posts); err != nil {
+		return err
+	}
+
+	if s.config.Feeds.Years {
+		years := make(map[int][]*post)
+		for _, p := range posts {
+			years[p.date.Year()] = append(years[p.date.Year()], p)
+		}
+
+		for year, yearPosts := range years {
+			path := filepath.Join(strconv.Itoa(year), "feed.xml")
+			if err := s.writeFeed(b, path, fmt.Sprintf("%s: %d", title, year), yearPosts); err != nil {
+				return err
+			}
+		}
+	}
+
+	if s.config.Feeds.Tags {
+		tags := make(map[string][]*post)
+		for _, p := range posts {
+			for _, tag := range p.tags {
+				tags[tag] = append(tags[tag], p)
+			}
+		}
+
+		names := make([]string, 0, len(tags))
+		for tag := range tags {
+			names = append(names, tag)
+		}
+		sort.Strings(names)
+
+		// Tags like "C" and "C++" share a slug and would overwrite
+		// each other's feed
+		slugs := make(map[string]string, len(names))
+		for _, tag := range names {
+			slug := gml.Slugify(tag)
+			if other, ok := slugs[slug]; ok {
+				return fmt.Errorf("tags %q and %q would both write the feed tags/%s/feed.xml: rename one of them", other, tag, slug)
+			}
+			slugs[slug] = tag
+
+			path := filepath.Join("tags", slug, "feed.xml")
+			if err := s.writeFeed(b, path, fmt.Sprintf("%s: %s", title, tag), tags[tag]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// writeFeed writes an Atom feed containing posts (oldest first) to
+// path, which is relative to the blog's root.
+func (s *Site) writeFeed(b *blog, path, title string, posts []*post) error {
+	webRoot := s.webRoot(b)
+	feedURL := s.absURL(filepath.Join(webRoot, path))
+	path = filepath.Join(s.blogOutDir(b), path)
+
+	feed := atomFeed{
+		Title: title,
+		ID:    feedURL,
+		Links: []atomLink{
+			{Href: feedURL, Rel: "self"},
+			{Href: s.absURL(webRoot)},
+		},
+		Updated: time.Unix(0, 0).UTC().Format(time.RFC3339),
+		Author:  atomPerson{Name: s.config.Author},
+	}
+	if feed.Author.Name == "" {
+		feed.Author.Name = title // An Atom feed must have an author
+	}
+
+	// Newest posts first
+	for i := len(posts) - 1; i >= 0; i-- {
+		p := posts[i]
+		postURL := s.absURL(p.url(webRoot))
+		updated := p.date.UTC().Format(time.RFC3339)
+
+		feed.Entries = append(feed.Entries, atomEntry{
+			Title:   p.title,
+			ID:      postURL,
+			Link:    atomLink{Href: postURL},
+			Updated: updated,
+			Summary: p.body.Summary(),
+			Content: atomContent{Type: "html", Body: p.body.HTML(s.htmlOptions())},
+		})
+
+		if updated > feed.Updated {
+			feed.Updated = updated
+		}
+	}
+
+	if err := mkdir(filepath.Dir(path)); err != nil {
+		return err
+	}
+
+	w, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating feed %q: %w", path, err)
+	}
+	defer w.Close()
+
+	w.WriteString(xml.Header)
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(feed); err != nil {
+		return fmt.Errorf("error writing feed %q: %w", path, err)
+	}
+
+	return nil
+}
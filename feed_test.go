@@ -0,0 +1,149 @@
+package gutenblog
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteFeeds(t *testing.T) {
+	s, err := New("examples/solo-blog", t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.config.URL = "https://example.com/"
+	s.config.Title = "Example"
+	s.config.Author = "Jane Doe"
+	s.config.Feeds = FeedConfig{Years: true, Tags: true}
+
+	b := s.blogs[0]
+	b.sortedPosts()[0].tags = []string{"Go Tips"}
+
+	if err := s.writeFeeds(b); err != nil {
+		t.Fatal(err)
+	}
+
+	postURL := "https://example.com/2022/03/21/hello-world/index.html"
+	tests := []struct {
+		path  string
+		title string
+	}{
+		{"feed.xml", "Example"},
+		{"2022/feed.xml", "Example: 2022"},
+		{"tags/go-tips/feed.xml", "Example: Go Tips"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join(s.outDir, filepath.FromSlash(tt.path)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(string(data), xml.Header) {
+				t.Error("want an XML declaration")
+			}
+
+			var feed atomFeed
+			if err := xml.Unmarshal(data, &feed); err != nil {
+				t.Fatal(err)
+			}
+
+			feedURL := "https://example.com/" + tt.path
+			if feed.Title != tt.title || feed.ID != feedURL {
+				t.Errorf("want title %q and id %q; got %q and %q", tt.title, feedURL, feed.Title, feed.ID)
+			}
+			if len(feed.Links) != 2 || feed.Links[0] != (atomLink{Href: feedURL, Rel: "self"}) || feed.Links[1] != (atomLink{Href: "https://example.com/"}) {
+				t.Errorf("want self and alternate links; got %+v", feed.Links)
+			}
+			if feed.Author.Name != "Jane Doe" {
+				t.Errorf("want the configured author; got %q", feed.Author.Name)
+			}
+			if feed.Updated != "2022-03-21T00:00:00Z" {
+				t.Errorf("want the feed updated with its newest post; got %q", feed.Updated)
+			}
+
+			if len(feed.Entries) != 1 {
+				t.Fatalf("want 1 entry; got %d", len(feed.Entries))
+			}
+			e := feed.Entries[0]
+			if e.Title != "Hello world" || e.ID != postURL || e.Link.Href != postURL || e.Updated != "2022-03-21T00:00:00Z" {
+				t.Errorf("unexpected entry: %+v", e)
+			}
+			if e.Content.Type != "html" || !strings.Contains(e.Content.Body, "<em>mauris</em>") {
+				t.Errorf("want the post's HTML as content; got %q", e.Content.Body)
+			}
+		})
+	}
+
+	// Variants are only written when enabled
+	s.outDir = t.TempDir()
+	s.config.Feeds = FeedConfig{}
+	if err := s.writeFeeds(b); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"2022", "tags"} {
+		if _, err := os.Stat(filepath.Join(s.outDir, path)); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("want no %s feeds; got %v", path, err)
+		}
+	}
+
+	s.outDir = t.TempDir()
+	s.config.Feeds = FeedConfig{Disable: true, Years: true, Tags: true}
+	if err := s.writeFeeds(b); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := os.ReadDir(s.outDir); len(entries) != 0 {
+		t.Errorf("want no feeds when disabled; got %d files", len(entries))
+	}
+}
+
+func TestWriteFeedsTagCollision(t *testing.T) {
+	s, err := New("examples/solo-blog", t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.config.URL = "https://example.com/"
+	s.config.Feeds = FeedConfig{Tags: true}
+
+	b := s.blogs[0]
+	b.sortedPosts()[0].tags = []string{"C++", "C"}
+
+	err = s.writeFeeds(b)
+	if want := `tags "C" and "C++" would both write the feed tags/c/feed.xml`; err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("want an error containing %q; got %v", want, err)
+	}
+}
+
+func TestWriteFeedsWithoutURL(t *testing.T) {
+	var buf bytes.Buffer
+	s, err := New("examples/solo-blog", t.TempDir(), slog.New(slog.NewTextHandler(&buf, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.config.Title = "Example"
+
+	if err := s.writeFeeds(s.blogs[0]); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "url is not set") {
+		t.Errorf("want a warning about the missing URL; got:\n%s", buf.String())
+	}
+
+	data, err := os.ReadFile(filepath.Join(s.outDir, "feed.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var feed atomFeed
+	if err := xml.Unmarshal(data, &feed); err != nil {
+		t.Fatal(err)
+	}
+	if feed.Author.Name != "Example" {
+		t.Errorf("want the author to default to the title; got %q", feed.Author.Name)
+	}
+}
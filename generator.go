@@ -0,0 +1,127 @@
+package gutenblog
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anschwa/gutenblog/gml"
+)
+
+// Generator adds extra artifacts (feeds, custom indexes, stats pages,
+// etc.) to a site after its blogs have been generated. Generators run
+// concurrently with each other and with the built-in artifacts, so
+// they must not depend on each other's output.
+type Generator interface {
+	Name() string
+	Generate(site *Site, out OutputFS) error
+}
+
+// OutputFS is the site's output directory as seen by a Generator.
+type OutputFS interface {
+	// WriteFile writes data to the slash-separated path name relative to
+	// the output directory, creating any missing parent directories.
+	WriteFile(name string, data []byte) error
+}
+
+var (
+	generatorsMu sync.Mutex
+	generators   = make(map[string]Generator)
+)
+
+// RegisterGenerator makes a Generator available to every site. It is
+// intended to be called from the init function of packages that
+// provide generators. RegisterGenerator panics if it is called twice
+// with the same name or if g is nil.
+func RegisterGenerator(g Generator) {
+	generatorsMu.Lock()
+	defer generatorsMu.Unlock()
+
+	if g == nil {
+		panic("gutenblog: RegisterGenerator generator is nil")
+	}
+
+	name := g.Name()
+	if _, dup := generators[name]; dup {
+		panic("gutenblog: RegisterGenerator called twice for generator " + name)
+	}
+	generators[name] = g
+}
+
+// registeredGenerators returns all registered generators in name order.
+func registeredGenerators() []Generator {
+	generatorsMu.Lock()
+	defer generatorsMu.Unlock()
+
+	names := make([]string, 0, len(generators))
+	for name := range generators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	gens := make([]Generator, 0, len(names))
+	for _, name := range names {
+		gens = append(gens, generators[name])
+	}
+
+	return gens
+}
+
+// dirFS implements OutputFS for a directory on disk.
+type dirFS string
+
+func (dir dirFS) WriteFile(name string, data []byte) error {
+	if filepath.IsAbs(name) || strings.HasPrefix(filepath.Clean(filepath.FromSlash(name)), "..") {
+		return fmt.Errorf("invalid output path: %q", name)
+	}
+
+	path := filepath.Join(string(dir), filepath.FromSlash(name))
+	if err := mkdir(filepath.Dir(path)); err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0644)
+}
+
+// PostInfo is a read-only view of a post for use by generators.
+type PostInfo struct {
+	Blog   string // Name of the blog directory the post belongs to
+	Title  string
+	Date   time.Time
+	URL    string // Site path of the post's generated page
+	Source string // Path of the post's source file
+	Doc    gml.Document
+}
+
+// Posts returns every post on the site sorted by date.
+func (s *Site) Posts() []PostInfo {
+	var posts []PostInfo
+	for _, b := range s.blogs {
+		webRoot := s.webRoot(b)
+		for _, p := range b.sortedPosts() {
+			posts = append(posts, PostInfo{
+				Blog:   filepath.Base(b.name),
+				Title:  p.title,
+				Date:   p.date.Time,
+				URL:    p.url(webRoot),
+				Source: p.path,
+				Doc:    p.body,
+			})
+		}
+	}
+
+	sort.SliceStable(posts, func(i, j int) bool {
+		return posts[i].Date.Before(posts[j].Date)
+	})
+
+	return posts
+}
+
+// Config returns the site's configuration.
+func (s *Site) Config() Config {
+	return *s.config
+}
@@ -0,0 +1,87 @@
+package gutenblog
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type titlesGenerator struct{}
+
+func (titlesGenerator) Name() string { return "titles" }
+
+func (titlesGenerator) Generate(site *Site, out OutputFS) error {
+	var b strings.Builder
+	for _, p := range site.Posts() {
+		fmt.Fprintf(&b, "%s %s\n", p.URL, p.Title)
+	}
+
+	return out.WriteFile("titles.txt", []byte(b.String()))
+}
+
+func TestGenerator(t *testing.T) {
+	RegisterGenerator(titlesGenerator{})
+	defer delete(generators, "titles")
+
+	outDir := t.TempDir()
+	s, err := New("examples/solo-blog", outDir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Build(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(filepath.Join(outDir, "titles.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := "/2022/03/21/hello-world/index.html Hello world\n", string(b); want != got {
+		t.Errorf("want: %q; got: %q", want, got)
+	}
+}
+
+func TestOutputFSRejectsEscapes(t *testing.T) {
+	out := dirFS(t.TempDir())
+	for _, name := range []string{"../escape.txt", "/abs.txt"} {
+		if err := out.WriteFile(name, nil); err == nil {
+			t.Errorf("WriteFile(%q): want error", name)
+		}
+	}
+}
+
+type failingGenerator string
+
+func (g failingGenerator) Name() string { return string(g) }
+
+func (g failingGenerator) Generate(site *Site, out OutputFS) error {
+	return fmt.Errorf("%s failed", g)
+}
+
+func TestArtifactErrors(t *testing.T) {
+	RegisterGenerator(failingGenerator("fail-a"))
+	RegisterGenerator(failingGenerator("fail-b"))
+	defer delete(generators, "fail-a")
+	defer delete(generators, "fail-b")
+
+	s, err := New("examples/solo-blog", t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.Build()
+
+	var artifactErr *ArtifactError
+	if !errors.As(err, &artifactErr) {
+		t.Fatalf("want *ArtifactError; got: %v", err)
+	}
+
+	if len(artifactErr.Errs) != 2 {
+		t.Errorf("want 2 errors; got: %v", artifactErr.Errs)
+	}
+}
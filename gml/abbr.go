@@ -0,0 +1,113 @@
+package gml
+
+import (
+	"io"
+	"strings"
+)
+
+// "%abbr HTML HyperText Markup Language" declares an abbreviation.
+// Once it's declared, every use of the term as a whole word in styled
+// text is wrapped in an <abbr> element with the rest of the line as
+// its title:
+//
+//   <abbr title="HyperText Markup Language">HTML</abbr>
+//
+// Terms are left alone in code, math, HTML tags, URLs, and images.
+
+// Abbr is an %abbr block. Parse keeps the declarations in a table of
+// the document rather than its blocks, so the only time it's a block
+// is when a document is parsed for Format.
+type Abbr struct {
+	Term  string `json:"term"`
+	Title string `json:"title"`
+}
+
+// abbr only declares an abbreviation so it's kept in the document when
+// it's parsed for Format.
+func (a *Abbr) WriteHTML(w io.Writer, opts *HTMLOptions) (int, error) {
+	return 0, nil
+}
+
+func (p *parser) parseAbbr(token item) {
+	term, title, _ := strings.Cut(strings.TrimSpace(token.val), " ")
+	title = strings.TrimSpace(title)
+	if term == "" || title == "" {
+		p.errorf("%%abbr needs a term and its title, e.g. \"%%abbr HTML HyperText Markup Language\"")
+	}
+	if text := p.collectItems(itemText); len(text) > 0 {
+		p.errorf("%%abbr doesn't take any text; got: %q", text[0])
+	}
+
+	p.doc.content = append(p.doc.content, &Abbr{Term: term, Title: title})
+}
+
+// declaredAbbr is an abbreviation along with the index of the first
+// block of the document's content it applies to.
+type declaredAbbr struct {
+	Abbr
+	block int
+}
+
+// collectAbbrs moves the %abbr declarations out of the document into
+// its table of abbreviations. The text is left as it's written; terms
+// are only wrapped when it's rendered.
+func (d *document) collectAbbrs() {
+	var content []Block
+	var positions []int
+	for i, b := range d.content {
+		if a, ok := b.(*Abbr); ok {
+			d.abbrs = append(d.abbrs, declaredAbbr{Abbr: *a, block: len(content)})
+			continue
+		}
+
+		content = append(content, b)
+		if i < len(d.positions) {
+			positions = append(positions, d.positions[i])
+		}
+	}
+
+	d.content, d.positions = content, positions
+}
+
+// abbrOptions returns opts for writing block i of the document's
+// content, with the abbreviations declared before it.
+func (d document) abbrOptions(opts *HTMLOptions, i int) *HTMLOptions {
+	var titles map[string]string // Term to title
+	for _, a := range d.abbrs {
+		if a.block > i {
+			break
+		}
+		if titles == nil {
+			titles = make(map[string]string)
+		}
+		titles[a.Term] = a.Title
+	}
+	if titles == nil {
+		return opts
+	}
+
+	abbrOpts := *opts
+	abbrOpts.abbrs = titles
+	return &abbrOpts
+}
+
+// matchTerm returns the longest term of titles that s starts with as a
+// whole word, or "" if there isn't one.
+func matchTerm(s string, titles map[string]string) string {
+	var match string
+	for term := range titles {
+		if len(term) <= len(match) || !strings.HasPrefix(s, term) {
+			continue
+		}
+		if len(s) > len(term) && isWordByte(s[len(term)]) {
+			continue
+		}
+		match = term
+	}
+
+	return match
+}
+
+func isWordByte(c byte) bool {
+	return isASCIILetter(c) || '0' <= c && c <= '9' || c == '_' || c >= 0x80
+}
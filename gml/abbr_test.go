@@ -0,0 +1,44 @@
+package gml
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAbbr(t *testing.T) {
+	input := "HTML before it's declared.\n\n" +
+		"%abbr HTML HyperText Markup Language\n" +
+		"%abbr HTML5 HTML \"version 5\"\n\n" +
+		"HTML and HTML5, not HTMLX or ~HTML~, in [an HTML page](https://html.example/HTML).\n\n" +
+		"- *HTML* <b title=\"HTML\">x</b>"
+	doc, err := Parse(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "<p>HTML before it's declared.</p>" +
+		"<p><abbr title=\"HyperText Markup Language\">HTML</abbr> and <abbr title=\"HTML &#34;version 5&#34;\">HTML5</abbr>," +
+		" not HTMLX or <code>HTML</code>, in <a href=\"https://html.example/HTML\">an <abbr title=\"HyperText Markup Language\">HTML</abbr> page</a>.</p>" +
+		"<ul><li><strong><abbr title=\"HyperText Markup Language\">HTML</abbr></strong> &lt;b title=\"HTML\"&gt;x&lt;/b&gt;</li></ul>"
+	if got := doc.ExcerptHTML(10, &HTMLOptions{Minified: true}); got != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+
+	// Terms are wrapped as they're written; the text itself is unchanged
+	if p, ok := doc.Blocks()[1].(*Paragraph); !ok || strings.Contains(p.Text, "<abbr") {
+		t.Errorf("want the paragraph's text as written; got %#v", doc.Blocks()[1])
+	}
+	if got := doc.PlainText(); strings.Contains(got, "<abbr") {
+		t.Errorf("want plain text without <abbr>; got:\n%s", got)
+	}
+
+	for _, input := range []string{"%abbr HTML\n", "%abbr HTML HyperText\nMarkup Language\n"} {
+		if _, err := Parse(input); err == nil {
+			t.Errorf("%q: want an error", input)
+		}
+	}
+
+	if got, err := Format("%abbr   HTML   HyperText Markup Language\n", nil); err != nil || !strings.HasPrefix(got, "%abbr HTML HyperText Markup Language\n") {
+		t.Errorf("want the declaration kept by Format; got %q, %v", got, err)
+	}
+}
@@ -0,0 +1,142 @@
+package gml
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// "%embed https://www.youtube.com/watch?v=..." embeds a video player
+// from a site GML knows about, YouTube or Vimeo, as a responsive
+// iframe. It may be given a title= for screen readers and a caption
+// on the lines after it:
+//
+//   %embed https://vimeo.com/76979871 title="The New Vimeo Player"
+//   Vimeo's new player, /finally/.
+
+// Embed is an %embed block.
+type Embed struct {
+	args    string // Arguments as written
+	Src     string `json:"src"` // URL of the player
+	Title   string `json:"title"`
+	Caption string `json:"caption,omitempty"` // Styled text as written
+}
+
+func (e *Embed) WriteHTML(w io.Writer, opts *HTMLOptions) (int, error) {
+	var b bytes.Buffer
+
+	if opts == nil {
+		opts = &HTMLOptions{}
+	}
+
+	fmt.Fprintf(&b, `<figure class="%s">`, opts.class("embed"))
+	opts.newline(&b, 1)
+	fmt.Fprintf(&b, `<iframe%s title="%s" style="width: 100%%; aspect-ratio: 16 / 9; border: 0" loading="lazy" `+
+		`allow="autoplay; encrypted-media; fullscreen; picture-in-picture" allowfullscreen></iframe>`,
+		opts.urlAttr("src", e.Src), escapeHTML(e.Title))
+
+	if e.Caption != "" {
+		opts.newline(&b, 1)
+		fmt.Fprintf(&b, `<figcaption>%s</figcaption>`, textToHTML(e.Caption, opts))
+	}
+
+	opts.newline(&b, 0)
+	b.WriteString(`</figure>`)
+	return w.Write(b.Bytes())
+}
+
+func (p *parser) parseEmbed(token item) {
+	e := &Embed{args: token.val, Caption: strings.Join(p.collectItems(itemText), "\n")}
+
+	// The URL comes first since its query may have a "=" in it
+	rawURL, args, _ := strings.Cut(strings.TrimSpace(token.val), " ")
+	if rawURL == "" {
+		p.errorf("%%embed: missing URL")
+	}
+
+	words, named := parseArgs(args)
+	if len(words) > 0 {
+		p.errorf("%%embed: unexpected argument %q", words[0])
+	}
+	for k, v := range named {
+		switch k {
+		case "title":
+			e.Title = v
+		default:
+			p.errorf("%%embed: unknown argument %q", k)
+		}
+	}
+
+	src, site, err := playerURL(rawURL)
+	if err != nil {
+		p.errorf("%%embed: %v", err)
+	}
+	e.Src = src
+	if e.Title == "" {
+		e.Title = site + " video"
+	}
+
+	p.doc.content = append(p.doc.content, e)
+}
+
+// playerURL returns the URL of the embeddable player for the video at
+// rawURL and the name of the site it's on.
+func playerURL(rawURL string) (src, site string, err error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "https" && u.Scheme != "http" {
+		return "", "", fmt.Errorf("invalid URL %q", rawURL)
+	}
+
+	host := strings.TrimPrefix(strings.TrimPrefix(u.Hostname(), "www."), "m.")
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+
+	switch host {
+	case "youtube.com", "youtu.be", "youtube-nocookie.com":
+		var id string
+		switch {
+		case host == "youtu.be":
+			id = segments[0]
+		case u.Path == "/watch":
+			id = u.Query().Get("v")
+		case len(segments) == 2 && (segments[0] == "embed" || segments[0] == "shorts" || segments[0] == "live"):
+			id = segments[1]
+		}
+		if id == "" {
+			return "", "", fmt.Errorf("no YouTube video ID in %q", rawURL)
+		}
+
+		src = "https://www.youtube-nocookie.com/embed/" + url.PathEscape(id)
+		if start := startSeconds(u.Query().Get("t")); start > 0 {
+			src += "?start=" + strconv.Itoa(start)
+		}
+		return src, "YouTube", nil
+	case "vimeo.com", "player.vimeo.com":
+		id := segments[len(segments)-1]
+		if _, err := strconv.Atoi(id); err != nil {
+			return "", "", fmt.Errorf("no Vimeo video ID in %q", rawURL)
+		}
+
+		return "https://player.vimeo.com/video/" + id, "Vimeo", nil
+	}
+
+	return "", "", fmt.Errorf("can't embed %q: only YouTube and Vimeo videos are supported", rawURL)
+}
+
+// startSeconds parses a YouTube start time like "90" or "1m30s", or
+// returns 0 if there isn't one.
+func startSeconds(t string) int {
+	if n, err := strconv.Atoi(t); err == nil {
+		return n
+	}
+
+	d, err := time.ParseDuration(t)
+	if err != nil {
+		return 0
+	}
+
+	return int(d.Seconds())
+}
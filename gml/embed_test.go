@@ -0,0 +1,64 @@
+package gml
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEmbed(t *testing.T) {
+	doc, err := Parse("%embed https://www.youtube.com/watch?v=dQw4w9WgXcQ&t=1m30s title=\"Never gonna\"\nA /classic/.")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "<figure class=\"embed\">" +
+		"<iframe src=\"https://www.youtube-nocookie.com/embed/dQw4w9WgXcQ?start=90\" title=\"Never gonna\"" +
+		" style=\"width: 100%; aspect-ratio: 16 / 9; border: 0\" loading=\"lazy\"" +
+		" allow=\"autoplay; encrypted-media; fullscreen; picture-in-picture\" allowfullscreen></iframe>" +
+		"<figcaption>A <em>classic</em>.</figcaption>" +
+		"</figure>"
+	if got := doc.ExcerptHTML(1, &HTMLOptions{Minified: true}); got != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+
+	players := []struct {
+		url, src, title string
+	}{
+		{"https://youtu.be/dQw4w9WgXcQ?t=42", "https://www.youtube-nocookie.com/embed/dQw4w9WgXcQ?start=42", "YouTube video"},
+		{"https://m.youtube.com/shorts/abc123", "https://www.youtube-nocookie.com/embed/abc123", "YouTube video"},
+		{"https://vimeo.com/76979871", "https://player.vimeo.com/video/76979871", "Vimeo video"},
+		{"https://vimeo.com/channels/staffpicks/76979871", "https://player.vimeo.com/video/76979871", "Vimeo video"},
+	}
+
+	for _, tt := range players {
+		doc, err := Parse("%embed " + tt.url)
+		if err != nil {
+			t.Errorf("%s: %v", tt.url, err)
+			continue
+		}
+
+		got := doc.ExcerptHTML(1, nil)
+		if !strings.Contains(got, `src="`+tt.src+`"`) || !strings.Contains(got, `title="`+tt.title+`"`) {
+			t.Errorf("%s: want src %q and title %q; got:\n%s", tt.url, tt.src, tt.title, got)
+		}
+	}
+
+	errTests := []struct {
+		input string
+		err   string
+	}{
+		{"%embed\n", "missing URL"},
+		{"%embed https://example.com/video.mp4\n", "only YouTube and Vimeo"},
+		{"%embed https://www.youtube.com/feed\n", "no YouTube video ID"},
+		{"%embed https://vimeo.com/about\n", "no Vimeo video ID"},
+		{"%embed https://youtu.be/x autoplay\n", "unexpected argument \"autoplay\""},
+		{"%embed https://youtu.be/x width=3\n", "unknown argument \"width\""},
+	}
+
+	for _, tt := range errTests {
+		_, err := Parse(tt.input)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%q: want error containing %q; got %v", tt.input, tt.err, err)
+		}
+	}
+}
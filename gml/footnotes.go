@@ -0,0 +1,268 @@
+package gml
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Footnotes may be named instead of numbered so authors don't have to
+// renumber them as a post changes:
+//
+//   Set up the server first.[fn:setup]
+//
+//   %footnotes
+//   - [setup] See the install guide.
+//
+// Once a document is parsed, every reference must have a definition
+// and every definition a reference. Footnotes are then numbered in the
+// order they're first referenced, whether they were written with names
+// or numbers, and written together at the end of the article wherever
+// their %footnotes blocks are.
+
+var reFootnoteDefLabel = regexp.MustCompile(`^\[([A-Za-z][\w-]*|\d+)\]`)
+
+// textBlock is a block with styled text, which may have footnotes.
+type textBlock interface {
+	// rewriteText replaces each piece of styled text s with f(s) in
+	// the order it's written
+	rewriteText(f func(string) string)
+}
+
+// numberFootnotes checks that the footnote references and definitions
+// of the document match and numbers them in order of use. It returns
+// the mismatches in order of their lines.
+func (d document) numberFootnotes() ParseErrors {
+	var errs ParseErrors
+	errorf := func(line int, format string, args ...interface{}) {
+		errs = append(errs, &ParseError{
+			Line:    line,
+			Msg:     fmt.Sprintf(format, args...),
+			Snippet: sourceLine(d.src, lineStart(d.src, line)),
+		})
+	}
+
+	defined := make(map[string]bool)
+	for i, b := range d.content {
+		f, ok := b.(*Footnotes)
+		if !ok {
+			continue
+		}
+
+		line := d.line(i) + 1
+		for j, label := range f.labels() {
+			if defined[label] {
+				errorf(line, "footnote %s is defined more than once", label)
+			}
+			defined[label] = true
+			line += strings.Count(f.Items[j], "\n") + 1
+		}
+	}
+
+	numbers := make(map[string]int) // Label to number
+	for i, b := range d.content {
+		rewriteBlocks([]Block{b}, func(s string) string {
+			for _, m := range reFootnoteRef.FindAllStringSubmatch(s, -1) {
+				label := m[1]
+				if !defined[label] {
+					errorf(d.line(i), "footnote [fn:%s] has no definition", label)
+					continue
+				}
+				if _, ok := numbers[label]; !ok {
+					numbers[label] = len(numbers) + 1
+				}
+			}
+			return s
+		})
+	}
+
+	for i, b := range d.content {
+		if f, ok := b.(*Footnotes); ok {
+			line := d.line(i) + 1
+			for j, label := range f.labels() {
+				if _, ok := numbers[label]; !ok {
+					errorf(line, "footnote %s is never referenced", label)
+				}
+				line += strings.Count(f.Items[j], "\n") + 1
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		sort.SliceStable(errs, func(i, j int) bool { return errs[i].Line < errs[j].Line })
+		return errs
+	}
+
+	rewriteBlocks(d.content, func(s string) string {
+		return reFootnoteRef.ReplaceAllStringFunc(s, func(ref string) string {
+			label := reFootnoteRef.FindStringSubmatch(ref)[1]
+			return "[fn:" + strconv.Itoa(numbers[label]) + "]"
+		})
+	})
+
+	for _, b := range d.content {
+		if f, ok := b.(*Footnotes); ok {
+			f.renumber(numbers)
+		}
+	}
+
+	return nil
+}
+
+// moveFootnotes merges the %footnotes blocks of the document into one
+// at the end, so the footnotes are always written after the rest of
+// the article no matter where they're defined.
+func (d *document) moveFootnotes() {
+	var merged *Footnotes
+	var content []Block
+	var positions []int
+	for i, b := range d.content {
+		f, ok := b.(*Footnotes)
+		if !ok {
+			content = append(content, b)
+			if i < len(d.positions) {
+				positions = append(positions, d.positions[i])
+			}
+			continue
+		}
+
+		if merged == nil {
+			merged = &Footnotes{}
+		}
+		for j := range f.Items {
+			merged.Items = append(merged.Items, f.Items[j])
+			var blocks []Block
+			if j < len(f.Blocks) {
+				blocks = f.Blocks[j]
+			}
+			merged.Blocks = append(merged.Blocks, blocks)
+			n := j + 1
+			if j < len(f.numbers) {
+				n = f.numbers[j]
+			}
+			merged.numbers = append(merged.numbers, n)
+		}
+	}
+
+	if merged == nil {
+		return
+	}
+
+	merged.sort()
+	d.content = append(content, merged)
+	d.positions = append(positions, len(d.src))
+}
+
+// rewriteBlocks calls rewriteText on each block with styled text.
+func rewriteBlocks(blocks []Block, f func(string) string) {
+	for _, b := range blocks {
+		if t, ok := b.(textBlock); ok {
+			t.rewriteText(f)
+		}
+	}
+}
+
+// labels returns the label of each footnote definition: the name or
+// number it starts with, or its position if it has neither.
+func (f *Footnotes) labels() []string {
+	labels := make([]string, len(f.Items))
+	for i, item := range f.Items {
+		labels[i] = strconv.Itoa(i + 1)
+		if m := reFootnoteDefLabel.FindStringSubmatch(item); m != nil {
+			labels[i] = m[1]
+		}
+	}
+
+	return labels
+}
+
+// renumber rewrites the labels of the footnote definitions with their
+// numbers, e.g. "[setup] ..." as "[2] ...".
+func (f *Footnotes) renumber(numbers map[string]int) {
+	f.numbers = make([]int, len(f.Items))
+	for i, label := range f.labels() {
+		n := numbers[label]
+		f.numbers[i] = n
+
+		m := reFootnoteDefLabel.FindString(f.Items[i])
+		if m == "" {
+			continue
+		}
+
+		num := "[" + strconv.Itoa(n) + "]"
+		f.Items[i] = num + f.Items[i][len(m):]
+		if i < len(f.Blocks) && len(f.Blocks[i]) > 0 {
+			if p, ok := f.Blocks[i][0].(*Paragraph); ok {
+				p.Text = num + strings.TrimPrefix(p.Text, m)
+			}
+		}
+	}
+}
+
+// sort sorts the footnote definitions by number.
+func (f *Footnotes) sort() {
+	order := make([]int, len(f.Items))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return f.numbers[order[a]] < f.numbers[order[b]] })
+
+	items := make([]string, len(f.Items))
+	blocks := make([][]Block, len(f.Blocks))
+	ids := make([]int, len(f.Items))
+	for i, j := range order {
+		items[i] = f.Items[j]
+		if j < len(f.Blocks) {
+			blocks[i] = f.Blocks[j]
+		}
+		ids[i] = f.numbers[j]
+	}
+	f.Items, f.Blocks, f.numbers = items, blocks, ids
+}
+
+func (h *HeadingBlock) rewriteText(f func(string) string) { h.Text = f(h.Text) }
+func (p *Paragraph) rewriteText(f func(string) string)    { p.Text = f(p.Text) }
+func (fig *Figure) rewriteText(f func(string) string)     { fig.Caption = f(fig.Caption) }
+func (a *Admonition) rewriteText(f func(string) string)   { a.Title, a.Text = f(a.Title), f(a.Text) }
+
+func (q *Blockquote) rewriteText(f func(string) string) {
+	q.Text, q.Attribution = f(q.Text), f(q.Attribution)
+}
+
+func (v *Verse) rewriteText(f func(string) string) {
+	for i := range v.Lines {
+		v.Lines[i] = f(v.Lines[i])
+	}
+}
+
+func (l *ListItems) rewriteText(f func(string) string) {
+	for i := range l.Items {
+		l.Items[i] = f(l.Items[i])
+		if i < len(l.Blocks) {
+			rewriteBlocks(l.Blocks[i], f)
+		}
+	}
+}
+
+func (l *DefinitionList) rewriteText(f func(string) string) {
+	for i := range l.Items {
+		d := &l.Items[i]
+		d.Term = f(d.Term)
+		for j := range d.Definitions {
+			d.Definitions[j] = f(d.Definitions[j])
+		}
+	}
+}
+
+func (t *Table) rewriteText(f func(string) string) {
+	for i := range t.Header {
+		t.Header[i] = f(t.Header[i])
+	}
+	for _, row := range t.Rows {
+		for i := range row {
+			row[i] = f(row[i])
+		}
+	}
+}
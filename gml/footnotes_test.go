@@ -0,0 +1,71 @@
+package gml
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNumberFootnotes(t *testing.T) {
+	doc, err := Parse("Set up[fn:setup] and run[fn:1], then[fn:x] again[fn:setup].\n\n%footnotes\n- [1] one\n- [x] ex\n- [setup] s /it/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "<p>Set up<a id=\"fnr.1\" href=\"#fn.1\"><sup>[1]</sup></a> and run<a id=\"fnr.2\" href=\"#fn.2\"><sup>[2]</sup></a>," +
+		" then<a id=\"fnr.3\" href=\"#fn.3\"><sup>[3]</sup></a> again<a id=\"fnr.1\" href=\"#fn.1\"><sup>[1]</sup></a>.</p>" +
+		"<footer><ol>" +
+		"<li id=\"fn.1\">[1] s <em>it</em> <a href=\"#fnr.1\">⮐</a></li>" +
+		"<li id=\"fn.2\">[2] one <a href=\"#fnr.2\">⮐</a></li>" +
+		"<li id=\"fn.3\">[3] ex <a href=\"#fnr.3\">⮐</a></li>" +
+		"</ol></footer>"
+	if got := doc.ExcerptHTML(10, &HTMLOptions{Minified: true}); got != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestMoveFootnotes(t *testing.T) {
+	doc, err := Parse("A[fn:b]\n\n%footnotes\n- [a] first\n\nB[fn:a]\n\n%footnotes\n- [b] second\n\n* End")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blocks := doc.BlocksHTML(&HTMLOptions{Minified: true})
+	want := "<footer><ol>" +
+		"<li id=\"fn.1\">[1] second <a href=\"#fnr.1\">⮐</a></li>" +
+		"<li id=\"fn.2\">[2] first <a href=\"#fnr.2\">⮐</a></li>" +
+		"</ol></footer>"
+	if len(blocks) != 4 || blocks[3] != want {
+		t.Errorf("want the footnotes last:\n%s\ngot:\n%s", want, strings.Join(blocks, "\n"))
+	}
+}
+
+func TestFootnoteErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"no definition", "Hi\n\n- a[fn:2]\n\n%footnotes\n- [1] one", "gml: line 3: footnote [fn:2] has no definition"},
+		{"no footnotes", "Hi[fn:note]", "gml: line 1: footnote [fn:note] has no definition"},
+		{"never referenced", "Hi[fn:1]\n\n%footnotes\n- [1] one\n  more\n- [2] two", "gml: line 6: footnote 2 is never referenced"},
+		{"defined twice", "Hi[fn:a]\n\n%footnotes\n- [a] one\n- [a] two", "gml: line 5: footnote a is defined more than once"},
+		{"first error", "Hi[fn:a]\n\n%footnotes\n- [b] one\n\nBye[fn:c]", "gml: line 1: footnote [fn:a] has no definition"},
+	}
+
+	for _, tt := range tests {
+		_, err := Parse(tt.input)
+		if err == nil {
+			t.Errorf("%s: want error %q", tt.name, tt.want)
+			continue
+		}
+
+		var perr *ParseError
+		if !errors.As(err, &perr) {
+			t.Errorf("%s: want a *ParseError; got %T", tt.name, err)
+		}
+		if err.Error() != tt.want {
+			t.Errorf("%s:\nwant:\t%q\n got:\t%q", tt.name, tt.want, err)
+		}
+	}
+}
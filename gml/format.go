@@ -0,0 +1,296 @@
+package gml
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FormatOptions controls how Format prints a document.
+type FormatOptions struct {
+	// Wrap re-wraps paragraphs and blockquotes to lines of at most this
+	// many characters. Zero keeps the line breaks as written.
+	Wrap int
+}
+
+// Format parses GML source and prints it in canonical form: metadata
+// in a fixed order, one blank line between blocks, renumbered ordered
+// lists, and no trailing whitespace. If opts is nil then the default
+// options are used instead.
+func Format(src string, opts *FormatOptions) (string, error) {
+	doc, err := parseSource(src)
+	if err != nil {
+		return "", err
+	}
+
+	if opts == nil {
+		opts = &FormatOptions{}
+	}
+
+	d := doc.(document)
+
+	var blocks []string
+	if m := d.metadata.gml(); m != "" {
+		blocks = append(blocks, m)
+	}
+
+	for _, b := range d.content {
+		blocks = append(blocks, formatBlock(b, opts))
+	}
+
+	if len(blocks) == 0 {
+		return "", nil
+	}
+
+	return strings.Join(blocks, "\n\n") + "\n", nil
+}
+
+func (m *metadata) gml() string {
+	var lines []string
+	if m.title != "" {
+		lines = append(lines, "%title "+m.title)
+	}
+	if m.subtitle != "" {
+		lines = append(lines, "%subtitle "+m.subtitle)
+	}
+	if !m.date.IsZero() {
+		lines = append(lines, "%date "+m.date.Format("2006-01-02"))
+	}
+	if m.author != "" {
+		lines = append(lines, "%author "+m.author)
+	}
+	if len(m.tags) > 0 {
+		lines = append(lines, "%tags "+strings.Join(m.tags, ", "))
+	}
+	if m.summary != "" {
+		lines = append(lines, "%summary "+m.summary)
+	}
+	if m.lang != "" {
+		lines = append(lines, "%lang "+m.lang)
+	}
+	for _, f := range m.extra {
+		lines = append(lines, "%"+f.key+" "+f.value)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func formatBlock(b Block, opts *FormatOptions) string {
+	switch b := b.(type) {
+	case *HeadingBlock:
+		text := strings.Repeat("*", b.Level) + " " + strings.TrimSpace(b.Text)
+		if b.ID != "" {
+			text += " {#" + b.ID + "}"
+		}
+		return text
+	case *Paragraph:
+		return formatText(b.Text, opts)
+	case *UnorderedList:
+		return formatItems(b.Items, func(int) string { return "- " })
+	case *OrderedList:
+		return formatItems(b.Items, func(i int) string { return fmt.Sprintf("%d. ", i+1) })
+	case *Footnotes:
+		return "%footnotes\n" + formatItems(b.Items, func(int) string { return "- " })
+	case *Admonition:
+		keyword := "%" + b.Kind
+		if b.Title != "" {
+			keyword += " " + b.Title
+		}
+		return keyword + "\n" + formatText(b.Text, opts)
+	case *CustomBlock:
+		keyword := strings.TrimSpace(b.Keyword + " " + b.Args)
+		if len(b.Lines) == 0 {
+			return keyword
+		}
+		return keyword + "\n" + strings.Join(b.Lines, "\n")
+	case *include:
+		return "%include " + b.args
+	case *Abbr:
+		return "%abbr " + b.Term + " " + b.Title
+	case *Comment:
+		if b.block {
+			return strings.TrimSpace("%comment "+b.args) + "\n" + b.Text
+		}
+		return b.Text
+	case *Verse:
+		return "%verse\n" + strings.Join(b.Lines, "\n") // Never wrapped
+	case *Blockquote:
+		keyword := strings.TrimSpace("%blockquote " + b.args)
+		text := formatText(b.Text, opts)
+		if b.Attribution != "" {
+			text += "\n-- " + b.Attribution
+		}
+		return keyword + "\n" + text
+	case *Figure:
+		lines := []string{strings.TrimSpace("%figure " + b.args), b.HTML}
+		if b.Caption != "" {
+			lines = append(lines, b.Caption)
+		}
+		return strings.Join(lines, "\n")
+	case *Table:
+		return "%table\n" + formatTable(b)
+	case *TOC:
+		if b.Depth > 0 {
+			return fmt.Sprintf("%%toc %d", b.Depth)
+		}
+		return "%toc"
+	case *DefinitionList:
+		var lines []string
+		for _, d := range b.Items {
+			for i, def := range d.Definitions {
+				term := d.Term
+				if i > 0 {
+					term = ""
+				}
+				lines = append(lines, strings.TrimSpace(term+" :: "+def))
+			}
+		}
+		return "%dl\n" + strings.Join(lines, "\n")
+	case *CSVTable:
+		return strings.TrimSpace(strings.TrimSpace("%csv "+b.args) + "\n" + b.text)
+	case *Pre:
+		return strings.TrimSpace("%pre "+b.args) + "\n" + b.Text // Verbatim
+	case *RawHTML:
+		return "%html\n" + b.Text // Verbatim
+	case *Embed:
+		return strings.TrimSpace(strings.TrimSpace("%embed "+b.args) + "\n" + formatText(b.Caption, opts))
+	case *Video:
+		return "%video " + b.args
+	case *AudioBlock:
+		return "%audio " + b.args
+	case *Math:
+		return "%math\n" + b.Text // Verbatim
+	default:
+		panic(fmt.Sprintf("gml: can't format %T", b))
+	}
+}
+
+// formatItems prints each list item after its marker, indenting any
+// continuation lines to line up with the item's text. List items are
+// never wrapped.
+func formatItems(items []string, marker func(i int) string) string {
+	lines := make([]string, len(items))
+	for i, item := range items {
+		m := marker(i)
+		indent := strings.Repeat(" ", len(m))
+
+		itemLines := strings.Split(strings.TrimSpace(item), "\n")
+		for j, line := range itemLines {
+			line = strings.TrimRight(line, " \t")
+			if j > 0 && line != "" {
+				line = indent + line
+			}
+			itemLines[j] = line
+		}
+
+		lines[i] = m + strings.Join(itemLines, "\n")
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// formatTable prints a table's rows with their columns lined up.
+func formatTable(t *Table) string {
+	rows := t.Rows
+	if t.Header != nil {
+		rows = append([][]string{t.Header}, rows...)
+	}
+
+	cols := len(t.Align)
+	for _, row := range rows {
+		if len(row) > cols {
+			cols = len(row)
+		}
+	}
+
+	width := make([]int, cols)
+	for i := range width {
+		width[i] = 3 // Room for "---"
+	}
+	for _, row := range rows {
+		for i, cell := range row {
+			if n := len([]rune(cell)); n > width[i] {
+				width[i] = n
+			}
+		}
+	}
+
+	line := func(cells []string) string {
+		var b strings.Builder
+		b.WriteString("|")
+		for i, w := range width {
+			var cell string
+			if i < len(cells) {
+				cell = cells[i]
+			}
+			fmt.Fprintf(&b, " %s%s |", cell, strings.Repeat(" ", w-len([]rune(cell))))
+		}
+		return b.String()
+	}
+
+	var lines []string
+	if t.Header != nil {
+		lines = append(lines, line(t.Header))
+	}
+
+	if t.Header != nil || t.Align != nil {
+		markers := make([]string, cols)
+		for i, w := range width {
+			var a string
+			if i < len(t.Align) {
+				a = t.Align[i]
+			}
+
+			switch a {
+			case "left":
+				markers[i] = ":" + strings.Repeat("-", w-1)
+			case "center":
+				markers[i] = ":" + strings.Repeat("-", w-2) + ":"
+			case "right":
+				markers[i] = strings.Repeat("-", w-1) + ":"
+			default:
+				markers[i] = strings.Repeat("-", w)
+			}
+		}
+		lines = append(lines, line(markers))
+	}
+
+	for _, row := range t.Rows {
+		lines = append(lines, line(row))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// formatText trims trailing whitespace from each line of text and
+// re-wraps it when opts.Wrap is set.
+func formatText(text string, opts *FormatOptions) string {
+	if opts.Wrap <= 0 {
+		lines := strings.Split(strings.TrimSpace(text), "\n")
+		for i, line := range lines {
+			lines[i] = strings.TrimRight(line, " \t")
+		}
+		return strings.Join(lines, "\n")
+	}
+
+	var (
+		b       strings.Builder
+		lineLen int
+	)
+	for i, word := range strings.Fields(text) {
+		n := len([]rune(word))
+		switch {
+		case i == 0:
+		case lineLen+1+n > opts.Wrap:
+			b.WriteString("\n")
+			lineLen = 0
+		default:
+			b.WriteString(" ")
+			lineLen++
+		}
+
+		b.WriteString(word)
+		lineLen += n
+	}
+
+	return b.String()
+}
@@ -0,0 +1,164 @@
+package gml
+
+import (
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		opts  *FormatOptions
+		want  string
+	}{
+		{
+			"metadata order",
+			"%date 2022-03-21\n%author me\n%title Hello\n",
+			nil,
+			"%title Hello\n%date 2022-03-21\n%author me\n",
+		},
+		{
+			"tags",
+			"%tags go,blogging\n%title Hello\n",
+			nil,
+			"%title Hello\n%tags go, blogging\n",
+		},
+		{
+			"other metadata",
+			"%series   Go tips\n%title Hello\n",
+			nil,
+			"%title Hello\n%series Go tips\n",
+		},
+		{
+			"blank lines and trailing space",
+			"%title Hello\n\n\n\n* Heading  \n\n\nfoo  \nbar\n\n\n",
+			nil,
+			"%title Hello\n\n* Heading\n\nfoo\nbar\n",
+		},
+		{
+			"named footnotes",
+			"Hi[fn:setup]\n\n%footnotes\n-  [setup] note\n",
+			nil,
+			"Hi[fn:setup]\n\n%footnotes\n- [setup] note\n",
+		},
+		{
+			"heading anchor",
+			"** Heading   {#anchor}\n",
+			nil,
+			"** Heading {#anchor}\n",
+		},
+		{
+			"lists",
+			"- a\n-   b\n\n3. x\n7. y\n",
+			nil,
+			"- a\n- b\n\n1. x\n2. y\n",
+		},
+		{
+			"blocks",
+			"%pre\n  indented  \n\n%figure href=\"/a.png\"\n<img src=\"/a.png\">\ncaption\n\n%footnotes\n- [1] note\n",
+			nil,
+			"%pre\n  indented  \n\n%figure href=\"/a.png\"\n<img src=\"/a.png\">\ncaption\n\n%footnotes\n- [1] note\n",
+		},
+		{
+			"table",
+			"%table\n|Name|Qty|\n|:-|-:|\n|apple|3|\n",
+			nil,
+			"%table\n| Name  | Qty |\n| :---- | --: |\n| apple | 3   |\n",
+		},
+		{
+			"multi-line list items",
+			"- a\n    b\n\n    c\n10. x\n  y\n",
+			nil,
+			"- a\n  b\n\n  c\n\n1. x\n   y\n",
+		},
+		{
+			"admonition",
+			"%warning   Careful\nhot  \nstove\n",
+			nil,
+			"%warning Careful\nhot\nstove\n",
+		},
+		{
+			"blockquote attribution",
+			"%blockquote   cite=https://example.com\nquote  \n--   someone\n",
+			nil,
+			"%blockquote cite=https://example.com\nquote\n-- someone\n",
+		},
+		{
+			"include",
+			"%include   shared/bio.gml\n",
+			nil,
+			"%include shared/bio.gml\n",
+		},
+		{
+			"comments",
+			";; TODO\n;; more\nText\n\n%comment draft\nnotes  \n",
+			nil,
+			";; TODO\n;; more\n\nText\n\n%comment draft\nnotes  \n",
+		},
+		{
+			"verse",
+			"%verse\na short line  \n   indented\n",
+			&FormatOptions{Wrap: 5},
+			"%verse\na short line\n   indented\n",
+		},
+		{
+			"math",
+			"%math\n\\sum_{i=1}^{n} i = \\frac{n(n+1)}{2}\n",
+			&FormatOptions{Wrap: 5},
+			"%math\n\\sum_{i=1}^{n} i = \\frac{n(n+1)}{2}\n",
+		},
+		{
+			"embed",
+			"%embed   https://youtu.be/x  title=\"A video\"\na  \ncaption\n",
+			nil,
+			"%embed https://youtu.be/x  title=\"A video\"\na\ncaption\n",
+		},
+		{
+			"video",
+			"%video clip.mp4   loop caption=\"A clip\"\n",
+			nil,
+			"%video clip.mp4   loop caption=\"A clip\"\n",
+		},
+		{
+			"audio",
+			"%audio   ep1.mp3 duration=42:10\n",
+			nil,
+			"%audio ep1.mp3 duration=42:10\n",
+		},
+		{
+			"toc",
+			"%toc   2\n\n* Heading\n",
+			nil,
+			"%toc 2\n\n* Heading\n",
+		},
+		{
+			"definition list",
+			"%dl\nterm::def\n  ::  more\n",
+			nil,
+			"%dl\nterm :: def\n:: more\n",
+		},
+		{
+			"wrap",
+			"one two three\nfour five six seven",
+			&FormatOptions{Wrap: 14},
+			"one two three\nfour five six\nseven\n",
+		},
+	}
+
+	for _, test := range tests {
+		got, err := Format(test.input, test.opts)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		if got != test.want {
+			t.Errorf("%s:\nwant:\t%q\n got:\t%q", test.name, test.want, got)
+		}
+
+		// Formatting is idempotent
+		if again, _ := Format(got, test.opts); again != got {
+			t.Errorf("%s: not idempotent:\nwant:\t%q\n got:\t%q", test.name, got, again)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package gml
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+)
+
+// Code in a %pre block with a language, e.g. "%pre go", is highlighted
+// with chroma. Each token is wrapped in a <span> with a class for its
+// type (e.g. "kd" for a keyword declaration) so the colors come from a
+// stylesheet that HighlightCSS generates.
+//
+// Code blocks may also number their lines ("linenos") and highlight
+// some of them ("hl=3-5,8"). Line numbers are hidden from screen
+// readers and highlighted lines are marked with <mark>.
+
+// codeOptions are the line options of a %pre block.
+type codeOptions struct {
+	lineNumbers bool
+	highlighted [][2]int // Inclusive ranges of lines to highlight
+}
+
+func (o codeOptions) isHighlighted(line int) bool {
+	for _, r := range o.highlighted {
+		if r[0] <= line && line <= r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// parseLineRanges parses line ranges like "3-5,8".
+func parseLineRanges(s string) ([][2]int, error) {
+	var ranges [][2]int
+	for _, part := range strings.Split(s, ",") {
+		from, to, isRange := strings.Cut(part, "-")
+		if !isRange {
+			to = from
+		}
+
+		start, err1 := strconv.Atoi(from)
+		end, err2 := strconv.Atoi(to)
+		if err1 != nil || err2 != nil || start < 1 || end < start {
+			return nil, fmt.Errorf("invalid line range %q", part)
+		}
+
+		ranges = append(ranges, [2]int{start, end})
+	}
+
+	return ranges, nil
+}
+
+// languageOf returns the language of the named file, or "" if it
+// isn't known.
+func languageOf(filename string) string {
+	lexer := lexers.Match(filename)
+	if lexer == nil {
+		return ""
+	}
+
+	return strings.ToLower(lexer.Config().Name)
+}
+
+// knownLanguage reports whether code in lang can be highlighted.
+func knownLanguage(lang string) bool {
+	return lexers.Get(lang) != nil
+}
+
+// highlight writes code as highlighted HTML. Without a language the
+// code is written as plain text, which is only needed for line options.
+func highlight(w io.Writer, code, lang string, opts codeOptions) error {
+	var tokens []chroma.Token
+
+	if lang == "" {
+		tokens = []chroma.Token{{Type: chroma.Text, Value: code}}
+	} else {
+		lexer := lexers.Get(lang)
+		if lexer == nil {
+			return fmt.Errorf("unknown language %q", lang)
+		}
+
+		it, err := chroma.Coalesce(lexer).Tokenise(nil, code)
+		if err != nil {
+			return err
+		}
+		tokens = it.Tokens()
+	}
+
+	var b strings.Builder
+	if lang == "" {
+		b.WriteString(`<pre class="chroma"><code>`)
+	} else {
+		fmt.Fprintf(&b, `<pre class="chroma"><code class="language-%s">`, escapeHTML(lang))
+	}
+
+	lines := chroma.SplitTokensIntoLines(tokens)
+	width := len(strconv.Itoa(len(lines)))
+
+	for i, line := range lines {
+		n := i + 1
+
+		tag := "span"
+		if opts.isHighlighted(n) {
+			tag = "mark"
+			b.WriteString(`<mark class="line hl">`)
+		} else {
+			b.WriteString(`<span class="line">`)
+		}
+
+		if opts.lineNumbers {
+			fmt.Fprintf(&b, `<span class="ln" aria-hidden="true">%*d</span>`, width, n)
+		}
+
+		b.WriteString(`<span class="cl">`)
+		for _, t := range line {
+			text := escapeHTML(t.Value)
+			if class := tokenClass(t.Type); class != "" {
+				fmt.Fprintf(&b, `<span class="%s">%s</span>`, class, text)
+			} else {
+				b.WriteString(text)
+			}
+		}
+		fmt.Fprintf(&b, `</span></%s>`, tag)
+	}
+
+	b.WriteString(`</code></pre>`)
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// tokenClass returns the CSS class chroma uses for a token type.
+func tokenClass(t chroma.TokenType) string {
+	for ; t != 0; t = t.Parent() {
+		if class, ok := chroma.StandardTypes[t]; ok {
+			return class
+		}
+	}
+
+	return ""
+}
+
+// HighlightCSS returns the stylesheet for highlighted code in the named
+// chroma style, e.g. "monokai" or "github".
+func HighlightCSS(style string) (string, error) {
+	s := styles.Get(style)
+	if s == styles.Fallback && !strings.EqualFold(style, styles.Fallback.Name) {
+		return "", fmt.Errorf("unknown highlight style %q", style)
+	}
+
+	var b strings.Builder
+	if err := chromahtml.New(chromahtml.WithClasses(true)).WriteCSS(&b, s); err != nil {
+		return "", err
+	}
+
+	return b.String(), nil
+}
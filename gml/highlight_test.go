@@ -0,0 +1,106 @@
+package gml
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHighlight(t *testing.T) {
+	doc, err := Parse("%pre go\nfunc main() {}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := doc.ExcerptHTML(1, nil)
+	for _, want := range []string{
+		`<pre class="chroma"><code class="language-go">`,
+		`<span class="kd">func</span>`,
+		`</code></pre>`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in:\n%s", want, got)
+		}
+	}
+
+	// Unknown languages fall back to plain text
+	doc, err = Parse("%pre nosuchlang\nx < y")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "<pre>x < y</pre>", doc.ExcerptHTML(1, nil); got != want {
+		t.Errorf("want: %q; got: %q", want, got)
+	}
+}
+
+func TestHighlightLines(t *testing.T) {
+	doc, err := Parse("%pre linenos hl=2-3\na\nb < c\nd\ne")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `<pre class="chroma"><code>` +
+		`<span class="line"><span class="ln" aria-hidden="true">1</span><span class="cl">a` + "\n" + `</span></span>` +
+		`<mark class="line hl"><span class="ln" aria-hidden="true">2</span><span class="cl">b &lt; c` + "\n" + `</span></mark>` +
+		`<mark class="line hl"><span class="ln" aria-hidden="true">3</span><span class="cl">d` + "\n" + `</span></mark>` +
+		`<span class="line"><span class="ln" aria-hidden="true">4</span><span class="cl">e</span></span>` +
+		`</code></pre>`
+	if got := doc.ExcerptHTML(1, nil); got != want {
+		t.Errorf("want: %q\n got: %q", want, got)
+	}
+
+	for _, input := range []string{"%pre hl=5-3\nx", "%pre hl=x\nx", "%pre go extra\nx", "%pre color=red\nx"} {
+		if _, err := Parse(input); err == nil {
+			t.Errorf("%q: want an error", input)
+		}
+	}
+}
+
+func TestCodeCaption(t *testing.T) {
+	doc, err := Parse("%pre file=main.go caption=\"The /entry/ point\"\nfunc main() {}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := doc.ExcerptHTML(1, nil)
+	for _, want := range []string{
+		"<figure class=\"code\">\n\t<figcaption><code class=\"filename\">main.go</code> The <em>entry</em> point</figcaption>\n\t<pre class=\"chroma\"><code class=\"language-go\">",
+		"</code></pre>\n</figure>",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in:\n%s", want, got)
+		}
+	}
+
+	doc, err = Parse("%pre caption=Output\nhello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "<figure class=\"code\"><figcaption>Output</figcaption><pre>hello</pre></figure>", doc.ExcerptHTML(1, &HTMLOptions{Minified: true}); got != want {
+		t.Errorf("want: %q; got: %q", want, got)
+	}
+}
+
+func TestParseArgs(t *testing.T) {
+	words, named := parseArgs(` go  linenos hl=3-5 caption="Hello, world" file=main.go`)
+	if want := []string{"go", "linenos"}; !reflect.DeepEqual(words, want) {
+		t.Errorf("want words %q; got %q", want, words)
+	}
+	if want := map[string]string{"hl": "3-5", "caption": "Hello, world", "file": "main.go"}; !reflect.DeepEqual(named, want) {
+		t.Errorf("want named %q; got %q", want, named)
+	}
+}
+
+func TestHighlightCSS(t *testing.T) {
+	css, err := HighlightCSS("monokai")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(css, ".chroma .kd") {
+		t.Errorf("missing keyword style in:\n%s", css)
+	}
+
+	if _, err := HighlightCSS("no-such-style"); err == nil {
+		t.Error("want an error for an unknown style")
+	}
+}
@@ -0,0 +1,59 @@
+package gml
+
+import (
+	"io"
+	"reflect"
+)
+
+// A site can change how some kinds of blocks are written without
+// forking GML by giving hooks for their types in HTMLOptions.Hooks:
+//
+//   opts := &gml.HTMLOptions{Hooks: map[string]gml.RenderHook{
+//   	"Figure": func(w io.Writer, b gml.Block, opts *gml.HTMLOptions) error {
+//   		io.WriteString(w, `<div class="frame">`)
+//   		b.WriteHTML(w, opts) // The usual <figure>
+//   		_, err := io.WriteString(w, `</div>`)
+//   		return err
+//   	},
+//   }}
+
+// RenderHook writes the block b as HTML in place of how it's usually
+// written. It may call b.WriteHTML to write it the usual way.
+type RenderHook func(w io.Writer, b Block, opts *HTMLOptions) error
+
+// WriteBlockHTML writes the block b as HTML to w the way a document
+// writes it, with the hook for its type if opts has one. It returns the
+// number of bytes written and the first error from the hook or from
+// writing to w.
+func WriteBlockHTML(w io.Writer, b Block, opts *HTMLOptions) (int, error) {
+	if opts == nil {
+		opts = &HTMLOptions{}
+	}
+
+	return writeBlock(w, b, opts)
+}
+
+// writeBlock writes b as HTML with the hook for its type, if any.
+func writeBlock(w io.Writer, b Block, opts *HTMLOptions) (int, error) {
+	hook := opts.Hooks[blockType(b)]
+	if hook == nil {
+		return b.WriteHTML(w, opts)
+	}
+
+	cw := &countingWriter{w: w}
+	if err := hook(cw, b, opts); err != nil {
+		return cw.n, err
+	}
+
+	return cw.n, cw.err
+}
+
+// blockType returns the name of the type of b, e.g. "Figure".
+func blockType(b Block) string {
+	t := reflect.TypeOf(b)
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	return t.Name()
+}
@@ -0,0 +1,59 @@
+package gml
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestHooks(t *testing.T) {
+	doc, err := Parse("* Intro\n\nHello.\n\n- one\n\n  nested\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := &HTMLOptions{Minified: true, Hooks: map[string]RenderHook{
+		"HeadingBlock": func(w io.Writer, b Block, opts *HTMLOptions) error {
+			h := b.(*HeadingBlock)
+			_, err := fmt.Fprintf(w, "<h%d>%s</h%d>", h.Level, h.Text, h.Level)
+			return err
+		},
+		"Paragraph": func(w io.Writer, b Block, opts *HTMLOptions) error {
+			io.WriteString(w, `<div class="p">`)
+			b.WriteHTML(w, opts)
+			_, err := io.WriteString(w, `</div>`)
+			return err
+		},
+	}}
+
+	want := `<h1>Intro</h1><div class="p"><p>Hello.</p></div>` +
+		`<ul><li><div class="p"><p>one</p></div><div class="p"><p>nested</p></div></li></ul>`
+	if got := doc.ExcerptHTML(3, opts); got != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+
+	hookErr := errors.New("hook failed")
+	opts.Hooks = map[string]RenderHook{
+		"Paragraph": func(io.Writer, Block, *HTMLOptions) error { return hookErr },
+	}
+	if _, err := doc.WriteHTML(io.Discard, opts); !errors.Is(err, hookErr) {
+		t.Errorf("want %v; got %v", hookErr, err)
+	}
+
+	// The list fails from the paragraphs nested in its item
+	if _, err := doc.WriteExcerptHTML(io.Discard, 3, opts); !errors.Is(err, hookErr) {
+		t.Errorf("excerpt: want %v; got %v", hookErr, err)
+	}
+	if got, want := doc.ExcerptHTML(3, opts), doc.ExcerptHTML(1, &HTMLOptions{Minified: true}); got != want {
+		t.Errorf("excerpt: want %q; got %q", want, got)
+	}
+	if got := doc.BlocksHTML(opts); len(got) != 1 {
+		t.Errorf("blocks: want only the heading; got %q", got)
+	}
+
+	list := doc.(document).content[2]
+	if _, err := WriteBlockHTML(io.Discard, list, opts); !errors.Is(err, hookErr) {
+		t.Errorf("block: want %v; got %v", hookErr, err)
+	}
+}
@@ -0,0 +1,92 @@
+package gml
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// "%include bio.gml" splices the blocks of another GML file into the
+// document where it's written, and "%include ad.html raw" splices in
+// a file as HTML. Paths are relative to the file they're written in
+// and read from the parser's file system (see ParseFS).
+
+// include is an %include kept in the document when files aren't read
+// so Format can write it back out.
+type include struct {
+	args string
+}
+
+func (i *include) WriteHTML(w io.Writer, opts *HTMLOptions) (int, error) {
+	return 0, nil
+}
+
+func (p *parser) parseInclude(token item) {
+	var name string
+	var raw bool
+	for _, arg := range strings.Fields(token.val) {
+		switch {
+		case arg == "raw":
+			raw = true
+		case name == "":
+			name = arg
+		default:
+			p.errorf("%%include: unexpected argument %q", arg)
+		}
+	}
+
+	if name == "" {
+		p.errorf("%%include: missing file name")
+	}
+	if text := p.collectItems(itemText); len(text) > 0 {
+		p.errorf("%%include doesn't take any text; got: %q", text[0])
+	}
+
+	if p.source {
+		p.doc.content = append(p.doc.content, &include{args: token.val})
+		return
+	}
+	if p.fsys == nil {
+		p.errorf("%%include: can't read %q without a file system (see ParseFS)", name)
+	}
+
+	file := path.Join(p.dir, name)
+	for _, f := range p.including {
+		if f == file {
+			p.errorf("%%include: %q includes itself: %s", name, strings.Join(append(p.including, file), " -> "))
+		}
+	}
+
+	b, err := fs.ReadFile(p.fsys, file)
+	if err != nil {
+		p.errorf("%%include: %v", err)
+	}
+
+	if raw {
+		p.doc.content = append(p.doc.content, &RawHTML{Text: strings.TrimRight(strings.TrimPrefix(normalizeNewlines(string(b)), byteOrderMark), "\n")})
+		return
+	}
+
+	sub := &parser{
+		fsys:      p.fsys,
+		source:    p.source,
+		dir:       path.Dir(file),
+		including: append(p.including[:len(p.including):len(p.including)], file),
+	}
+
+	doc, err := parse(string(b)+"\n", sub) // A keyword can't end the input
+	if err != nil {
+		var perr *ParseError
+		if errors.As(err, &perr) {
+			if perr.File == "" {
+				perr.File = file
+			}
+			panic(perr)
+		}
+		p.errorf("%%include %s: %v", name, err)
+	}
+
+	p.doc.content = append(p.doc.content, doc.(document).content...)
+}
@@ -0,0 +1,73 @@
+package gml
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestInclude(t *testing.T) {
+	fsys := fstest.MapFS{
+		"shared/bio.gml":    {Data: []byte("* About me {#bio}\n\nI /write/ things.\n\n%include links.gml\n")},
+		"shared/links.gml":  {Data: []byte("- [home](/)")},
+		"shared/ad.html":    {Data: []byte("<div class=\"ad\">Buy *this*</div>\n")},
+		"loop/a.gml":        {Data: []byte("%include b.gml\n")},
+		"loop/b.gml":        {Data: []byte("%include a.gml\n")},
+		"broken/error.gml":  {Data: []byte("ok\n\n%nope\n")},
+		"shared/table.gml":  {Data: []byte("%csv ../data.csv\n")},
+		"data.csv":          {Data: []byte("a,b\n1,2\n")},
+		"shared/empty.gml":  {Data: []byte("")},
+		"shared/titled.gml": {Data: []byte("%title Ignored\n\ntext\n")},
+	}
+
+	doc, err := ParseFS(fsys, "%title Post\n\nBefore\n\n%include shared/bio.gml\n\n%include shared/ad.html raw\n\nAfter")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "<p>Before</p>\n" +
+		"<h2 id=\"bio\" class=\"heading\">About me <a class=\"heading-ref\" href=\"#bio\">¶</a></h2>\n" +
+		"<p>I <em>write</em> things.</p>\n" +
+		"<ul>\n\t<li><a href=\"/\">home</a></li>\n</ul>\n" +
+		"<div class=\"ad\">Buy *this*</div>\n" +
+		"<p>After</p>"
+	if got := doc.ExcerptHTML(10, nil); got != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+	if got := doc.Title(); got != "Post" {
+		t.Errorf("want title %q; got %q", "Post", got)
+	}
+
+	doc, err = ParseFS(fsys, "%include shared/table.gml\n\n%include shared/titled.gml\n\n%include shared/empty.gml\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := doc.ExcerptHTML(10, &HTMLOptions{Minified: true}); !strings.Contains(got, "<td>1</td>") || !strings.HasSuffix(got, "<p>text</p>") {
+		t.Errorf("included files read relative paths wrong: %q", got)
+	}
+	if got := doc.Title(); got != "" {
+		t.Errorf("included metadata should be ignored; got title %q", got)
+	}
+
+	errTests := []struct {
+		input string
+		err   string
+	}{
+		{"%include loop/a.gml\n", `"a.gml" includes itself: loop/a.gml -> loop/b.gml -> loop/a.gml`},
+		{"%include missing.gml\n", "file does not exist"},
+		{"text\n\n%include broken/error.gml\n", `gml: broken/error.gml: line 3, col 1: unrecognized keyword: "%nope"`},
+		{"%include\n", "missing file name"},
+		{"%include a.gml\ntext\n", "doesn't take any text"},
+	}
+
+	for _, tt := range errTests {
+		_, err := ParseFS(fsys, tt.input)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%q: want error containing %q; got %v", tt.input, tt.err, err)
+		}
+	}
+
+	if _, err := Parse("%include shared/bio.gml\n"); err == nil {
+		t.Error("want an error without a file system")
+	}
+}
@@ -0,0 +1,489 @@
+package gml
+
+// The lexer leaves the text of paragraphs, list items, headings, and
+// blockquotes as-is. Styled text is scanned here when it is rendered:
+//
+//   /italic/  -> <em>italic</em>
+//   *bold*    -> <strong>bold</strong>
+//   ~code~    -> <code>code</code>
+//   +deleted+ -> <del>deleted</del>
+//   x^{2}     -> x<sup>2</sup>
+//   H_{2}O    -> H<sub>2</sub>O
+//
+//   [text](https://example.com) -> <a href="https://example.com">text</a>
+//   [[https://example.com]]     -> <a href="https://example.com">https://example.com</a>
+//   ![alt text](img/photo.jpg)  -> <img src="img/photo.jpg" alt="alt text">
+//   http://example.com/a.       -> <a href="http://example.com/a">http://example.com/a</a>.
+//   mailto:me@example.com       -> <a href="mailto:me@example.com">me@example.com</a>
+//   [[kbd:Ctrl+C]]              -> <kbd>Ctrl+C</kbd>
+//   $x^2$                       -> <span class="math inline">\(x^2\)</span>
+//
+// Like org-mode, a marker only opens a span at the start of a word
+// and only closes one at the end of a word, so "and/or" or "2*3*4"
+// are left alone. Superscripts and subscripts are the exception since
+// they're usually part of a word.
+//
+// "<", ">", and "&" are escaped so a stray "<" can't break the page.
+// With HTMLOptions.InlineHTML, HTML tags and entities are copied
+// verbatim instead and tags never contain styled text.
+//
+// A backslash before any ASCII punctuation writes it as-is, e.g.
+// "\*not bold\*" or "\<br>". That's also how a line can start with
+// something the lexer would read as a block, like "\% of users" or
+// "\- not a list", or "1\. not a list" for numbers.
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// emphasis maps each inline marker to the HTML element it renders as.
+var emphasis = map[byte]string{
+	'/': "em",
+	'*': "strong",
+	'~': "code",
+	'+': "del",
+}
+
+// scripts maps the marker of a superscript or subscript like "^{2}"
+// to the HTML element it renders as.
+var scripts = map[byte]string{
+	'^': "sup",
+	'_': "sub",
+}
+
+// renderInline writes the styled text s as HTML. If opts is nil then
+// the default options are used instead.
+func renderInline(s string, opts *HTMLOptions) string {
+	return renderSpans(s, false, opts)
+}
+
+// renderSpans writes the styled text s as HTML. Links can't be
+// nested, so inside a link's text (inLink) URLs and links are left
+// as text. Terms declared with %abbr are wrapped in <abbr> as they're
+// written.
+func renderSpans(s string, inLink bool, opts *HTMLOptions) string {
+	var b strings.Builder
+
+	if opts == nil {
+		opts = &HTMLOptions{}
+	}
+
+	plain := 0 // Terms aren't abbreviated in s before plain
+	for i := 0; i < len(s); {
+		c := s[i]
+
+		if c == '\\' && i+1 < len(s) && isASCIIPunct(s[i+1]) {
+			b.WriteString(escapeHTML(s[i+1 : i+2]))
+			i += 2
+			continue
+		}
+
+		if c == '<' {
+			if end := scanTag(s, i); end > 0 && opts.InlineHTML {
+				tag := s[i:end]
+				if opts.Sanitize {
+					tag = sanitizeTag(tag)
+				}
+				b.WriteString(tag)
+
+				// The text of an HTML link is already linked
+				if j := closeAnchor(s, i, end); j > 0 && !inLink {
+					b.WriteString(renderSpans(s[end:j], true, opts))
+					end = j
+				}
+
+				i = end
+				continue
+			} else if end > 0 {
+				plain = end // Escaped, but still a tag rather than text
+			}
+		}
+
+		if end := scanURL(s, i); end > 0 {
+			if inLink {
+				plain = end // Left as text, but still a URL
+			} else {
+				url := s[i:end]
+				fmt.Fprintf(&b, `<a%s>%s</a>`, opts.urlAttr("href", url), escapeHTML(strings.TrimPrefix(url, "mailto:")))
+				i = end
+				continue
+			}
+		}
+
+		if strings.HasPrefix(s[i:], "[fn:") {
+			if n, end := scanFootnoteRef(s, i); end > 0 {
+				fmt.Fprintf(&b, `<a id="%s" href="#%s"><sup>[%s]</sup></a>`, opts.id("fnr."+n), opts.id("fn."+n), n)
+				i = end
+				continue
+			}
+		}
+
+		if strings.HasPrefix(s[i:], "[[kbd:") {
+			if keys, end := scanKbd(s, i); end > 0 {
+				fmt.Fprintf(&b, `<kbd>%s</kbd>`, escapeHTML(keys))
+				i = end
+				continue
+			}
+		}
+
+		if c == '$' {
+			if tex, end := scanMath(s, i); end > 0 {
+				b.WriteString(mathHTML(tex, opts))
+				i = end
+				continue
+			}
+		}
+
+		if c == '!' && i+1 < len(s) && s[i+1] == '[' && !strings.HasPrefix(s[i+1:], "[[") {
+			if alt, src, end := scanLink(s, i+1); end > 0 {
+				fmt.Fprintf(&b, `<img%s alt="%s">`, opts.imageAttr("src", src), escapeHTML(alt))
+				i = end
+				continue
+			}
+		}
+
+		if c == '[' && !inLink {
+			if text, url, end := scanLink(s, i); end > 0 && text != "" {
+				fmt.Fprintf(&b, `<a%s>%s</a>`, opts.urlAttr("href", url), renderSpans(text, true, opts))
+				i = end
+				continue
+			}
+		}
+
+		if tag, ok := scripts[c]; ok {
+			if inner, end := scanScript(s, i); end > 0 {
+				fmt.Fprintf(&b, `<%s>%s</%s>`, tag, renderSpans(inner, inLink, opts), tag)
+				i = end
+				continue
+			}
+		}
+
+		if tag, ok := emphasis[c]; ok && opensSpan(s, i) {
+			if end := closeSpan(s, i); end > 0 {
+				inner := s[i+1 : end]
+				if c == '~' {
+					inner = escapeHTML(inner)
+				} else {
+					inner = renderSpans(inner, inLink, opts)
+				}
+
+				fmt.Fprintf(&b, `<%s>%s</%s>`, tag, inner, tag)
+				i = end + 1
+				continue
+			}
+		}
+
+		if len(opts.abbrs) > 0 && i >= plain && (i == 0 || !isWordByte(s[i-1])) {
+			if term := matchTerm(s[i:], opts.abbrs); term != "" {
+				fmt.Fprintf(&b, `<abbr title="%s">%s</abbr>`, escapeHTML(opts.abbrs[term]), term)
+				i += len(term)
+				continue
+			}
+		}
+
+		switch {
+		case c == '<' || c == '>':
+			b.WriteString(escapeHTML(s[i : i+1]))
+		case c == '&' && !opts.InlineHTML:
+			b.WriteString("&amp;")
+		default:
+			b.WriteByte(c)
+		}
+		i++
+	}
+
+	return b.String()
+}
+
+// scanTag returns the index just past the HTML tag or comment that
+// starts at s[i], or -1 if there isn't one.
+func scanTag(s string, i int) int {
+	if i+1 >= len(s) {
+		return -1
+	}
+
+	if strings.HasPrefix(s[i:], "<!--") {
+		if j := strings.Index(s[i:], "-->"); j > 0 {
+			return i + j + len("-->")
+		}
+		return -1
+	}
+
+	if c := s[i+1]; !(c == '/' || c == '!' || isASCIILetter(c)) {
+		return -1 // e.g. "a < b"
+	}
+
+	if j := strings.IndexByte(s[i:], '>'); j > 0 {
+		return i + j + 1
+	}
+
+	return -1
+}
+
+// scanLink scans a link like "[text](url)" or "[[url]]" at s[i] and
+// returns its text, URL, and the index just past it. The text of a
+// "[[url]]" link is its URL. The text may be empty, as it is for the
+// alt text of a decorative image.
+func scanLink(s string, i int) (text, url string, end int) {
+	if strings.HasPrefix(s[i:], "[[") {
+		j := strings.Index(s[i:], "]]")
+		if j < 0 {
+			return "", "", -1
+		}
+
+		url = s[i+2 : i+j]
+		if url == "" || strings.ContainsAny(url, " \t\n[") {
+			return "", "", -1
+		}
+
+		return url, url, i + j + 2
+	}
+
+	// Find the closing bracket, allowing nested images in the text
+	j, depth := i+1, 1
+	for ; j < len(s) && depth > 0; j++ {
+		switch s[j] {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		}
+	}
+	if depth > 0 || j >= len(s) || s[j] != '(' {
+		return "", "", -1
+	}
+	text = s[i+1 : j-1]
+
+	// Find the closing parenthesis, allowing balanced ones in the URL
+	// like Wikipedia's "Go_(programming_language)"
+	k, depth := j+1, 1
+	for ; k < len(s); k++ {
+		if s[k] == '(' {
+			depth++
+		} else if s[k] == ')' {
+			if depth--; depth == 0 {
+				break
+			}
+		}
+	}
+	if depth > 0 {
+		return "", "", -1
+	}
+
+	url = s[j+1 : k]
+	if url == "" || strings.ContainsAny(url, " \t\n") {
+		return "", "", -1
+	}
+
+	return text, url, k + 1
+}
+
+// scanKbd scans keyboard input like "[[kbd:Ctrl+C]]" at s[i] and
+// returns the keys and the index just past it.
+func scanKbd(s string, i int) (string, int) {
+	if !strings.HasPrefix(s[i:], "[[kbd:") {
+		return "", -1
+	}
+
+	start := i + len("[[kbd:")
+	j := strings.Index(s[start:], "]]")
+	if j <= 0 || strings.Contains(s[start:start+j], "\n") {
+		return "", -1
+	}
+
+	return s[start : start+j], start + j + 2
+}
+
+// urlSchemes are the schemes of the raw URLs that are linked.
+var urlSchemes = []string{"https://", "http://", "mailto:"}
+
+// scanURL returns the index just past the raw URL that starts at s[i],
+// or -1 if there isn't one. Punctuation at the end, like the period
+// ending a sentence or a closing parenthesis without an opening one,
+// isn't part of the URL.
+func scanURL(s string, i int) int {
+	start := -1
+	for _, scheme := range urlSchemes {
+		if strings.HasPrefix(s[i:], scheme) {
+			start = i + len(scheme)
+			break
+		}
+	}
+	if start < 0 {
+		return -1
+	}
+
+	end := start
+	for end < len(s) && !isSpaceByte(s[end]) && s[end] != '<' {
+		end++
+	}
+
+	for end > start {
+		c := s[end-1]
+		switch {
+		case strings.IndexByte(".,:;!?'\"*~", c) >= 0:
+		case c == ')' && strings.Count(s[i:end], ")") > strings.Count(s[i:end], "("):
+		case c == ']' && strings.Count(s[i:end], "]") > strings.Count(s[i:end], "["):
+		default:
+			return end
+		}
+		end--
+	}
+
+	return -1
+}
+
+// closeAnchor returns the index of the "</a>" closing the HTML link
+// whose opening tag is s[i:end], or -1 if s[i:end] isn't an <a> tag or
+// it isn't closed.
+func closeAnchor(s string, i, end int) int {
+	if end-i < 3 || !strings.EqualFold(s[i:i+2], "<a") || !(s[i+2] == '>' || isSpaceByte(s[i+2])) {
+		return -1
+	}
+
+	for j := end; j+4 <= len(s); j++ {
+		if s[j] == '<' && strings.EqualFold(s[j:j+4], "</a>") {
+			return j
+		}
+	}
+
+	return -1
+}
+
+// scanFootnoteRef scans a footnote reference like "[fn:1]" at s[i]
+// and returns its number and the index just past it.
+func scanFootnoteRef(s string, i int) (string, int) {
+	start := i + len("[fn:")
+	end := start
+	for end < len(s) && '0' <= s[end] && s[end] <= '9' {
+		end++
+	}
+
+	if end == start || end >= len(s) || s[end] != ']' {
+		return "", -1
+	}
+
+	return s[start:end], end + 1
+}
+
+// scanScript scans a superscript or subscript like "^{2}" at s[i] and
+// returns its text and the index just past it. The text can't be
+// empty or span lines.
+func scanScript(s string, i int) (string, int) {
+	if i+1 >= len(s) || s[i+1] != '{' {
+		return "", -1
+	}
+
+	j := strings.IndexAny(s[i+2:], "}\n")
+	if j <= 0 || s[i+2+j] != '}' {
+		return "", -1
+	}
+
+	return s[i+2 : i+2+j], i + 2 + j + 1
+}
+
+// opensSpan reports whether the marker at s[i] can open a span: it
+// must start a word and be followed by text.
+func opensSpan(s string, i int) bool {
+	if i+1 >= len(s) || isSpaceByte(s[i+1]) {
+		return false
+	}
+
+	return i == 0 || strings.IndexByte(" \t\n([{\"'-", s[i-1]) >= 0
+}
+
+// closeSpan returns the index of the marker closing the span opened
+// at s[i], or -1 if it isn't closed. Spans can't be empty and the
+// closing marker must end a word. Tags, URLs, and links are skipped
+// over (except in code) so a slash in "</a>", a URL, or math never
+// closes a span.
+func closeSpan(s string, i int) int {
+	marker := s[i]
+
+	for j := i + 2; j < len(s); j++ {
+		if marker != '~' {
+			if s[j] == '\\' && j+1 < len(s) && isASCIIPunct(s[j+1]) {
+				j++ // Escaped
+				continue
+			}
+
+			if end := scanTag(s, j); s[j] == '<' && end > 0 {
+				j = end - 1
+				continue
+			}
+
+			if end := scanURL(s, j); end > 0 {
+				j = end - 1
+				continue
+			}
+
+			if _, end := scanKbd(s, j); end > 0 {
+				j = end - 1
+				continue
+			}
+
+			if _, end := scanMath(s, j); s[j] == '$' && end > 0 {
+				j = end - 1
+				continue
+			}
+
+			if _, _, end := scanLink(s, j); s[j] == '[' && end > 0 {
+				j = end - 1
+				continue
+			}
+		}
+
+		if s[j] != marker || isSpaceByte(s[j-1]) {
+			continue
+		}
+
+		if j+1 == len(s) || strings.IndexByte(" \t\n-.,:;!?'\")]}[", s[j+1]) >= 0 {
+			return j
+		}
+	}
+
+	return -1
+}
+
+var reTag = regexp.MustCompile(`<[^>]*>`)
+
+// plainText renders the styled text s without any markup or footnote
+// references, e.g. for a description.
+func plainText(s string) string {
+	s = reFootnoteRef.ReplaceAllString(s, "")
+	s = reTag.ReplaceAllString(renderInline(s, nil), "")
+	return strings.Join(strings.Fields(unescapeHTML(s)), " ")
+}
+
+// unescapeHTML undoes escapeHTML.
+var unescapeHTML = strings.NewReplacer(
+	"&amp;", "&",
+	"&lt;", "<",
+	"&gt;", ">",
+	"&#34;", `"`,
+	"&#39;", "'",
+).Replace
+
+// escapeHTML escapes the characters that are special in HTML text
+// and attribute values.
+var escapeHTML = strings.NewReplacer(
+	"&", "&amp;",
+	"<", "&lt;",
+	">", "&gt;",
+	`"`, "&#34;",
+	"'", "&#39;",
+).Replace
+
+func isSpaceByte(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n'
+}
+
+func isASCIIPunct(c byte) bool {
+	return strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", c) >= 0
+}
+
+func isASCIILetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
@@ -0,0 +1,83 @@
+package gml
+
+import "testing"
+
+func TestRenderInline(t *testing.T) {
+	tests := []struct {
+		name, input, want string
+	}{
+		{"italic", "this is /my/ language", "this is <em>my</em> language"},
+		{"bold", "*markup language*!", "<strong>markup language</strong>!"},
+		{"code", "called ~a < b~", "called <code>a &lt; b</code>"},
+		{"code is literal", "~*not bold*~", "<code>*not bold*</code>"},
+		{"deleted", "it's +free+ $5", "it's <del>free</del> $5"},
+		{"not deleted", "C++ and 1 + 2 or +1 and +2", "C++ and 1 + 2 or +1 and +2"},
+		{"superscript", "E = mc^{2} and 2^{/n/}", "E = mc<sup>2</sup> and 2<sup><em>n</em></sup>"},
+		{"subscript", "H_{2}O", "H<sub>2</sub>O"},
+		{"not scripts", "snake_case_name x^2 a_{} b^{\n}", "snake_case_name x^2 a_{} b^{\n}"},
+		{"nested", "*bold /and italic/*", "<strong>bold <em>and italic</em></strong>"},
+		{"spans lines", "/one\ntwo/", "<em>one\ntwo</em>"},
+		{"in parentheses", "(/aside/)", "(<em>aside</em>)"},
+		{"mid-word", "and/or 2*3*4 x~y~", "and/or 2*3*4 x~y~"},
+		{"unclosed", "/open and * alone", "/open and * alone"},
+		{"space before close", "/not italic /", "/not italic /"},
+		{"html is escaped", "<em>my</em> & </a>", "&lt;em&gt;my&lt;/em&gt; &amp; &lt;/a&gt;"},
+		{"stray brackets", "a < b > c", "a &lt; b &gt; c"},
+		{"urls", "/visit https://example.com/a/ now/", "<em>visit <a href=\"https://example.com/a/\">https://example.com/a/</a> now</em>"},
+		{"http urls", "http://example.com/", "<a href=\"http://example.com/\">http://example.com/</a>"},
+		{"mailto", "write mailto:me@example.com.", "write <a href=\"mailto:me@example.com\">me@example.com</a>."},
+		{"trailing punctuation", "see https://example.com/a?b=1&c=2, or (https://en.wikipedia.org/wiki/Go_(game)).",
+			"see <a href=\"https://example.com/a?b=1&amp;c=2\">https://example.com/a?b=1&amp;c=2</a>, or (<a href=\"https://en.wikipedia.org/wiki/Go_(game)\">https://en.wikipedia.org/wiki/Go_(game)</a>)."},
+		{"url in span", "*at https://example.com*", "<strong>at <a href=\"https://example.com\">https://example.com</a></strong>"},
+		{"not urls", "https:// and mailto: and xhttp", "https:// and mailto: and xhttp"},
+		{"footnote", "*bold*[fn:2]", "<strong>bold</strong><a id=\"fnr.2\" href=\"#fn.2\"><sup>[2]</sup></a>"},
+		{"link", "Click [here](https://example.com)!", "Click <a href=\"https://example.com\">here</a>!"},
+		{"link with parens", "([Go](https://en.wikipedia.org/wiki/Go_(programming_language)))",
+			"(<a href=\"https://en.wikipedia.org/wiki/Go_(programming_language)\">Go</a>)"},
+		{"styled link", "[*bold* text](/about/)", "<a href=\"/about/\"><strong>bold</strong> text</a>"},
+		{"bare link", "see [[https://example.com]]", "see <a href=\"https://example.com\">https://example.com</a>"},
+		{"link in span", "/see [x](/a/b/)/", "<em>see <a href=\"/a/b/\">x</a></em>"},
+		{"link url is escaped", "[x](/?a=1&b=\"2\")", "<a href=\"/?a=1&amp;b=&#34;2&#34;\">x</a>"},
+		{"not a link", "[x] (y) [z](a b) []()", "[x] (y) [z](a b) []()"},
+		{"image", "a ![small icon](img/icon.png) here", "a <img src=\"img/icon.png\" alt=\"small icon\"> here"},
+		{"image alt is escaped", "![\"quoted\" <b>](x.png)", "<img src=\"x.png\" alt=\"&#34;quoted&#34; &lt;b&gt;\">"},
+		{"decorative image", "![](x.png)", "<img src=\"x.png\" alt=\"\">"},
+		{"image link", "[![logo](logo.png)](/)", "<a href=\"/\"><img src=\"logo.png\" alt=\"logo\"></a>"},
+		{"kbd", "press [[kbd:Ctrl+C]] or [[kbd:<Enter>]]", "press <kbd>Ctrl+C</kbd> or <kbd>&lt;Enter&gt;</kbd>"},
+		{"kbd in span", "+use [[kbd:Ctrl + C]]+", "<del>use <kbd>Ctrl + C</kbd></del>"},
+		{"math", "if $a<b$ then $\\alpha_{1}$", "if <span class=\"math inline\">\\(a&lt;b\\)</span> then <span class=\"math inline\">\\(\\alpha_{1}\\)</span>"},
+		{"math in span", "/where $x/2$ is/", "<em>where <span class=\"math inline\">\\(x/2\\)</span> is</em>"},
+		{"not math", "$5 or $10 and $5-$10", "$5 or $10 and $5-$10"},
+		{"escaped math", "\\$x$ and $ y$", "$x$ and $ y$"},
+		{"not kbd", "[[kbd:a\nb]]", "[[kbd:a\nb]]"},
+		{"not an image", "wow! [[x]] !(y)", "wow! <a href=\"x\">x</a> !(y)"},
+		{"escapes", `\*not bold\* \/not em/ \[fn:1] \\`, `*not bold* /not em/ [fn:1] \`},
+		{"escaped html", `\<br>`, "&lt;br&gt;"},
+		{"escape in span", `*a \* b*`, "<strong>a * b</strong>"},
+		{"not an escape", `C:\Users \1`, `C:\Users \1`},
+	}
+
+	for _, test := range tests {
+		if got := renderInline(test.input, nil); got != test.want {
+			t.Errorf("%s:\nwant:\t%q\n got:\t%q", test.name, test.want, got)
+		}
+	}
+}
+
+func TestRenderInlineHTML(t *testing.T) {
+	tests := []struct {
+		name, input, want string
+	}{
+		{"html is verbatim", "<em>my</em> &mdash; </a>", "<em>my</em> &mdash; </a>"},
+		{"tags don't close spans", "/see <a href=\"/x/\">x</a>/", "<em>see <a href=\"/x/\">x</a></em>"},
+		{"url in html link", "<a href=\"https://example.com\">https://example.com /here/</a>", "<a href=\"https://example.com\">https://example.com <em>here</em></a>"},
+		{"stray brackets", "a < b", "a &lt; b"},
+		{"escaped html", `\<br>`, "&lt;br&gt;"},
+	}
+
+	for _, test := range tests {
+		if got := renderInline(test.input, &HTMLOptions{InlineHTML: true}); got != test.want {
+			t.Errorf("%s:\nwant:\t%q\n got:\t%q", test.name, test.want, got)
+		}
+	}
+}
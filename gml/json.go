@@ -0,0 +1,308 @@
+package gml
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// A parsed document can be written as JSON for tools that don't read
+// GML themselves, like editors or renderers in other languages. Each
+// block is an object with its "type", the name of its Go type, and its
+// fields:
+//
+//   {
+//     "title": "Hello",
+//     "blocks": [
+//       {"type": "HeadingBlock", "level": 1, "text": "Intro", "anchor": "intro"},
+//       {"type": "UnorderedList", "items": ["one", "two"]}
+//     ]
+//   }
+//
+// Styled text is kept as it's written. UnmarshalDocument reads the JSON
+// back into a Document that renders the same as the one it came from.
+
+// documentJSON is the JSON of a document.
+type documentJSON struct {
+	Title    string            `json:"title,omitempty"`
+	Subtitle string            `json:"subtitle,omitempty"`
+	Date     *time.Time        `json:"date,omitempty"`
+	Author   string            `json:"author,omitempty"`
+	Tags     []string          `json:"tags,omitempty"`
+	Summary  string            `json:"summary,omitempty"`
+	Lang     string            `json:"lang,omitempty"`
+	Meta     []metaFieldJSON   `json:"meta,omitempty"`
+	Abbrs    []abbrJSON        `json:"abbrs,omitempty"`
+	Blocks   []json.RawMessage `json:"blocks"`
+}
+
+// abbrJSON is an %abbr declaration and the index of the first block
+// it applies to.
+type abbrJSON struct {
+	Abbr
+	Block int `json:"block"`
+}
+
+type metaFieldJSON struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// MarshalJSON writes the document's metadata and blocks as JSON.
+func (d document) MarshalJSON() ([]byte, error) {
+	blocks, err := marshalBlocks(d.content)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := documentJSON{
+		Title:    d.title,
+		Subtitle: d.subtitle,
+		Author:   d.author,
+		Tags:     d.tags,
+		Summary:  d.summary,
+		Lang:     d.lang,
+		Blocks:   blocks,
+	}
+	if !d.date.IsZero() {
+		doc.Date = &d.date
+	}
+	for _, f := range d.extra {
+		doc.Meta = append(doc.Meta, metaFieldJSON{f.key, f.value})
+	}
+	for _, a := range d.abbrs {
+		doc.Abbrs = append(doc.Abbrs, abbrJSON{a.Abbr, a.block})
+	}
+
+	return json.Marshal(doc)
+}
+
+// UnmarshalDocument reads a document from the JSON written by its
+// MarshalJSON method. Custom blocks are parsed again from their
+// arguments and lines, so their keywords must be registered.
+func UnmarshalDocument(data []byte) (Document, error) {
+	var d document
+	if err := json.Unmarshal(data, &d); err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+func (d *document) UnmarshalJSON(data []byte) error {
+	var doc documentJSON
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+
+	content, err := unmarshalBlocks(doc.Blocks)
+	if err != nil {
+		return err
+	}
+
+	*d = document{content: content}
+	d.title, d.subtitle, d.author = doc.Title, doc.Subtitle, doc.Author
+	d.tags, d.summary, d.lang = doc.Tags, doc.Summary, doc.Lang
+	if doc.Date != nil {
+		d.date = *doc.Date
+	}
+	for _, f := range doc.Meta {
+		d.extra = append(d.extra, metaField{f.Key, f.Value})
+	}
+	for _, a := range doc.Abbrs {
+		d.abbrs = append(d.abbrs, declaredAbbr{a.Abbr, a.Block})
+	}
+
+	assignAnchors(d.content)
+	return nil
+}
+
+// blockTypes makes an empty block of each type by its name.
+var blockTypes = map[string]func() Block{
+	"HeadingBlock":   func() Block { return &HeadingBlock{} },
+	"UnorderedList":  func() Block { return &UnorderedList{} },
+	"OrderedList":    func() Block { return &OrderedList{} },
+	"Paragraph":      func() Block { return &Paragraph{} },
+	"Figure":         func() Block { return &Figure{} },
+	"Pre":            func() Block { return &Pre{} },
+	"RawHTML":        func() Block { return &RawHTML{} },
+	"Blockquote":     func() Block { return &Blockquote{} },
+	"Admonition":     func() Block { return &Admonition{} },
+	"Verse":          func() Block { return &Verse{} },
+	"Comment":        func() Block { return &Comment{} },
+	"Table":          func() Block { return &Table{} },
+	"DefinitionList": func() Block { return &DefinitionList{} },
+	"CSVTable":       func() Block { return &CSVTable{} },
+	"Footnotes":      func() Block { return &Footnotes{} },
+	"TOC":            func() Block { return &TOC{} },
+	"Abbr":           func() Block { return &Abbr{} },
+	"Math":           func() Block { return &Math{} },
+	"Embed":          func() Block { return &Embed{} },
+	"Video":          func() Block { return &Video{} },
+	"AudioBlock":     func() Block { return &AudioBlock{} },
+	"CustomBlock":    func() Block { return &CustomBlock{} },
+}
+
+// blockExtraJSON is the state of a block that isn't in its exported
+// fields but is needed to render it the same way.
+type blockExtraJSON struct {
+	Anchor      string   `json:"anchor,omitempty"`       // HeadingBlock
+	LineNumbers bool     `json:"line_numbers,omitempty"` // Pre
+	Highlight   [][2]int `json:"highlight,omitempty"`    // Pre
+	Numbers     []int    `json:"numbers,omitempty"`      // Footnotes
+}
+
+// marshalBlock writes the block as a JSON object of its type followed
+// by its fields.
+func marshalBlock(b Block) (json.RawMessage, error) {
+	fields, err := json.Marshal(b)
+	if err != nil {
+		return nil, err
+	}
+
+	var extra blockExtraJSON
+	switch b := b.(type) {
+	case *HeadingBlock:
+		extra.Anchor = b.anchor
+	case *Pre:
+		extra.LineNumbers, extra.Highlight = b.lineNumbers, b.highlighted
+	case *Footnotes:
+		extra.Numbers = b.numbers
+	}
+	more, err := json.Marshal(extra)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `{"type":%q`, blockType(b))
+	for _, obj := range [][]byte{fields, more} {
+		if obj = bytes.TrimSpace(obj[1 : len(obj)-1]); len(obj) > 0 {
+			buf.WriteByte(',')
+			buf.Write(obj)
+		}
+	}
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+// unmarshalBlock reads a block from the JSON written by marshalBlock.
+func unmarshalBlock(data []byte) (Block, error) {
+	var head struct {
+		Type string `json:"type"`
+		blockExtraJSON
+	}
+	if err := json.Unmarshal(data, &head); err != nil {
+		return nil, err
+	}
+
+	newBlock, ok := blockTypes[head.Type]
+	if !ok {
+		return nil, fmt.Errorf("gml: unknown block type %q", head.Type)
+	}
+
+	b := newBlock()
+	if err := json.Unmarshal(data, b); err != nil {
+		return nil, fmt.Errorf("gml: %s: %w", head.Type, err)
+	}
+
+	switch b := b.(type) {
+	case *HeadingBlock:
+		b.anchor = head.Anchor
+	case *Pre:
+		b.lineNumbers, b.highlighted = head.LineNumbers, head.Highlight
+	case *Footnotes:
+		b.numbers = head.Numbers
+	case *CSVTable:
+		if b.Table == nil {
+			b.Table = &Table{}
+		}
+	case *CustomBlock:
+		c, ok := lookupBlock(b.Keyword)
+		if !ok {
+			return nil, fmt.Errorf("gml: unregistered block keyword %q", b.Keyword)
+		}
+
+		value, err := c.parse(b.Args, b.Lines)
+		if err != nil {
+			return nil, fmt.Errorf("gml: %s: %v", b.Keyword, err)
+		}
+		b.Value, b.render = value, c.render
+	}
+
+	return b, nil
+}
+
+func marshalBlocks(blocks []Block) ([]json.RawMessage, error) {
+	raw := make([]json.RawMessage, len(blocks))
+	for i, b := range blocks {
+		var err error
+		if raw[i], err = marshalBlock(b); err != nil {
+			return nil, err
+		}
+	}
+
+	return raw, nil
+}
+
+func unmarshalBlocks(raw []json.RawMessage) ([]Block, error) {
+	blocks := make([]Block, len(raw))
+	for i, data := range raw {
+		var err error
+		if blocks[i], err = unmarshalBlock(data); err != nil {
+			return nil, err
+		}
+	}
+
+	return blocks, nil
+}
+
+// listItemsJSON is the JSON of the items of a list. The blocks of an
+// item are null when it's only text.
+type listItemsJSON struct {
+	Items  []string            `json:"items"`
+	Blocks [][]json.RawMessage `json:"blocks,omitempty"`
+}
+
+func (l ListItems) MarshalJSON() ([]byte, error) {
+	items := listItemsJSON{Items: l.Items}
+	for i, blocks := range l.Blocks {
+		if blocks == nil {
+			continue
+		}
+		if items.Blocks == nil {
+			items.Blocks = make([][]json.RawMessage, len(l.Blocks))
+		}
+
+		var err error
+		if items.Blocks[i], err = marshalBlocks(blocks); err != nil {
+			return nil, err
+		}
+	}
+
+	return json.Marshal(items)
+}
+
+func (l *ListItems) UnmarshalJSON(data []byte) error {
+	var items listItemsJSON
+	if err := json.Unmarshal(data, &items); err != nil {
+		return err
+	}
+
+	l.Items = items.Items
+	l.Blocks = make([][]Block, len(items.Items))
+	for i, raw := range items.Blocks {
+		if raw == nil || i >= len(l.Blocks) {
+			continue
+		}
+
+		var err error
+		if l.Blocks[i], err = unmarshalBlocks(raw); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,85 @@
+package gml
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestJSON(t *testing.T) {
+	input := `%title Hello
+%date 2006-01-02
+%tags go, gml
+%license CC-BY
+
+* Intro
+
+%abbr GML Gutenblog Markup Language
+
+Some /styled/ GML text.[fn:a]
+
+- one
+- two
+
+  %pre go hl=1 linenos
+  fmt.Println("hi")
+
+%figure id=cat href=https://example.com
+<img src="cat.jpg">
+A cat.
+
+%table
+| A | B |
+| :-- | --: |
+| 1 | 2 |
+
+%note
+Careful.
+
+%audio ep.mp3 duration=1:30
+
+%footnotes
+- [a] A note.`
+
+	doc, err := Parse(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		`"title":"Hello"`,
+		`{"type":"HeadingBlock","level":1,"text":"Intro","anchor":"intro"}`,
+		`"meta":[{"key":"license","value":"CC-BY"}]`,
+		`{"type":"UnorderedList","items":["one","two\n\n%pre go hl=1 linenos\nfmt.Println(\"hi\")"],"blocks":[null,[`,
+		`"mime_type":"audio/mpeg"`,
+		`"abbrs":[{"term":"GML","title":"Gutenblog Markup Language","block":1}]`,
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("want JSON to contain %s; got:\n%s", want, data)
+		}
+	}
+
+	got, err := UnmarshalDocument(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(got.HTML(nil), `<abbr title="Gutenblog Markup Language">GML</abbr>`) {
+		t.Errorf("want the abbreviations kept; got:\n%s", got.HTML(nil))
+	}
+	if got.HTML(nil) != doc.HTML(nil) {
+		t.Errorf("want HTML:\n%s\ngot:\n%s", doc.HTML(nil), got.HTML(nil))
+	}
+	if got.Meta("license") != "CC-BY" || !got.Date().Equal(doc.Date()) {
+		t.Errorf("want metadata of %s; got %q, %v", data, got.Meta("license"), got.Date())
+	}
+
+	if _, err := UnmarshalDocument([]byte(`{"blocks":[{"type":"Marquee"}]}`)); err == nil {
+		t.Error("want error for an unknown block type")
+	}
+}
@@ -0,0 +1,486 @@
+package gml
+
+import (
+	"strconv"
+	"strings"
+
+	nethtml "golang.org/x/net/html"
+)
+
+// A document can also be written as a LaTeX article to typeset it as a
+// PDF, e.g. with pdflatex. Headings are sections, "*" being \section,
+// styled text is \emph, \textbf, \texttt, and so on, links are \href,
+// and footnotes are \footnote where they're first referenced:
+//
+//   * Setup             -> \section{Setup}\label{setup}
+//   /Read/ the [docs](https://go.dev/doc/).[fn:1]
+//                       -> \emph{Read} the \href{https://go.dev/doc/}{docs}.\footnote{...}
+//
+// Figures are floats showing their first image, code is verbatim, and
+// %math is display math. HTML has no LaTeX to map to, so only the text
+// of %html blocks is kept, and %comment blocks are left out.
+
+// latexPreamble starts a LaTeX document with the packages its body
+// needs.
+const latexPreamble = `\documentclass{article}
+\usepackage[T1]{fontenc}
+\usepackage{amsmath,amssymb}
+\usepackage{graphicx}
+\usepackage[normalem]{ulem}
+\usepackage{hyperref}
+`
+
+// LaTeX returns the document as a LaTeX article. The body between
+// \begin{document} and \end{document} can also be included in another
+// article using the same packages.
+func (d document) LaTeX() string {
+	var b strings.Builder
+	b.WriteString(latexPreamble)
+
+	if d.title != "" {
+		b.WriteString("\n\\title{" + escapeLaTeX(d.title))
+		if d.subtitle != "" {
+			b.WriteString(`\\ \large ` + escapeLaTeX(d.subtitle))
+		}
+		b.WriteString("}\n")
+
+		if d.author != "" {
+			b.WriteString(`\author{` + escapeLaTeX(d.author) + "}\n")
+		}
+
+		// \maketitle writes today's date unless it's given
+		date := ""
+		if !d.date.IsZero() {
+			date = d.date.Format("January 2, 2006")
+		}
+		b.WriteString(`\date{` + date + "}\n")
+	}
+
+	b.WriteString("\n\\begin{document}\n")
+	if d.title != "" {
+		b.WriteString("\\maketitle\n")
+	}
+
+	l := newLaTeXWriter(d.content)
+	if body := l.blocks(d.content); body != "" {
+		b.WriteString("\n" + body + "\n")
+	}
+
+	b.WriteString("\n\\end{document}\n")
+	return b.String()
+}
+
+// latexWriter writes blocks as LaTeX, keeping track of the footnotes
+// that have been written.
+type latexWriter struct {
+	footnotes *Footnotes
+	index     map[int]int  // Index in footnotes of each footnote number
+	written   map[int]bool // Footnote numbers already written
+}
+
+func newLaTeXWriter(blocks []Block) *latexWriter {
+	l := &latexWriter{index: make(map[int]int), written: make(map[int]bool)}
+	for _, b := range blocks {
+		if f, ok := b.(*Footnotes); ok {
+			l.footnotes = f
+		}
+	}
+
+	if l.footnotes != nil {
+		for i := range l.footnotes.Items {
+			n := i + 1
+			if i < len(l.footnotes.numbers) {
+				n = l.footnotes.numbers[i]
+			}
+			l.index[n] = i
+		}
+	}
+
+	return l
+}
+
+// blocks returns the blocks as LaTeX separated by blank lines.
+func (l *latexWriter) blocks(blocks []Block) string {
+	var parts []string
+	for _, b := range blocks {
+		if s := l.block(b); s != "" {
+			parts = append(parts, s)
+		}
+	}
+
+	return strings.Join(parts, "\n\n")
+}
+
+// block returns the block as LaTeX, or "" if it has nothing to show.
+func (l *latexWriter) block(block Block) string {
+	switch b := block.(type) {
+	case *Comment, *Abbr, *Footnotes:
+		return "" // Footnotes are written where they're referenced
+	case *TOC:
+		return `\tableofcontents`
+	case *HeadingBlock:
+		level := min(b.Level, len(latexSections))
+		s := `\` + latexSections[level-1] + "{" + l.inline(b.Text) + "}"
+		if b.anchor != "" {
+			s += `\label{` + b.anchor + "}"
+		}
+		return s
+	case *Paragraph:
+		return l.inline(b.Text)
+	case *UnorderedList:
+		return l.list("itemize", &b.ListItems)
+	case *OrderedList:
+		return l.list("enumerate", &b.ListItems)
+	case *Figure:
+		return l.figure(b)
+	case *Pre:
+		var caption []string
+		if b.File != "" {
+			caption = append(caption, `\texttt{`+escapeLaTeX(b.File)+"}")
+		}
+		if b.Caption != "" {
+			caption = append(caption, l.inline(b.Caption))
+		}
+
+		var s string
+		if caption != nil {
+			s = `\noindent ` + strings.Join(caption, " ") + "\n"
+		}
+		return s + "\\begin{verbatim}\n" + b.Text + "\n\\end{verbatim}"
+	case *RawHTML:
+		return htmlLaTeX(b.Text)
+	case *Blockquote:
+		s := "\\begin{quote}\n" + l.inline(b.Text)
+		if b.Attribution != "" {
+			s += "\n\\par\\hfill--- " + l.inline(b.Attribution)
+		}
+		return s + "\n\\end{quote}"
+	case *Admonition:
+		title := escapeLaTeX(b.Title)
+		if b.Title == "" {
+			title = strings.ToUpper(b.Kind[:1]) + b.Kind[1:]
+		}
+		return "\\begin{quote}\n\\textbf{" + title + ":} " + l.inline(b.Text) + "\n\\end{quote}"
+	case *Verse:
+		return l.verse(b)
+	case *Table:
+		return l.table(b)
+	case *CSVTable:
+		return l.table(b.Table)
+	case *DefinitionList:
+		var s strings.Builder
+		s.WriteString("\\begin{description}\n")
+		for _, d := range b.Items {
+			defs := make([]string, len(d.Definitions))
+			for i, def := range d.Definitions {
+				defs[i] = l.inline(def)
+			}
+			s.WriteString(`\item[{` + l.inline(d.Term) + `}] ` + strings.Join(defs, `\par `) + "\n")
+		}
+		s.WriteString(`\end{description}`)
+		return s.String()
+	case *Math:
+		return "\\[\n" + b.Text + "\n\\]"
+	case *Embed:
+		return l.media(b.Caption, b.Src)
+	case *Video:
+		return l.media(b.Caption, b.Src)
+	case *AudioBlock:
+		return l.media(b.Caption, b.Src)
+	}
+
+	var html strings.Builder
+	if _, err := block.WriteHTML(&html, nil); err != nil {
+		return ""
+	}
+	return htmlLaTeX(html.String())
+}
+
+// latexSections are the sectioning commands of each heading level.
+var latexSections = []string{"section", "subsection", "subsubsection", "paragraph", "subparagraph"}
+
+// list returns the items of a list as an itemize or enumerate env.
+// Tasks are marked with an empty or crossed box.
+func (l *latexWriter) list(env string, items *ListItems) string {
+	var b strings.Builder
+	b.WriteString(`\begin{` + env + "}\n")
+
+	for i := range items.Items {
+		switch box, _ := cutCheckbox(items.Items[i]); box {
+		case "[ ]":
+			b.WriteString(`\item[$\square$] `)
+		case "[x]":
+			b.WriteString(`\item[$\boxtimes$] `)
+		default:
+			b.WriteString(`\item `)
+		}
+		b.WriteString(l.item(items, i) + "\n")
+	}
+
+	b.WriteString(`\end{` + env + "}")
+	return b.String()
+}
+
+// item returns the content of the i-th item of a list.
+func (l *latexWriter) item(items *ListItems, i int) string {
+	if i < len(items.Blocks) && items.Blocks[i] != nil {
+		return l.blocks(items.Blocks[i])
+	}
+
+	_, text := cutCheckbox(items.Items[i])
+	return l.inline(text)
+}
+
+// figure returns the figure as a float with its first image and
+// caption.
+func (l *latexWriter) figure(f *Figure) string {
+	var b strings.Builder
+	b.WriteString("\\begin{figure}[htbp]\n\\centering\n")
+
+	z := nethtml.NewTokenizer(strings.NewReader(f.content()))
+	for tt := z.Next(); tt != nethtml.ErrorToken; tt = z.Next() {
+		tok := z.Token()
+		if tok.Data == "img" && (tt == nethtml.StartTagToken || tt == nethtml.SelfClosingTagToken) {
+			b.WriteString(`\includegraphics[width=\linewidth]{` + attrValue(tok, "src") + "}\n")
+			break
+		}
+	}
+
+	if f.Caption != "" {
+		b.WriteString(`\caption{` + l.inline(f.Caption) + "}\n")
+	}
+	if f.ID != "" {
+		b.WriteString(`\label{` + f.ID + "}\n")
+	}
+
+	b.WriteString(`\end{figure}`)
+	return b.String()
+}
+
+// verse returns the lines of a verse, keeping their indentation and
+// separating stanzas at blank lines.
+func (l *latexWriter) verse(v *Verse) string {
+	var stanzas []string
+	var lines []string
+	for _, line := range append(v.Lines, "") {
+		text := strings.TrimLeft(line, " ")
+		if text == "" {
+			if lines != nil {
+				stanzas = append(stanzas, strings.Join(lines, " \\\\\n"))
+			}
+			lines = nil
+			continue
+		}
+
+		indent := strings.Repeat(`\quad `, (len(line)-len(text)+1)/2)
+		lines = append(lines, indent+l.inline(text))
+	}
+
+	return "\\begin{verse}\n" + strings.Join(stanzas, "\n\n") + "\n\\end{verse}"
+}
+
+// table returns the table as a tabular, with a rule under its header.
+func (l *latexWriter) table(t *Table) string {
+	cols := len(t.Header)
+	for _, r := range t.Rows {
+		cols = max(cols, len(r))
+	}
+
+	var spec strings.Builder
+	for i := 0; i < cols; i++ {
+		align := ""
+		if i < len(t.Align) {
+			align = t.Align[i]
+		}
+
+		switch align {
+		case "center":
+			spec.WriteString("c")
+		case "right":
+			spec.WriteString("r")
+		default:
+			spec.WriteString("l")
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("\\begin{center}\n\\begin{tabular}{" + spec.String() + "}\n")
+	row := func(cells []string) {
+		text := make([]string, len(cells))
+		for i, cell := range cells {
+			text[i] = l.inline(cell)
+		}
+		b.WriteString(strings.Join(text, " & ") + " \\\\\n")
+	}
+
+	if t.Header != nil {
+		row(t.Header)
+		b.WriteString("\\hline\n")
+	}
+	for _, r := range t.Rows {
+		row(r)
+	}
+
+	b.WriteString("\\end{tabular}\n\\end{center}")
+	return b.String()
+}
+
+// media returns the caption of a media file followed by its URL.
+func (l *latexWriter) media(caption, src string) string {
+	if caption == "" {
+		return `\url{` + escapeLaTeXURL(src) + "}"
+	}
+
+	return l.inline(caption) + "\n\\par\\url{" + escapeLaTeXURL(src) + "}"
+}
+
+// footnote returns the n-th footnote as a \footnote, or as a mark if
+// it's already been written.
+func (l *latexWriter) footnote(n int) string {
+	i, ok := l.index[n]
+	if !ok {
+		return ""
+	}
+	if l.written[n] {
+		return `\footnotemark[` + strconv.Itoa(n) + "]"
+	}
+	l.written[n] = true
+
+	text := l.item(&l.footnotes.ListItems, i)
+	text = strings.TrimLeft(strings.TrimPrefix(text, "["+strconv.Itoa(n)+"]"), " ")
+	return `\footnote{` + text + "}"
+}
+
+// latexCommands maps the HTML elements of styled text to the LaTeX
+// commands they're written as.
+var latexCommands = map[string]string{
+	"em":     "emph",
+	"strong": "textbf",
+	"code":   "texttt",
+	"kbd":    "texttt",
+	"del":    "sout",
+	"sup":    "textsuperscript",
+	"sub":    "textsubscript",
+}
+
+// inline returns the styled text s as LaTeX.
+func (l *latexWriter) inline(s string) string {
+	var b strings.Builder
+
+	var closers []string // What ends each open element
+	var footnote bool    // In a footnote reference, which is replaced
+	var math bool        // In inline math
+
+	z := nethtml.NewTokenizer(strings.NewReader(strings.TrimSpace(renderInline(s, nil))))
+	for {
+		tt := z.Next()
+		if tt == nethtml.ErrorToken {
+			break
+		}
+
+		tok := z.Token()
+		if footnote {
+			footnote = !(tt == nethtml.EndTagToken && tok.Data == "a")
+			continue
+		}
+
+		switch tt {
+		case nethtml.TextToken:
+			if math {
+				b.WriteString(strings.TrimSuffix(strings.TrimPrefix(tok.Data, `\(`), `\)`))
+				continue
+			}
+			b.WriteString(escapeLaTeX(tok.Data))
+		case nethtml.StartTagToken, nethtml.SelfClosingTagToken:
+			closer := ""
+			switch tok.Data {
+			case "a":
+				href := attrValue(tok, "href")
+				if n, ok := strings.CutPrefix(href, "#fn."); ok && strings.HasPrefix(attrValue(tok, "id"), "fnr.") {
+					num, _ := strconv.Atoi(n)
+					b.WriteString(l.footnote(num))
+					footnote = true
+					continue
+				}
+
+				if id, ok := strings.CutPrefix(href, "#"); ok {
+					b.WriteString(`\hyperref[` + id + "]{")
+				} else {
+					b.WriteString(`\href{` + escapeLaTeXURL(href) + "}{")
+				}
+				closer = "}"
+			case "img":
+				b.WriteString(escapeLaTeX(attrValue(tok, "alt")))
+				continue
+			case "br":
+				b.WriteString("\\\\\n")
+				continue
+			case "span":
+				if attrValue(tok, "class") == "math inline" {
+					b.WriteString("$")
+					closer, math = "$", true
+				}
+			default:
+				if cmd, ok := latexCommands[tok.Data]; ok {
+					b.WriteString(`\` + cmd + "{")
+					closer = "}"
+				}
+			}
+			if tt == nethtml.StartTagToken {
+				closers = append(closers, closer)
+			} else {
+				b.WriteString(closer)
+			}
+		case nethtml.EndTagToken:
+			if len(closers) > 0 {
+				b.WriteString(closers[len(closers)-1])
+				closers = closers[:len(closers)-1]
+			}
+			math = false
+		}
+	}
+
+	return b.String()
+}
+
+// htmlLaTeX returns the text of the HTML s as LaTeX paragraphs.
+func htmlLaTeX(s string) string {
+	text := htmlText(s)
+	if text == "" {
+		return ""
+	}
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = escapeLaTeX(line)
+	}
+
+	return strings.Join(lines, "\n\n")
+}
+
+// latexEscaper escapes the characters LaTeX treats specially in text.
+var latexEscaper = strings.NewReplacer(
+	`\`, `\textbackslash{}`,
+	`{`, `\{`,
+	`}`, `\}`,
+	`$`, `\$`,
+	`&`, `\&`,
+	`#`, `\#`,
+	`%`, `\%`,
+	`_`, `\_`,
+	`^`, `\textasciicircum{}`,
+	`~`, `\textasciitilde{}`,
+	`<`, `\textless{}`,
+	`>`, `\textgreater{}`,
+)
+
+// escapeLaTeX escapes the plain text s for LaTeX.
+func escapeLaTeX(s string) string {
+	return latexEscaper.Replace(s)
+}
+
+// escapeLaTeXURL escapes the URL s for \href or \url in the argument
+// of another command.
+func escapeLaTeXURL(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `#`, `\#`, `%`, `\%`, `{`, `\{`, `}`, `\}`).Replace(s)
+}
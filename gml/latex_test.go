@@ -0,0 +1,85 @@
+package gml
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLaTeX(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			"headings and styles",
+			"* Setup\n\n** Next steps\n\n/Read/ the [docs](https://go.dev/doc/#x), *all* 100% of ~a{b}~.",
+			"\\section{Setup}\\label{setup}\n\n\\subsection{Next steps}\\label{next-steps}\n\n" +
+				`\emph{Read} the \href{https://go.dev/doc/\#x}{docs}, \textbf{all} 100\% of \texttt{a\{b\}}.`,
+		},
+		{
+			"internal link and math",
+			"* Intro\n\nSee [the intro](#intro) for $x^2$ and a_b.",
+			"\\section{Intro}\\label{intro}\n\nSee \\hyperref[intro]{the intro} for $x^2$ and a\\_b.",
+		},
+		{
+			"footnotes",
+			"Once[fn:a] and again[fn:a].\n\n%footnotes\n- [a] A /note/.",
+			`Once\footnote{A \emph{note}.} and again\footnotemark[1].`,
+		},
+		{
+			"lists",
+			"- [ ] todo\n- done\n\n  more\n\n1. one",
+			"\\begin{itemize}\n\\item[$\\square$] todo\n\\item done\n\nmore\n\\end{itemize}\n\n" +
+				"\\begin{enumerate}\n\\item one\n\\end{enumerate}",
+		},
+		{
+			"figure",
+			"%figure id=fig-cat\n<img src=\"cat.jpg\" alt=\"A cat\">\nA /cat/.",
+			"\\begin{figure}[htbp]\n\\centering\n\\includegraphics[width=\\linewidth]{cat.jpg}\n" +
+				"\\caption{A \\emph{cat}.}\n\\label{fig-cat}\n\\end{figure}",
+		},
+		{
+			"code",
+			"%pre\nif a < b {\n\treturn\n}",
+			"\\begin{verbatim}\nif a < b {\n\treturn\n}\n\\end{verbatim}",
+		},
+		{
+			"table",
+			"%table\n| A | B |\n| :-- | --: |\n| 1 | 2 |",
+			"\\begin{center}\n\\begin{tabular}{lr}\nA & B \\\\\n\\hline\n1 & 2 \\\\\n\\end{tabular}\n\\end{center}",
+		},
+		{
+			"math",
+			"%math\ne^{i\\pi} + 1 = 0",
+			"\\[\ne^{i\\pi} + 1 = 0\n\\]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := Parse(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := "\n\\begin{document}\n\n" + tt.want + "\n\n\\end{document}\n"
+			if got := strings.TrimPrefix(doc.LaTeX(), latexPreamble); got != want {
+				t.Errorf("want:\n%s\ngot:\n%s", want, got)
+			}
+		})
+	}
+}
+
+func TestLaTeXTitle(t *testing.T) {
+	doc, err := Parse("%title Cats & Dogs\n%subtitle A history\n%author Me\n%date 2006-01-02\n\nHi.")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := latexPreamble + "\n\\title{Cats \\& Dogs\\\\ \\large A history}\n\\author{Me}\n\\date{January 2, 2006}\n" +
+		"\n\\begin{document}\n\\maketitle\n\nHi.\n\n\\end{document}\n"
+	if got := doc.LaTeX(); got != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+}
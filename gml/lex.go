@@ -7,7 +7,8 @@ package gml
 // For now, lexer emits items that contain the primary structure of a
 // GML document. Such as headings, lists, paragraphs, and blocks.
 // However, it doesn't tokenize the text content itself. That is,
-// bold, italics, URLs, and footnotes are left as-is.
+// bold, italics, URLs, and footnotes are left as-is and are
+// rendered by renderInline in inline.go.
 //
 // Goals:
 // - Limit ambiguity
@@ -18,8 +19,14 @@ package gml
 // splitting and regular expressions.
 
 import (
+	"bufio"
+	"context"
 	"fmt"
+	"io"
+	"regexp"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"unicode"
 	"unicode/utf8"
 )
@@ -34,19 +41,42 @@ const (
 	itemHeadingOne
 	itemHeadingTwo
 	itemHeadingThree
+	itemHeadingFour
+	itemHeadingFive
 	itemUnorderedList
 	itemOrderedList
+	itemComment // Lines starting with ";;"
 
 	itemKeyword // Only used as delimiter for block keywords
 	itemTitle
 	itemSubtitle
 	itemDate
 	itemAuthor
+	itemTags
+	itemSummary
+	itemLang
 	itemPre
 	itemHTML
 	itemFigure
 	itemFootnotes
 	itemBlockquote
+	itemTable
+	itemCSV
+	itemDefinitions
+	itemTOC
+	itemNote
+	itemWarning
+	itemTip
+	itemVerse
+	itemCommentBlock
+	itemInclude
+	itemAbbr
+	itemMath
+	itemEmbed
+	itemVideo
+	itemAudio
+	itemCustom // Keywords added with RegisterBlock
+	itemMeta   // Other metadata, e.g. "%license CC-BY"
 )
 
 var key = map[string]itemType{
@@ -55,6 +85,9 @@ var key = map[string]itemType{
 	"%subtitle": itemSubtitle,
 	"%date":     itemDate,
 	"%author":   itemAuthor,
+	"%tags":     itemTags,
+	"%summary":  itemSummary,
+	"%lang":     itemLang,
 
 	// Blocks
 	"%pre":        itemPre,
@@ -62,6 +95,21 @@ var key = map[string]itemType{
 	"%figure":     itemFigure,
 	"%footnotes":  itemFootnotes,
 	"%blockquote": itemBlockquote,
+	"%table":      itemTable,
+	"%csv":        itemCSV,
+	"%dl":         itemDefinitions,
+	"%toc":        itemTOC,
+	"%note":       itemNote,
+	"%warning":    itemWarning,
+	"%tip":        itemTip,
+	"%verse":      itemVerse,
+	"%comment":    itemCommentBlock,
+	"%include":    itemInclude,
+	"%abbr":       itemAbbr,
+	"%math":       itemMath,
+	"%embed":      itemEmbed,
+	"%video":      itemVideo,
+	"%audio":      itemAudio,
 }
 
 type item struct {
@@ -88,19 +136,33 @@ func (i item) String() string {
 type stateFn func(*lexer) stateFn
 
 type lexer struct {
-	input string
-	pos   int
-	start int
-	width int
-	items chan item
+	input  string
+	pos    int
+	start  int
+	width  int
+	header bool // In the metadata at the top of the document
+	items  chan item
+
+	// A streamed input is read a line at a time as it's lexed. Only
+	// the lexer writes to input, holding mu so the parser can read
+	// the source it has so far with source().
+	r   *bufio.Reader // Nil once it's read to the end
+	ctx context.Context
+	buf strings.Builder
+	mu  sync.Mutex
+	err error // Why reading the input stopped early
+
+	stopped atomic.Bool // The parser stopped at an error, so there's no need to read on
 }
 
 const eof = -1
 
 func (l *lexer) next() rune {
-	if l.pos >= len(l.input) {
-		l.width = 0
-		return eof
+	for l.pos >= len(l.input) {
+		if !l.fill() {
+			l.width = 0
+			return eof
+		}
 	}
 
 	r, w := utf8.DecodeRuneInString(l.input[l.pos:])
@@ -130,10 +192,95 @@ func (l *lexer) emit(t itemType) {
 
 // lex creates a new lexer and scans the input
 func lex(input string) *lexer {
-	l := &lexer{
-		input: input,
-		items: make(chan item),
+	input = strings.TrimPrefix(normalizeNewlines(input), byteOrderMark)
+	return startLexer(&lexer{input: input, header: true})
+}
+
+// byteOrderMark may start a UTF-8 file written by Windows editors. It
+// isn't part of the text, so it's dropped before lexing.
+const byteOrderMark = "\ufeff"
+
+// newlines replaces Windows ("\r\n") and old Mac ("\r") line endings.
+var newlines = strings.NewReplacer("\r\n", "\n", "\r", "\n")
+
+// normalizeNewlines returns s with every line ending as "\n", so the
+// lexer only has to look for that. Positions in the source of a
+// document are of its normalized text.
+func normalizeNewlines(s string) string {
+	if !strings.Contains(s, "\r") {
+		return s
+	}
+
+	return newlines.Replace(s)
+}
+
+// lexReader scans the input read from r until ctx is done.
+func lexReader(ctx context.Context, r io.Reader) *lexer {
+	return startLexer(&lexer{r: bufio.NewReader(r), ctx: ctx, header: true})
+}
+
+// fill reads the next line of a streamed input and reports whether
+// there was one.
+func (l *lexer) fill() bool {
+	if l.r == nil || l.stopped.Load() {
+		return false
+	}
+
+	if err := l.ctx.Err(); err != nil {
+		l.r, l.err = nil, err
+		return false
+	}
+
+	line, err := l.r.ReadString('\n')
+	if line != "" {
+		line = normalizeNewlines(line)
+		if l.buf.Len() == 0 {
+			line = strings.TrimPrefix(line, byteOrderMark)
+		}
+
+		l.mu.Lock()
+		l.buf.WriteString(line)
+		l.input = l.buf.String()
+		l.mu.Unlock()
+	}
+	if err != nil {
+		l.r = nil
+		if err != io.EOF {
+			l.err = err
+		}
+	}
+
+	return line != ""
+}
+
+// readAhead returns the input from the cursor on, having read a
+// streamed input far enough to have the next line that isn't blank
+// after the current one.
+func (l *lexer) readAhead() string {
+	for {
+		rest := l.input[l.pos:]
+		if i := strings.IndexByte(rest, '\n'); i >= 0 && strings.TrimSpace(rest[i+1:]) != "" || !l.fill() {
+			return rest
+		}
 	}
+}
+
+// source returns the input the lexer has read so far.
+func (l *lexer) source() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.input
+}
+
+// lexNested scans a document nested in another, like the blocks of a
+// list item, which has no metadata.
+func lexNested(input string) *lexer {
+	return startLexer(&lexer{input: input})
+}
+
+func startLexer(l *lexer) *lexer {
+	l.items = make(chan item)
 
 	go l.run()
 	return l
@@ -144,6 +291,24 @@ func (l *lexer) errorf(format string, args ...interface{}) stateFn {
 	return nil
 }
 
+// skipf emits an error like errorf but carries on lexing after the
+// rest of the block, so a parser recording every error can find more.
+func (l *lexer) skipf(format string, args ...interface{}) stateFn {
+	l.items <- item{itemError, fmt.Sprintf(format, args...), l.start}
+
+	for {
+		switch a, b := l.next(), l.peek(); {
+		case a == eof:
+			l.ignore()
+			return lexBlock
+		case isNewline(a) && (isNewline(b) || b == eof):
+			l.ignore()
+			l.header = false
+			return lexBlock
+		}
+	}
+}
+
 func (l *lexer) run() {
 	for state := lexBlock; state != nil; {
 		state = state(l)
@@ -153,7 +318,13 @@ func (l *lexer) run() {
 }
 
 func (l *lexer) nextItem() item {
-	return <-l.items
+	it, ok := <-l.items
+	if !ok {
+		// The lexer stopped at an error that was already read
+		return item{itemEOF, "", len(l.source())}
+	}
+
+	return it
 }
 
 // drain reads out all items so the lexing goroutine can exit.
@@ -167,11 +338,17 @@ func lexBlock(l *lexer) stateFn {
 		switch r := l.next(); {
 		case r == '%':
 			return lexKeyword
+		case r == ';' && l.peek() == ';':
+			l.header = false
+			return lexComment
 		case r == '*':
+			l.header = false
 			return lexHeading
 		case r == '-':
+			l.header = false
 			return lexUnorderedList
 		case isDigit(r):
+			l.header = false
 			return lexOrderedList
 		case isSpace(r) || isNewline(r):
 			l.ignore()
@@ -179,6 +356,7 @@ func lexBlock(l *lexer) stateFn {
 			l.emit(itemEOF)
 			return nil
 		default:
+			l.header = false
 			l.backup()
 			return lexParagraph
 		}
@@ -198,8 +376,20 @@ func lexKeyword(l *lexer) stateFn {
 
 	// Check if metadata entry is valid
 	word := strings.ToLower(l.input[l.start:l.pos])
-	if _, ok := key[word]; !ok {
-		return l.errorf("unrecognized keyword: %q", word)
+	typ, ok := key[word]
+	if !ok {
+		_, custom := lookupBlock(word)
+		switch {
+		case custom:
+			typ = itemCustom
+		case l.header && reMetaKey.MatchString(word) && !l.lineIsEmpty():
+			typ = itemMeta // Metadata we don't know about is kept for Meta
+		default:
+			return l.skipf("unrecognized keyword: %q", word)
+		}
+	}
+	if !isMetadata(typ) {
+		l.header = false // A block ends the metadata
 	}
 
 	// Ignore spaces between key + value
@@ -212,8 +402,11 @@ func lexKeyword(l *lexer) stateFn {
 		}
 	}
 
-	// Ignore keyword tokens
-	l.ignore()
+	// Ignore keyword tokens, except for custom blocks and metadata so
+	// the parser knows which one it is
+	if typ != itemCustom && typ != itemMeta {
+		l.ignore()
+	}
 
 	// Scan value
 	// Consume all chars until end of line
@@ -225,10 +418,10 @@ func lexKeyword(l *lexer) stateFn {
 	}
 
 	// Emit keyword item with it's argument as the value
-	l.emit(key[word])
+	l.emit(typ)
 
 	// Special cases:
-	if key[word] == itemFootnotes {
+	if typ == itemFootnotes {
 		if isNewline(l.next()) && l.peek() != '-' {
 			return l.errorf("footnotes must be given as an unordered list")
 		} else {
@@ -246,9 +439,13 @@ func lexKeyword(l *lexer) stateFn {
 		case isNewline(a) && b == '%':
 			l.ignore() // Move cursor to start of next keyword
 			return lexKeyword
+		case isNewline(a) && l.header && l.indentedKeyword():
+			l.ignore()
+			return lexBlock // Metadata may be indented
 		case isNewline(a) && isNewline(b):
 			l.next()   // Consume newline from 'b'
 			l.ignore() // Move cursor to start of next block
+			l.header = false
 			return lexBlock
 		case a == eof:
 			l.emit(itemEOF)
@@ -261,6 +458,7 @@ func lexKeyword(l *lexer) stateFn {
 			if isNewline(a) {
 				l.ignore()
 			}
+			l.header = false
 
 			for {
 				if r := l.next(); isNewline(r) || r == eof {
@@ -274,6 +472,23 @@ func lexKeyword(l *lexer) stateFn {
 	}
 }
 
+// indentedKeyword reports whether the line at the cursor is a keyword
+// indented by spaces or tabs, without moving the cursor.
+func (l *lexer) indentedKeyword() bool {
+	pos := l.pos
+	defer func() { l.pos = pos }()
+
+	r := l.next()
+	if !isSpace(r) {
+		return false
+	}
+	for isSpace(r) {
+		r = l.next()
+	}
+
+	return r == '%'
+}
+
 func lexHeading(l *lexer) stateFn {
 	// Scan heading level
 	for {
@@ -315,8 +530,12 @@ func lexHeading(l *lexer) stateFn {
 		l.emit(itemHeadingOne)
 	case 2:
 		l.emit(itemHeadingTwo)
-	default:
+	case 3:
 		l.emit(itemHeadingThree)
+	case 4:
+		l.emit(itemHeadingFour)
+	default:
+		l.emit(itemHeadingFive) // Rendered as <h6>, the deepest HTML heading
 	}
 
 	return lexBlock
@@ -346,6 +565,7 @@ func lexUnorderedList(l *lexer) stateFn {
 		}
 	}
 
+	l.scanListContinuation()
 	l.emit(itemUnorderedList)
 	return lexBlock
 }
@@ -388,11 +608,78 @@ Loop:
 		}
 	}
 
+	l.scanListContinuation()
 	l.emit(itemOrderedList)
 	return lexBlock
 }
 
+// scanListContinuation extends a list item over the indented lines
+// that follow it. Indented lines after blank lines continue the item
+// too, starting a new paragraph (or other block) within it.
+func (l *lexer) scanListContinuation() {
+	for strings.HasPrefix(l.readAhead(), "\n") {
+		rest := l.readAhead()
+
+		// Find the next line that isn't blank
+		start := 1
+		for {
+			end := strings.IndexByte(rest[start:], '\n')
+			if end < 0 {
+				end = len(rest) - start
+			}
+
+			if strings.TrimSpace(rest[start:start+end]) != "" {
+				break
+			}
+
+			if start+end >= len(rest) {
+				return // Only blank lines left
+			}
+			start += end + 1
+		}
+
+		if !isSpace(rune(rest[start])) {
+			return // Not indented so it's the next block
+		}
+
+		end := strings.IndexByte(rest[start:], '\n')
+		if end < 0 {
+			end = len(rest) - start
+		}
+		l.pos += start + end
+	}
+}
+
 // lexParagraph consumes all text until the next empty line.
+// lexComment scans consecutive lines starting with ";;".
+func lexComment(l *lexer) stateFn {
+	for {
+		if r := l.next(); r == eof {
+			l.emit(itemComment)
+			l.emit(itemEOF)
+			return nil
+		} else if isNewline(r) && !strings.HasPrefix(l.readAhead(), ";;") {
+			l.backup()
+			l.emit(itemComment)
+			return lexBlock
+		}
+	}
+}
+
+// isMetadata reports whether typ is a keyword of the metadata at the
+// top of a document.
+func isMetadata(typ itemType) bool {
+	return itemTitle <= typ && typ <= itemLang || typ == itemMeta
+}
+
+// lineIsEmpty reports whether the rest of the line is only spaces.
+func (l *lexer) lineIsEmpty() bool {
+	rest, _, _ := strings.Cut(l.input[l.pos:], "\n")
+	return strings.TrimSpace(rest) == ""
+}
+
+var reMetaKey = regexp.MustCompile(`^%[a-z][a-z0-9_-]*$`)
+
 func lexParagraph(l *lexer) stateFn {
 	for {
 		switch a, b := l.next(), l.peek(); {
@@ -405,6 +692,11 @@ func lexParagraph(l *lexer) stateFn {
 			l.next()
 			l.ignore()
 			return lexBlock
+		case isNewline(a) && strings.HasPrefix(l.readAhead(), ";;"):
+			// A comment ends the paragraph
+			l.backup()
+			l.emit(itemParagraph)
+			return lexBlock
 		case a == eof:
 			l.emit(itemParagraph)
 			l.emit(itemEOF)
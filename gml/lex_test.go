@@ -221,6 +221,24 @@ func main() {
 			{itemUnorderedList, "[2] bar", 640},
 			{itemEOF, "", 648}},
 	},
+	{
+		"list items continue onto indented lines",
+		"- one\n  more\n\n  %pre\n  code\n- two\n\nafter",
+		[]item{
+			{itemUnorderedList, "one\n  more\n\n  %pre\n  code", 2},
+			{itemUnorderedList, "two", 30},
+			{itemParagraph, "after", 35},
+			{itemEOF, "", 40},
+		},
+	},
+	{
+		"list items end at blank lines",
+		"1. one\n\n   \n",
+		[]item{
+			{itemOrderedList, "one", 3},
+			{itemEOF, "", 12},
+		},
+	},
 	// Miscellaneous test cases
 	{
 		"keyword accepts spaces or tabs as delimiter",
@@ -233,9 +251,19 @@ func main() {
 		[]item{{itemHeadingOne, "one", 7}, {itemEOF, "", 10}},
 	},
 	{
-		"headings stop at level 3",
-		"***** five",
-		[]item{{itemHeadingThree, "five", 6}, {itemEOF, "", 10}},
+		"comments",
+		";; one\n;; two\npara\n;; three\n",
+		[]item{{itemComment, ";; one\n;; two", 0}, {itemParagraph, "para", 14}, {itemComment, ";; three", 19}, {itemEOF, "", 28}},
+	},
+	{
+		"heading four",
+		"**** four",
+		[]item{{itemHeadingFour, "four", 5}, {itemEOF, "", 9}},
+	},
+	{
+		"headings stop at level 5",
+		"******* seven",
+		[]item{{itemHeadingFive, "seven", 8}, {itemEOF, "", 13}},
 	},
 	{
 		"not a list item (1)",
@@ -0,0 +1,232 @@
+package gml
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Problem is an issue found by Lint. Line is the line of the source
+// where the problem was found, or zero when it isn't known.
+type Problem struct {
+	Line    int
+	Message string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%d: %s", p.Line, p.Message)
+}
+
+var (
+	reFootnoteRef = regexp.MustCompile(`\[fn:(\d+|[A-Za-z][\w-]*)\]`)
+	reImg         = regexp.MustCompile(`(?i)<img\b[^>]*>`)
+	reAlt         = regexp.MustCompile(`(?i)\balt\s*=`)
+)
+
+// Lint reports problems in a parsed document that don't prevent it
+// from rendering but are probably mistakes: missing metadata, footnote
+// references without definitions (and vice versa), figures without
+// captions or alt text, videos without captions, empty headings,
+// headings pinned to the same anchor, and table rows with the wrong
+// number of cells.
+func Lint(doc Document) []Problem {
+	var problems []Problem
+	report := func(line int, format string, args ...interface{}) {
+		problems = append(problems, Problem{line, fmt.Sprintf(format, args...)})
+	}
+
+	if doc.Title() == "" {
+		report(1, "missing %%title")
+	}
+	if doc.Date().IsZero() {
+		report(1, "missing %%date")
+	}
+
+	d, ok := doc.(document)
+	if !ok {
+		return problems
+	}
+
+	type ref struct {
+		line  int
+		label string // Number or name of the footnote
+	}
+	var refs []ref
+	findRefs := func(line int, text string) {
+		for _, m := range reFootnoteRef.FindAllStringSubmatch(text, -1) {
+			refs = append(refs, ref{line, m[1]})
+		}
+	}
+
+	// Items may span several lines
+	findItemRefs := func(line int, items []string) {
+		for _, item := range items {
+			findRefs(line, item)
+			line += strings.Count(item, "\n") + 1
+		}
+	}
+
+	var defined []ref               // Footnote definitions in order
+	anchors := make(map[string]int) // Explicit heading anchor to line
+	for i, b := range d.content {
+		line := d.line(i)
+
+		switch b := b.(type) {
+		case *HeadingBlock:
+			if strings.TrimSpace(b.Text) == "" {
+				report(line, "empty heading")
+			}
+			if b.ID != "" {
+				if first, ok := anchors[b.ID]; ok {
+					report(line, "heading anchor %q is already used on line %d", b.ID, first)
+				} else {
+					anchors[b.ID] = line
+				}
+			}
+			findRefs(line, b.Text)
+		case *Paragraph:
+			findRefs(line, b.Text)
+		case *Blockquote:
+			findRefs(line, b.Text)
+			findRefs(line, b.Attribution)
+		case *Verse:
+			for j, l := range b.Lines {
+				findRefs(line+1+j, l)
+			}
+		case *Admonition:
+			if strings.TrimSpace(b.Text) == "" {
+				report(line, "empty %%%s", b.Kind)
+			}
+			findRefs(line, b.Title)
+			findRefs(line+1, b.Text)
+		case *Embed:
+			findRefs(line+1, b.Caption)
+		case *Video:
+			if strings.TrimSpace(b.Caption) == "" {
+				report(line, "video has no caption")
+			}
+			findRefs(line, b.Caption)
+		case *AudioBlock:
+			findRefs(line, b.Caption)
+		case *Math:
+			if strings.TrimSpace(b.Text) == "" {
+				report(line, "empty %%math")
+			}
+		case *TOC:
+			if len(b.Headings) == 0 {
+				report(line, "%%toc has no headings to list")
+			}
+		case *DefinitionList:
+			n := line + 1
+			for _, d := range b.Items {
+				for _, def := range d.Definitions {
+					findRefs(n, d.Term+" "+def)
+					n++
+				}
+			}
+		case *UnorderedList:
+			findItemRefs(line, b.Items)
+		case *OrderedList:
+			findItemRefs(line, b.Items)
+		case *Figure:
+			if strings.TrimSpace(b.Caption) == "" {
+				report(line, "figure has no caption")
+			}
+			for _, img := range reImg.FindAllString(b.content(), -1) {
+				if !reAlt.MatchString(img) {
+					report(line+1, "figure image has no alt text")
+				}
+			}
+			findRefs(line+2, b.Caption)
+		case *Table:
+			start := line + 1 // Line of the first row after the keyword
+			if b.Header != nil {
+				findRefs(start, strings.Join(b.Header, " "))
+				start += 2
+			} else if b.Align != nil {
+				start++
+			}
+
+			cols := len(b.Header)
+			if cols == 0 {
+				cols = len(b.Align)
+			}
+			for j, row := range b.Rows {
+				if cols == 0 {
+					cols = len(row)
+				}
+				if len(row) != cols {
+					report(start+j, "table row has %d cells but the table has %d columns", len(row), cols)
+				}
+				findRefs(start+j, strings.Join(row, " "))
+			}
+		case *Pre:
+			if b.Lang != "" && !knownLanguage(b.Lang) {
+				report(line, "unknown %%pre language %q: the code won't be highlighted", b.Lang)
+			}
+			n := strings.Count(b.Text, "\n") + 1
+			for _, r := range b.highlighted {
+				if r[1] > n {
+					report(line, "%%pre highlights lines past the end of the code (%d lines)", n)
+					break
+				}
+			}
+		case *Footnotes:
+			itemLine := line + 1
+			for j, label := range b.labels() {
+				defined = append(defined, ref{itemLine, label})
+				itemLine += strings.Count(b.Items[j], "\n") + 1
+			}
+		}
+	}
+
+	definedLabels := make(map[string]bool)
+	for _, d := range defined {
+		definedLabels[d.label] = true
+	}
+
+	referenced := make(map[string]bool)
+	for _, r := range refs {
+		referenced[r.label] = true
+		if !definedLabels[r.label] {
+			report(r.line, "footnote [fn:%s] has no definition", r.label)
+		}
+	}
+
+	for _, d := range defined {
+		if !referenced[d.label] {
+			report(d.line, "footnote %s is never referenced", d.label)
+		}
+	}
+
+	return problems
+}
+
+// LintSource parses src and lints the result. Syntax errors, such as
+// an unknown keyword, are all reported as problems instead of an error.
+func LintSource(src string) []Problem {
+	doc, err := parse(src, &parser{source: true, allErrors: true})
+	if err != nil {
+		var errs ParseErrors
+		if errors.As(err, &errs) {
+			problems := make([]Problem, len(errs))
+			for i, perr := range errs {
+				problems[i] = Problem{perr.Line, perr.Msg}
+			}
+			return problems
+		}
+		return []Problem{{0, err.Error()}}
+	}
+
+	return Lint(doc)
+}
+
+// line returns the source line where the i-th block starts.
+func (d document) line(i int) int {
+	if i >= len(d.positions) {
+		return 0
+	}
+
+	return lineAt(d.src, d.positions[i])
+}
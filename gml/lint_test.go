@@ -0,0 +1,105 @@
+package gml
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []Problem
+	}{
+		{
+			"clean",
+			"%title Hello\n%date 2022-03-21\n\nHi[fn:1]\n\n%footnotes\n- [1] note\n",
+			nil,
+		},
+		{
+			"missing metadata",
+			"Hi\n",
+			[]Problem{{1, "missing %title"}, {1, "missing %date"}},
+		},
+		{
+			"footnotes",
+			"%title Hello\n%date 2022-03-21\n\nHi[fn:2]\n\n%footnotes\n- [1] one\n- [2] two\n- [3] three\n",
+			[]Problem{{7, "footnote 1 is never referenced"}, {9, "footnote 3 is never referenced"}},
+		},
+		{
+			"named footnotes",
+			"%title Hello\n%date 2022-03-21\n\nHi[fn:setup] and[fn:gone]\n\n%footnotes\n- [setup] one\n- [extra] two\n",
+			[]Problem{{4, "footnote [fn:gone] has no definition"}, {8, "footnote extra is never referenced"}},
+		},
+		{
+			"undefined footnote",
+			"%title Hello\n%date 2022-03-21\n\n- a\n- b[fn:1]\n",
+			[]Problem{{5, "footnote [fn:1] has no definition"}},
+		},
+		{
+			"figure",
+			"%title Hello\n%date 2022-03-21\n\n%figure\n<img src=\"a.png\">\n",
+			[]Problem{{4, "figure has no caption"}, {5, "figure image has no alt text"}},
+		},
+		{
+			"figure alt argument",
+			"%title Hello\n%date 2022-03-21\n\n%figure alt=A\n<img src=\"a.png\">\nA caption\n",
+			nil,
+		},
+		{
+			"video",
+			"%title Hello\n%date 2022-03-21\n\n%video clip.mp4\n",
+			[]Problem{{4, "video has no caption"}},
+		},
+		{
+			"empty heading",
+			"%title Hello\n%date 2022-03-21\n\n* \n",
+			[]Problem{{4, "empty heading"}},
+		},
+		{
+			"duplicate anchor",
+			"%title Hello\n%date 2022-03-21\n\n* One {#a}\n\n* Two {#a}\n",
+			[]Problem{{6, "heading anchor \"a\" is already used on line 4"}},
+		},
+		{
+			"empty toc",
+			"%title Hello\n%date 2022-03-21\n\n%toc\n\nText\n",
+			[]Problem{{4, "%toc has no headings to list"}},
+		},
+		{
+			"table",
+			"%title Hello\n%date 2022-03-21\n\n%table\n| a | b |\n| - | - |\n| 1 |\n| 1 | 2 |\n",
+			[]Problem{{7, "table row has 1 cells but the table has 2 columns"}},
+		},
+		{
+			"unknown language",
+			"%title Hello\n%date 2022-03-21\n\n%pre nosuchlang\nfoo\n",
+			[]Problem{{4, `unknown %pre language "nosuchlang": the code won't be highlighted`}},
+		},
+		{
+			"highlighted lines",
+			"%title Hello\n%date 2022-03-21\n\n%pre hl=1,3\nfoo\nbar\n",
+			[]Problem{{4, "%pre highlights lines past the end of the code (2 lines)"}},
+		},
+		{
+			"unknown keyword",
+			"%title Hello\n%date 2022-03-21\n\n%aside\nfoo\n",
+			[]Problem{{4, `unrecognized keyword: "%aside"`}},
+		},
+		{
+			"several syntax errors",
+			"%title Hello\n%date someday\n\n%aside\nfoo\n\n%video\n",
+			[]Problem{
+				{2, "invalid date format: want: YYYY-MM-DD; got: someday"},
+				{4, `unrecognized keyword: "%aside"`},
+				{7, "%video: missing file name"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		if got := LintSource(test.input); !reflect.DeepEqual(test.want, got) {
+			t.Errorf("%s:\nwant:\t%v\n got:\t%v", test.name, test.want, got)
+		}
+	}
+}
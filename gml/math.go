@@ -0,0 +1,82 @@
+package gml
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// A %math block is display math and "$...$" in styled text is inline
+// math. Both are written as TeX in the delimiters that KaTeX's
+// auto-render and MathJax look for by default, so either one can
+// typeset them in the browser:
+//
+//   %math
+//   e^{i\pi} + 1 = 0  -> <div class="math display">\[e^{i\pi} + 1 = 0\]</div>
+//
+//   $x^2$             -> <span class="math inline">\(x^2\)</span>
+//
+// Like Pandoc, the opening "$" must be followed by a non-space and the
+// closing "$" must follow a non-space and can't be followed by a
+// digit, so prices like "$5 or $10" are left alone.
+
+// Math is a %math block of display math.
+type Math struct {
+	Text string `json:"text"` // TeX as written
+}
+
+func (m *Math) WriteHTML(w io.Writer, opts *HTMLOptions) (int, error) {
+	var b bytes.Buffer
+
+	if opts == nil {
+		opts = &HTMLOptions{}
+	}
+
+	fmt.Fprintf(&b, `<div class="%s">\[`, opts.class("math display"))
+	b.WriteString(escapeHTML(m.Text))
+	b.WriteString(`\]</div>`)
+
+	return w.Write(b.Bytes())
+}
+
+func (p *parser) parseMath(token item) {
+	if args := strings.TrimSpace(token.val); args != "" {
+		p.errorf("%%math: unexpected argument %q", args)
+	}
+
+	items := unescapeKeywords(p.collectItems(itemText))
+	p.doc.content = append(p.doc.content, &Math{Text: strings.Join(items, "\n")})
+}
+
+// mathHTML writes the inline math tex as HTML.
+func mathHTML(tex string, opts *HTMLOptions) string {
+	return `<span class="` + opts.class("math inline") + `">\(` + escapeHTML(tex) + `\)</span>`
+}
+
+// scanMath scans inline math like "$x^2$" at s[i] and returns its TeX
+// and the index just past it. A "\$" in the TeX doesn't close it.
+func scanMath(s string, i int) (string, int) {
+	if i+1 >= len(s) || s[i] != '$' || isSpaceByte(s[i+1]) || s[i+1] == '$' {
+		return "", -1
+	}
+
+	for j := i + 1; j < len(s); j++ {
+		if s[j] == '\\' {
+			j++ // Escaped, e.g. "\$" or "\\"
+			continue
+		}
+
+		if s[j] != '$' || isSpaceByte(s[j-1]) {
+			continue
+		}
+
+		if j+1 < len(s) && '0' <= s[j+1] && s[j+1] <= '9' {
+			continue // e.g. "$5-$10"
+		}
+
+		return s[i+1 : j], j + 1
+	}
+
+	return "", -1
+}
@@ -0,0 +1,229 @@
+package gml
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// "%video clip.mp4 poster=clip.jpg caption="A clip"" plays a video
+// file with the browser's controls, the way %figure shows an image.
+// The words autoplay, loop, and muted turn those on; a video that
+// plays on its own is always muted since browsers won't autoplay one
+// with sound.
+
+// Video is a %video block.
+type Video struct {
+	args    string // Arguments as written
+	Src     string `json:"src"` // File name or URL as written
+	Poster  string `json:"poster,omitempty"`
+	Caption string `json:"caption,omitempty"` // Styled text as written
+
+	Autoplay bool `json:"autoplay,omitempty"`
+	Loop     bool `json:"loop,omitempty"`
+	Muted    bool `json:"muted,omitempty"`
+}
+
+func (v *Video) WriteHTML(w io.Writer, opts *HTMLOptions) (int, error) {
+	var b bytes.Buffer
+
+	if opts == nil {
+		opts = &HTMLOptions{}
+	}
+
+	fmt.Fprintf(&b, `<figure class="%s">`, opts.class("video"))
+	opts.newline(&b, 1)
+
+	fmt.Fprintf(&b, `<video%s controls preload="metadata" playsinline`, opts.urlAttr("src", v.Src))
+	if v.Poster != "" {
+		b.WriteString(opts.imageAttr("poster", v.Poster))
+	}
+	if v.Autoplay {
+		b.WriteString(` autoplay`)
+	}
+	if v.Loop {
+		b.WriteString(` loop`)
+	}
+	if v.Muted || v.Autoplay {
+		b.WriteString(` muted`)
+	}
+	fmt.Fprintf(&b, `><a%s>Download the video</a></video>`, opts.urlAttr("href", v.Src))
+
+	if v.Caption != "" {
+		opts.newline(&b, 1)
+		fmt.Fprintf(&b, `<figcaption>%s</figcaption>`, textToHTML(v.Caption, opts))
+	}
+
+	opts.newline(&b, 0)
+	b.WriteString(`</figure>`)
+	return w.Write(b.Bytes())
+}
+
+func (p *parser) parseVideo(token item) {
+	v := &Video{args: token.val}
+
+	words, named := parseArgs(token.val)
+	for _, w := range words {
+		switch {
+		case w == "autoplay":
+			v.Autoplay = true
+		case w == "loop":
+			v.Loop = true
+		case w == "muted":
+			v.Muted = true
+		case v.Src == "":
+			v.Src = w
+		default:
+			p.errorf("%%video: unexpected argument %q", w)
+		}
+	}
+	if v.Src == "" {
+		p.errorf("%%video: missing file name")
+	}
+
+	for k, val := range named {
+		switch k {
+		case "poster":
+			v.Poster = val
+		case "caption":
+			v.Caption = val
+		default:
+			p.errorf("%%video: unknown argument %q", k)
+		}
+	}
+
+	if text := p.collectItems(itemText); len(text) > 0 {
+		p.errorf("%%video doesn't take any text; got: %q", text[0])
+	}
+
+	p.doc.content = append(p.doc.content, v)
+}
+
+// "%audio episode.mp3 duration=42:10 caption="Episode 1"" plays an
+// audio file with the browser's controls. Its duration, given as
+// seconds, "mm:ss", or "hh:mm:ss", isn't shown but is kept with the
+// file on the Document (see Document.Audio), e.g. to build a podcast
+// feed from.
+
+// Audio is an audio file of a document.
+type Audio struct {
+	Src      string        `json:"src"`                 // File name or URL as written
+	Type     string        `json:"mime_type,omitempty"` // MIME type guessed from the file extension, or ""
+	Duration time.Duration `json:"duration,omitempty"`  // Zero if it isn't given
+	Caption  string        `json:"caption,omitempty"`   // Styled text as written
+}
+
+// Audio returns the audio files of the document's %audio blocks in
+// order.
+func (d document) Audio() []Audio {
+	var files []Audio
+	for _, b := range d.content {
+		if a, ok := b.(*AudioBlock); ok {
+			files = append(files, a.Audio)
+		}
+	}
+
+	return files
+}
+
+// AudioBlock is an %audio block. (Audio is what Document.Audio
+// returns.)
+type AudioBlock struct {
+	args string // Arguments as written
+	Audio
+}
+
+func (a *AudioBlock) WriteHTML(w io.Writer, opts *HTMLOptions) (int, error) {
+	var b bytes.Buffer
+
+	if opts == nil {
+		opts = &HTMLOptions{}
+	}
+
+	fmt.Fprintf(&b, `<figure class="%s">`, opts.class("audio"))
+	opts.newline(&b, 1)
+	fmt.Fprintf(&b, `<audio%s controls preload="metadata"><a%s>Download the audio</a></audio>`,
+		opts.urlAttr("src", a.Src), opts.urlAttr("href", a.Src))
+
+	if a.Caption != "" {
+		opts.newline(&b, 1)
+		fmt.Fprintf(&b, `<figcaption>%s</figcaption>`, textToHTML(a.Caption, opts))
+	}
+
+	opts.newline(&b, 0)
+	b.WriteString(`</figure>`)
+	return w.Write(b.Bytes())
+}
+
+// audioTypes maps the extension of an audio file to its MIME type.
+var audioTypes = map[string]string{
+	".mp3":  "audio/mpeg",
+	".m4a":  "audio/mp4",
+	".aac":  "audio/aac",
+	".ogg":  "audio/ogg",
+	".oga":  "audio/ogg",
+	".opus": "audio/ogg",
+	".wav":  "audio/wav",
+	".flac": "audio/flac",
+}
+
+func (p *parser) parseAudio(token item) {
+	a := &AudioBlock{args: token.val}
+
+	words, named := parseArgs(token.val)
+	for _, w := range words {
+		if a.Src != "" {
+			p.errorf("%%audio: unexpected argument %q", w)
+		}
+		a.Src = w
+	}
+	if a.Src == "" {
+		p.errorf("%%audio: missing file name")
+	}
+	a.Type = audioTypes[strings.ToLower(path.Ext(a.Src))]
+
+	for k, v := range named {
+		switch k {
+		case "duration":
+			d, err := parseDuration(v)
+			if err != nil {
+				p.errorf("%%audio: %v", err)
+			}
+			a.Duration = d
+		case "caption":
+			a.Caption = v
+		default:
+			p.errorf("%%audio: unknown argument %q", k)
+		}
+	}
+
+	if text := p.collectItems(itemText); len(text) > 0 {
+		p.errorf("%%audio doesn't take any text; got: %q", text[0])
+	}
+
+	p.doc.content = append(p.doc.content, a)
+}
+
+// parseDuration parses a duration given as seconds, "mm:ss", or
+// "hh:mm:ss", e.g. "90", "1:30", or "1:02:03".
+func parseDuration(s string) (time.Duration, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) > 3 {
+		return 0, fmt.Errorf("invalid duration %q: want seconds, mm:ss, or hh:mm:ss", s)
+	}
+
+	var d time.Duration
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 || i > 0 && n >= 60 {
+			return 0, fmt.Errorf("invalid duration %q: want seconds, mm:ss, or hh:mm:ss", s)
+		}
+		d = d*60 + time.Duration(n)
+	}
+
+	return d * time.Second, nil
+}
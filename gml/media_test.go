@@ -0,0 +1,85 @@
+package gml
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVideo(t *testing.T) {
+	doc, err := Parse("%video clips/demo.mp4 autoplay loop poster=clips/demo.jpg caption=\"The /new/ editor\"\n\n%video a&b.webm\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "<figure class=\"video\">" +
+		"<video src=\"clips/demo.mp4\" controls preload=\"metadata\" playsinline poster=\"clips/demo.jpg\" autoplay loop muted>" +
+		"<a href=\"clips/demo.mp4\">Download the video</a></video>" +
+		"<figcaption>The <em>new</em> editor</figcaption>" +
+		"</figure>" +
+		"<figure class=\"video\">" +
+		"<video src=\"a&amp;b.webm\" controls preload=\"metadata\" playsinline><a href=\"a&amp;b.webm\">Download the video</a></video>" +
+		"</figure>"
+	if got := doc.ExcerptHTML(2, &HTMLOptions{Minified: true}); got != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+
+	errTests := []struct {
+		input string
+		err   string
+	}{
+		{"%video\n", "missing file name"},
+		{"%video a.mp4 b.mp4\n", "unexpected argument \"b.mp4\""},
+		{"%video a.mp4 width=3\n", "unknown argument \"width\""},
+		{"%video a.mp4\ncaption\n", "doesn't take any text"},
+	}
+
+	for _, tt := range errTests {
+		_, err := Parse(tt.input)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%q: want error containing %q; got %v", tt.input, tt.err, err)
+		}
+	}
+}
+
+func TestAudio(t *testing.T) {
+	doc, err := Parse("%audio ep1.MP3 duration=1:02:03 caption=\"Episode /one/\"\n\n%audio https://cdn.example.com/ep2.ogg duration=90\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "<figure class=\"audio\">" +
+		"<audio src=\"ep1.MP3\" controls preload=\"metadata\"><a href=\"ep1.MP3\">Download the audio</a></audio>" +
+		"<figcaption>Episode <em>one</em></figcaption>" +
+		"</figure>"
+	if got := doc.ExcerptHTML(1, &HTMLOptions{Minified: true}); got != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+
+	wantAudio := []Audio{
+		{Src: "ep1.MP3", Type: "audio/mpeg", Duration: time.Hour + 2*time.Minute + 3*time.Second, Caption: "Episode /one/"},
+		{Src: "https://cdn.example.com/ep2.ogg", Type: "audio/ogg", Duration: 90 * time.Second},
+	}
+	if got := doc.Audio(); !reflect.DeepEqual(got, wantAudio) {
+		t.Errorf("want audio:\n%+v\ngot:\n%+v", wantAudio, got)
+	}
+
+	errTests := []struct {
+		input string
+		err   string
+	}{
+		{"%audio\n", "missing file name"},
+		{"%audio a.mp3 b.mp3\n", "unexpected argument \"b.mp3\""},
+		{"%audio a.mp3 duration=1:60\n", "invalid duration \"1:60\""},
+		{"%audio a.mp3 duration=1h\n", "invalid duration \"1h\""},
+		{"%audio a.mp3 size=3\n", "unknown argument \"size\""},
+	}
+
+	for _, tt := range errTests {
+		_, err := Parse(tt.input)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%q: want error containing %q; got %v", tt.input, tt.err, err)
+		}
+	}
+}
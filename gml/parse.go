@@ -2,11 +2,21 @@ package gml
 
 import (
 	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"net/url"
+	"path"
 	"regexp"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 // The idea here is to transform a GML document into HTML.
@@ -14,27 +24,228 @@ type Document interface {
 	Title() string
 	Subtitle() string
 	Date() time.Time
+	Excerpt() string
+	ExcerptHTML(n int, opts *HTMLOptions) string
+	WriteExcerptHTML(w io.Writer, n int, opts *HTMLOptions) (int, error)
+	BlocksHTML(opts *HTMLOptions) []string
 	HTML(opts *HTMLOptions) string
+	WriteHTML(w io.Writer, opts *HTMLOptions) (int, error)
+	PlainText() string
+	LaTeX() string
+	MarshalJSON() ([]byte, error)
+	Stats() Stats
+	Blocks() []Block
+	Headings() []Heading
+	Meta(key string) string
+	Tags() []string
+	Summary() string
+	Lang() string
+	Audio() []Audio
+	Warnings() []*ParseError
 }
 
 type HTMLOptions struct {
+	// Minified writes the HTML without line breaks or indentation.
 	Minified bool
+
+	// Indent is written once for each level a line of unminified HTML
+	// is nested, e.g. "  " for two spaces. It's a tab when empty.
+	Indent string
+
+	// InlineHTML writes HTML tags and entities in styled text as-is
+	// instead of escaping them. Only set it for documents from trusted
+	// authors; %html blocks are always written as-is unless they're
+	// sanitized.
+	InlineHTML bool
+
+	// Sanitize cuts the HTML of %html blocks, figures, and inline
+	// HTML down to an allowlist of safe elements and attributes, for
+	// documents from untrusted authors.
+	Sanitize bool
+
+	// Hooks write the blocks of some types in place of how they're
+	// usually written, keyed by the name of the type, e.g. "Figure"
+	// or "HeadingBlock".
+	Hooks map[string]RenderHook
+
+	// ClassPrefix is put before the classes GML writes, e.g. "gml-"
+	// for class="gml-title", so they can't collide with a page's own.
+	// Classes given with a figure's class= and those of highlighted
+	// code, which Chroma's stylesheets use, are left as they are.
+	ClassPrefix string
+
+	// Classes renames the classes GML writes, keyed by their usual
+	// name, e.g. {"heading-ref": "anchor"}. ClassPrefix isn't added to
+	// the new names, and a class renamed to "" is left out.
+	Classes map[string]string
+
+	// HeadingRef is the HTML of the link to each heading's anchor, "¶"
+	// by default, e.g. "#" or an <svg> icon. HeadingRefLabel is the
+	// link's aria-label for screen readers, if any.
+	HeadingRef      string
+	HeadingRefLabel string
+
+	// FootnoteBackref is the HTML of the link from each footnote back
+	// to where it's referenced, "⮐" by default. FootnoteBackrefLabel is
+	// the link's aria-label, if any, e.g. "Back to the text".
+	FootnoteBackref      string
+	FootnoteBackrefLabel string
+
+	// IDPrefix is put before the ids of headings and footnotes, and the
+	// links to them, e.g. "post-1-" for id="post-1-fn.1", so several
+	// documents can be written on one page. Ids given with a figure's
+	// id= and links written as "#anchor" are left as they are.
+	IDPrefix string
+
+	depth int               // Levels the block being written is nested
+	abbrs map[string]string // Terms to wrap in <abbr>, with their titles
+}
+
+// newline starts a line of unminified HTML nested n levels deeper than
+// the block being written. Nothing is written when Minified is true.
+func (opts *HTMLOptions) newline(w io.Writer, n int) {
+	if opts.Minified {
+		return
+	}
+
+	indent := opts.Indent
+	if indent == "" {
+		indent = "\t"
+	}
+	io.WriteString(w, "\n"+strings.Repeat(indent, opts.depth+n))
+}
+
+// nested returns the options for writing blocks nested n levels deeper
+// than the block being written, like those of a list item.
+func (opts *HTMLOptions) nested(n int) *HTMLOptions {
+	nested := *opts
+	nested.depth += n
+	return &nested
+}
+
+// class returns the classes names, like "task done", as they're
+// written in a class attribute: renamed and prefixed.
+func (opts *HTMLOptions) class(names string) string {
+	if opts.ClassPrefix == "" && opts.Classes == nil {
+		return names
+	}
+
+	var classes []string
+	for _, name := range strings.Fields(names) {
+		if c, ok := opts.Classes[name]; ok {
+			name = c
+		} else {
+			name = opts.ClassPrefix + name
+		}
+
+		if name != "" {
+			classes = append(classes, name)
+		}
+	}
+
+	return escapeHTML(strings.Join(classes, " "))
+}
+
+// id returns the id of a heading or footnote as it's written in an
+// id attribute or after the "#" of a link: prefixed.
+func (opts *HTMLOptions) id(id string) string {
+	return escapeHTML(opts.IDPrefix + id)
+}
+
+// urlAttr returns the attribute name="s" for the URL s, or "" when s
+// could run a script, e.g. "javascript:...". Like html/template, this
+// applies whether or not the HTML is sanitized.
+func (opts *HTMLOptions) urlAttr(name, s string) string {
+	if !scriptFreeURL(s, false) {
+		return ""
+	}
+
+	return fmt.Sprintf(` %s="%s"`, name, escapeHTML(s))
+}
+
+// imageAttr is like urlAttr for the URL of an image, which may also
+// be a data: URL.
+func (opts *HTMLOptions) imageAttr(name, s string) string {
+	if !scriptFreeURL(s, true) {
+		return ""
+	}
+
+	return fmt.Sprintf(` %s="%s"`, name, escapeHTML(s))
+}
+
+// scriptFreeURL reports whether the URL s can't run a script when it's
+// followed or loaded. Only images may be data: URLs.
+func scriptFreeURL(s string, image bool) bool {
+	u, err := url.Parse(strings.TrimSpace(s))
+	if err != nil {
+		return false
+	}
+
+	switch strings.ToLower(u.Scheme) {
+	case "javascript", "vbscript":
+		return false
+	case "data":
+		return image && strings.HasPrefix(strings.ToLower(u.Opaque), "image/")
+	}
+
+	return true
+}
+
+// link returns the attributes and content of a link to an anchor:
+// its aria-label, if any, and its HTML, or def if it has none.
+func (opts *HTMLOptions) link(html, label, def string) (attrs, content string) {
+	if label != "" {
+		attrs = fmt.Sprintf(` aria-label="%s"`, escapeHTML(label))
+	}
+	if html == "" {
+		html = def
+	}
+
+	return attrs, html
+}
+
+// escape escapes the plain text s unless inline HTML is allowed.
+func (opts *HTMLOptions) escape(s string) string {
+	switch {
+	case !opts.InlineHTML:
+		return escapeHTML(s)
+	case opts.Sanitize:
+		return sanitizeHTML(s)
+	}
+
+	return s
 }
 
-// writeStringUnminified will not write string s to io.Writer w when Minified is true
-func (opts *HTMLOptions) writeStringUnminified(w io.Writer, s string) {
-	if !opts.Minified {
-		w.Write([]byte(s))
+// rawHTML returns the HTML s an author wrote, sanitized if need be.
+func (opts *HTMLOptions) rawHTML(s string) string {
+	if opts.Sanitize {
+		return sanitizeHTML(s)
 	}
+
+	return s
 }
 
-type block interface {
+// Block is a block of a document, like a paragraph, heading, or list.
+// Each kind of block is a type in this package, e.g. *Paragraph; see
+// Walk for going through them.
+type Block interface {
 	WriteHTML(w io.Writer, opts *HTMLOptions) (int, error)
 }
 
 type document struct {
 	metadata
-	content []block
+	content []Block
+	abbrs   []declaredAbbr // From %abbr, in the order they're declared
+
+	src       string
+	positions []int // Byte offset in src where each block of content starts
+	warnings  []*ParseError
+}
+
+// Warnings returns the errors that were let through by parsing the
+// document leniently (see ParseOptions.Strict).
+func (d document) Warnings() []*ParseError {
+	return d.warnings
 }
 
 func (d document) Title() string {
@@ -49,32 +260,157 @@ func (d document) Date() time.Time {
 	return d.metadata.date
 }
 
-// HTML writes a GML document into HTML. As long as we are using
-// string buffers the error is always nil so it can be ignored.
+// Lang returns the language of the document given by %lang, or "" if
+// it doesn't say.
+func (d document) Lang() string {
+	return d.metadata.lang
+}
+
+// Tags returns the tags of the document in the order they're written.
+func (d document) Tags() []string {
+	return d.metadata.tags
+}
+
+// Excerpt returns the raw text of the document's first paragraph.
+func (d document) Excerpt() string {
+	for _, block := range d.content {
+		if p, ok := block.(*Paragraph); ok {
+			return p.Text
+		}
+	}
+
+	return ""
+}
+
+// Summary returns a plain text description of the document: its
+// %summary or else the text of its first paragraph, without markup.
+func (d document) Summary() string {
+	if d.summary != "" {
+		return plainText(d.summary)
+	}
+
+	return plainText(d.Excerpt())
+}
+
+// HTML writes a GML document into HTML. Writing to a string buffer
+// cannot fail, but a hook can: with hooks that can fail, use WriteHTML
+// instead; HTML stops at the first block a hook fails to write.
 func (d document) HTML(opts *HTMLOptions) string {
 	var buf strings.Builder
+	d.WriteHTML(&buf, opts) // Only a hook can fail; see WriteHTML for its error
+	return buf.String()
+}
+
+// WriteHTML writes the GML document as HTML to w a block at a time,
+// e.g. straight into a file or an HTTP response. It returns the number
+// of bytes written and the first error writing to w.
+func (d document) WriteHTML(w io.Writer, opts *HTMLOptions) (int, error) {
+	cw := &countingWriter{w: w}
+
+	if opts == nil {
+		opts = &HTMLOptions{}
+	}
+
+	if d.lang != "" {
+		fmt.Fprintf(cw, `<article lang="%s">`, d.lang)
+	} else {
+		io.WriteString(cw, `<article>`)
+	}
+	opts.newline(cw, 0)
+
+	d.metadata.WriteHTML(cw, opts)
+	opts.newline(cw, 0)
+
+	for i, block := range d.content {
+		if _, err := writeBlock(cw, block, d.abbrOptions(opts, i)); err != nil {
+			return cw.n, err // Maybe from a hook rather than w
+		}
+		opts.newline(cw, 0)
+	}
+
+	io.WriteString(cw, `</article>`)
+	return cw.n, cw.err
+}
+
+// countingWriter adds up the bytes written to w and keeps the first
+// error, after which it doesn't write any more.
+type countingWriter struct {
+	w   io.Writer
+	n   int
+	err error
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	if cw.err != nil {
+		return 0, cw.err
+	}
+
+	n, err := cw.w.Write(p)
+	cw.n += n
+	cw.err = err
+	return n, err
+}
+
+// ExcerptHTML writes the first n blocks of a GML document into HTML
+// without the surrounding article and header. Because whole blocks
+// are rendered, the result is always well-formed. With hooks that can
+// fail, use WriteExcerptHTML instead; ExcerptHTML stops at the first
+// block a hook fails to write.
+func (d document) ExcerptHTML(n int, opts *HTMLOptions) string {
+	var buf strings.Builder
+	d.WriteExcerptHTML(&buf, n, opts) // Only a hook can fail; see WriteExcerptHTML for its error
+	return buf.String()
+}
+
+// WriteExcerptHTML writes the first n blocks of a GML document as HTML
+// to w like ExcerptHTML. It returns the number of bytes written and the
+// first error from a hook or from writing to w.
+func (d document) WriteExcerptHTML(w io.Writer, n int, opts *HTMLOptions) (int, error) {
+	cw := &countingWriter{w: w}
 
 	if opts == nil {
 		opts = &HTMLOptions{}
 	}
 
-	buf.WriteString(`<article>`)
-	opts.writeStringUnminified(&buf, "\n")
+	if n < 0 {
+		n = 0
+	} else if n > len(d.content) {
+		n = len(d.content)
+	}
+
+	for i, block := range d.content[:n] {
+		if i > 0 {
+			opts.newline(cw, 0)
+		}
 
-	if _, err := d.metadata.WriteHTML(&buf, opts); err != nil {
-		return "unreachable: DON'T PANIC"
+		if _, err := writeBlock(cw, block, d.abbrOptions(opts, i)); err != nil {
+			return cw.n, err
+		}
 	}
-	opts.writeStringUnminified(&buf, "\n")
 
-	for _, block := range d.content {
-		if _, err := block.WriteHTML(&buf, opts); err != nil {
-			return "unreachable: DON'T PANIC"
+	return cw.n, cw.err
+}
+
+// BlocksHTML writes each block of a GML document into HTML separately
+// so callers can compare or rearrange documents block by block. With
+// hooks that can fail, write the blocks with WriteBlockHTML instead;
+// BlocksHTML leaves out the blocks from the first one a hook fails to
+// write.
+func (d document) BlocksHTML(opts *HTMLOptions) []string {
+	if opts == nil {
+		opts = &HTMLOptions{}
+	}
+
+	blocks := make([]string, 0, len(d.content))
+	for i, block := range d.content {
+		var buf strings.Builder
+		if _, err := writeBlock(&buf, block, d.abbrOptions(opts, i)); err != nil {
+			break // See WriteBlockHTML for the error
 		}
-		opts.writeStringUnminified(&buf, "\n")
+		blocks = append(blocks, buf.String())
 	}
 
-	buf.WriteString(`</article>`)
-	return buf.String()
+	return blocks
 }
 
 type metadata struct {
@@ -82,6 +418,53 @@ type metadata struct {
 	subtitle string
 	date     time.Time
 	author   string
+	tags     []string
+	summary  string
+	lang     string      // Language tag, e.g. "en" or "pt-BR"
+	extra    []metaField // Other metadata in the order it's written
+}
+
+// metaField is metadata that GML doesn't know about, like
+// "%license CC-BY".
+type metaField struct {
+	key   string // Lowercase and without the "%"
+	value string
+}
+
+// Meta returns the value of the metadata key, e.g. "license" for
+// "%license CC-BY", or "" if the document doesn't have it. Keys are
+// case-insensitive and the date is given as YYYY-MM-DD.
+func (d document) Meta(key string) string {
+	key = strings.ToLower(strings.TrimPrefix(key, "%"))
+
+	switch key {
+	case "title":
+		return d.title
+	case "subtitle":
+		return d.subtitle
+	case "author":
+		return d.author
+	case "tags":
+		return strings.Join(d.tags, ", ")
+	case "summary":
+		return d.summary
+	case "lang":
+		return d.lang
+	case "date":
+		if d.date.IsZero() {
+			return ""
+		}
+		return d.date.Format("2006-01-02")
+	}
+
+	// The last one wins, like the built-in metadata
+	for i := len(d.extra) - 1; i >= 0; i-- {
+		if d.extra[i].key == key {
+			return d.extra[i].value
+		}
+	}
+
+	return ""
 }
 
 func (m *metadata) WriteHTML(w io.Writer, opts *HTMLOptions) (int, error) {
@@ -92,68 +475,179 @@ func (m *metadata) WriteHTML(w io.Writer, opts *HTMLOptions) (int, error) {
 	}
 
 	b.WriteString(`<header>`)
-	opts.writeStringUnminified(&b, "\n")
 
 	if m.title != "" {
-		opts.writeStringUnminified(&b, "\t")
-		fmt.Fprintf(&b, `<h1 class="title">%s</h1>`, m.title)
-		opts.writeStringUnminified(&b, "\n")
+		opts.newline(&b, 1)
+		fmt.Fprintf(&b, `<h1 class="%s">%s</h1>`, opts.class("title"), opts.escape(m.title))
 	}
 
 	if m.subtitle != "" {
-		opts.writeStringUnminified(&b, "\t")
-		fmt.Fprintf(&b, `<p class="subtitle">%s</p>`, m.subtitle)
-		opts.writeStringUnminified(&b, "\n")
+		opts.newline(&b, 1)
+		fmt.Fprintf(&b, `<p class="%s">%s</p>`, opts.class("subtitle"), opts.escape(m.subtitle))
 	}
 
 	if !m.date.IsZero() {
-		opts.writeStringUnminified(&b, "\t")
+		opts.newline(&b, 1)
 
-		b.WriteString(`<p class="pubdate">`)
+		fmt.Fprintf(&b, `<p class="%s">`, opts.class("pubdate"))
 		fmt.Fprintf(&b, `<time datetime="%s">`, m.date.Format("2006-01-02"))
 		b.WriteString(m.date.Format("January 2, 2006"))
 		b.WriteString(`</time>`)
 		b.WriteString(`</p>`)
-		opts.writeStringUnminified(&b, "\n")
 	}
 
 	if m.author != "" {
-		opts.writeStringUnminified(&b, "\t")
-		fmt.Fprintf(&b, `<p class="author">%s</p>`, m.author)
-		opts.writeStringUnminified(&b, "\n")
+		opts.newline(&b, 1)
+		fmt.Fprintf(&b, `<p class="%s">%s</p>`, opts.class("author"), opts.escape(m.author))
 	}
 
+	opts.newline(&b, 0)
 	b.WriteString(`</header>`)
 	return w.Write(b.Bytes())
 }
 
-type heading struct {
-	level int
-	text  string
+// HeadingBlock is a heading, e.g. "** Install". (Heading is what
+// Document.Headings returns.)
+type HeadingBlock struct {
+	Level int    `json:"level"`        // 1 for "*", 2 for "**", and so on
+	Text  string `json:"text"`         // Styled text as written
+	ID    string `json:"id,omitempty"` // Anchor given with {#id}, or "" to slugify the text
+
+	anchor string // Unique id in the document, see assignAnchors
 }
 
-func (h *heading) WriteHTML(w io.Writer, opts *HTMLOptions) (int, error) {
+func (h *HeadingBlock) WriteHTML(w io.Writer, opts *HTMLOptions) (int, error) {
 	var b bytes.Buffer
 
 	if opts == nil {
 		opts = &HTMLOptions{}
 	}
 
-	level := h.level + 1 // There should be only one <h1> per document
-	ref := slugify(h.text)
+	level := h.Level + 1 // There should be only one <h1> per document
+	ref := h.anchor
+	if ref == "" {
+		ref = h.ref()
+	}
+	ref = opts.id(ref)
 
-	fmt.Fprintf(&b, `<h%d id="%s" class="heading">`, level, ref)
-	fmt.Fprintf(&b, `%s <a class="heading-ref" href="#%s">#</a>`, textToHTML(h.text), ref)
+	fmt.Fprintf(&b, `<h%d id="%s" class="%s">`, level, ref, opts.class("heading"))
+	attrs, symbol := opts.link(opts.HeadingRef, opts.HeadingRefLabel, "¶")
+	fmt.Fprintf(&b, `%s <a class="%s" href="#%s"%s>%s</a>`, textToHTML(h.Text, opts), opts.class("heading-ref"), ref, attrs, symbol)
 	fmt.Fprintf(&b, `</h%d>`, level)
 
 	return w.Write(b.Bytes())
 }
 
-type unorderedList struct {
-	items []string
+// ref returns the heading's anchor before it's made unique.
+func (h *HeadingBlock) ref() string {
+	if h.ID != "" {
+		return h.ID
+	}
+
+	return Slugify(reTag.ReplaceAllString(h.Text, "")) // Without inline HTML
+}
+
+// assignAnchors gives each heading a unique anchor. Explicit anchors
+// are kept as they are and a slug that is already taken gets a number,
+// e.g. the second "Notes" heading is "notes-2".
+func assignAnchors(blocks []Block) {
+	used := make(map[string]bool)
+	for _, b := range blocks {
+		if h, ok := b.(*HeadingBlock); ok && h.ID != "" {
+			h.anchor = h.ID
+			used[h.ID] = true
+		}
+	}
+
+	for _, b := range blocks {
+		h, ok := b.(*HeadingBlock)
+		if !ok || h.ID != "" {
+			continue
+		}
+
+		base := h.ref()
+		if base == "" {
+			base = "section" // e.g. a heading of only emoji
+		}
+		h.anchor = base
+		for n := 2; used[h.anchor]; n++ {
+			h.anchor = fmt.Sprintf("%s-%d", base, n)
+		}
+		used[h.anchor] = true
+	}
+}
+
+// ListItems are the items of a list. An item continued onto indented
+// lines may hold several blocks, like paragraphs or code, so those
+// items are also parsed as a document of their own.
+type ListItems struct {
+	Items  []string  // Item text with continuation lines unindented
+	Blocks [][]Block // Blocks of each item, or nil if it's only text
 }
 
-func (l *unorderedList) WriteHTML(w io.Writer, opts *HTMLOptions) (int, error) {
+// itemHTML writes the content of the i-th item. Its blocks are nested
+// under the item, which is nested under the list. Only a hook for one
+// of its blocks can fail.
+func (l *ListItems) itemHTML(i int, opts *HTMLOptions) (string, error) {
+	if i >= len(l.Blocks) || l.Blocks[i] == nil {
+		return textToHTML(l.Items[i], opts), nil
+	}
+
+	var b strings.Builder
+	opts = opts.nested(1)
+	for j, block := range l.Blocks[i] {
+		if j > 0 {
+			opts.newline(&b, 0)
+		}
+		if _, err := writeBlock(&b, block, opts); err != nil {
+			return "", err
+		}
+	}
+
+	return b.String(), nil
+}
+
+// taskHTML writes the i-th item of a list as a <li>. Items starting
+// with a checkbox, "[ ]" or "[x]", are tasks.
+func (l *ListItems) taskHTML(i int, opts *HTMLOptions) (string, error) {
+	box, text := cutCheckbox(l.Items[i])
+
+	content := textToHTML(text, opts)
+	if box == "" || i < len(l.Blocks) && l.Blocks[i] != nil {
+		var err error
+		if content, err = l.itemHTML(i, opts); err != nil {
+			return "", err
+		}
+	}
+
+	switch box {
+	case "":
+		return fmt.Sprintf(`<li>%s</li>`, content), nil
+	case "[ ]":
+		return fmt.Sprintf(`<li class="%s"><input type="checkbox" disabled> %s</li>`, opts.class("task"), content), nil
+	}
+
+	return fmt.Sprintf(`<li class="%s"><input type="checkbox" checked disabled> %s</li>`, opts.class("task done"), content), nil
+}
+
+// cutCheckbox returns the checkbox that starts a task list item and
+// the rest of its text, or "" and the text if it isn't a task.
+func cutCheckbox(text string) (box, rest string) {
+	for _, box := range []string{"[ ]", "[x]", "[X]"} {
+		if rest, ok := strings.CutPrefix(text, box); ok && (rest == "" || isSpaceByte(rest[0])) {
+			return strings.ToLower(box), strings.TrimLeft(rest, " \t")
+		}
+	}
+
+	return "", text
+}
+
+// UnorderedList is a list of "-" items.
+type UnorderedList struct {
+	ListItems
+}
+
+func (l *UnorderedList) WriteHTML(w io.Writer, opts *HTMLOptions) (int, error) {
 	var b bytes.Buffer
 
 	if opts == nil {
@@ -161,23 +655,26 @@ func (l *unorderedList) WriteHTML(w io.Writer, opts *HTMLOptions) (int, error) {
 	}
 
 	b.WriteString(`<ul>`)
-	opts.writeStringUnminified(&b, "\n")
+	for i := range l.Items {
+		item, err := l.taskHTML(i, opts)
+		if err != nil {
+			return 0, err
+		}
 
-	for _, text := range l.items {
-		opts.writeStringUnminified(&b, "\t")
-		fmt.Fprintf(&b, `<li>%s</li>`, textToHTML(text))
-		opts.writeStringUnminified(&b, "\n")
+		opts.newline(&b, 1)
+		b.WriteString(item)
 	}
-
+	opts.newline(&b, 0)
 	b.WriteString(`</ul>`)
 	return w.Write(b.Bytes())
 }
 
-type orderedList struct {
-	items []string
+// OrderedList is a list of numbered items, e.g. "1. ".
+type OrderedList struct {
+	ListItems
 }
 
-func (l *orderedList) WriteHTML(w io.Writer, opts *HTMLOptions) (int, error) {
+func (l *OrderedList) WriteHTML(w io.Writer, opts *HTMLOptions) (int, error) {
 	var b bytes.Buffer
 
 	if opts == nil {
@@ -185,224 +682,718 @@ func (l *orderedList) WriteHTML(w io.Writer, opts *HTMLOptions) (int, error) {
 	}
 
 	b.WriteString(`<ol>`)
-	opts.writeStringUnminified(&b, "\n")
+	for i := range l.Items {
+		item, err := l.taskHTML(i, opts)
+		if err != nil {
+			return 0, err
+		}
 
-	for _, text := range l.items {
-		opts.writeStringUnminified(&b, "\t")
-		fmt.Fprintf(&b, `<li>%s</li>`, textToHTML(text))
-		opts.writeStringUnminified(&b, "\n")
+		opts.newline(&b, 1)
+		b.WriteString(item)
 	}
-
+	opts.newline(&b, 0)
 	b.WriteString(`</ol>`)
 	return w.Write(b.Bytes())
 }
 
-type paragraph struct {
-	text string
+// Paragraph is a paragraph of styled text.
+type Paragraph struct {
+	Text string `json:"text"` // Styled text as written
 }
 
-func (p *paragraph) WriteHTML(w io.Writer, opts *HTMLOptions) (int, error) {
+func (p *Paragraph) WriteHTML(w io.Writer, opts *HTMLOptions) (int, error) {
 	var b bytes.Buffer
 
 	if opts == nil {
 		opts = &HTMLOptions{}
 	}
 
-	fmt.Fprintf(&b, `<p>%s</p>`, textToHTML(p.text))
+	fmt.Fprintf(&b, `<p>%s</p>`, textToHTML(p.Text, opts))
 	return w.Write(b.Bytes())
 }
 
-type figure struct {
-	args    string
-	html    string
-	caption string
+// Figure is an image, or other HTML, with a caption. Its arguments
+// link it with href= and set the class= and id= of the <figure>; alt=,
+// width=, height=, and loading= are added to its first <img>.
+type Figure struct {
+	args    string // Arguments as written
+	HTML    string `json:"html"`              // HTML as written
+	Caption string `json:"caption,omitempty"` // Styled text as written
+
+	Href  string `json:"href,omitempty"`  // URL the figure links to, if any
+	Class string `json:"class,omitempty"` // Class of the <figure>, if any
+	ID    string `json:"id,omitempty"`    // Id of the <figure>, if any
+	Img   []Attr `json:"img,omitempty"`   // Attributes to add to the <img>
+}
+
+// Attr is an HTML attribute and its unescaped value.
+type Attr struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
 }
 
-func (f *figure) WriteHTML(w io.Writer, opts *HTMLOptions) (int, error) {
+func (f *Figure) WriteHTML(w io.Writer, opts *HTMLOptions) (int, error) {
 	var b bytes.Buffer
 
 	if opts == nil {
 		opts = &HTMLOptions{}
 	}
 
-	b.WriteString(`<figure>`)
-	opts.writeStringUnminified(&b, "\n")
-
-	reHref := regexp.MustCompile(`href="(.+)"`)
-	href := reHref.FindStringSubmatch(f.args)
-
-	if href != nil {
-		opts.writeStringUnminified(&b, "\t")
-		fmt.Fprintf(&b, `<a href="%s">`, href[1])
-		opts.writeStringUnminified(&b, "\n")
-		opts.writeStringUnminified(&b, "\t") // Indent for next line
+	b.WriteString(`<figure`)
+	if f.ID != "" {
+		fmt.Fprintf(&b, ` id="%s"`, escapeHTML(f.ID))
 	}
-
-	opts.writeStringUnminified(&b, "\t")
-	b.WriteString(f.html)
-	opts.writeStringUnminified(&b, "\n")
-
-	if href != nil {
-		opts.writeStringUnminified(&b, "\t")
+	if f.Class != "" {
+		fmt.Fprintf(&b, ` class="%s"`, escapeHTML(f.Class))
+	}
+	b.WriteString(`>`)
+
+	if f.Href != "" {
+		opts.newline(&b, 1)
+		fmt.Fprintf(&b, `<a%s>`, opts.urlAttr("href", f.Href))
+		opts.newline(&b, 2)
+		b.WriteString(opts.rawHTML(f.content()))
+		opts.newline(&b, 1)
 		b.WriteString(`</a>`)
-		opts.writeStringUnminified(&b, "\n")
+	} else {
+		opts.newline(&b, 1)
+		b.WriteString(opts.rawHTML(f.content()))
 	}
 
-	if f.caption != "" {
-		opts.writeStringUnminified(&b, "\t")
-		fmt.Fprintf(&b, `<figcaption>%s</figcaption>`, f.caption)
-		opts.writeStringUnminified(&b, "\n")
+	if f.Caption != "" {
+		opts.newline(&b, 1)
+		fmt.Fprintf(&b, `<figcaption>%s</figcaption>`, textToHTML(f.Caption, opts))
 	}
 
+	opts.newline(&b, 0)
 	b.WriteString(`</figure>`)
 	return w.Write(b.Bytes())
 }
 
-type pre struct {
-	text string
+// content returns the HTML of the figure with the attributes from its
+// arguments added to its first <img>.
+func (f *Figure) content() string {
+	if len(f.Img) == 0 {
+		return f.HTML
+	}
+
+	loc := reImg.FindStringIndex(f.HTML)
+	if loc == nil {
+		return f.HTML
+	}
+
+	var attrs strings.Builder
+	for _, a := range f.Img {
+		fmt.Fprintf(&attrs, ` %s="%s"`, a.Name, escapeHTML(a.Value))
+	}
+
+	i := loc[0] + len("<img")
+	return f.HTML[:i] + attrs.String() + f.HTML[i:]
+}
+
+// Pre is preformatted text, usually code.
+type Pre struct {
+	args string // Arguments as written, e.g. "go hl=3-5"
+	Lang string `json:"lang,omitempty"` // Language to highlight the text as, if any
+	Text string `json:"text"`           // Text as written, or the code read from File
+	codeOptions
+
+	File    string `json:"file,omitempty"` // Name of the file the code is from
+	Caption string `json:"caption,omitempty"`
 }
 
-func (p *pre) WriteHTML(w io.Writer, opts *HTMLOptions) (int, error) {
+func (p *Pre) WriteHTML(w io.Writer, opts *HTMLOptions) (int, error) {
 	var b bytes.Buffer
 
 	if opts == nil {
 		opts = &HTMLOptions{}
 	}
 
-	fmt.Fprintf(&b, `<pre>%s</pre>`, p.text)
+	if p.File == "" && p.Caption == "" {
+		p.writeCode(&b)
+		return w.Write(b.Bytes())
+	}
+
+	// Label the code with its file name and caption
+	fmt.Fprintf(&b, `<figure class="%s">`, opts.class("code"))
+
+	opts.newline(&b, 1)
+	b.WriteString(`<figcaption>`)
+	if p.File != "" {
+		fmt.Fprintf(&b, `<code class="%s">%s</code>`, opts.class("filename"), escapeHTML(p.File))
+	}
+	if p.File != "" && p.Caption != "" {
+		b.WriteString(" ")
+	}
+	b.WriteString(textToHTML(p.Caption, opts))
+	b.WriteString(`</figcaption>`)
+
+	opts.newline(&b, 1)
+	p.writeCode(&b)
+
+	opts.newline(&b, 0)
+	b.WriteString(`</figure>`)
 	return w.Write(b.Bytes())
 }
 
-type html struct {
-	text string
+// writeCode writes the <pre> element of a code block.
+func (p *Pre) writeCode(b *bytes.Buffer) {
+	lang := p.Lang
+	if lang == "" && p.File != "" {
+		lang = languageOf(p.File)
+	}
+	if lang != "" && !knownLanguage(lang) {
+		lang = "" // Fall back to plain text
+	}
+
+	if lang != "" || p.lineNumbers || p.highlighted != nil {
+		// Nothing is written on error so fall back to plain text
+		if err := highlight(b, p.Text, lang, p.codeOptions); err == nil {
+			return
+		}
+	}
+
+	fmt.Fprintf(b, `<pre>%s</pre>`, p.Text)
+}
+
+// RawHTML is an %html block, written out as-is.
+type RawHTML struct {
+	Text string `json:"text"`
 }
 
-func (h *html) WriteHTML(w io.Writer, opts *HTMLOptions) (int, error) {
+func (h *RawHTML) WriteHTML(w io.Writer, opts *HTMLOptions) (int, error) {
 	var b bytes.Buffer
 
 	if opts == nil {
 		opts = &HTMLOptions{}
 	}
 
-	b.WriteString(h.text)
+	b.WriteString(opts.rawHTML(h.Text))
 	return w.Write(b.Bytes())
 }
 
-type blockquote struct {
-	text string
+// Blockquote is a quotation. It may say who it's from on a last line
+// starting with "-- " and link to its source with cite=.
+type Blockquote struct {
+	args        string // Arguments as written
+	Text        string `json:"text"`                  // Styled text as written
+	Cite        string `json:"cite,omitempty"`        // URL of the source
+	Attribution string `json:"attribution,omitempty"` // Styled text after the "-- ", if any
 }
 
-func (q *blockquote) WriteHTML(w io.Writer, opts *HTMLOptions) (int, error) {
+func (q *Blockquote) WriteHTML(w io.Writer, opts *HTMLOptions) (int, error) {
 	var b bytes.Buffer
 
 	if opts == nil {
 		opts = &HTMLOptions{}
 	}
 
-	fmt.Fprintf(&b, `<blockquote>%s</blockquote>`, textToHTML(q.text))
+	var cite string
+	if q.Cite != "" {
+		cite = opts.urlAttr("cite", q.Cite)
+	}
+
+	if q.Attribution == "" {
+		fmt.Fprintf(&b, `<blockquote%s>%s</blockquote>`, cite, textToHTML(q.Text, opts))
+		return w.Write(b.Bytes())
+	}
+
+	fmt.Fprintf(&b, `<figure class="%s">`, opts.class("quote"))
+	opts.newline(&b, 1)
+	fmt.Fprintf(&b, `<blockquote%s>%s</blockquote>`, cite, textToHTML(q.Text, opts))
+	opts.newline(&b, 1)
+	fmt.Fprintf(&b, `<figcaption>— <cite>%s</cite></figcaption>`, textToHTML(q.Attribution, opts))
+	opts.newline(&b, 0)
+	b.WriteString(`</figure>`)
+
 	return w.Write(b.Bytes())
 }
 
-type footnotes struct {
-	items []string
+// Admonition is a callout like a note or warning. It has a title,
+// which defaults to its kind, e.g. "Note".
+type Admonition struct {
+	Kind  string `json:"kind"`            // "note", "warning", or "tip"
+	Title string `json:"title,omitempty"` // Title as written, or "" for the default
+	Text  string `json:"text"`            // Styled text as written
+}
+
+// admonitions maps the keyword of each admonition to its kind.
+var admonitions = map[itemType]string{
+	itemNote:    "note",
+	itemWarning: "warning",
+	itemTip:     "tip",
 }
 
-func (f *footnotes) WriteHTML(w io.Writer, opts *HTMLOptions) (int, error) {
+func (a *Admonition) WriteHTML(w io.Writer, opts *HTMLOptions) (int, error) {
 	var b bytes.Buffer
 
 	if opts == nil {
 		opts = &HTMLOptions{}
 	}
 
-	b.WriteString(`<footer>`)
-	opts.writeStringUnminified(&b, "\n")
-
-	opts.writeStringUnminified(&b, "\t")
-	b.WriteString(`<ol>`)
-	opts.writeStringUnminified(&b, "\n")
-
-	for i, text := range f.items {
-		id := i + 1 // Are you a Nihilist or Unitarian?
-
-		opts.writeStringUnminified(&b, "\t\t")
-		fmt.Fprintf(&b, `<li id="fn.%d">%s <a href="#fnr.%d">⮐</a></li>`, id, textToHTML(text), id)
-		opts.writeStringUnminified(&b, "\n")
+	title := a.Title
+	if title == "" {
+		title = strings.ToUpper(a.Kind[:1]) + a.Kind[1:]
 	}
 
-	opts.writeStringUnminified(&b, "\t")
-	b.WriteString(`</ol>`)
-	opts.writeStringUnminified(&b, "\n")
+	fmt.Fprintf(&b, `<aside class="%s">`, opts.class("admonition "+a.Kind))
+	opts.newline(&b, 1)
+	fmt.Fprintf(&b, `<p class="%s">%s</p>`, opts.class("admonition-title"), textToHTML(title, opts))
+	opts.newline(&b, 1)
+	fmt.Fprintf(&b, `<p>%s</p>`, textToHTML(a.Text, opts))
+	opts.newline(&b, 0)
+	b.WriteString(`</aside>`)
 
-	b.WriteString(`</footer>`)
 	return w.Write(b.Bytes())
 }
 
-type parser struct {
-	doc       document
-	lex       *lexer
-	peekCount int
-	token     [1]item // Single token look-ahead (array makes it easier to expand later if we need more)
+// Verse is a stanza of poetry or lyrics. Unlike a paragraph, its line
+// breaks and indentation are kept.
+type Verse struct {
+	Lines []string `json:"lines"`
 }
 
-func (p *parser) next() item {
-	if p.peekCount > 0 {
-		p.peekCount--
-	} else {
-		p.token[0] = p.lex.nextItem()
+func (v *Verse) WriteHTML(w io.Writer, opts *HTMLOptions) (int, error) {
+	var b bytes.Buffer
+
+	if opts == nil {
+		opts = &HTMLOptions{}
 	}
 
-	return p.token[p.peekCount]
-}
+	fmt.Fprintf(&b, `<p class="%s">`, opts.class("verse"))
+	for i, line := range v.Lines {
+		if i > 0 {
+			b.WriteString(`<br>`)
+			opts.newline(&b, 0)
+		}
 
-func (p *parser) peek() item {
-	if p.peekCount > 0 {
-		return p.token[p.peekCount-1] // With single token look-ahead this is always zero
+		text := strings.TrimLeft(line, " ")
+		b.WriteString(strings.Repeat("&nbsp;", len(line)-len(text)))
+		b.WriteString(textToHTML(text, opts))
 	}
+	b.WriteString(`</p>`)
 
-	p.peekCount = 1
-	p.token[0] = p.lex.nextItem()
-	return p.token[0]
+	return w.Write(b.Bytes())
 }
 
-func (p *parser) backup() {
-	// Backing up is the same as pretending we peeked at the next token
-	// because it makes the next call to next() a no-op.
-	p.peekCount++
+// Comment is a note to the author that is never rendered. Comments are
+// only kept in the document for Format.
+type Comment struct {
+	args  string // Rest of the %comment line
+	Text  string `json:"text"`
+	block bool   // Written as a %comment block instead of ";;" lines
 }
 
-func (p *parser) errorf(format string, args ...interface{}) {
-	format = fmt.Sprintf("gml: token: %s:%d: %s", p.token[0], p.token[0].pos, format)
-	panic(fmt.Errorf(format, args...))
+func (c *Comment) WriteHTML(w io.Writer, opts *HTMLOptions) (int, error) {
+	return 0, nil
 }
 
-func (p *parser) parseMetadata(token item) {
-	// Skip empty entries
-	if token.val == "" {
-		return
+// Table is a table of styled text.
+type Table struct {
+	Header []string   `json:"header,omitempty"` // Nil when the table has no header row
+	Align  []string   `json:"align,omitempty"`  // "left", "center", "right", or "" for each column
+	Rows   [][]string `json:"rows"`
+}
+
+func (t *Table) WriteHTML(w io.Writer, opts *HTMLOptions) (int, error) {
+	var b bytes.Buffer
+
+	if opts == nil {
+		opts = &HTMLOptions{}
 	}
 
-	switch token.typ {
-	case itemTitle:
-		p.doc.metadata.title = token.val
-	case itemSubtitle:
-		p.doc.metadata.subtitle = token.val
-	case itemDate:
-		dt, err := time.Parse("2006-01-02", token.val)
-		if err != nil {
-			p.errorf("invalid date format: want: YYYY-MM-DD; got: %s", token.val)
-			return
+	cols := len(t.Header)
+	for _, row := range t.Rows {
+		if len(row) > cols {
+			cols = len(row)
+		}
+	}
+
+	writeRow := func(cell string, row []string) {
+		opts.newline(&b, 2)
+		b.WriteString(`<tr>`)
+		for i := 0; i < cols; i++ {
+			var text, style string
+			if i < len(row) {
+				text = textToHTML(row[i], opts)
+			}
+			if i < len(t.Align) && t.Align[i] != "" {
+				style = fmt.Sprintf(` style="text-align: %s"`, t.Align[i])
+			}
+			fmt.Fprintf(&b, `<%s%s>%s</%s>`, cell, style, text, cell)
+		}
+		b.WriteString(`</tr>`)
+	}
+
+	b.WriteString(`<table>`)
+
+	if t.Header != nil {
+		opts.newline(&b, 1)
+		b.WriteString(`<thead>`)
+		writeRow("th", t.Header)
+		opts.newline(&b, 1)
+		b.WriteString(`</thead>`)
+	}
+
+	opts.newline(&b, 1)
+	b.WriteString(`<tbody>`)
+	for _, row := range t.Rows {
+		writeRow("td", row)
+	}
+	opts.newline(&b, 1)
+	b.WriteString(`</tbody>`)
+
+	opts.newline(&b, 0)
+	b.WriteString(`</table>`)
+	return w.Write(b.Bytes())
+}
+
+// Definition is a term of a definition list and its definitions.
+type Definition struct {
+	Term        string   `json:"term"`        // Styled text as written
+	Definitions []string `json:"definitions"` // Styled text as written
+}
+
+// DefinitionList is a %dl list of terms and their definitions.
+type DefinitionList struct {
+	Items []Definition `json:"items"`
+}
+
+func (l *DefinitionList) WriteHTML(w io.Writer, opts *HTMLOptions) (int, error) {
+	var b bytes.Buffer
+
+	if opts == nil {
+		opts = &HTMLOptions{}
+	}
+
+	b.WriteString(`<dl>`)
+
+	for _, d := range l.Items {
+		opts.newline(&b, 1)
+		fmt.Fprintf(&b, `<dt>%s</dt>`, textToHTML(d.Term, opts))
+
+		for _, def := range d.Definitions {
+			opts.newline(&b, 1)
+			fmt.Fprintf(&b, `<dd>%s</dd>`, textToHTML(def, opts))
+		}
+	}
+
+	opts.newline(&b, 0)
+	b.WriteString(`</dl>`)
+	return w.Write(b.Bytes())
+}
+
+// CSVTable is a table read from CSV given inline or in a file.
+type CSVTable struct {
+	args string // File path and options as written
+	text string // Inline CSV
+	*Table
+}
+
+// Footnotes are the footnote definitions of a document. Once it's
+// parsed, they're all in one Footnotes block at the end.
+type Footnotes struct {
+	ListItems
+	numbers []int // Number of each footnote, or nil to number them in order
+}
+
+func (f *Footnotes) WriteHTML(w io.Writer, opts *HTMLOptions) (int, error) {
+	var b bytes.Buffer
+
+	if opts == nil {
+		opts = &HTMLOptions{}
+	}
+
+	attrs, symbol := opts.link(opts.FootnoteBackref, opts.FootnoteBackrefLabel, "⮐")
+
+	b.WriteString(`<footer>`)
+	opts.newline(&b, 1)
+	b.WriteString(`<ol>`)
+
+	for i := range f.Items {
+		id := i + 1 // Are you a Nihilist or Unitarian?
+		if i < len(f.numbers) {
+			id = f.numbers[i]
+		}
+
+		item, err := f.itemHTML(i, opts.nested(1))
+		if err != nil {
+			return 0, err
+		}
+
+		opts.newline(&b, 2)
+		fmt.Fprintf(&b, `<li id="%s">%s <a href="#%s"%s>%s</a></li>`,
+			opts.id(fmt.Sprintf("fn.%d", id)), item, opts.id(fmt.Sprintf("fnr.%d", id)), attrs, symbol)
+	}
+
+	opts.newline(&b, 1)
+	b.WriteString(`</ol>`)
+	opts.newline(&b, 0)
+	b.WriteString(`</footer>`)
+	return w.Write(b.Bytes())
+}
+
+type parser struct {
+	doc       document
+	lex       *lexer
+	fsys      fs.FS    // Where %csv and %include files are read from (nil if they can't be)
+	dir       string   // Directory in fsys that paths are relative to
+	including []string // Files being included, to catch an %include cycle
+	source    bool     // Only the source is needed (e.g. by Format): keep it as written and don't read files
+	nested    bool     // Parsing the blocks of a list item, which have no metadata
+	lenient   bool     // Keep blocks with errors as paragraphs and record the errors as warnings
+	allErrors bool     // Record errors and carry on instead of stopping at the first one
+	errs      ParseErrors
+	peekCount int
+	token     [1]item // Single token look-ahead (array makes it easier to expand later if we need more)
+}
+
+func (p *parser) next() item {
+	if p.peekCount > 0 {
+		p.peekCount--
+	} else {
+		p.token[0] = p.lex.nextItem()
+	}
+
+	return p.token[p.peekCount]
+}
+
+func (p *parser) peek() item {
+	if p.peekCount > 0 {
+		return p.token[p.peekCount-1] // With single token look-ahead this is always zero
+	}
+
+	p.peekCount = 1
+	p.token[0] = p.lex.nextItem()
+	return p.token[0]
+}
+
+func (p *parser) backup() {
+	// Backing up is the same as pretending we peeked at the next token
+	// because it makes the next call to next() a no-op.
+	p.peekCount++
+}
+
+// ParseError is a syntax error in a GML document.
+type ParseError struct {
+	File    string // File the error is in if it's an included one, or ""
+	Line    int    // Line number, starting at 1
+	Col     int    // Column in characters, starting at 1, or 0 if it isn't known
+	Msg     string // Description of the error
+	Snippet string // The line the error is on
+}
+
+func (e *ParseError) Error() string {
+	var b strings.Builder
+	b.WriteString("gml: ")
+	if e.File != "" {
+		b.WriteString(e.File + ": ")
+	}
+	fmt.Fprintf(&b, "line %d", e.Line)
+	if e.Col > 0 {
+		fmt.Fprintf(&b, ", col %d", e.Col)
+	}
+	b.WriteString(": " + e.Msg)
+
+	return b.String()
+}
+
+// Context returns the line the error is on with a caret under the
+// column of the error, e.g. for a command to print after the error:
+//
+//	%figur photo.jpg
+//	^
+func (e *ParseError) Context() string {
+	if e.Snippet == "" {
+		return ""
+	}
+
+	s := strings.TrimRight(e.Snippet, "\r")
+	if e.Col > 0 {
+		// Keep tabs so the caret lines up however they're shown
+		var pad strings.Builder
+		for i, r := range []rune(s) {
+			if i >= e.Col-1 {
+				break
+			}
+			if r == '\t' {
+				pad.WriteRune('\t')
+			} else {
+				pad.WriteRune(' ')
+			}
+		}
+		s += "\n" + pad.String() + "^"
+	}
+
+	return s
+}
+
+// ParseErrors are the errors in a document parsed with
+// ParseOptions.AllErrors, in order of their lines.
+type ParseErrors []*ParseError
+
+func (e ParseErrors) Error() string {
+	switch len(e) {
+	case 0:
+		return "gml: no errors"
+	case 1:
+		return e[0].Error()
+	case 2:
+		return e[0].Error() + " (and 1 more error)"
+	}
+
+	return fmt.Sprintf("%s (and %d more errors)", e[0], len(e)-1)
+}
+
+// Unwrap returns the errors so errors.As finds the first *ParseError.
+func (e ParseErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+
+	return errs
+}
+
+func (p *parser) errorf(format string, args ...interface{}) {
+	panic(errorAt(p.lex.source(), p.token[0].pos, fmt.Sprintf(format, args...)))
+}
+
+// errorAt returns a *ParseError for the byte offset pos in src.
+func errorAt(src string, pos int, msg string) *ParseError {
+	if pos > len(src) {
+		pos = len(src)
+	}
+
+	start := strings.LastIndexByte(src[:pos], '\n') + 1
+	return &ParseError{
+		Line:    strings.Count(src[:pos], "\n") + 1,
+		Col:     utf8.RuneCountInString(src[start:pos]) + 1,
+		Msg:     msg,
+		Snippet: sourceLine(src, start),
+	}
+}
+
+// lineAt returns the line number of the byte offset pos in src.
+func lineAt(src string, pos int) int {
+	if pos > len(src) {
+		pos = len(src)
+	}
+
+	return strings.Count(src[:pos], "\n") + 1
+}
+
+// sourceLine returns the line of src that starts at the byte offset
+// start.
+func sourceLine(src string, start int) string {
+	line := src[start:]
+	if i := strings.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+
+	return line
+}
+
+// lineStart returns the byte offset of the n-th line of src.
+func lineStart(src string, n int) int {
+	start := 0
+	for ; n > 1; n-- {
+		i := strings.IndexByte(src[start:], '\n')
+		if i < 0 {
+			return len(src)
+		}
+		start += i + 1
+	}
+
+	return start
+}
+
+// recover turns a panic raised by errorf into an error returned by
+// Parse. Any other panic is a bug and is re-raised.
+func (p *parser) recover(errp *error) {
+	e := recover()
+	if e == nil {
+		return
+	}
+
+	err, ok := e.(*ParseError)
+	if !ok {
+		panic(e)
+	}
+
+	// Let the lexing goroutine exit without reading any more
+	p.lex.stopped.Store(true)
+	p.lex.drain()
+
+	// An error reading a streamed input is what cut it short
+	if p.lex.err != nil {
+		*errp = p.lex.err
+		return
+	}
+
+	*errp = err
+}
+
+func (p *parser) parseMetadata(token item) {
+	// Skip empty entries
+	if token.val == "" {
+		return
+	}
+
+	switch token.typ {
+	case itemTitle:
+		p.doc.metadata.title = token.val
+	case itemSubtitle:
+		p.doc.metadata.subtitle = token.val
+	case itemDate:
+		dt, err := time.Parse("2006-01-02", token.val)
+		if err != nil {
+			p.errorf("invalid date format: want: YYYY-MM-DD; got: %s", token.val)
+			return
 		}
 		p.doc.metadata.date = dt
 	case itemAuthor:
 		p.doc.metadata.author = token.val
+	case itemLang:
+		if !reLangTag.MatchString(token.val) {
+			p.errorf("invalid language tag: want e.g. en or pt-BR; got: %s", token.val)
+		}
+		p.doc.metadata.lang = token.val
+	case itemSummary:
+		p.doc.metadata.summary = token.val
+	case itemTags:
+		// Tags may be split across several %tags lines
+		for _, tag := range strings.Split(token.val, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag != "" && !slices.Contains(p.doc.metadata.tags, tag) {
+				p.doc.metadata.tags = append(p.doc.metadata.tags, tag)
+			}
+		}
+	case itemMeta:
+		key, value := cutKeyword(token.val)
+		p.doc.metadata.extra = append(p.doc.metadata.extra, metaField{
+			key:   strings.TrimPrefix(key, "%"),
+			value: value,
+		})
 	default:
 		p.errorf("unrecognized metadata")
 		return
 	}
 }
 
+// cutKeyword splits a whole keyword line, e.g. "%license CC-BY", into
+// its lowercase keyword and arguments.
+func cutKeyword(line string) (keyword, args string) {
+	keyword = line
+	if i := strings.IndexAny(line, " \t"); i >= 0 {
+		keyword, args = line[:i], line[i+1:]
+	}
+
+	return strings.ToLower(keyword), strings.TrimSpace(args)
+}
+
 func (p *parser) parseParagraph(token item) {
-	b := &paragraph{text: token.val}
+	b := &Paragraph{Text: token.val}
 	p.doc.content = append(p.doc.content, b)
 }
 
@@ -416,11 +1407,23 @@ func (p *parser) parseHeading(token item) {
 		level = 2
 	case itemHeadingThree:
 		level = 3
+	case itemHeadingFour:
+		level = 4
+	case itemHeadingFive:
+		level = 5
 	default:
 		p.errorf("invalid heading level")
 	}
 
-	h := &heading{level: level, text: token.val}
+	h := &HeadingBlock{Level: level, Text: token.val}
+
+	// An explicit anchor, e.g. "* Heading {#id}", keeps links to the
+	// heading working when its text changes.
+	if m := reHeadingID.FindStringSubmatchIndex(h.Text); m != nil {
+		h.ID = h.Text[m[2]:m[3]]
+		h.Text = h.Text[:m[0]]
+	}
+
 	p.doc.content = append(p.doc.content, h)
 }
 
@@ -438,142 +1441,725 @@ func (p *parser) collectItems(typ itemType) []string {
 	return items
 }
 
+// collectListItems collects the items of a list. Items continued onto
+// indented lines are unindented, and those with more than one block
+// are parsed into blocks.
+func (p *parser) collectListItems(typ itemType) ListItems {
+	var l ListItems
+	for {
+		li := p.next()
+		if li.typ != typ {
+			p.backup()
+			break
+		}
+
+		text := unindent(li.val)
+		l.Items = append(l.Items, text)
+
+		_, text = cutCheckbox(text)
+		l.Blocks = append(l.Blocks, p.parseItemBlocks(li, text))
+	}
+
+	return l
+}
+
+// parseItemBlocks parses the text of a list item continued onto more
+// lines. It returns nil when the item is only a paragraph of text.
+func (p *parser) parseItemBlocks(li item, text string) []Block {
+	if !strings.Contains(text, "\n") {
+		return nil
+	}
+
+	sub := &parser{fsys: p.fsys, source: p.source, dir: p.dir, including: p.including, nested: true}
+	doc, err := parse(text+"\n", sub) // A keyword can't end the input
+	if err != nil {
+		// Report the error at its line in the whole document
+		var perr *ParseError
+		if errors.As(err, &perr) && perr.File == "" {
+			// The item's lines were unindented, so the column is lost
+			src := p.lex.source()
+			line := lineAt(src, li.pos) + perr.Line - 1
+			panic(&ParseError{
+				File:    perr.File,
+				Line:    line,
+				Msg:     perr.Msg,
+				Snippet: sourceLine(src, lineStart(src, line)),
+			})
+		}
+		p.errorf("%v", err)
+	}
+
+	blocks := doc.(document).content
+	if len(blocks) == 1 {
+		if _, ok := blocks[0].(*Paragraph); ok {
+			return nil
+		}
+	}
+
+	return blocks
+}
+
+// unindent removes the indentation that the continuation lines of a
+// list item share.
+func unindent(s string) string {
+	lines := strings.Split(s, "\n")
+
+	indent := -1
+	for _, line := range lines[1:] {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		n := len(line) - len(strings.TrimLeft(line, " \t"))
+		if indent < 0 || n < indent {
+			indent = n
+		}
+	}
+
+	for i := 1; i < len(lines); i++ {
+		if len(lines[i]) >= indent && indent > 0 {
+			lines[i] = lines[i][indent:]
+		} else {
+			lines[i] = strings.TrimLeft(lines[i], " \t")
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
 func (p *parser) parseUnorderedList() {
-	items := p.collectItems(itemUnorderedList)
-	ul := &unorderedList{items}
+	ul := &UnorderedList{p.collectListItems(itemUnorderedList)}
 	p.doc.content = append(p.doc.content, ul)
 }
 
 func (p *parser) parseOrderedList() {
-	items := p.collectItems(itemOrderedList)
-	ol := &orderedList{items}
+	ol := &OrderedList{p.collectListItems(itemOrderedList)}
 	p.doc.content = append(p.doc.content, ol)
 }
 
 func (p *parser) parseFootnotes(token item) {
-	items := p.collectItems(itemUnorderedList)
-	fn := &footnotes{items}
+	fn := &Footnotes{ListItems: p.collectListItems(itemUnorderedList)}
 	p.doc.content = append(p.doc.content, fn)
 }
 
 func (p *parser) parseBlockquote(token item) {
 	items := p.collectItems(itemText)
-	bq := &blockquote{text: strings.Join(items, "\n")}
+	bq := &Blockquote{args: token.val}
+
+	if n := len(items); n > 1 {
+		if who, ok := strings.CutPrefix(items[n-1], "-- "); ok {
+			bq.Attribution = strings.TrimSpace(who)
+			items = items[:n-1]
+		}
+	}
+	bq.Text = strings.Join(items, "\n")
+
+	words, named := parseArgs(token.val)
+	if len(words) > 0 {
+		p.errorf("%%blockquote: unexpected argument %q", words[0])
+	}
+	for k, v := range named {
+		switch k {
+		case "cite":
+			bq.Cite = v
+		default:
+			p.errorf("%%blockquote: unknown argument %q", k)
+		}
+	}
+
 	p.doc.content = append(p.doc.content, bq)
 }
 
-func (p *parser) parsePre(token item) {
+func (p *parser) parseAdmonition(token item) {
 	items := p.collectItems(itemText)
-	pre := &pre{text: strings.Join(items, "\n")}
+	a := &Admonition{
+		Kind:  admonitions[token.typ],
+		Title: strings.TrimSpace(token.val),
+		Text:  strings.Join(items, "\n"),
+	}
+
+	p.doc.content = append(p.doc.content, a)
+}
+
+func (p *parser) parseComment(token item) {
+	c := &Comment{Text: token.val}
+	if token.typ == itemCommentBlock {
+		c.block = true
+		c.args = token.val
+		c.Text = strings.Join(p.collectItems(itemText), "\n")
+	}
+
+	if p.source {
+		p.doc.content = append(p.doc.content, c)
+	}
+}
+
+func (p *parser) parseVerse(token item) {
+	v := &Verse{}
+	for _, line := range p.collectItems(itemText) {
+		v.Lines = append(v.Lines, strings.TrimRight(line, " \t"))
+	}
+
+	p.doc.content = append(p.doc.content, v)
+}
+
+func (p *parser) parsePre(token item) {
+	items := unescapeKeywords(p.collectItems(itemText))
+	pre := &Pre{args: token.val, Text: strings.Join(items, "\n")}
+
+	words, named := parseArgs(token.val)
+	for _, w := range words {
+		switch {
+		case w == "linenos":
+			pre.lineNumbers = true
+		case pre.Lang == "":
+			pre.Lang = w
+		default:
+			p.errorf("%%pre: unexpected argument %q", w)
+		}
+	}
+
+	for k, v := range named {
+		switch k {
+		case "hl":
+			ranges, err := parseLineRanges(v)
+			if err != nil {
+				p.errorf("%%pre: %v", err)
+			}
+			pre.highlighted = ranges
+		case "file":
+			pre.File = v
+		case "caption":
+			pre.Caption = v
+		default:
+			p.errorf("%%pre: unknown argument %q", k)
+		}
+	}
+
 	p.doc.content = append(p.doc.content, pre)
 }
 
+// unescapeKeywords removes the backslash from lines starting with
+// "\%" in verbatim blocks, which is how they include a line starting
+// with "%" that would otherwise start the next block.
+func unescapeKeywords(lines []string) []string {
+	for i, line := range lines {
+		if strings.HasPrefix(line, `\%`) {
+			lines[i] = line[1:]
+		}
+	}
+
+	return lines
+}
+
 func (p *parser) parseHTML(token item) {
-	items := p.collectItems(itemText)
-	html := &html{text: strings.Join(items, "\n")}
+	items := unescapeKeywords(p.collectItems(itemText))
+	html := &RawHTML{Text: strings.Join(items, "\n")}
 	p.doc.content = append(p.doc.content, html)
 }
 
+// parseArgs splits the arguments of a block keyword into words and
+// key=value pairs. Values may be quoted to include spaces, e.g.
+// caption="Hello, world".
+func parseArgs(s string) (words []string, named map[string]string) {
+	named = make(map[string]string)
+
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+		end := strings.IndexAny(s, " \t=")
+		if end < 0 {
+			end = len(s)
+		}
+
+		if end == len(s) || s[end] != '=' {
+			words = append(words, s[:end])
+			s = s[end:]
+			continue
+		}
+
+		key, rest := s[:end], s[end+1:]
+		if strings.HasPrefix(rest, `"`) {
+			if close := strings.IndexByte(rest[1:], '"'); close >= 0 {
+				named[key] = rest[1 : close+1]
+				s = rest[close+2:]
+				continue
+			}
+		}
+
+		valEnd := strings.IndexAny(rest, " \t")
+		if valEnd < 0 {
+			valEnd = len(rest)
+		}
+		named[key] = rest[:valEnd]
+		s = rest[valEnd:]
+	}
+
+	return words, named
+}
+
+// reAlignCell matches the cells of a table's alignment row, e.g. ":--" or "---:"
+var reLangTag = regexp.MustCompile(`^[A-Za-z]{2,8}(-[A-Za-z0-9]{1,8})*$`)
+
+var reHeadingID = regexp.MustCompile(`\s*\{#([A-Za-z][\w:.-]*)\}\s*$`)
+
+var reAlignCell = regexp.MustCompile(`^:?-+:?$`)
+
+// splitRow splits a table row like "| a | b |" into its cells. The
+// outer pipes are optional.
+func splitRow(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	line = strings.TrimSuffix(line, "|")
+
+	cells := strings.Split(line, "|")
+	for i, c := range cells {
+		cells[i] = strings.TrimSpace(c)
+	}
+
+	return cells
+}
+
+// alignment returns the column alignments given by a row of
+// alignment markers, or nil if row isn't one.
+func alignment(row []string) []string {
+	align := make([]string, len(row))
+	for i, c := range row {
+		if !reAlignCell.MatchString(c) {
+			return nil
+		}
+
+		switch left, right := strings.HasPrefix(c, ":"), strings.HasSuffix(c, ":"); {
+		case left && right:
+			align[i] = "center"
+		case left:
+			align[i] = "left"
+		case right:
+			align[i] = "right"
+		}
+	}
+
+	return align
+}
+
+func (p *parser) parseTable(token item) {
+	t := &Table{}
+
+	var rows [][]string
+	for _, line := range p.collectItems(itemText) {
+		rows = append(rows, splitRow(line))
+	}
+
+	// An alignment row either follows the header or starts a table without one
+	switch {
+	case len(rows) > 1 && alignment(rows[1]) != nil:
+		t.Header, t.Align, rows = rows[0], alignment(rows[1]), rows[2:]
+	case len(rows) > 0 && alignment(rows[0]) != nil:
+		t.Align, rows = alignment(rows[0]), rows[1:]
+	}
+
+	t.Rows = rows
+	p.doc.content = append(p.doc.content, t)
+}
+
+// parseCSV reads a table from CSV, e.g. "%csv data/sales.csv", or
+// from the lines following "%csv". The first record is the table's
+// header unless the "noheader" option is given.
+func (p *parser) parseCSV(token item) {
+	c := &CSVTable{args: token.val, Table: &Table{}}
+
+	var file string
+	header := true
+	for _, arg := range strings.Fields(token.val) {
+		switch {
+		case arg == "noheader":
+			header = false
+		case file == "":
+			file = arg
+		default:
+			p.errorf("%%csv: unexpected argument %q", arg)
+		}
+	}
+
+	c.text = strings.Join(p.collectItems(itemText), "\n")
+
+	src := c.text
+	switch {
+	case file != "" && c.text != "":
+		p.errorf("%%csv: give either a file or inline CSV, not both")
+	case file != "" && p.source:
+		p.doc.content = append(p.doc.content, c)
+		return
+	case file != "":
+		if p.fsys == nil {
+			p.errorf("%%csv: can't read %q without a file system (see ParseFS)", file)
+		}
+
+		b, err := fs.ReadFile(p.fsys, path.Join(p.dir, file))
+		if err != nil {
+			p.errorf("%%csv: %v", err)
+		}
+		src = string(b)
+	}
+
+	r := csv.NewReader(strings.NewReader(src))
+	r.FieldsPerRecord = -1 // Short rows are padded when rendered
+	records, err := r.ReadAll()
+	if err != nil {
+		p.errorf("%%csv: %v", err)
+	}
+
+	if header && len(records) > 0 {
+		c.Header, records = records[0], records[1:]
+	}
+	c.Rows = records
+
+	p.doc.content = append(p.doc.content, c)
+}
+
+// parseDefinitions parses a definition list with a "term :: definition"
+// on each line. A line starting with "::" adds another definition to
+// the term before it.
+func (p *parser) parseDefinitions(token item) {
+	l := &DefinitionList{}
+
+	for _, line := range p.collectItems(itemText) {
+		term, def, ok := strings.Cut(line, "::")
+		if !ok {
+			p.errorf("%%dl: want \"term :: definition\"; got: %q", line)
+		}
+		term, def = strings.TrimSpace(term), strings.TrimSpace(def)
+
+		if term == "" {
+			if len(l.Items) == 0 {
+				p.errorf("%%dl: definition %q has no term", def)
+			}
+			last := &l.Items[len(l.Items)-1]
+			last.Definitions = append(last.Definitions, def)
+			continue
+		}
+
+		l.Items = append(l.Items, Definition{Term: term, Definitions: []string{def}})
+	}
+
+	p.doc.content = append(p.doc.content, l)
+}
+
 func (p *parser) parseFigure(token item) {
-	fig := &figure{args: token.val}
+	fig := &Figure{args: token.val}
 
 	if t1 := p.next(); t1.typ == itemText {
-		fig.html = t1.val
+		fig.HTML = t1.val
 	}
 
 	if t2 := p.next(); t2.typ == itemText {
-		fig.caption = t2.val
+		fig.Caption = t2.val
 	} else {
 		p.backup() // No caption provided
 	}
 
+	words, named := parseArgs(token.val)
+	if len(words) > 0 {
+		p.errorf("%%figure: unexpected argument %q", words[0])
+	}
+
+	// Sorted so the attributes are always written in the same order
+	keys := make([]string, 0, len(named))
+	for k := range named {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	for _, k := range keys {
+		v := named[k]
+		switch k {
+		case "href":
+			fig.Href = v
+		case "class":
+			fig.Class = v
+		case "id":
+			fig.ID = v
+		case "alt":
+			fig.Img = append(fig.Img, Attr{k, v})
+		case "width", "height":
+			if n, err := strconv.Atoi(v); err != nil || n <= 0 {
+				p.errorf("%%figure: %s must be a number of pixels; got: %q", k, v)
+			}
+			fig.Img = append(fig.Img, Attr{k, v})
+		case "loading":
+			if v != "lazy" && v != "eager" {
+				p.errorf("%%figure: loading must be lazy or eager; got: %q", v)
+			}
+			fig.Img = append(fig.Img, Attr{k, v})
+		default:
+			p.errorf("%%figure: unknown argument %q", k)
+		}
+	}
+
+	if len(fig.Img) > 0 && !reImg.MatchString(fig.HTML) {
+		p.errorf("%%figure: %s= needs an <img> to go on", fig.Img[0].Name)
+	}
+
 	p.doc.content = append(p.doc.content, fig)
 }
 
+// Parse parses a GML document. Blocks that read files, like
+// "%csv data.csv", are an error; use ParseFS for those.
 func Parse(s string) (Document, error) {
-	p := &parser{
-		lex: lex(s),
+	return ParseFS(nil, s)
+}
+
+// ParseFS parses a GML document whose blocks may read files from fsys,
+// e.g. os.DirFS of the directory the document is in.
+func ParseFS(fsys fs.FS, s string) (Document, error) {
+	return ParseWithOptions(s, &ParseOptions{FS: fsys, Strict: true})
+}
+
+// ParseOptions are the options for parsing a document.
+type ParseOptions struct {
+	// FS is where blocks like "%csv data.csv" read files from, or nil
+	// if they can't.
+	FS fs.FS
+
+	// Strict makes an unknown keyword or a malformed block an error.
+	// Otherwise they're let through: the block is kept as a paragraph
+	// of its source, bad metadata is dropped, and the errors are
+	// returned by Document.Warnings instead, so old documents keep
+	// rendering as GML changes. Parse and ParseFS are strict.
+	Strict bool
+
+	// AllErrors carries on parsing after a block with an error in
+	// strict mode, so every error in the document is returned
+	// together as ParseErrors along with the blocks that did parse.
+	AllErrors bool
+}
+
+// ParseWithOptions parses a GML document with the given options.
+func ParseWithOptions(s string, opts *ParseOptions) (Document, error) {
+	if opts == nil {
+		opts = &ParseOptions{}
+	}
+
+	return parse(s, &parser{fsys: opts.FS, lenient: !opts.Strict, allErrors: opts.AllErrors})
+}
+
+// ParseReader parses a GML document read from r. It's lexed as it's
+// read, a line at a time, rather than read into memory first, and
+// parsing stops with ctx's error once ctx is done. The Document still
+// keeps the source to report the lines of errors.
+func ParseReader(ctx context.Context, r io.Reader, opts *ParseOptions) (Document, error) {
+	if opts == nil {
+		opts = &ParseOptions{}
+	}
+
+	p := &parser{fsys: opts.FS, lenient: !opts.Strict, allErrors: opts.AllErrors, lex: lexReader(ctx, r)}
+	return parse("", p)
+}
+
+// parseSource parses a GML document without reading any files. It's
+// for callers like Format and Lint that only need the source.
+func parseSource(s string) (Document, error) {
+	return parse(s, &parser{source: true})
+}
+
+func parse(s string, p *parser) (doc Document, err error) {
+	p.doc = document{src: s}
+	switch {
+	case p.lex != nil:
+		// Already lexing a streamed input
+	case p.nested:
+		p.lex = lexNested(s)
+	default:
+		p.lex = lex(s)
 	}
+	defer p.recover(&err)
 
 	for tok := p.next(); tok.typ != itemEOF; tok = p.next() {
-		switch tok.typ {
-		case itemTitle, itemSubtitle, itemDate, itemAuthor:
-			p.parseMetadata(tok)
-		case itemParagraph:
-			p.parseParagraph(tok)
-		case itemHeadingOne, itemHeadingTwo, itemHeadingThree:
-			p.parseHeading(tok)
-		case itemUnorderedList:
-			p.backup()
-			p.parseUnorderedList()
-		case itemOrderedList:
-			p.backup()
-			p.parseOrderedList()
-		case itemFootnotes:
-			p.parseFootnotes(tok)
-		case itemFigure:
-			p.parseFigure(tok)
-		case itemBlockquote:
-			p.parseBlockquote(tok)
-		case itemPre:
-			p.parsePre(tok)
-		case itemHTML:
-			p.parseHTML(tok)
-		default:
-			fmt.Println("Unimplemented:", tok) // Debug
+		if !p.allErrors && !p.lenient {
+			p.parseBlock(tok)
+		} else if err := p.tryBlock(tok); err != nil && p.lenient {
+			p.doc.warnings = append(p.doc.warnings, err)
+			p.downgrade(tok)
+		} else if err != nil {
+			p.errs = append(p.errs, err)
+		}
+
+		// Remember where each new block started
+		for len(p.doc.positions) < len(p.doc.content) {
+			p.doc.positions = append(p.doc.positions, tok.pos)
 		}
 	}
 
+	if p.lex.err != nil {
+		return nil, p.lex.err
+	}
+	p.doc.src = p.lex.source()
+
+	// Footnotes are checked and numbered across the whole document,
+	// including any files it includes, so only once it's all parsed
+	if !p.source && !p.nested && len(p.including) == 0 {
+		if errs := p.doc.numberFootnotes(); len(errs) > 0 {
+			switch {
+			case p.lenient:
+				p.doc.warnings = append(p.doc.warnings, errs...)
+			case p.allErrors:
+				p.errs = append(p.errs, errs...)
+			default:
+				return nil, errs[0]
+			}
+		} else {
+			p.doc.moveFootnotes()
+		}
+		p.doc.collectAbbrs()
+	}
+
+	assignAnchors(p.doc.content)
+	fillTOC(p.doc.content)
+
+	if len(p.errs) > 0 {
+		sort.SliceStable(p.errs, func(i, j int) bool { return p.errs[i].Line < p.errs[j].Line })
+		return p.doc, p.errs
+	}
+	sort.SliceStable(p.doc.warnings, func(i, j int) bool { return p.doc.warnings[i].Line < p.doc.warnings[j].Line })
+
 	// Done.
 	return p.doc, nil
 }
 
-func textToHTML(s string) string {
-	// Keep it simple (TODO: better lexer)
+// parseBlock parses the block that starts with tok.
+func (p *parser) parseBlock(tok item) {
+	switch tok.typ {
+	case itemError:
+		p.errorf("%s", tok.val)
+	case itemTitle, itemSubtitle, itemDate, itemAuthor, itemTags, itemSummary, itemLang, itemMeta:
+		p.parseMetadata(tok)
+	case itemParagraph:
+		p.parseParagraph(tok)
+	case itemHeadingOne, itemHeadingTwo, itemHeadingThree, itemHeadingFour, itemHeadingFive:
+		p.parseHeading(tok)
+	case itemUnorderedList:
+		p.backup()
+		p.parseUnorderedList()
+	case itemOrderedList:
+		p.backup()
+		p.parseOrderedList()
+	case itemFootnotes:
+		p.parseFootnotes(tok)
+	case itemFigure:
+		p.parseFigure(tok)
+	case itemBlockquote:
+		p.parseBlockquote(tok)
+	case itemPre:
+		p.parsePre(tok)
+	case itemHTML:
+		p.parseHTML(tok)
+	case itemTable:
+		p.parseTable(tok)
+	case itemCSV:
+		p.parseCSV(tok)
+	case itemDefinitions:
+		p.parseDefinitions(tok)
+	case itemTOC:
+		p.parseTOC(tok)
+	case itemNote, itemWarning, itemTip:
+		p.parseAdmonition(tok)
+	case itemVerse:
+		p.parseVerse(tok)
+	case itemComment, itemCommentBlock:
+		p.parseComment(tok)
+	case itemInclude:
+		p.parseInclude(tok)
+	case itemAbbr:
+		p.parseAbbr(tok)
+	case itemMath:
+		p.parseMath(tok)
+	case itemEmbed:
+		p.parseEmbed(tok)
+	case itemVideo:
+		p.parseVideo(tok)
+	case itemAudio:
+		p.parseAudio(tok)
+	case itemCustom:
+		p.parseCustom(tok)
+	default:
+		fmt.Println("Unimplemented:", tok) // Debug
+	}
+}
+
+// tryBlock parses the block that starts with tok like parseBlock, but
+// returns an error in it instead of stopping. The rest of a block with
+// an error is skipped and nothing of it is kept.
+func (p *parser) tryBlock(tok item) (err *ParseError) {
+	n := len(p.doc.content)
+	defer func() {
+		e := recover()
+		if e == nil {
+			return
+		}
+
+		var ok bool
+		if err, ok = e.(*ParseError); !ok {
+			panic(e)
+		}
+
+		p.doc.content = p.doc.content[:n]
+		for p.peek().typ == itemText {
+			p.next()
+		}
+	}()
+
+	p.parseBlock(tok)
+	return nil
+}
+
+// downgrade keeps the source of the block that starts with tok, which
+// has an error, as a paragraph. Metadata with an error is dropped.
+func (p *parser) downgrade(tok item) {
+	if isMetadata(tok.typ) {
+		return
+	}
 
-	var replacements = [...]struct {
-		re   *regexp.Regexp
-		repl string
-	}{
-		{regexp.MustCompile(`(\s?)(https://[^\s]+)`), `$1<a href="$2">$2</a>`},                   // Raw URL
-		{regexp.MustCompile(`\[fn:(\d+)\]`), `<a id="fnr.$1" href="#fn.$1"><sup>[$1]</sup></a>`}, // Footnote
+	// Items like keywords and list items start after their markup, so
+	// the block runs from the start of its line to that of the next
+	next := p.peek()
+	src := p.lex.source()
+	start := strings.LastIndexByte(src[:tok.pos], '\n') + 1
+	end := len(src)
+	if next.typ != itemEOF && next.pos > start {
+		end = strings.LastIndexByte(src[:next.pos], '\n') + 1
 	}
 
-	withHTML := s
-	for _, sub := range replacements {
-		withHTML = sub.re.ReplaceAllString(withHTML, sub.repl)
+	if text := strings.TrimSpace(src[start:end]); text != "" {
+		p.doc.content = append(p.doc.content, &Paragraph{Text: text})
 	}
+}
 
+func textToHTML(s string, opts *HTMLOptions) string {
 	// Strip trailing spaces
-	withHTML = strings.TrimSpace(withHTML)
-
-	return withHTML
+	return strings.TrimSpace(renderInline(s, opts))
 }
 
-// slugify creates a URL safe string by removing
-// all non-alphanumeric characters and replacing spaces with hyphens.
-func slugify(slug string) string {
+// Slugify makes a string URL safe for an anchor or a path by
+// replacing spaces with hyphens and removing everything other than
+// letters, numbers, hyphens, and underscores. Letters are lowercased
+// but kept in any script, so "Über uns" is "über-uns".
+func Slugify(s string) string {
 	// Remove leading and trailing spaces
-	slug = strings.TrimSpace(slug)
+	slug := strings.TrimSpace(s)
 
 	// Replace spaces with hyphens
-	reSpace := regexp.MustCompile(`[\t\n\f\r ]`)
-	slug = reSpace.ReplaceAllString(slug, "-")
+	slug = reSlugSpace.ReplaceAllString(slug, "-")
 
 	// Remove duplicate hyphens
-	reDupDash := regexp.MustCompile(`-+`)
-	slug = reDupDash.ReplaceAllString(slug, "-")
-
-	// Remove HTML tags
-	reTag := regexp.MustCompile(`<[^>]+>`)
-	slug = reTag.ReplaceAllString(slug, "")
+	slug = reSlugDashes.ReplaceAllString(slug, "-")
 
-	// Remove non-word chars
-	reNonWord := regexp.MustCompile(`[^0-9A-Za-z_-]`)
-	slug = reNonWord.ReplaceAllString(slug, "")
+	// Remove non-word chars (Unicode character classes)
+	slug = reSlugNonWord.ReplaceAllString(slug, "")
 
 	// Lowercase
-	slug = strings.ToLower(slug)
-
-	return slug
+	return strings.ToLower(slug)
 }
+
+var (
+	reSlugSpace   = regexp.MustCompile(`[\t\n\f\r ]`)
+	reSlugDashes  = regexp.MustCompile(`-+`)
+	reSlugNonWord = regexp.MustCompile(`[^\p{N}\p{L}_-]`)
+)
@@ -1,7 +1,14 @@
 package gml
 
 import (
+	"context"
+	"errors"
+	"reflect"
+	"regexp"
+	"strings"
 	"testing"
+	"testing/fstest"
+	"testing/iotest"
 )
 
 type parseTest struct {
@@ -29,8 +36,17 @@ var parseTests = []parseTest{
 </article>`,
 	},
 	{
-		"paragraph with styled text",
-		"this is <em>my</em> <strong>markup language</strong> called <code>GML</code>",
+		"paragraph with html",
+		"this is <em>my</em> markup language & a < b",
+		`<article>
+<header>
+</header>
+<p>this is &lt;em&gt;my&lt;/em&gt; markup language &amp; a &lt; b</p>
+</article>`,
+	},
+	{
+		"paragraph with GML styles",
+		"this is /my/ *markup language* called ~GML~",
 		`<article>
 <header>
 </header>
@@ -50,8 +66,8 @@ baz</p>
 	},
 	{
 		"footnote",
-		"example[fn:1]",
-		"<article>\n<header>\n</header>\n<p>example<a id=\"fnr.1\" href=\"#fn.1\"><sup>[1]</sup></a></p>\n</article>",
+		"example[fn:1]\n\n%footnotes\n- [1] note",
+		"<article>\n<header>\n</header>\n<p>example<a id=\"fnr.1\" href=\"#fn.1\"><sup>[1]</sup></a></p>\n<footer>\n\t<ol>\n\t\t<li id=\"fn.1\">[1] note <a href=\"#fnr.1\">⮐</a></li>\n\t</ol>\n</footer>\n</article>",
 	},
 	{
 		"url",
@@ -64,9 +80,29 @@ baz</p>
 		"<article>\n<header>\n</header>\n<h2 id=\"example-heading-123\" class=\"heading\">Example Heading 123 <a class=\"heading-ref\" href=\"#example-heading-123\">¶</a></h2>\n</article>",
 	},
 	{
-		"heading with style",
-		"* Example Heading <strong><em>123</em></strong>",
-		"<article>\n<header>\n</header>\n<h2 id=\"example-heading-123\" class=\"heading\">Example Heading <strong><em>123</em></strong> <a class=\"heading-ref\" href=\"#example-heading-123\">¶</a></h2>\n</article>",
+		"heading with html",
+		"* Example Heading <strong>123</strong>",
+		"<article>\n<header>\n</header>\n<h2 id=\"example-heading-123\" class=\"heading\">Example Heading &lt;strong&gt;123&lt;/strong&gt; <a class=\"heading-ref\" href=\"#example-heading-123\">¶</a></h2>\n</article>",
+	},
+	{
+		"heading with GML styles",
+		"** The /best/ heading",
+		"<article>\n<header>\n</header>\n<h3 id=\"the-best-heading\" class=\"heading\">The <em>best</em> heading <a class=\"heading-ref\" href=\"#the-best-heading\">¶</a></h3>\n</article>",
+	},
+	{
+		"deepest heading",
+		"***** Five",
+		"<article>\n<header>\n</header>\n<h6 id=\"five\" class=\"heading\">Five <a class=\"heading-ref\" href=\"#five\">¶</a></h6>\n</article>",
+	},
+	{
+		"heading with an explicit anchor",
+		"* Renamed /heading/ {#original-heading}",
+		"<article>\n<header>\n</header>\n<h2 id=\"original-heading\" class=\"heading\">Renamed <em>heading</em> <a class=\"heading-ref\" href=\"#original-heading\">¶</a></h2>\n</article>",
+	},
+	{
+		"list items with GML styles",
+		"- *one*\n- ~two~",
+		"<article>\n<header>\n</header>\n<ul>\n\t<li><strong>one</strong></li>\n\t<li><code>two</code></li>\n</ul>\n</article>",
 	},
 }
 
@@ -88,3 +124,818 @@ func TestParse(t *testing.T) {
 		}
 	}
 }
+
+func TestInlineHTML(t *testing.T) {
+	doc, err := Parse("%title A <b>bold</b> title\n\n%figure\n<img src=\"a.png\" alt=\"A\">\nA <em>caption</em> & more\n\n- <kbd>x</kbd>")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "<article><header><h1 class=\"title\">A &lt;b&gt;bold&lt;/b&gt; title</h1></header>" +
+		"<figure><img src=\"a.png\" alt=\"A\"><figcaption>A &lt;em&gt;caption&lt;/em&gt; &amp; more</figcaption></figure>" +
+		"<ul><li>&lt;kbd&gt;x&lt;/kbd&gt;</li></ul></article>"
+	if got := doc.HTML(&HTMLOptions{Minified: true}); got != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+
+	want = "<article><header><h1 class=\"title\">A <b>bold</b> title</h1></header>" +
+		"<figure><img src=\"a.png\" alt=\"A\"><figcaption>A <em>caption</em> & more</figcaption></figure>" +
+		"<ul><li><kbd>x</kbd></li></ul></article>"
+	if got := doc.HTML(&HTMLOptions{Minified: true, InlineHTML: true}); got != want {
+		t.Errorf("want with InlineHTML:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestMultiLineListItems(t *testing.T) {
+	input := "- first line\n  second line\n- install it:\n\n  %pre\n  go install\n\n  then run it\n- last"
+
+	doc, err := Parse(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "<ul>\n" +
+		"\t<li>first line\nsecond line</li>\n" +
+		"\t<li><p>install it:</p>\n\t<pre>go install</pre>\n\t<p>then run it</p></li>\n" +
+		"\t<li>last</li>\n" +
+		"</ul>"
+	if got := doc.ExcerptHTML(1, nil); got != want {
+		t.Errorf("want:\t%q\n got:\t%q", want, got)
+	}
+
+	// Errors in an item are reported at their line in the document
+	_, err = Parse("intro\n\n- item\n\n  %nope\n")
+	if err == nil || err.Error() != "gml: line 5: unrecognized keyword: \"%nope\"" {
+		t.Errorf("got error: %v", err)
+	}
+}
+
+func TestParseError(t *testing.T) {
+	_, err := Parse("%title Hi\n\n%video clip.mp4 size=3\n")
+	var perr *ParseError
+	if !errors.As(err, &perr) {
+		t.Fatalf("want a *ParseError; got %T: %v", err, err)
+	}
+
+	want := &ParseError{Line: 3, Col: 8, Msg: `%video: unknown argument "size"`, Snippet: "%video clip.mp4 size=3"}
+	if !reflect.DeepEqual(perr, want) {
+		t.Errorf("want: %+v\ngot:  %+v", want, perr)
+	}
+	if want := `gml: line 3, col 8: %video: unknown argument "size"`; perr.Error() != want {
+		t.Errorf("want: %q\ngot:  %q", want, perr.Error())
+	}
+	if want := "%video clip.mp4 size=3\n       ^"; perr.Context() != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, perr.Context())
+	}
+}
+
+func TestParseAllErrors(t *testing.T) {
+	input := "%title Hi\n\n%figur photo.jpg\n\nFine.\n\n%audio a.mp3 b.mp3\ncaption\n\n%nope\n\nAlso fine.\n"
+	doc, err := ParseWithOptions(input, &ParseOptions{Strict: true, AllErrors: true})
+
+	var errs ParseErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("want ParseErrors; got %T: %v", err, err)
+	}
+
+	var got []string
+	for _, err := range errs {
+		got = append(got, err.Error())
+	}
+	want := []string{
+		`gml: line 3, col 1: unrecognized keyword: "%figur"`,
+		`gml: line 7, col 8: %audio: unexpected argument "b.mp3"`,
+		`gml: line 10, col 1: unrecognized keyword: "%nope"`,
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("want:\t%q\n got:\t%q", want, got)
+	}
+	if want := want[0] + " (and 2 more errors)"; err.Error() != want {
+		t.Errorf("want: %q\ngot:  %q", want, err)
+	}
+
+	// The blocks without errors are kept
+	if want, got := "<p>Fine.</p><p>Also fine.</p>", doc.ExcerptHTML(2, &HTMLOptions{Minified: true}); got != want {
+		t.Errorf("want:\t%q\n got:\t%q", want, got)
+	}
+
+	// Without AllErrors, parsing stops at the first error
+	if _, err := Parse(input); err == nil || err.Error() != want[0] {
+		t.Errorf("want: %q\ngot:  %v", want[0], err)
+	}
+}
+
+func TestParseLenient(t *testing.T) {
+	input := "%title Hi\n%date someday\n\n%figur photo.jpg\n\nFine.\n\n%audio a.mp3 b.mp3\ncaption\n\n- item\n"
+	doc, err := ParseWithOptions(input, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, err := range doc.Warnings() {
+		got = append(got, err.Error())
+	}
+	want := []string{
+		"gml: line 2, col 7: invalid date format: want: YYYY-MM-DD; got: someday",
+		`gml: line 4, col 1: unrecognized keyword: "%figur"`,
+		`gml: line 8, col 8: %audio: unexpected argument "b.mp3"`,
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("want:\t%q\n got:\t%q", want, got)
+	}
+
+	wantHTML := "<p>%figur photo.jpg</p><p>Fine.</p><p>%audio a.mp3 b.mp3\ncaption</p><ul><li>item</li></ul>"
+	if got := doc.ExcerptHTML(4, &HTMLOptions{Minified: true}); got != wantHTML {
+		t.Errorf("want:\t%q\n got:\t%q", wantHTML, got)
+	}
+	if doc.Title() != "Hi" || !doc.Date().IsZero() {
+		t.Errorf("got title %q and date %v", doc.Title(), doc.Date())
+	}
+
+	if _, err := ParseWithOptions(input, &ParseOptions{Strict: true}); err == nil || err.Error() != want[0] {
+		t.Errorf("want: %q\ngot:  %v", want[0], err)
+	}
+}
+
+func TestParseReader(t *testing.T) {
+	input := "%title Streamed\n%date 2022-03-21\n\n* Heading\n\nSome /text/.\n;; a comment\n\n- item\n\n  more of it\n- next\n\n%pre\ncode\n\n%footnotes\n- [1] note\n\nEnd[fn:1]"
+
+	want, err := Parse(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A reader that returns a byte at a time reads a line in many calls
+	got, err := ParseReader(context.Background(), iotest.OneByteReader(strings.NewReader(input)), &ParseOptions{Strict: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.HTML(nil) != want.HTML(nil) || got.Title() != want.Title() {
+		t.Errorf("want:\n%s\ngot:\n%s", want.HTML(nil), got.HTML(nil))
+	}
+
+	// Errors are at their line of what's been read
+	_, err = ParseReader(context.Background(), strings.NewReader("Hi\n\n%nope\n\nmore"), &ParseOptions{Strict: true})
+	if want := `gml: line 3, col 1: unrecognized keyword: "%nope"`; err == nil || err.Error() != want {
+		t.Errorf("want: %q\ngot:  %v", want, err)
+	}
+
+	readErr := errors.New("connection reset")
+	_, err = ParseReader(context.Background(), iotest.TimeoutReader(strings.NewReader("%title Hi\n\n%pre\ncode")), nil)
+	if !errors.Is(err, iotest.ErrTimeout) {
+		t.Errorf("want %v; got %v", iotest.ErrTimeout, err)
+	}
+	_, err = ParseReader(context.Background(), iotest.ErrReader(readErr), nil)
+	if !errors.Is(err, readErr) {
+		t.Errorf("want %v; got %v", readErr, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ParseReader(ctx, strings.NewReader(input), nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("want %v; got %v", context.Canceled, err)
+	}
+}
+
+func TestLineEndings(t *testing.T) {
+	input := "%title Endings\n%date 2022-03-21\n\n* Heading\n\nSome /text/\nover lines.\n\n- item\n\n  more of it\n- next\n\n%pre\ncode\n\n%footnotes\n- [1] note\n\nEnd[fn:1]\n"
+
+	want, err := Parse(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, eol := range map[string]string{"CRLF": "\r\n", "CR": "\r"} {
+		crlf := strings.ReplaceAll(input, "\n", eol)
+
+		got, err := Parse(crlf)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got.HTML(nil) != want.HTML(nil) || got.Title() != want.Title() {
+			t.Errorf("%s: want:\n%s\ngot:\n%s", name, want.HTML(nil), got.HTML(nil))
+		}
+
+		got, err = ParseReader(context.Background(), strings.NewReader(crlf), &ParseOptions{Strict: true})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got.HTML(nil) != want.HTML(nil) {
+			t.Errorf("%s: streamed: want:\n%s\ngot:\n%s", name, want.HTML(nil), got.HTML(nil))
+		}
+	}
+
+	// Lines of errors count a "\r\n" once
+	_, err = Parse("Hi\r\n\r\nthere\r\n\r\n%nope\r\n")
+	if want := `gml: line 5, col 1: unrecognized keyword: "%nope"`; err == nil || err.Error() != want {
+		t.Errorf("want: %q\ngot:  %v", want, err)
+	}
+}
+
+func TestLeadingSpace(t *testing.T) {
+	want := "<article><header><h1 class=\"title\">Hello</h1><p class=\"pubdate\"><time datetime=\"2020-01-02\">January 2, 2020</time></p></header><p>Hi</p></article>"
+
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"byte order mark", "\ufeff%title Hello\n%date 2020-01-02\n\nHi"},
+		{"byte order mark and CRLF", "\ufeff%title Hello\r\n%date 2020-01-02\r\n\r\nHi"},
+		{"blank lines", "\n\n \t\n%title Hello\n%date 2020-01-02\n\nHi"},
+		{"indented metadata", "\n  %title Hello\n  %date 2020-01-02\n\nHi"},
+		{"indented with tabs", "\t%title Hello\n\t%date 2020-01-02\n\nHi"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := Parse(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := doc.HTML(&HTMLOptions{Minified: true}); got != want {
+				t.Errorf("want:\n%s\ngot:\n%s", want, got)
+			}
+
+			doc, err = ParseReader(context.Background(), strings.NewReader(tt.input), &ParseOptions{Strict: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := doc.HTML(&HTMLOptions{Minified: true}); got != want {
+				t.Errorf("streamed: want:\n%s\ngot:\n%s", want, got)
+			}
+		})
+	}
+}
+
+func TestWriteHTML(t *testing.T) {
+	doc, err := Parse("%title Hi\n%lang en\n\n* Heading\n\nSome /text/.\n\n- a\n- b\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b strings.Builder
+	n, err := doc.WriteHTML(&b, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := doc.HTML(nil); b.String() != want || n != len(want) {
+		t.Errorf("want %d bytes:\n%s\ngot %d bytes:\n%s", len(want), want, n, b.String())
+	}
+
+	// Writing stops at the first error
+	w := &limitedWriter{max: 20}
+	n, err = doc.WriteHTML(w, nil)
+	if !errors.Is(err, errFull) || n != w.written || n > 20 {
+		t.Errorf("got %d bytes (%d written) and error %v", n, w.written, err)
+	}
+}
+
+var errFull = errors.New("full")
+
+// limitedWriter fails once it would be written more than max bytes.
+type limitedWriter struct {
+	max, written int
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if w.written+len(p) > w.max {
+		return 0, errFull
+	}
+
+	w.written += len(p)
+	return len(p), nil
+}
+
+func TestClassNames(t *testing.T) {
+	doc, err := Parse("%title Hi\n\n* Intro\n\n- [x] done\n\n%note\nCareful with $x$.\n\n%figure class=wide\n<img src=\"a.jpg\">")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := &HTMLOptions{
+		Minified:    true,
+		ClassPrefix: "gml-",
+		Classes:     map[string]string{"heading-ref": "anchor", "done": ""},
+	}
+
+	want := `<article><header><h1 class="gml-title">Hi</h1></header>` +
+		`<h2 id="intro" class="gml-heading">Intro <a class="anchor" href="#intro">¶</a></h2>` +
+		`<ul><li class="gml-task"><input type="checkbox" checked disabled> done</li></ul>` +
+		`<aside class="gml-admonition gml-note"><p class="gml-admonition-title">Note</p>` +
+		`<p>Careful with <span class="gml-math gml-inline">\(x\)</span>.</p></aside>` +
+		`<figure class="wide"><img src="a.jpg"></figure></article>`
+	if got := doc.HTML(opts); got != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestIndent(t *testing.T) {
+	doc, err := Parse("- see:\n\n  %figure href=https://example.com\n  <img src=\"a.jpg\">\n  A caption\n- done")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Blocks in a list item are indented under it
+	want := "<ul>\n" +
+		"  <li><p>see:</p>\n" +
+		"  <figure>\n" +
+		"    <a href=\"https://example.com\">\n" +
+		"      <img src=\"a.jpg\">\n" +
+		"    </a>\n" +
+		"    <figcaption>A caption</figcaption>\n" +
+		"  </figure></li>\n" +
+		"  <li>done</li>\n" +
+		"</ul>"
+	if got := doc.ExcerptHTML(1, &HTMLOptions{Indent: "  "}); got != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestRefSymbols(t *testing.T) {
+	doc, err := Parse("* Intro\n\nSee this[fn:1].\n\n%footnotes\n- [1] A note.")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := &HTMLOptions{
+		Minified:             true,
+		HeadingRef:           "#",
+		HeadingRefLabel:      "Link to this section",
+		FootnoteBackrefLabel: `Back to "the" text`,
+	}
+
+	want := `<article><header></header>` +
+		`<h2 id="intro" class="heading">Intro <a class="heading-ref" href="#intro" aria-label="Link to this section">#</a></h2>` +
+		`<p>See this<a id="fnr.1" href="#fn.1"><sup>[1]</sup></a>.</p>` +
+		`<footer><ol><li id="fn.1">[1] A note. <a href="#fnr.1" aria-label="Back to &#34;the&#34; text">⮐</a></li></ol></footer></article>`
+	if got := doc.HTML(opts); got != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestIDPrefix(t *testing.T) {
+	doc, err := Parse("%toc\n\n* Intro\n\nSee this[fn:1].\n\n%footnotes\n- [1] A note.")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `<nav class="toc"><ul><li><a href="#post-1-intro">Intro</a></li></ul></nav>` +
+		`<h2 id="post-1-intro" class="heading">Intro <a class="heading-ref" href="#post-1-intro">¶</a></h2>` +
+		`<p>See this<a id="post-1-fnr.1" href="#post-1-fn.1"><sup>[1]</sup></a>.</p>` +
+		`<footer><ol><li id="post-1-fn.1">[1] A note. <a href="#post-1-fnr.1">⮐</a></li></ol></footer>`
+	if got := doc.ExcerptHTML(4, &HTMLOptions{Minified: true, IDPrefix: "post-1-"}); got != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestTaskList(t *testing.T) {
+	doc, err := Parse("- [ ] write the post\n- [x] pick a /title/\n- [X]\n- [link](https://example.com)\n- [ ]\n  blocks\n\n  %pre\n  code")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "<ul>\n" +
+		"\t<li class=\"task\"><input type=\"checkbox\" disabled> write the post</li>\n" +
+		"\t<li class=\"task done\"><input type=\"checkbox\" checked disabled> pick a <em>title</em></li>\n" +
+		"\t<li class=\"task done\"><input type=\"checkbox\" checked disabled> </li>\n" +
+		"\t<li><a href=\"https://example.com\">link</a></li>\n" +
+		"\t<li class=\"task\"><input type=\"checkbox\" disabled> <p>blocks</p>\n\t<pre>code</pre></li>\n" +
+		"</ul>"
+	if got := doc.ExcerptHTML(1, nil); got != want {
+		t.Errorf("want:\t%q\n got:\t%q", want, got)
+	}
+}
+
+func TestDuplicateAnchors(t *testing.T) {
+	doc, err := Parse("* Notes\n\n* Notes\n\n** Notes {#notes-2}\n\n* Notes")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	for _, m := range regexp.MustCompile(`id="([^"]+)"`).FindAllStringSubmatch(doc.ExcerptHTML(10, nil), -1) {
+		ids = append(ids, m[1])
+	}
+
+	want := []string{"notes", "notes-3", "notes-2", "notes-4"}
+	if !reflect.DeepEqual(ids, want) {
+		t.Errorf("want: %q; got: %q", want, ids)
+	}
+}
+
+func TestUnicodeAnchors(t *testing.T) {
+	doc, err := Parse("* Über uns\n\n* Привет, мир!\n\n* 日本語\n\n* 🎉\n\n* 🎈")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	for _, m := range regexp.MustCompile(`id="([^"]+)"`).FindAllStringSubmatch(doc.ExcerptHTML(10, nil), -1) {
+		ids = append(ids, m[1])
+	}
+
+	want := []string{"über-uns", "привет-мир", "日本語", "section", "section-2"}
+	if !reflect.DeepEqual(ids, want) {
+		t.Errorf("want: %q; got: %q", want, ids)
+	}
+}
+
+func TestSlugify(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"  Hello, World!  ", "hello-world"},
+		{"a  -  b", "a-b"},
+		{"Café au lait", "café-au-lait"},
+		{"snake_case 2", "snake_case-2"},
+	}
+
+	for _, tt := range tests {
+		if got := Slugify(tt.in); got != tt.want {
+			t.Errorf("Slugify(%q) = %q; want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestAdmonition(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{
+			"%note\nRead the /manual/.",
+			"<aside class=\"admonition note\">\n\t<p class=\"admonition-title\">Note</p>\n\t<p>Read the <em>manual</em>.</p>\n</aside>",
+		},
+		{
+			"%warning Heads up!\nThis *deletes*\neverything.",
+			"<aside class=\"admonition warning\">\n\t<p class=\"admonition-title\">Heads up!</p>\n\t<p>This <strong>deletes</strong>\neverything.</p>\n</aside>",
+		},
+		{
+			"%tip\nUse ~gmlfmt~.",
+			"<aside class=\"admonition tip\">\n\t<p class=\"admonition-title\">Tip</p>\n\t<p>Use <code>gmlfmt</code>.</p>\n</aside>",
+		},
+	}
+
+	for _, tt := range tests {
+		doc, err := Parse(tt.input)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.input, err)
+		}
+
+		if got := doc.ExcerptHTML(1, nil); got != tt.want {
+			t.Errorf("want:\t%q\n got:\t%q", tt.want, got)
+		}
+	}
+}
+
+func TestVerse(t *testing.T) {
+	doc, err := Parse("%verse\nSo much depends\n  upon\n\n%verse\na /red/ wheel\n  barrow")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "<p class=\"verse\">So much depends<br>\n&nbsp;&nbsp;upon</p>\n" +
+		"<p class=\"verse\">a <em>red</em> wheel<br>\n&nbsp;&nbsp;barrow</p>"
+	if got := doc.ExcerptHTML(2, nil); got != want {
+		t.Errorf("want:\t%q\n got:\t%q", want, got)
+	}
+}
+
+func TestFigure(t *testing.T) {
+	doc, err := Parse("%figure href=big.jpg?a=1&b=2 id=saturn class=\"wide dark\" alt=\"Saturn & rings\" width=640 loading=lazy\n<img src=\"saturn.jpg\">\nSaturn")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "<figure id=\"saturn\" class=\"wide dark\">" +
+		"<a href=\"big.jpg?a=1&amp;b=2\">" +
+		"<img alt=\"Saturn &amp; rings\" loading=\"lazy\" width=\"640\" src=\"saturn.jpg\">" +
+		"</a>" +
+		"<figcaption>Saturn</figcaption>" +
+		"</figure>"
+	if got := doc.ExcerptHTML(1, &HTMLOptions{Minified: true}); got != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+
+	errTests := []struct {
+		input string
+		err   string
+	}{
+		{"%figure big\n<img src=\"a.png\">\n", "unexpected argument \"big\""},
+		{"%figure title=x\n<img src=\"a.png\">\n", "unknown argument \"title\""},
+		{"%figure width=wide\n<img src=\"a.png\">\n", "width must be a number"},
+		{"%figure loading=later\n<img src=\"a.png\">\n", "loading must be lazy or eager"},
+		{"%figure alt=x\n<svg></svg>\n", "alt= needs an <img>"},
+	}
+
+	for _, tt := range errTests {
+		_, err := Parse(tt.input)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%q: want error containing %q; got %v", tt.input, tt.err, err)
+		}
+	}
+}
+
+func TestMath(t *testing.T) {
+	doc, err := Parse("%math\n\\frac{a}{b} < 1\n\\% not a keyword\n\nWhere $b \\neq 0$.")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "<div class=\"math display\">\\[\\frac{a}{b} &lt; 1\n% not a keyword\\]</div>\n" +
+		"<p>Where <span class=\"math inline\">\\(b \\neq 0\\)</span>.</p>"
+	if got := doc.ExcerptHTML(2, nil); got != want {
+		t.Errorf("want:\t%q\n got:\t%q", want, got)
+	}
+
+	if _, err := Parse("%math inline\nx\n"); err == nil {
+		t.Error("want an error for %math arguments")
+	}
+}
+
+func TestBlockquoteAttribution(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{
+			"%blockquote cite=https://example.com/talk\nSimplicity is /complicated/.",
+			"<blockquote cite=\"https://example.com/talk\">Simplicity is <em>complicated</em>.</blockquote>",
+		},
+		{
+			"%blockquote cite=\"https://go.dev/talks\"\nClear is better\nthan clever.\n-- Rob Pike, [Go Proverbs](https://go-proverbs.github.io)",
+			"<figure class=\"quote\">\n\t<blockquote cite=\"https://go.dev/talks\">Clear is better\nthan clever.</blockquote>\n" +
+				"\t<figcaption>— <cite>Rob Pike, <a href=\"https://go-proverbs.github.io\">Go Proverbs</a></cite></figcaption>\n</figure>",
+		},
+		{
+			"%blockquote\n-- not an attribution",
+			"<blockquote>-- not an attribution</blockquote>",
+		},
+	}
+
+	for _, tt := range tests {
+		doc, err := Parse(tt.input)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.input, err)
+		}
+
+		if got := doc.ExcerptHTML(1, nil); got != tt.want {
+			t.Errorf("want:\t%q\n got:\t%q", tt.want, got)
+		}
+	}
+
+	if _, err := Parse("%blockquote author=me\ntext"); err == nil {
+		t.Error("want an error for an unknown argument")
+	}
+}
+
+func TestEscapes(t *testing.T) {
+	doc, err := Parse("\\% of users\n\n\\- not a list\n\n\\* not a heading\n\n1\\. not a list\n\n%pre\n\\%verbatim\n\n%blockquote\nquote\n\\%continued")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "<p>% of users</p>\n<p>- not a list</p>\n<p>* not a heading</p>\n<p>1. not a list</p>\n" +
+		"<pre>%verbatim</pre>\n<blockquote>quote\n%continued</blockquote>"
+	if got := doc.ExcerptHTML(6, nil); got != want {
+		t.Errorf("want:\t%q\n got:\t%q", want, got)
+	}
+}
+
+func TestComments(t *testing.T) {
+	doc, err := Parse(";; TODO: intro\nFirst\n;; a note\nsecond\n\n%comment\n* not a heading\n\n- item")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "<p>First</p>\n<p>second</p>\n<ul>\n\t<li>item</li>\n</ul>"
+	if got := doc.ExcerptHTML(10, nil); got != want {
+		t.Errorf("want:\t%q\n got:\t%q", want, got)
+	}
+}
+
+func TestMeta(t *testing.T) {
+	doc, err := Parse("%title Hello\n%License CC-BY 4.0\n%series  Go tips\n%date 2022-03-21\n%series Go\n\nBody")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]string{
+		"title":    "Hello",
+		"license":  "CC-BY 4.0",
+		"%LICENSE": "CC-BY 4.0",
+		"series":   "Go",
+		"date":     "2022-03-21",
+		"missing":  "",
+	}
+	for key, want := range tests {
+		if got := doc.Meta(key); got != want {
+			t.Errorf("Meta(%q): want %q; got %q", key, want, got)
+		}
+	}
+
+	// Other keywords are only metadata at the top of the document
+	for _, input := range []string{"Body\n\n%license CC-BY\n", "%title Hello\n\n%license CC-BY\n", "%license\n"} {
+		if _, err := Parse(input); err == nil || !strings.Contains(err.Error(), "unrecognized keyword") {
+			t.Errorf("%q: want an unrecognized keyword error; got: %v", input, err)
+		}
+	}
+}
+
+func TestTags(t *testing.T) {
+	doc, err := Parse("%title Hello\n%tags go,  blogging,\n%tags Go, blogging\n\nBody")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"go", "blogging", "Go"}
+	if got := doc.Tags(); !reflect.DeepEqual(got, want) {
+		t.Errorf("want: %q; got: %q", want, got)
+	}
+	if got := doc.Meta("tags"); got != "go, blogging, Go" {
+		t.Errorf("got Meta(\"tags\"): %q", got)
+	}
+}
+
+func TestSummary(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"%summary A /short/ post & more\n\nBody", "A short post & more"},
+		{"* Heading\n\nThe *first*[fn:1]\nparagraph, [linked](/x/).\n\nSecond\n\n%footnotes\n- [1] note", "The first paragraph, linked."},
+		{"* Only a heading", ""},
+	}
+
+	for _, tt := range tests {
+		doc, err := Parse(tt.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := doc.Summary(); got != tt.want {
+			t.Errorf("%q:\nwant:\t%q\n got:\t%q", tt.input, tt.want, got)
+		}
+	}
+}
+
+func TestLang(t *testing.T) {
+	doc, err := Parse("%title Olá\n%lang pt-BR\n\nTexto")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := doc.Lang(); got != "pt-BR" {
+		t.Errorf("got Lang %q", got)
+	}
+
+	want := "<article lang=\"pt-BR\"><header><h1 class=\"title\">Olá</h1></header><p>Texto</p></article>"
+	if got := doc.HTML(&HTMLOptions{Minified: true}); got != want {
+		t.Errorf("want:\t%q\n got:\t%q", want, got)
+	}
+
+	if _, err := Parse("%lang \"><script>\n"); err == nil {
+		t.Error("want an error for an invalid language tag")
+	}
+}
+
+func TestDefinitionList(t *testing.T) {
+	doc, err := Parse("%dl\nGML :: Gutenblog /Markup/ Language\n:: A markup language\nTOC :: Table of contents")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "<dl>\n" +
+		"\t<dt>GML</dt>\n\t<dd>Gutenblog <em>Markup</em> Language</dd>\n\t<dd>A markup language</dd>\n" +
+		"\t<dt>TOC</dt>\n\t<dd>Table of contents</dd>\n" +
+		"</dl>"
+	if got := doc.ExcerptHTML(1, nil); got != want {
+		t.Errorf("want:\t%q\n got:\t%q", want, got)
+	}
+
+	for _, input := range []string{"%dl\nno separator", "%dl\n:: no term"} {
+		if _, err := Parse(input); err == nil {
+			t.Errorf("%q: want an error", input)
+		}
+	}
+}
+
+func TestExcerpt(t *testing.T) {
+	input := "%title example\n\n* Heading\n\nfirst\nparagraph\n\nsecond paragraph"
+
+	doc, err := Parse(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := "first\nparagraph", doc.Excerpt(); want != got {
+		t.Errorf("want: %q; got: %q", want, got)
+	}
+}
+
+func TestExcerptHTML(t *testing.T) {
+	input := "%title example\n\n* Heading\n\nfirst\n\n- one\n- two\n\nlast"
+
+	doc, err := Parse(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		n    int
+		want string
+	}{
+		{0, ""},
+		{2, "<h2 id=\"heading\" class=\"heading\">Heading <a class=\"heading-ref\" href=\"#heading\">¶</a></h2>\n<p>first</p>"},
+		{3, "<h2 id=\"heading\" class=\"heading\">Heading <a class=\"heading-ref\" href=\"#heading\">¶</a></h2>\n<p>first</p>\n<ul>\n\t<li>one</li>\n\t<li>two</li>\n</ul>"},
+		{10, "<h2 id=\"heading\" class=\"heading\">Heading <a class=\"heading-ref\" href=\"#heading\">¶</a></h2>\n<p>first</p>\n<ul>\n\t<li>one</li>\n\t<li>two</li>\n</ul>\n<p>last</p>"},
+	}
+
+	for _, test := range tests {
+		if got := doc.ExcerptHTML(test.n, nil); got != test.want {
+			t.Errorf("n=%d:\nwant:\t%q\n got:\t%q", test.n, test.want, got)
+		}
+	}
+}
+
+func TestTable(t *testing.T) {
+	tests := []struct {
+		name, input, want string
+	}{
+		{
+			"header and alignment",
+			"%table\n| Name | Qty |\n| :--- | --: |\n| *apple* | 3 |\n| pear |",
+			"<table>\n\t<thead>\n\t\t<tr><th style=\"text-align: left\">Name</th><th style=\"text-align: right\">Qty</th></tr>\n\t</thead>\n\t<tbody>\n\t\t<tr><td style=\"text-align: left\"><strong>apple</strong></td><td style=\"text-align: right\">3</td></tr>\n\t\t<tr><td style=\"text-align: left\">pear</td><td style=\"text-align: right\"></td></tr>\n\t</tbody>\n</table>",
+		},
+		{
+			"no header",
+			"%table\na | b\nc | d",
+			"<table>\n\t<tbody>\n\t\t<tr><td>a</td><td>b</td></tr>\n\t\t<tr><td>c</td><td>d</td></tr>\n\t</tbody>\n</table>",
+		},
+		{
+			"alignment without header",
+			"%table\n|:-:|\n|x|",
+			"<table>\n\t<tbody>\n\t\t<tr><td style=\"text-align: center\">x</td></tr>\n\t</tbody>\n</table>",
+		},
+	}
+
+	for _, test := range tests {
+		doc, err := Parse(test.input)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		if got := doc.ExcerptHTML(1, nil); got != test.want {
+			t.Errorf("%s:\nwant:\t%q\n got:\t%q", test.name, test.want, got)
+		}
+	}
+}
+
+func TestCSV(t *testing.T) {
+	fsys := fstest.MapFS{
+		"data/sales.csv": {Data: []byte("Fruit,Qty\napple,3\n\"pear, green\",4\n")},
+	}
+
+	tests := []struct {
+		name, input, want string
+	}{
+		{
+			"file",
+			"%csv data/sales.csv",
+			"<table>\n\t<thead>\n\t\t<tr><th>Fruit</th><th>Qty</th></tr>\n\t</thead>\n\t<tbody>\n\t\t<tr><td>apple</td><td>3</td></tr>\n\t\t<tr><td>pear, green</td><td>4</td></tr>\n\t</tbody>\n</table>",
+		},
+		{
+			"inline without header",
+			"%csv noheader\na,b\nc",
+			"<table>\n\t<tbody>\n\t\t<tr><td>a</td><td>b</td></tr>\n\t\t<tr><td>c</td><td></td></tr>\n\t</tbody>\n</table>",
+		},
+	}
+
+	for _, test := range tests {
+		doc, err := ParseFS(fsys, test.input)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		if got := doc.ExcerptHTML(1, nil); got != test.want {
+			t.Errorf("%s:\nwant:\t%q\n got:\t%q", test.name, test.want, got)
+		}
+	}
+
+	for _, input := range []string{"%csv missing.csv", "%csv data/sales.csv\na,b"} {
+		if _, err := ParseFS(fsys, input); err == nil {
+			t.Errorf("%q: want an error", input)
+		}
+	}
+
+	if _, err := Parse("%csv data/sales.csv"); err == nil {
+		t.Error("Parse: want an error for a CSV file without a file system")
+	}
+
+	// Formatting doesn't read the file
+	if got, err := Format("%csv   data/sales.csv", nil); err != nil || got != "%csv data/sales.csv\n" {
+		t.Errorf("Format: got %q, %v", got, err)
+	}
+}
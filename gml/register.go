@@ -0,0 +1,117 @@
+package gml
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Applications can add their own block keywords with RegisterBlock.
+// A custom block is written like any other keyword block:
+//
+//   %map zoom=12
+//   51.5, -0.12
+//
+// Its parser gets the arguments and text and returns a value that is
+// given to its renderer when the document is written as HTML.
+
+// BlockParser parses the arguments and lines of text of a custom
+// block into a value for its BlockRenderer.
+type BlockParser func(args string, lines []string) (interface{}, error)
+
+// BlockRenderer writes the value parsed from a custom block as HTML.
+type BlockRenderer func(w io.Writer, value interface{}, opts *HTMLOptions) error
+
+type customKeyword struct {
+	parse  BlockParser
+	render BlockRenderer
+}
+
+var (
+	customMu sync.RWMutex
+	custom   = make(map[string]customKeyword)
+)
+
+// RegisterBlock adds a block keyword, e.g. "%map", to every document
+// parsed after it. Keywords are case-insensitive and can't replace a
+// built-in keyword or one that is already registered.
+func RegisterBlock(keyword string, parse BlockParser, render BlockRenderer) error {
+	keyword = strings.ToLower(keyword)
+	if len(keyword) < 2 || keyword[0] != '%' || strings.ContainsAny(keyword, " \t\n") {
+		return fmt.Errorf("gml: invalid block keyword %q", keyword)
+	}
+	if parse == nil || render == nil {
+		return fmt.Errorf("gml: block keyword %q needs a parser and a renderer", keyword)
+	}
+
+	customMu.Lock()
+	defer customMu.Unlock()
+
+	if _, ok := key[keyword]; ok {
+		return fmt.Errorf("gml: block keyword %q is built in", keyword)
+	}
+	if _, ok := custom[keyword]; ok {
+		return fmt.Errorf("gml: block keyword %q is already registered", keyword)
+	}
+
+	custom[keyword] = customKeyword{parse, render}
+	return nil
+}
+
+// lookupBlock returns the custom block keyword registered as keyword.
+func lookupBlock(keyword string) (customKeyword, bool) {
+	customMu.RLock()
+	defer customMu.RUnlock()
+
+	c, ok := custom[keyword]
+	return c, ok
+}
+
+// CustomBlock is a block of a keyword added with RegisterBlock, with
+// the value its BlockParser returned.
+type CustomBlock struct {
+	Keyword string      `json:"keyword"`
+	Args    string      `json:"args"`
+	Lines   []string    `json:"lines"`
+	Value   interface{} `json:"value,omitempty"`
+	render  BlockRenderer
+}
+
+func (c *CustomBlock) WriteHTML(w io.Writer, opts *HTMLOptions) (int, error) {
+	if opts == nil {
+		opts = &HTMLOptions{}
+	}
+
+	var b strings.Builder
+	if err := c.render(&b, c.Value, opts); err != nil {
+		return 0, fmt.Errorf("error rendering %s: %w", c.Keyword, err)
+	}
+
+	return io.WriteString(w, b.String())
+}
+
+func (p *parser) parseCustom(token item) {
+	// The item is the whole keyword line, e.g. "%map zoom=12"
+	keyword, args := cutKeyword(token.val)
+
+	c, ok := lookupBlock(keyword)
+	if !ok {
+		p.errorf("unrecognized keyword: %q", keyword)
+	}
+
+	block := &CustomBlock{
+		Keyword: keyword,
+		Args:    args,
+		Lines:   p.collectItems(itemText),
+		render:  c.render,
+	}
+
+	value, err := c.parse(block.Args, block.Lines)
+	if err != nil {
+		p.errorf("%s: %v", keyword, err)
+	}
+	block.Value = value
+
+	p.doc.content = append(p.doc.content, block)
+}
@@ -0,0 +1,63 @@
+package gml
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestRegisterBlock(t *testing.T) {
+	type point struct {
+		zoom string
+		at   []string
+	}
+
+	parse := func(args string, lines []string) (interface{}, error) {
+		_, zoom, _ := strings.Cut(args, "zoom=")
+		if len(lines) == 0 {
+			return nil, errors.New("missing coordinates")
+		}
+		return point{zoom, lines}, nil
+	}
+	render := func(w io.Writer, v interface{}, opts *HTMLOptions) error {
+		p := v.(point)
+		_, err := fmt.Fprintf(w, `<div class="map" data-zoom="%s">%s</div>`, p.zoom, strings.Join(p.at, ";"))
+		return err
+	}
+
+	if err := RegisterBlock("%Test-Map", parse, render); err != nil {
+		t.Fatal(err)
+	}
+
+	doc, err := Parse("Before\n\n%test-map   zoom=12\n51.5, -0.12\n\n%TEST-MAP\n1, 2\n3, 4")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "<p>Before</p>\n" +
+		"<div class=\"map\" data-zoom=\"12\">51.5, -0.12</div>\n" +
+		"<div class=\"map\" data-zoom=\"\">1, 2;3, 4</div>"
+	if got := doc.ExcerptHTML(3, nil); got != want {
+		t.Errorf("want:\t%q\n got:\t%q", want, got)
+	}
+
+	if _, err := Parse("%test-map\n"); err == nil || !strings.Contains(err.Error(), "%test-map: missing coordinates") {
+		t.Errorf("want the parser's error; got: %v", err)
+	}
+
+	got, err := Format("%test-map   zoom=12\n51.5, -0.12\n", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "%test-map zoom=12\n51.5, -0.12\n"; got != want {
+		t.Errorf("want:\t%q\n got:\t%q", want, got)
+	}
+
+	for _, keyword := range []string{"%test-map", "%pre", "map", "%", "%two words"} {
+		if err := RegisterBlock(keyword, parse, render); err == nil {
+			t.Errorf("%q: want an error", keyword)
+		}
+	}
+}
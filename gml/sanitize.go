@@ -0,0 +1,193 @@
+package gml
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+
+	nethtml "golang.org/x/net/html"
+)
+
+// With HTMLOptions.Sanitize, the HTML an author writes themselves, in
+// %html blocks, figures, and inline HTML, is cut down to an allowlist
+// of elements and attributes that can't run scripts or restyle the
+// page. Disallowed elements are dropped but their text is kept, except
+// for elements like <script> whose content is never text to read.
+// Links and images may only point at http, https, mailto, or relative
+// URLs. GML's own links, images, figures, and media never get script
+// URLs, sanitized or not (see urlAttr).
+
+// allowedElements maps each element that's kept to the attributes it
+// may have, besides the ones in globalAttrs.
+var allowedElements = map[string][]string{
+	"a":          {"href"},
+	"abbr":       nil,
+	"b":          nil,
+	"blockquote": {"cite"},
+	"br":         nil,
+	"caption":    nil,
+	"cite":       nil,
+	"code":       nil,
+	"dd":         nil,
+	"del":        {"cite", "datetime"},
+	"details":    {"open"},
+	"dfn":        nil,
+	"div":        nil,
+	"dl":         nil,
+	"dt":         nil,
+	"em":         nil,
+	"figcaption": nil,
+	"figure":     nil,
+	"h1":         nil,
+	"h2":         nil,
+	"h3":         nil,
+	"h4":         nil,
+	"h5":         nil,
+	"h6":         nil,
+	"hr":         nil,
+	"i":          nil,
+	"img":        {"src", "alt", "width", "height", "loading"},
+	"ins":        {"cite", "datetime"},
+	"kbd":        nil,
+	"li":         nil,
+	"mark":       nil,
+	"ol":         {"start", "reversed"},
+	"p":          nil,
+	"pre":        nil,
+	"q":          {"cite"},
+	"s":          nil,
+	"samp":       nil,
+	"small":      nil,
+	"span":       nil,
+	"strong":     nil,
+	"sub":        nil,
+	"summary":    nil,
+	"sup":        nil,
+	"table":      nil,
+	"tbody":      nil,
+	"td":         {"colspan", "rowspan"},
+	"tfoot":      nil,
+	"th":         {"colspan", "rowspan", "scope"},
+	"thead":      nil,
+	"time":       {"datetime"},
+	"tr":         nil,
+	"u":          nil,
+	"ul":         nil,
+	"var":        nil,
+}
+
+// globalAttrs are the attributes any allowed element may have.
+var globalAttrs = []string{"id", "class", "title", "lang", "dir"}
+
+// urlAttrs are the attributes whose value is a URL.
+var urlAttrs = map[string]bool{"href": true, "src": true, "cite": true}
+
+// droppedContent are the elements whose content is dropped along with
+// them.
+var droppedContent = map[string]bool{
+	"script":   true,
+	"style":    true,
+	"template": true,
+	"iframe":   true,
+	"object":   true,
+	"noscript": true,
+	"textarea": true,
+	"title":    true,
+}
+
+// sanitizeHTML returns the HTML s with only the allowed elements and
+// attributes.
+func sanitizeHTML(s string) string {
+	var b strings.Builder
+
+	z := nethtml.NewTokenizer(strings.NewReader(s))
+	skip := "" // Element whose content is being dropped
+	for {
+		tt := z.Next()
+		if tt == nethtml.ErrorToken {
+			return b.String() // io.EOF since it's read from a string
+		}
+
+		tok := z.Token()
+		if skip != "" {
+			if tt == nethtml.EndTagToken && tok.Data == skip {
+				skip = ""
+			}
+			continue
+		}
+
+		switch tt {
+		case nethtml.TextToken:
+			b.WriteString(escapeHTML(tok.Data))
+		case nethtml.StartTagToken, nethtml.SelfClosingTagToken:
+			if droppedContent[tok.Data] && tt == nethtml.StartTagToken {
+				skip = tok.Data
+				continue
+			}
+			b.WriteString(sanitizeToken(tok))
+		case nethtml.EndTagToken:
+			if _, ok := allowedElements[tok.Data]; ok {
+				b.WriteString("</" + tok.Data + ">")
+			}
+		}
+		// Comments and doctypes are dropped
+	}
+}
+
+// sanitizeTag returns the single HTML tag s with only the allowed
+// attributes, or "" if its element isn't allowed.
+func sanitizeTag(s string) string {
+	z := nethtml.NewTokenizer(strings.NewReader(s))
+	switch z.Next() {
+	case nethtml.StartTagToken, nethtml.SelfClosingTagToken:
+		return sanitizeToken(z.Token())
+	case nethtml.EndTagToken:
+		name := z.Token().Data
+		if _, ok := allowedElements[name]; ok {
+			return "</" + name + ">"
+		}
+	}
+
+	return ""
+}
+
+// sanitizeToken writes the start tag tok with only the allowed
+// attributes, or "" if its element isn't allowed.
+func sanitizeToken(tok nethtml.Token) string {
+	attrs, ok := allowedElements[tok.Data]
+	if !ok {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("<" + tok.Data)
+	for _, a := range tok.Attr {
+		if a.Namespace != "" || !slices.Contains(attrs, a.Key) && !slices.Contains(globalAttrs, a.Key) {
+			continue
+		}
+		if urlAttrs[a.Key] && !safeURL(a.Val) {
+			continue
+		}
+
+		b.WriteString(" " + a.Key + `="` + escapeHTML(a.Val) + `"`)
+	}
+	b.WriteString(">")
+
+	return b.String()
+}
+
+// safeURL reports whether the URL s is relative or uses a scheme that
+// can't run scripts.
+func safeURL(s string) bool {
+	u, err := url.Parse(strings.TrimSpace(s))
+	if err != nil {
+		return false
+	}
+
+	switch strings.ToLower(u.Scheme) {
+	case "", "http", "https", "mailto":
+		return true
+	}
+
+	return false
+}
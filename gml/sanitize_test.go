@@ -0,0 +1,91 @@
+package gml
+
+import "testing"
+
+func TestSanitizeHTML(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"allowed", `<p class="note">Hello, <em>world</em>!</p>`, `<p class="note">Hello, <em>world</em>!</p>`},
+		{"script", `<p>Hi</p><script>alert("hi")</script>`, `<p>Hi</p>`},
+		{"style", `<style>body { display: none }</style>Text`, `Text`},
+		{"event handler", `<img src="a.png" onerror="alert(1)" alt="A">`, `<img src="a.png" alt="A">`},
+		{"javascript url", `<a href="javascript:alert(1)">x</a>`, `<a>x</a>`},
+		{"javascript url case", `<a href=" JavaScript:alert(1)">x</a>`, `<a>x</a>`},
+		{"safe urls", `<a href="/about">a</a><a href="mailto:me@example.com">b</a>`, `<a href="/about">a</a><a href="mailto:me@example.com">b</a>`},
+		{"unknown element", `<marquee>Wheee</marquee>`, `Wheee`},
+		{"iframe", `<iframe src="https://example.com">x</iframe>after`, `after`},
+		{"comment", `a<!-- secret -->b`, `ab`},
+		{"style attribute", `<span style="color: red">red</span>`, `<span>red</span>`},
+		{"text", `1 < 2 & 3`, `1 &lt; 2 &amp; 3`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sanitizeHTML(tt.input); got != tt.want {
+				t.Errorf("want: %s\ngot:  %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	input := "%html\n<div onclick=\"steal()\">Hi<script>steal()</script></div>\n\n" +
+		"Click <a href=\"javascript:steal()\" title=\"t\">/here/</a> or <b onmouseover=\"steal()\">there</b>.\n"
+	doc, err := Parse(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `<div>Hi</div><p>Click <a title="t"><em>here</em></a> or <b>there</b>.</p>`
+	if got := doc.ExcerptHTML(2, &HTMLOptions{Minified: true, InlineHTML: true, Sanitize: true}); got != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+
+	// Without inline HTML, tags in the text are escaped anyway
+	want = `<div>Hi</div><p>Click &lt;a href="javascript:steal()" title="t"&gt;/here/&lt;/a&gt; or &lt;b onmouseover="steal()"&gt;there&lt;/b&gt;.</p>`
+	if got := doc.ExcerptHTML(2, &HTMLOptions{Minified: true, Sanitize: true}); got != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestScriptURLs(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"link", "[l](javascript:steal)", `<p><a>l</a></p>`},
+		{"link case", "[l](JavaScript:steal)", `<p><a>l</a></p>`},
+		{"bracketed link", "[[javascript:alert(1)]]", `<p><a>javascript:alert(1)</a></p>`},
+		{"image", "![x](javascript:steal)", `<p><img alt="x"></p>`},
+		{"safe link", "[l](/about/) and https://example.com", `<p><a href="/about/">l</a> and <a href="https://example.com">https://example.com</a></p>`},
+		{"figure href", "%figure href=\"javascript:alert(1)\"\n<img src=\"a.png\">", `<figure><a><img src="a.png"></a></figure>`},
+		{"video", "%video javascript:alert(1) poster=javascript:alert(2)", `<figure class="video"><video controls preload="metadata" playsinline><a>Download the video</a></video></figure>`},
+		{"audio", "%audio javascript:alert(1)", `<figure class="audio"><audio controls preload="metadata"><a>Download the audio</a></audio></figure>`},
+		{"blockquote cite", "%blockquote cite=javascript:alert(1)\nQuoted", `<blockquote>Quoted</blockquote>`},
+		{"vbscript link", "[l](vbscript:steal)", `<p><a>l</a></p>`},
+		{"data link", "[l](data:text/html;base64,PHNjcmlwdD4=)", `<p><a>l</a></p>`},
+		{"data image", "![x](data:image/png;base64,iVBO)", `<p><img src="data:image/png;base64,iVBO" alt="x"></p>`},
+		{"data html image", "![x](data:text/html;base64,PHNjcmlwdD4=)", `<p><img alt="x"></p>`},
+		{"other scheme", "[call](tel:+15555550100)", `<p><a href="tel:+15555550100">call</a></p>`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := Parse(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Script URLs are dropped by default, not only when sanitizing
+			for _, sanitize := range []bool{false, true} {
+				if got := doc.ExcerptHTML(1, &HTMLOptions{Minified: true, Sanitize: sanitize}); got != tt.want {
+					t.Errorf("sanitize=%v\nwant: %s\ngot:  %s", sanitize, tt.want, got)
+				}
+			}
+		})
+	}
+}
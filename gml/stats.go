@@ -0,0 +1,90 @@
+package gml
+
+import (
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Stats are counts of what's in a document, e.g. for a post's reading
+// time or a lint check on its length. Words and characters are only
+// counted in styled text, so code, math, and HTML blocks aren't.
+type Stats struct {
+	Words       int
+	Characters  int // Characters of the words, not counting spaces
+	Headings    int
+	Links       int // Links in styled text, not counting footnote references
+	Images      int // Images in styled text
+	Figures     int
+	Footnotes   int           // Footnote definitions
+	ReadingTime time.Duration // At WordsPerMinute, rounded up to a whole minute
+}
+
+// WordsPerMinute is the reading speed that Stats.ReadingTime assumes.
+const WordsPerMinute = 200
+
+// Stats counts the words, headings, links, and so on of the document.
+func (d document) Stats() Stats {
+	var s Stats
+
+	count := func(text string) string {
+		for _, w := range strings.Fields(plainText(text)) {
+			if isWord(w) {
+				s.Words++
+				s.Characters += utf8.RuneCountInString(w)
+			}
+		}
+
+		html := renderInline(reFootnoteRef.ReplaceAllString(text, ""), nil)
+		s.Links += strings.Count(html, `<a href="`)
+		s.Images += strings.Count(html, `<img src="`)
+		return text
+	}
+
+	Inspect(d, func(b Block) bool {
+		switch b := b.(type) {
+		case *HeadingBlock:
+			s.Headings++
+		case *Figure:
+			s.Figures++
+		case *Footnotes:
+			s.Footnotes += len(b.Items)
+		}
+
+		// The blocks of list items are inspected on their own
+		if l := listItems(b); l != nil {
+			for i, item := range l.Items {
+				if i >= len(l.Blocks) || l.Blocks[i] == nil {
+					_, text := cutCheckbox(item)
+					count(text)
+				}
+			}
+		} else if t, ok := b.(textBlock); ok {
+			t.rewriteText(count)
+		}
+		return true
+	})
+
+	if s.Words > 0 {
+		minutes := (s.Words + WordsPerMinute - 1) / WordsPerMinute
+		s.ReadingTime = time.Duration(minutes) * time.Minute
+	}
+
+	return s
+}
+
+// isWord reports whether s is a word: it has a letter or digit,
+// unlike "--", and isn't the label of a footnote like "[1]".
+func isWord(s string) bool {
+	if label, ok := strings.CutPrefix(s, "["); ok {
+		if n, ok := strings.CutSuffix(label, "]"); ok {
+			if _, err := strconv.Atoi(n); err == nil {
+				return false
+			}
+		}
+	}
+
+	return strings.IndexFunc(s, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsNumber(r) }) >= 0
+}
@@ -0,0 +1,57 @@
+package gml
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	input := `%title Not counted
+
+* Getting started
+
+Read /the/ [docs](https://go.dev/doc) -- twice.[fn:1]
+
+- [x] one
+- two
+
+  ![A cat](cat.jpg) and https://example.com
+
+%pre
+not counted either
+
+%figure
+<img src="dog.jpg">
+A dog.
+
+%footnotes
+- [1] A note.`
+
+	doc, err := Parse(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Stats{
+		Words:       14,
+		Characters:  70,
+		Headings:    1,
+		Links:       2,
+		Images:      1,
+		Figures:     1,
+		Footnotes:   1,
+		ReadingTime: time.Minute,
+	}
+	if got := doc.Stats(); got != want {
+		t.Errorf("want %+v; got %+v", want, got)
+	}
+
+	doc, err = Parse(strings.Repeat("word ", WordsPerMinute+1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := doc.Stats().ReadingTime; got != 2*time.Minute {
+		t.Errorf("want reading time of 2m; got %v", got)
+	}
+}
@@ -0,0 +1,296 @@
+package gml
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	nethtml "golang.org/x/net/html"
+)
+
+// A document's plain text has no markup at all, e.g. for a search
+// index, an excerpt, or the text part of an email. Blocks are
+// separated by a blank line, links are followed by their URL, and
+// footnotes are numbered notes at the end:
+//
+//   Hello world
+//
+//   See the docs (https://example.com/docs).[1]
+//
+//   - First
+//   - Second
+//
+//   [1] A note.
+//
+// Blocks that are only for a page, like %toc or %comment, are left out.
+
+// PlainText returns the document as plain text.
+func (d document) PlainText() string {
+	var b strings.Builder
+
+	if d.title != "" {
+		b.WriteString(d.title + "\n")
+		if d.subtitle != "" {
+			b.WriteString(d.subtitle + "\n")
+		}
+	}
+
+	writeBlocksText(&b, d.content, "")
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// writeBlocksText writes the blocks as plain text with each line after
+// the first indented by indent, separating them with blank lines.
+func writeBlocksText(b *strings.Builder, blocks []Block, indent string) {
+	for _, block := range blocks {
+		text := blockText(block, indent)
+		if text == "" {
+			continue
+		}
+
+		if b.Len() > 0 {
+			b.WriteString("\n" + indent)
+		}
+		b.WriteString(text + "\n")
+	}
+}
+
+// blockText returns the block as plain text with each line after the
+// first indented by indent, or "" if it has no text to read.
+func blockText(block Block, indent string) string {
+	var lines []string
+	switch b := block.(type) {
+	case *Comment, *TOC, *Abbr:
+		return ""
+	case *HeadingBlock:
+		lines = []string{plainLine(b.Text)}
+	case *Paragraph:
+		lines = []string{plainLine(b.Text)}
+	case *UnorderedList:
+		for i := range b.Items {
+			lines = append(lines, listItemText(&b.ListItems, i, "- ", indent))
+		}
+	case *OrderedList:
+		for i := range b.Items {
+			lines = append(lines, listItemText(&b.ListItems, i, strconv.Itoa(i+1)+". ", indent))
+		}
+	case *Footnotes:
+		for i := range b.Items {
+			n := i + 1
+			if i < len(b.numbers) {
+				n = b.numbers[i]
+			}
+
+			label := "[" + strconv.Itoa(n) + "]"
+			item := strings.TrimPrefix(strings.TrimPrefix(listItemText(&b.ListItems, i, "", indent), label), " ")
+			lines = append(lines, label+" "+item)
+		}
+	case *Figure:
+		lines = []string{plainLine(b.Caption)}
+	case *Pre:
+		lines = strings.Split(b.Text, "\n")
+	case *RawHTML:
+		lines = strings.Split(htmlText(b.Text), "\n")
+	case *Blockquote:
+		lines = []string{"> " + plainLine(b.Text)}
+		if b.Attribution != "" {
+			lines = append(lines, "> — "+plainLine(b.Attribution))
+		}
+	case *Admonition:
+		title := b.Title
+		if title == "" {
+			title = strings.ToUpper(b.Kind[:1]) + b.Kind[1:]
+		}
+		lines = []string{plainLine(title) + ": " + plainLine(b.Text)}
+	case *Verse:
+		for _, line := range b.Lines {
+			text := strings.TrimLeft(line, " ")
+			lines = append(lines, line[:len(line)-len(text)]+plainLine(text))
+		}
+	case *Table:
+		lines = tableText(b)
+	case *CSVTable:
+		lines = tableText(b.Table)
+	case *DefinitionList:
+		for _, d := range b.Items {
+			lines = append(lines, plainLine(d.Term))
+			for _, def := range d.Definitions {
+				lines = append(lines, "  "+plainLine(def))
+			}
+		}
+	case *Math:
+		lines = strings.Split(b.Text, "\n")
+	case *Embed:
+		lines = mediaText(b.Caption, b.Title, b.Src)
+	case *Video:
+		lines = mediaText(b.Caption, "", b.Src)
+	case *AudioBlock:
+		lines = mediaText(b.Caption, "", b.Src)
+	default:
+		var html strings.Builder
+		if _, err := block.WriteHTML(&html, nil); err != nil {
+			return ""
+		}
+		lines = strings.Split(htmlText(html.String()), "\n")
+	}
+
+	text := strings.Join(lines, "\n")
+	if strings.TrimSpace(text) == "" {
+		return ""
+	}
+
+	return strings.ReplaceAll(text, "\n", "\n"+indent)
+}
+
+// listItemText returns the i-th item of a list as plain text, starting
+// with marker and with the lines of its nested blocks lined up after
+// the marker.
+func listItemText(l *ListItems, i int, marker, indent string) string {
+	box, text := cutCheckbox(l.Items[i])
+	if box != "" {
+		marker += box + " "
+	}
+
+	if i >= len(l.Blocks) || l.Blocks[i] == nil {
+		return marker + plainLine(text)
+	}
+
+	var b strings.Builder
+	writeBlocksText(&b, l.Blocks[i], indent+strings.Repeat(" ", len(marker)))
+	return marker + strings.TrimSuffix(b.String(), "\n")
+}
+
+// tableText returns the rows of a table as lines with their cells
+// separated by " | ".
+func tableText(t *Table) []string {
+	var lines []string
+	row := func(cells []string) {
+		text := make([]string, len(cells))
+		for i, cell := range cells {
+			text[i] = plainLine(cell)
+		}
+		lines = append(lines, strings.Join(text, " | "))
+	}
+
+	if t.Header != nil {
+		row(t.Header)
+	}
+	for _, r := range t.Rows {
+		row(r)
+	}
+
+	return lines
+}
+
+// mediaText returns the caption, or else the title, of a media file
+// followed by its URL.
+func mediaText(caption, title, src string) []string {
+	if caption != "" {
+		return []string{plainLine(caption), src}
+	}
+	if title != "" {
+		return []string{title, src}
+	}
+
+	return []string{src}
+}
+
+// plainLine returns the styled text s as one line of plain text.
+func plainLine(s string) string {
+	return strings.Join(strings.Fields(htmlText(renderInline(s, &HTMLOptions{InlineHTML: true}))), " ")
+}
+
+// htmlText returns the text of the HTML s. Links are followed by their
+// URL unless it's their text, images are their alt text, and elements
+// like paragraphs and line breaks end a line.
+func htmlText(s string) string {
+	var b strings.Builder
+
+	type link struct {
+		href  string
+		start int // Index in b where the link's text starts
+	}
+	var links []link
+	var skip string // Element whose content is dropped, like <script>
+	var math bool   // In inline math, "\(x\)"
+
+	z := nethtml.NewTokenizer(strings.NewReader(s))
+	for {
+		tt := z.Next()
+		if tt == nethtml.ErrorToken {
+			break
+		}
+
+		tok := z.Token()
+		if skip != "" {
+			if tt == nethtml.EndTagToken && tok.Data == skip {
+				skip = ""
+			}
+			continue
+		}
+
+		switch tt {
+		case nethtml.TextToken:
+			text := tok.Data
+			if math {
+				text = strings.TrimSuffix(strings.TrimPrefix(text, `\(`), `\)`)
+			}
+			b.WriteString(text)
+		case nethtml.StartTagToken, nethtml.SelfClosingTagToken:
+			switch {
+			case droppedContent[tok.Data] && tt == nethtml.StartTagToken:
+				skip = tok.Data
+			case tok.Data == "a":
+				links = append(links, link{attrValue(tok, "href"), b.Len()})
+			case tok.Data == "img":
+				b.WriteString(attrValue(tok, "alt"))
+			case tok.Data == "br":
+				b.WriteString("\n")
+			case tok.Data == "span" && attrValue(tok, "class") == "math inline":
+				math = true
+			}
+		case nethtml.EndTagToken:
+			switch {
+			case tok.Data == "a" && len(links) > 0:
+				l := links[len(links)-1]
+				links = links[:len(links)-1]
+
+				text := strings.TrimSpace(b.String()[l.start:])
+				if l.href != "" && !strings.HasPrefix(l.href, "#") && text != l.href && "mailto:"+text != l.href {
+					fmt.Fprintf(&b, " (%s)", l.href)
+				}
+			case tok.Data == "span":
+				math = false
+			case lineElements[tok.Data]:
+				b.WriteString("\n")
+			}
+		}
+	}
+
+	var lines []string
+	for _, line := range strings.Split(b.String(), "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// lineElements are the elements whose end tag ends a line of text.
+var lineElements = map[string]bool{
+	"p": true, "div": true, "li": true, "dt": true, "dd": true, "tr": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"blockquote": true, "pre": true, "figcaption": true, "table": true,
+}
+
+// attrValue returns the value of the attribute of tok named key.
+func attrValue(tok nethtml.Token, key string) string {
+	for _, a := range tok.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,70 @@
+package gml
+
+import "testing"
+
+func TestPlainText(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			"title and paragraphs",
+			"%title A /Post/\n%subtitle Subtitle\n\n* Intro\n\nHello *world*\nand a < b.",
+			"A /Post/\nSubtitle\n\nIntro\n\nHello world and a < b.",
+		},
+		{
+			"links",
+			"See [the docs](https://go.dev/doc) and https://go.dev.",
+			"See the docs (https://go.dev/doc) and https://go.dev.",
+		},
+		{
+			"lists",
+			"- one\n- [x] two\n\n  more\n\n  - nested\n\n1. first\n2. second",
+			"- one\n- [x] two\n\n      more\n\n      - nested\n\n1. first\n2. second",
+		},
+		{
+			"footnotes",
+			"Hi[fn:a] there.\n\n%footnotes\n- [a] A /note/.",
+			"Hi[1] there.\n\n[1] A note.",
+		},
+		{
+			"blockquote",
+			"%blockquote\nClear is better\nthan clever.\n-- Rob Pike",
+			"> Clear is better than clever.\n> — Rob Pike",
+		},
+		{
+			"code and comments",
+			"%pre\nif a < b {\n\treturn\n}\n\n%comment\nnot for readers",
+			"if a < b {\n\treturn\n}",
+		},
+		{
+			"html",
+			"%html\n<p>Some <b>bold</b> text</p><script>alert(1)</script><p>Bye</p>",
+			"Some bold text\nBye",
+		},
+		{
+			"table",
+			"%table\n| Name | Qty |\n| *apple* | 3 |",
+			"Name | Qty\napple | 3",
+		},
+		{
+			"admonition",
+			"%note\nRead the /manual/.",
+			"Note: Read the manual.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := Parse(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := doc.PlainText(); got != tt.want {
+				t.Errorf("want:\n%s\ngot:\n%s", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package gml
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// A %toc block expands into a nested list of links to the document's
+// headings. "%toc 2" only lists headings down to the second level.
+
+// Heading is a heading of a document, e.g. for a template to build a
+// sidebar from.
+type Heading struct {
+	Level int    `json:"level"` // 1 for "*", 2 for "**", and so on
+	Text  string `json:"text"`  // Styled text as written
+	HTML  string `json:"html"`  // Text rendered as HTML
+	ID    string `json:"id"`    // Anchor of the heading's id attribute
+}
+
+// Headings returns the headings of the document in order.
+func (d document) Headings() []Heading {
+	var headings []Heading
+	for _, b := range d.content {
+		if h, ok := b.(*HeadingBlock); ok {
+			headings = append(headings, h.Heading())
+		}
+	}
+
+	return headings
+}
+
+// Heading returns the exported view of the heading.
+func (h *HeadingBlock) Heading() Heading {
+	id := h.anchor
+	if id == "" {
+		id = h.ref()
+	}
+
+	return Heading{
+		Level: h.Level,
+		Text:  strings.TrimSpace(h.Text),
+		HTML:  strings.TrimSpace(renderSpans(h.Text, true, nil)), // Headings are linked to
+		ID:    id,
+	}
+}
+
+// TOC is a %toc block, listing the document's headings.
+type TOC struct {
+	Depth    int       `json:"depth,omitempty"` // Deepest heading level to list, or 0 for all of them
+	Headings []Heading `json:"headings"`
+}
+
+func (t *TOC) WriteHTML(w io.Writer, opts *HTMLOptions) (int, error) {
+	var b bytes.Buffer
+
+	if opts == nil {
+		opts = &HTMLOptions{}
+	}
+
+	var headings []Heading
+	for _, h := range t.Headings {
+		if t.Depth == 0 || h.Level <= t.Depth {
+			headings = append(headings, h)
+		}
+	}
+
+	fmt.Fprintf(&b, `<nav class="%s">`, opts.class("toc"))
+	opts.newline(&b, 1)
+	writeTOCList(&b, headings, 1, opts)
+	opts.newline(&b, 0)
+	b.WriteString(`</nav>`)
+
+	return w.Write(b.Bytes())
+}
+
+// writeTOCList writes headings as a list nested depth levels deep.
+// Headings deeper than the first one are nested under the heading
+// before them, even when levels are skipped.
+func writeTOCList(b *bytes.Buffer, headings []Heading, depth int, opts *HTMLOptions) {
+	b.WriteString(`<ul>`)
+
+	for i := 0; i < len(headings); {
+		h := headings[i]
+
+		// Find the headings nested under this one
+		j := i + 1
+		for j < len(headings) && headings[j].Level > h.Level {
+			j++
+		}
+
+		opts.newline(b, depth+1)
+		fmt.Fprintf(b, `<li><a href="#%s">%s</a>`, opts.id(h.ID), strings.TrimSpace(renderSpans(h.Text, true, opts)))
+		if j > i+1 {
+			opts.newline(b, depth+2)
+			writeTOCList(b, headings[i+1:j], depth+2, opts)
+			opts.newline(b, depth+1)
+		}
+		b.WriteString(`</li>`)
+
+		i = j
+	}
+
+	opts.newline(b, depth)
+	b.WriteString(`</ul>`)
+}
+
+func (p *parser) parseTOC(token item) {
+	t := &TOC{}
+
+	if arg := strings.TrimSpace(token.val); arg != "" {
+		depth, err := strconv.Atoi(arg)
+		if err != nil || depth < 1 {
+			p.errorf("%%toc: invalid depth %q", arg)
+		}
+		t.Depth = depth
+	}
+
+	if text := p.collectItems(itemText); len(text) > 0 {
+		p.errorf("%%toc doesn't take any text; got: %q", text[0])
+	}
+
+	p.doc.content = append(p.doc.content, t)
+}
+
+// fillTOC gives each %toc block the document's headings once they
+// all have their anchors.
+func fillTOC(blocks []Block) {
+	headings := document{content: blocks}.Headings()
+	for _, b := range blocks {
+		if t, ok := b.(*TOC); ok {
+			t.Headings = headings
+		}
+	}
+}
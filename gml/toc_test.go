@@ -0,0 +1,67 @@
+package gml
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTOC(t *testing.T) {
+	input := "%toc\n\n* Intro\n\n** /Why/ GML\n\n**** Deep\n\n* Intro\n\n** Details {#more}"
+
+	doc, err := Parse(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "<nav class=\"toc\">\n" +
+		"\t<ul>\n" +
+		"\t\t<li><a href=\"#intro\">Intro</a>\n" +
+		"\t\t\t<ul>\n" +
+		"\t\t\t\t<li><a href=\"#why-gml\"><em>Why</em> GML</a>\n" +
+		"\t\t\t\t\t<ul>\n" +
+		"\t\t\t\t\t\t<li><a href=\"#deep\">Deep</a></li>\n" +
+		"\t\t\t\t\t</ul>\n" +
+		"\t\t\t\t</li>\n" +
+		"\t\t\t</ul>\n" +
+		"\t\t</li>\n" +
+		"\t\t<li><a href=\"#intro-2\">Intro</a>\n" +
+		"\t\t\t<ul>\n" +
+		"\t\t\t\t<li><a href=\"#more\">Details</a></li>\n" +
+		"\t\t\t</ul>\n" +
+		"\t\t</li>\n" +
+		"\t</ul>\n" +
+		"</nav>"
+	if got := doc.ExcerptHTML(1, nil); got != want {
+		t.Errorf("want:\n%s\ngot:\n%s", want, got)
+	}
+
+	minified := `<nav class="toc"><ul><li><a href="#intro">Intro</a><ul><li><a href="#why-gml"><em>Why</em> GML</a></li></ul></li><li><a href="#intro-2">Intro</a><ul><li><a href="#more">Details</a></li></ul></li></ul></nav>`
+	doc, err = Parse("%toc 2\n\n" + input[len("%toc\n\n"):])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := doc.ExcerptHTML(1, &HTMLOptions{Minified: true}); got != minified {
+		t.Errorf("want:\t%q\n got:\t%q", minified, got)
+	}
+
+	for _, input := range []string{"%toc zero\n", "%toc\ntext\n"} {
+		if _, err := Parse(input); err == nil {
+			t.Errorf("%q: want an error", input)
+		}
+	}
+}
+
+func TestHeadings(t *testing.T) {
+	doc, err := Parse("* One [[https://example.com]]\n\n** Two {#two}\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Heading{
+		{1, "One [[https://example.com]]", "One [[https://example.com]]", "one-httpsexamplecom"},
+		{2, "Two", "Two", "two"},
+	}
+	if got := doc.Headings(); !reflect.DeepEqual(got, want) {
+		t.Errorf("want: %+v\n got: %+v", want, got)
+	}
+}
@@ -0,0 +1,94 @@
+package gml
+
+// Tools that need more than a document's HTML, like a link checker or
+// a custom renderer, can go through its blocks with Walk or Inspect
+// and switch on their types:
+//
+//   gml.Inspect(doc, func(b gml.Block) bool {
+//   	if f, ok := b.(*gml.Figure); ok {
+//   		fmt.Println(f.Caption)
+//   	}
+//   	return true
+//   })
+//
+// The blocks are the document's own, so changing them changes what
+// the document renders.
+
+// Blocks returns the blocks of the document in order.
+func (d document) Blocks() []Block {
+	return d.content
+}
+
+// A Visitor's Visit method is called by Walk for each block. If it
+// returns a Visitor w, Walk visits the blocks nested in the block with
+// w, followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(b Block) (w Visitor)
+}
+
+// Walk visits the blocks of doc in order with v, depth-first: the
+// blocks nested in a list item or footnote come after the list or
+// footnotes they're in.
+func Walk(doc Document, v Visitor) {
+	for _, b := range doc.Blocks() {
+		walk(v, b)
+	}
+}
+
+func walk(v Visitor, b Block) {
+	if v = v.Visit(b); v == nil {
+		return
+	}
+
+	for _, child := range children(b) {
+		walk(v, child)
+	}
+
+	v.Visit(nil)
+}
+
+// children returns the blocks nested in b.
+func children(b Block) []Block {
+	items := listItems(b)
+	if items == nil {
+		return nil
+	}
+
+	var blocks []Block
+	for _, item := range items.Blocks {
+		blocks = append(blocks, item...)
+	}
+
+	return blocks
+}
+
+// listItems returns the items of b if it's a list or footnotes.
+func listItems(b Block) *ListItems {
+	switch b := b.(type) {
+	case *UnorderedList:
+		return &b.ListItems
+	case *OrderedList:
+		return &b.ListItems
+	case *Footnotes:
+		return &b.ListItems
+	}
+
+	return nil
+}
+
+type inspector func(Block) bool
+
+func (f inspector) Visit(b Block) Visitor {
+	if f(b) {
+		return f
+	}
+
+	return nil
+}
+
+// Inspect walks doc like Walk, calling f for each block. If f returns
+// true, Inspect calls f for the blocks nested in it, followed by
+// f(nil).
+func Inspect(doc Document, f func(Block) bool) {
+	Walk(doc, inspector(f))
+}
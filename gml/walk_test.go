@@ -0,0 +1,49 @@
+package gml
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWalk(t *testing.T) {
+	input := "* Intro\n\nHello.[fn:1]\n\n- one\n- two\n\n  %pre\n  code\n\n%figure\n<img src=\"a.png\">\nA /caption/\n\n%footnotes\n- [1] A note.\n"
+	doc, err := Parse(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	Inspect(doc, func(b Block) bool {
+		if b == nil {
+			got = append(got, "end")
+			return false
+		}
+
+		got = append(got, strings.TrimPrefix(fmt.Sprintf("%T", b), "*gml."))
+		return true
+	})
+
+	want := []string{
+		"HeadingBlock", "end",
+		"Paragraph", "end",
+		"UnorderedList", "Paragraph", "end", "Pre", "end", "end",
+		"Figure", "end",
+		"Footnotes", "end",
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("want:\t%v\n got:\t%v", want, got)
+	}
+
+	// Changing a block changes what's rendered
+	Inspect(doc, func(b Block) bool {
+		if f, ok := b.(*Figure); ok {
+			f.Caption = strings.ToUpper(f.Caption)
+		}
+		return true
+	})
+	if html := doc.HTML(nil); !strings.Contains(html, "<figcaption>A <em>CAPTION</em></figcaption>") {
+		t.Errorf("caption not changed:\n%s", html)
+	}
+}
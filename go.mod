@@ -1,3 +1,14 @@
 module github.com/anschwa/gutenblog
 
-go 1.18
+go 1.21
+
+require (
+	github.com/alecthomas/chroma/v2 v2.14.0
+	golang.org/x/crypto v0.21.0
+	golang.org/x/net v0.21.0
+)
+
+require (
+	github.com/dlclark/regexp2 v1.11.0 // indirect
+	golang.org/x/text v0.14.0 // indirect
+)
@@ -1,32 +1,22 @@
 package gutenblog
 
 import (
-	"context"
+	"crypto/sha256"
 	"fmt"
-	"html/template"
 	"io"
 	"io/fs"
-	"log"
-	"net/http"
+	"log/slog"
+	"net/url"
 	"os"
-	"os/signal"
 	"path/filepath"
-	"regexp"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/anschwa/gutenblog/gml"
 )
 
-var gutenlog *log.Logger
-
-func init() {
-	if gutenlog == nil {
-		gutenlog = log.Default()
-	}
-}
-
 // The idea is to walk through each blog directory, generate posts,
 // then write everything as HTML to an output directory. From there we
 // can serve it back with http.FileServer.
@@ -53,26 +43,48 @@ func init() {
 //   - home.html.tmpl uses the "base" template and acts as the blog's homepage.
 //   - post.html.tmpl uses the "base" template and provides the layout for each blog post.
 //
+//   Blogs without a "tmpl" directory fall back to a minimal built-in layout.
+//
 // All content within the "www" directory is copied directly into the
 // output directory as-is. Any custom web content should go there.
 
-type site struct {
+// Site is a solo or multi-blog website rooted in a directory.
+type Site struct {
 	rootDir string
 	outDir  string
 	blogs   []*blog
+	config  *Config
 
 	// Store the filepath of all the web assets to prevent excessive copying of unchanged files
 	pathCache map[string]struct{}
 	multi     bool
+
+	// Map each generated page to the source file that produced it
+	sources map[string]string
+
+	// Fingerprint of the current build, if enabled
+	build *BuildInfo
+
+	// In-memory replacements for the on-disk tmpl and www directories
+	templates map[string]fs.FS
+	www       fs.FS
+
+	logger *slog.Logger
 }
 
-type TmplArchive []struct {
+// TmplArchive lists a blog's posts grouped by month for use in templates.
+type TmplArchive []TmplArchiveMonth
+
+type TmplArchiveMonth struct {
 	Title string
-	Posts []struct {
-		Title string
-		URL   string
-		Date  date
-	}
+	Posts []TmplArchivePost
+}
+
+type TmplArchivePost struct {
+	Title string
+	URL   string
+	Date  date
+	Post  gml.Document // The parsed post, e.g. for {{excerptHTML .Post 2}}
 }
 
 func (b *blog) tmplArchive(webRoot string) TmplArchive {
@@ -81,32 +93,18 @@ func (b *blog) tmplArchive(webRoot string) TmplArchive {
 	for _, dates := range b.archive {
 		first := dates[0]
 
-		month := struct {
-			Title string
-			Posts []struct {
-				Title string
-				URL   string
-				Date  date
-			}
-		}{
+		month := TmplArchiveMonth{
 			Title: first.Format("January 2006"),
-			Posts: make([]struct {
-				Title string
-				URL   string
-				Date  date
-			}, 0, len(dates)),
+			Posts: make([]TmplArchivePost, 0, len(dates)),
 		}
 
 		for _, d := range dates {
 			post := b.posts[d]
-			ap := struct {
-				Title string
-				URL   string
-				Date  date
-			}{
+			ap := TmplArchivePost{
 				Title: post.title,
-				URL:   filepath.Join(webRoot, d.Format("2006/01/02"), slugify(post.title), "index.html"),
+				URL:   post.url(webRoot),
 				Date:  d,
+				Post:  post.body,
 			}
 			month.Posts = append(month.Posts, ap)
 		}
@@ -119,32 +117,26 @@ func (b *blog) tmplArchive(webRoot string) TmplArchive {
 // generate builds all blog posts and copies any static assets from
 // the www directory into outDir. generate will overwrite all existing
 // content within outDir but will create the directory if it does not yet exist.
-func (s *site) generate() error {
+func (s *Site) generate() error {
+	s.sources = make(map[string]string)
+
+	s.build = nil
+	if s.config.BuildInfo {
+		s.build = s.newBuildInfo()
+	}
+
 	for _, b := range s.blogs {
-		gutenlog.Printf("generating %q", b.name)
-
-		var blogOutDir, blogBaseDir string
-		if s.multi {
-			baseName := filepath.Base(b.name)
-			blogOutDir = filepath.Join(s.outDir, "blog", baseName)
-			blogBaseDir = filepath.Join("blog", baseName)
-		} else {
-			blogOutDir = s.outDir // A solo-blog is the web root
-			blogBaseDir = "/"
-		}
+		start := time.Now()
+		s.logger.Info("generating blog", "blog", b.name)
+
+		blogOutDir := s.blogOutDir(b)
+		blogBaseDir := s.webRoot(b)
 
 		// Make sure output directory exists
 		if err := mkdir(blogOutDir); err != nil {
 			return fmt.Errorf("error creating blogRoot %q: %w", blogOutDir, err)
 		}
 
-		// TOOD: cleanup solo vs multi site root vs. blog root mess
-		baseTmplPath := filepath.Join(s.rootDir, blogBaseDir, "tmpl", "base.html.tmpl")
-		homeTmplPath := filepath.Join(s.rootDir, blogBaseDir, "tmpl", "home.html.tmpl")
-		postTmplPath := filepath.Join(s.rootDir, blogBaseDir, "tmpl", "post.html.tmpl")
-
-		postArchive := b.tmplArchive(filepath.Join("/", blogBaseDir))
-
 		// Generate blog home page
 		writeHome := func() error {
 			homePath := filepath.Join(blogOutDir, "index.html")
@@ -153,20 +145,10 @@ func (s *site) generate() error {
 				return fmt.Errorf("error creating homePath %q: %w", homePath, err)
 			}
 			defer w.Close()
+			s.sources[homePath] = filepath.Join(s.rootDir, blogBaseDir, "tmpl", homeTmpl)
 
-			tmpl := template.Must(template.ParseFiles(baseTmplPath, homeTmplPath))
-			homeData := struct {
-				DocumentTitle string
-				Posts         map[date]*post
-				Archive       TmplArchive
-			}{
-				DocumentTitle: "",
-				Posts:         b.posts,
-				Archive:       postArchive,
-			}
-
-			if err := tmpl.ExecuteTemplate(w, "base", homeData); err != nil {
-				return fmt.Errorf("error executing template %q to %q: %w", homeTmplPath, homePath, err)
+			if err := s.renderHome(w, b); err != nil {
+				return fmt.Errorf("error rendering %q: %w", homePath, err)
 			}
 
 			return nil
@@ -179,15 +161,22 @@ func (s *site) generate() error {
 		// Generate posts (embarrassingly parallel)
 		for _, p := range b.posts {
 			writePost := func(p *post) error {
-				postDir := filepath.Join(blogOutDir, p.date.Format("2006/01/02"), slugify(p.title))
+				postDir := filepath.Join(blogOutDir, p.date.Format("2006/01/02"), gml.Slugify(p.title))
 				if err := mkdir(postDir); err != nil {
 					return fmt.Errorf("error creating postDir %q: %w", postDir, err)
 				}
 
+				opts := s.htmlOptions()
+				postHTML := p.body.HTML(opts)
+
 				// Copy over the files from the original post directory
 				srcDir := filepath.Dir(p.path)
-				if err := cpdir(srcDir, postDir); err != nil {
-					return fmt.Errorf("error copying contents of post %q: %w ", srcDir, err)
+				if s.config.CopyPostDirs {
+					if err := s.cpdir(srcDir, postDir); err != nil {
+						return fmt.Errorf("error copying contents of post %q: %w ", srcDir, err)
+					}
+				} else if err := s.copyPostAssets(srcDir, postDir, postHTML); err != nil {
+					return fmt.Errorf("error copying assets of post %q: %w ", srcDir, err)
 				}
 
 				// Generate post HTML
@@ -197,26 +186,11 @@ func (s *site) generate() error {
 					return fmt.Errorf("error creating postPath %q: %w", postPath, err)
 				}
 				defer w.Close()
+				s.sources[postPath] = p.path
 
-				postHTML := p.body.HTML(&gml.HTMLOptions{Minified: true})
-				postTmpl := template.Must(template.New("post").Parse(postHTML))
-				tmpl := template.Must(postTmpl.ParseFiles(baseTmplPath, postTmplPath))
-
-				postData := struct {
-					DocumentTitle string
-					PostHTML      string
-					Posts         map[date]*post
-					Archive       TmplArchive
-				}{
-					DocumentTitle: p.title,
-					PostHTML:      postHTML,
-					Posts:         b.posts,
-					Archive:       postArchive,
-				}
-
-				gutenlog.Printf("writing post: %q", p.path)
-				if err := tmpl.ExecuteTemplate(w, "base", postData); err != nil {
-					return fmt.Errorf("error executing template %q to %q: %w", postTmplPath, postPath, err)
+				s.logger.Debug("writing post", "blog", b.name, "post", p.title, "path", p.path)
+				if err := s.renderPost(w, b, p, postHTML, opts); err != nil {
+					return fmt.Errorf("error rendering %q: %w", postPath, err)
 				}
 
 				return nil
@@ -226,70 +200,27 @@ func (s *site) generate() error {
 				return fmt.Errorf("error writing post %q: %w", p.title, err)
 			}
 		}
-	}
 
-	// Copy all new files from the www directory
-	webDir := filepath.Join(s.rootDir, "www")
-	if err := cpdir(webDir, s.outDir); err != nil {
-		return fmt.Errorf("error copying %q to %q : %w", webDir, s.outDir, err)
+		s.logger.Debug("generated blog", "blog", b.name, "posts", len(b.posts), "duration", time.Since(start))
 	}
 
-	return nil
-}
-
-func (s *site) serve(addr string) {
-	fs := http.FileServer(http.Dir(s.outDir))
-	mux := http.NewServeMux()
-	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		gutenlog.Printf("%s\t%s", r.Method, r.URL)
-		// Regenerate the blog on with each request
-
-		s, err := newMultiSite(s.rootDir, s.outDir)
-		if err != nil {
-			gutenlog.Printf("Error getting latest blog entries: %s", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-
-		if err := s.generate(); err != nil {
-			gutenlog.Printf("Error generating blog: %s", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-
-		// No caching during development
-		w.Header().Set("Expires", time.Unix(0, 0).Format(time.RFC1123))
-		w.Header().Set("Cache-Control", "no-cache, private, max-age=0")
-
-		fs.ServeHTTP(w, r)
-	})
-
-	// Adapted from:
-	// - https://pkg.go.dev/net/http#ServeMux
-	// - https://pkg.go.dev/net/http#Server.Shutdown
-	srv := &http.Server{
-		Addr:    addr,
-		Handler: mux,
+	if err := s.generateArtifacts(); err != nil {
+		return err
 	}
 
-	idleConns := make(chan struct{})
-	go func() {
-		sigint := make(chan os.Signal, 1)
-		signal.Notify(sigint, os.Interrupt)
-		<-sigint
-
-		if err := srv.Shutdown(context.Background()); err != nil {
-			gutenlog.Printf("Error shutting down server: %v", err)
+	// Copy all new files from the www directory
+	if s.www != nil {
+		if err := cpfs(s.www, s.outDir); err != nil {
+			return fmt.Errorf("error copying www to %q : %w", s.outDir, err)
+		}
+	} else {
+		webDir := filepath.Join(s.rootDir, "www")
+		if err := s.cpdir(webDir, s.outDir); err != nil {
+			return fmt.Errorf("error copying %q to %q : %w", webDir, s.outDir, err)
 		}
-		close(idleConns)
-	}()
-
-	gutenlog.Printf("Starting server on: %s [%s]", srv.Addr, s.outDir)
-	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
-		gutenlog.Fatalf("Error starting server: %v", err)
 	}
 
-	<-idleConns
+	return nil
 }
 
 type blog struct {
@@ -302,9 +233,34 @@ type post struct {
 	title string
 	href  string
 	date  date
+	tags  []string
 	body  gml.Document
 
 	path string
+	hash string // SHA-256 of the source file
+}
+
+// url returns the path of the post's generated page relative to webRoot.
+func (p *post) url(webRoot string) string {
+	return filepath.Join(webRoot, p.date.Format("2006/01/02"), gml.Slugify(p.title), "index.html")
+}
+
+// webRoot returns the URL path that a blog is served from.
+func (s *Site) webRoot(b *blog) string {
+	if s.multi {
+		return filepath.Join("/", "blog", filepath.Base(b.name))
+	}
+
+	return "/" // A solo-blog is the web root
+}
+
+// blogOutDir returns the directory a blog is generated into.
+func (s *Site) blogOutDir(b *blog) string {
+	if s.multi {
+		return filepath.Join(s.outDir, "blog", filepath.Base(b.name))
+	}
+
+	return s.outDir
 }
 
 // isMultiBlog determines whether the target directory contains a solo or multi-blog layout.
@@ -336,7 +292,7 @@ func isMultiBlog(rootDir string) (bool, error) {
 	return multi, nil
 }
 
-func newMultiSite(rootDir, outDir string) (*site, error) {
+func newMultiSite(rootDir, outDir string) (*Site, error) {
 	multiBlogPath := filepath.Join(rootDir, "blog")
 	multiBlogRootFiles, err := os.ReadDir(multiBlogPath)
 	if err != nil {
@@ -359,7 +315,7 @@ func newMultiSite(rootDir, outDir string) (*site, error) {
 		blogs = append(blogs, b)
 	}
 
-	s := &site{
+	s := &Site{
 		rootDir: rootDir,
 		outDir:  outDir,
 		blogs:   blogs,
@@ -369,13 +325,13 @@ func newMultiSite(rootDir, outDir string) (*site, error) {
 	return s, nil
 }
 
-func newSoloSite(rootDir, outDir string) (*site, error) {
+func newSoloSite(rootDir, outDir string) (*Site, error) {
 	b, err := getBlog(rootDir)
 	if err != nil {
 		return nil, fmt.Errorf("error getting blog from %q: %w", rootDir, err)
 	}
 
-	s := &site{
+	s := &Site{
 		rootDir: rootDir,
 		outDir:  outDir,
 		blogs:   []*blog{b},
@@ -386,9 +342,9 @@ func newSoloSite(rootDir, outDir string) (*site, error) {
 
 // New initializes a new gutenblog site. If the provided logger is
 // nil then the default logger is used instead.
-func New(rootDir, outDir string, logger *log.Logger) (*site, error) {
-	if logger != nil {
-		gutenlog = logger
+func New(rootDir, outDir string, logger *slog.Logger) (*Site, error) {
+	if logger == nil {
+		logger = gutenlog
 	}
 
 	multi, err := isMultiBlog(rootDir)
@@ -396,7 +352,7 @@ func New(rootDir, outDir string, logger *log.Logger) (*site, error) {
 		return nil, fmt.Errorf("error determining blog layout: %w", err)
 	}
 
-	var s *site
+	var s *Site
 	if multi {
 		s, err = newMultiSite(rootDir, outDir)
 	} else {
@@ -406,15 +362,27 @@ func New(rootDir, outDir string, logger *log.Logger) (*site, error) {
 		return nil, fmt.Errorf("error building site: %w", err)
 	}
 
+	s.config, err = loadConfig(rootDir)
+	if err != nil {
+		return nil, fmt.Errorf("error loading config: %w", err)
+	}
+	s.logger = logger
+
 	return s, nil
 }
 
-func (s *site) Serve(addr string) {
-	s.serve(addr)
-}
+// Build generates the site, running the before_build and after_build
+// hooks around it.
+func (s *Site) Build() error {
+	if err := s.RunHook(HookBeforeBuild); err != nil {
+		return err
+	}
 
-func (s *site) Build() error {
-	return s.generate()
+	if err := s.generate(); err != nil {
+		return err
+	}
+
+	return s.RunHook(HookAfterBuild)
 }
 
 // getBlog builds a blog from a given filepath
@@ -440,6 +408,24 @@ func getBlog(path string) (*blog, error) {
 	return b, nil
 }
 
+// sortedPosts returns all of the blog's posts sorted by date.
+func (b *blog) sortedPosts() []*post {
+	dates := make([]date, 0, len(b.posts))
+	for d := range b.posts {
+		dates = append(dates, d)
+	}
+	sort.Slice(dates, func(i, j int) bool {
+		return dates[i].Before(dates[j].Time)
+	})
+
+	posts := make([]*post, 0, len(dates))
+	for _, d := range dates {
+		posts = append(posts, b.posts[d])
+	}
+
+	return posts
+}
+
 // getArchive creates a sorted blog archive from a map of posts.
 func getArchive(posts map[date]*post) [][]date {
 	monthMap := make(map[time.Time][]date)
@@ -507,7 +493,7 @@ func getPosts(path string) (posts []*post, err error) {
 				return fmt.Errorf("error reading %q: %w", name, err)
 			}
 
-			doc, err := gml.Parse(string(b))
+			doc, err := parsePost(p, string(b))
 			if err != nil {
 				return fmt.Errorf("error parsing %q: %w", name, err)
 			}
@@ -515,8 +501,10 @@ func getPosts(path string) (posts []*post, err error) {
 			newPost := &post{
 				title: doc.Title(),
 				date:  date{doc.Date()},
+				tags:  doc.Tags(),
 				body:  doc,
 				path:  p,
+				hash:  fmt.Sprintf("%x", sha256.Sum256(b)),
 			}
 			posts = append(posts, newPost)
 		}
@@ -531,6 +519,49 @@ func getPosts(path string) (posts []*post, err error) {
 	return posts, nil
 }
 
+// parsePost parses the source of the post at path. Files the post
+// reads, like %csv data or %include snippets, are relative to the
+// post's directory. A new post without a path can't read any files.
+func parsePost(path, source string) (gml.Document, error) {
+	if path == "" {
+		return gml.Parse(source)
+	}
+
+	return gml.ParseFS(newPostFS(path), source)
+}
+
+// postFS reads the files of a post relative to the post's directory.
+// Unlike os.DirFS, paths may go up out of it, e.g. to share an
+// "%include ../shared/bio.gml" between posts, but only as far as the
+// blog's posts directory.
+type postFS struct {
+	dir  string // The post's directory
+	root string // The posts directory, or dir if the post isn't in one
+}
+
+func newPostFS(path string) postFS {
+	dir := filepath.Dir(path)
+	for d := dir; ; d = filepath.Dir(d) {
+		if filepath.Base(d) == "posts" {
+			return postFS{dir: dir, root: d}
+		}
+		if filepath.Dir(d) == d {
+			return postFS{dir: dir, root: dir}
+		}
+	}
+}
+
+func (f postFS) Open(name string) (fs.File, error) {
+	p := filepath.Join(f.dir, filepath.FromSlash(name))
+
+	rel, err := filepath.Rel(f.root, p)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+	}
+
+	return os.Open(p)
+}
+
 // date is a wrapper for time.Time that provides helper methods in HTML templates
 type date struct{ time.Time }
 
@@ -579,17 +610,50 @@ func mkdir(path string) error {
 	return nil
 }
 
-var cpdirCache map[string]struct{}
+// copyCache records the source files that have already been copied.
+// It outlives any one Site because the dev server builds a new Site for
+// every rebuild, and it's guarded because a SIGHUP can reset it while a
+// build is copying files.
+type copyCache struct {
+	mu    sync.Mutex
+	files map[string]struct{}
+}
+
+var cpdirCache copyCache
+
+// copied reports whether the file at path was already copied.
+func (c *copyCache) copied(path string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, ok := c.files[path]
+	return ok
+}
+
+// add records that the file at path was copied.
+func (c *copyCache) add(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.files == nil {
+		c.files = make(map[string]struct{})
+	}
+	c.files[path] = struct{}{}
+}
+
+// reset forgets every copied file so they're all copied again.
+func (c *copyCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.files = nil
+}
 
 // cpdir recursively copies the contents of src into dst but will skip
 // previously copied filepaths on subsequent calls. This is mostly to
 // help eliminate redundant file copies when serving the site over
 // HTTP because it regenerates the entire site on each request.
-func cpdir(src, dst string) error {
-	if cpdirCache == nil {
-		cpdirCache = make(map[string]struct{})
-	}
-
+func (s *Site) cpdir(src, dst string) error {
 	// Make sure src and dst exist and are directories
 	srcInfo, err := os.Stat(src)
 	if err != nil {
@@ -617,59 +681,74 @@ func cpdir(src, dst string) error {
 			return nil // ignore
 		}
 
-		if _, exists := cpdirCache[p]; exists {
-			// gutenlog.Printf("skipping %q", p)
+		if cpdirCache.copied(p) {
+			// s.logger.Debug("skipping file", "path", p)
 			return nil
 		}
 
 		newPath := strings.Replace(p, src, dst, 1)
-		gutenlog.Printf("copying %q to %q", p, newPath)
+		return s.cpfile(p, newPath)
+	})
+}
 
-		if err := mkdir(filepath.Dir(newPath)); err != nil {
-			return err
-		}
+// cpfile copies the file at src to dst, creating any missing parent
+// directories. Like cpdir, it skips files that were already copied.
+func (s *Site) cpfile(src, dst string) error {
+	if cpdirCache.copied(src) {
+		return nil
+	}
 
-		r, err := os.Open(p)
-		if err != nil {
-			return err
-		}
-		defer r.Close()
+	s.logger.Debug("copying file", "src", src, "dst", dst)
 
-		w, err := os.Create(newPath)
-		if err != nil {
-			return err
-		}
-		defer w.Close()
+	if err := mkdir(filepath.Dir(dst)); err != nil {
+		return err
+	}
 
-		if _, err = io.Copy(w, r); err != nil {
-			return err
-		}
+	r, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
 
-		cpdirCache[p] = struct{}{} // add file to cache
-		return nil
-	})
-}
+	w, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
 
-// slugify creates a URL safe string by removing all non-alphanumeric
-// characters and replacing spaces with hyphens.
-func slugify(slug string) string {
-	// Remove leading and trailing spaces
-	slug = strings.TrimSpace(slug)
+	if _, err = io.Copy(w, r); err != nil {
+		return err
+	}
 
-	// Replace spaces with hyphens
-	reSpace := regexp.MustCompile(`[\t\n\f\r ]`)
-	slug = reSpace.ReplaceAllString(slug, "-")
+	cpdirCache.add(src)
+	return nil
+}
+
+// copyPostAssets copies the files in srcDir that are referenced by
+// relative links in postHTML into postDir. References to files outside
+// of srcDir and to files that don't exist are skipped; the latter are
+// reported by CheckLinks.
+func (s *Site) copyPostAssets(srcDir, postDir, postHTML string) error {
+	for _, m := range reLinkAttr.FindAllStringSubmatch(postHTML, -1) {
+		u, err := url.Parse(m[1])
+		if err != nil || u.Scheme != "" || u.Host != "" || u.Path == "" || strings.HasPrefix(u.Path, "/") {
+			continue
+		}
 
-	// Remove duplicate hyphens
-	reDupDash := regexp.MustCompile(`-+`)
-	slug = reDupDash.ReplaceAllString(slug, "-")
+		rel := filepath.Clean(filepath.FromSlash(u.Path))
+		if strings.HasPrefix(rel, "..") {
+			continue
+		}
 
-	// Remove non-word chars (Unicode character classes)
-	reNonWord := regexp.MustCompile(`[^\p{N}\p{L}_-]`)
-	slug = reNonWord.ReplaceAllString(slug, "")
+		src := filepath.Join(srcDir, rel)
+		if info, err := os.Stat(src); err != nil || !info.Mode().IsRegular() {
+			continue
+		}
 
-	// Lowercase
-	slug = strings.ToLower(slug)
+		if err := s.cpfile(src, filepath.Join(postDir, rel)); err != nil {
+			return err
+		}
+	}
 
-	return slug
+	return nil
 }
@@ -0,0 +1,134 @@
+package gutenblog
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestGetPostsTags(t *testing.T) {
+	root := t.TempDir()
+	postDir := filepath.Join(root, "posts", "hello")
+	if err := os.MkdirAll(postDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	src := "%title Hello\n%date 2022-03-21\n%tags go, blogging\n\nBody\n"
+	if err := os.WriteFile(filepath.Join(postDir, "hello.gml.txt"), []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	posts, err := getPosts(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(posts) != 1 || !reflect.DeepEqual(posts[0].tags, []string{"go", "blogging"}) {
+		t.Errorf("got posts %+v", posts)
+	}
+}
+
+func TestParsePostIncludes(t *testing.T) {
+	root := t.TempDir()
+	postsDir := filepath.Join(root, "posts")
+	postDir := filepath.Join(postsDir, "hello")
+
+	for name, data := range map[string]string{
+		filepath.Join(postsDir, "shared", "bio.gml"): "I write things.\n",
+		filepath.Join(postDir, "note.gml"):           "A note.\n",
+		filepath.Join(root, "secret.gml"):            "Secret.\n",
+	} {
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path := filepath.Join(postDir, "hello.gml.txt")
+	doc, err := parsePost(path, "%include note.gml\n\n%include ../shared/bio.gml\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "<p>A note.</p>\n<p>I write things.</p>"
+	if got := doc.ExcerptHTML(2, nil); got != want {
+		t.Errorf("want:\t%q\n got:\t%q", want, got)
+	}
+
+	if _, err := parsePost(path, "%include ../../secret.gml\n"); err == nil {
+		t.Error("want an error including a file outside the posts directory")
+	}
+
+	if _, err := newPostFS(path).Open("../../secret.gml"); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("want fs.ErrPermission; got: %v", err)
+	}
+}
+
+func TestNewLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+
+	s, err := New("examples/solo-blog", t.TempDir(), logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.logger != logger {
+		t.Error("want the site to log with its own logger")
+	}
+
+	other, err := New("examples/solo-blog", t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.logger != gutenlog {
+		t.Error("want the default logger for a site created without one")
+	}
+
+	if err := s.Build(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "generating blog") {
+		t.Errorf("want the build logged to the site's logger; got %q", buf.String())
+	}
+}
+
+func TestCopyCache(t *testing.T) {
+	var c copyCache
+	if c.copied("a") {
+		t.Error("want nothing copied yet")
+	}
+
+	// Reset while files are being copied, like a SIGHUP during a build
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			c.add("a")
+			c.copied("a")
+		}()
+		go func() {
+			defer wg.Done()
+			c.reset()
+		}()
+	}
+	wg.Wait()
+
+	c.add("a")
+	if !c.copied("a") {
+		t.Error("want a copied")
+	}
+	c.reset()
+	if c.copied("a") {
+		t.Error("want nothing copied after a reset")
+	}
+}
@@ -0,0 +1,48 @@
+package gutenblog
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// Hook names accepted by RunHook
+const (
+	HookBeforeBuild = "before_build"
+	HookAfterBuild  = "after_build"
+	HookAfterDeploy = "after_deploy"
+)
+
+// RunHook runs each command configured for the named hook in
+// order. Commands are run from the site's root directory with
+// GUTENBLOG_ROOT and GUTENBLOG_OUT set in their environment. The
+// first command to fail stops the hook.
+func (s *Site) RunHook(name string) error {
+	var cmds []string
+	switch name {
+	case HookBeforeBuild:
+		cmds = s.config.Hooks.BeforeBuild
+	case HookAfterBuild:
+		cmds = s.config.Hooks.AfterBuild
+	case HookAfterDeploy:
+		cmds = s.config.Hooks.AfterDeploy
+	default:
+		return fmt.Errorf("unknown hook: %q", name)
+	}
+
+	for _, c := range cmds {
+		s.logger.Info("running hook", "hook", name, "cmd", c)
+
+		cmd := exec.Command("sh", "-c", c)
+		cmd.Dir = s.rootDir
+		cmd.Env = append(os.Environ(), "GUTENBLOG_ROOT="+s.rootDir, "GUTENBLOG_OUT="+s.outDir)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("error running %s hook %q: %w", name, c, err)
+		}
+	}
+
+	return nil
+}
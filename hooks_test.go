@@ -0,0 +1,73 @@
+package gutenblog
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunHookOrder(t *testing.T) {
+	s, err := New("examples/solo-blog", t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log := filepath.Join(t.TempDir(), "hooks.log")
+	echo := func(line string) string { return "echo " + line + " >> '" + log + "'" }
+	s.config.Hooks = HookConfig{
+		BeforeBuild: []string{echo("before1"), echo("before2")},
+		AfterBuild:  []string{`test -f "$GUTENBLOG_OUT/index.html" && ` + echo("after")},
+		AfterDeploy: []string{echo("deploy")},
+	}
+
+	if err := s.Build(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(b), "before1\nbefore2\nafter\n"; got != want {
+		t.Errorf("want the hooks run in order around the build:\n%s\ngot:\n%s", want, got)
+	}
+
+	if err := s.RunHook("before_deploy"); err == nil || !strings.Contains(err.Error(), `unknown hook: "before_deploy"`) {
+		t.Errorf("want an unknown hook error; got %v", err)
+	}
+}
+
+func TestRunHookFailure(t *testing.T) {
+	s, err := New("examples/solo-blog", t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log := filepath.Join(t.TempDir(), "hooks.log")
+	s.config.Hooks = HookConfig{
+		BeforeBuild: []string{"echo one >> '" + log + "'", "exit 3", "echo two >> '" + log + "'"},
+	}
+
+	err = s.Build()
+	if err == nil {
+		t.Fatal("want an error from the failing hook")
+	}
+	if want := `error running before_build hook "exit 3"`; !strings.Contains(err.Error(), want) {
+		t.Errorf("want %q in the error; got %v", want, err)
+	}
+
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 3 {
+		t.Errorf("want the command's exit status 3; got %v", err)
+	}
+
+	if b, _ := os.ReadFile(log); string(b) != "one\n" {
+		t.Errorf("want the hook stopped at the failing command; got %q", b)
+	}
+	if _, err := os.Stat(filepath.Join(s.outDir, "index.html")); err == nil {
+		t.Error("want no build after a failing before_build hook")
+	}
+}
@@ -0,0 +1,432 @@
+package gutenblog
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/anschwa/gutenblog/gml"
+)
+
+// SiteImport is the result of ImportSite.
+type SiteImport struct {
+	Generator string // "jekyll" or "hugo"
+	Multi     bool   // Whether a multi-blog site was written
+	Posts     []ImportedFile
+
+	// Issues lists everything that couldn't be translated, such as
+	// drafts, pages, layouts, shortcodes, and unknown front matter.
+	Issues []Diagnosis
+}
+
+// ImportedFile maps a post of the original site to the gutenblog post
+// it became.
+type ImportedFile struct {
+	Source string // Markdown file relative to the source directory
+	Dest   string // GML file relative to the destination directory
+	OldURL string
+	NewURL string
+}
+
+// importedFrontMatter are the front matter keys translated by
+// ImportSite. Any others are reported as issues.
+var importedFrontMatter = map[string]bool{
+	"title": true, "subtitle": true, "description": true, "date": true, "author": true,
+	"tags": true, "draft": true, "layout": true, "permalink": true, "url": true, "slug": true,
+}
+
+var (
+	reLiquidHighlight    = regexp.MustCompile(`\{%-?\s*highlight\s+(\w+)[^%]*-?%\}`)
+	reLiquidEndHighlight = regexp.MustCompile(`\{%-?\s*endhighlight\s*-?%\}`)
+	reHugoHighlight      = regexp.MustCompile(`\{\{<\s*highlight\s+(\w+)[^>]*>\}\}`)
+	reHugoEndHighlight   = regexp.MustCompile(`\{\{<\s*/highlight\s*>\}\}`)
+	reTemplateTag        = regexp.MustCompile(`\{%.*?%\}|\{\{.*?\}\}`)
+)
+
+// ImportSite converts the Jekyll or Hugo site in srcDir into a new
+// gutenblog site in dstDir, which must not exist yet. Posts are
+// converted with ConvertMarkdown and their bundled assets are copied
+// next to them; static files are copied into "www". A Hugo site with
+// more than one content section becomes a multi-blog site with a blog
+// per section.
+func ImportSite(srcDir, dstDir string) (*SiteImport, error) {
+	if _, err := os.Stat(dstDir); err == nil {
+		return nil, fmt.Errorf("destination %q already exists", dstDir)
+	}
+
+	imp := &SiteImport{}
+
+	// Markdown files to import, grouped by blog ("" for a solo blog)
+	var blogs map[string][]string
+	var err error
+
+	switch {
+	case isDir(filepath.Join(srcDir, "_posts")):
+		imp.Generator = "jekyll"
+		blogs, err = imp.jekyllPosts(srcDir)
+	case isDir(filepath.Join(srcDir, "content")):
+		imp.Generator = "hugo"
+		blogs, err = imp.hugoPosts(srcDir)
+	default:
+		return nil, fmt.Errorf(`%q is not a Jekyll site (no "_posts" directory) or Hugo site (no "content" directory)`, srcDir)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	imp.Multi = len(blogs) > 1
+
+	names := make([]string, 0, len(blogs))
+	for name := range blogs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if len(names) == 0 {
+		names = []string{""} // Still write an empty solo blog
+	}
+
+	for _, name := range names {
+		blogDir := dstDir
+		webRoot := "/"
+		if imp.Multi {
+			blogDir = filepath.Join(dstDir, "blog", name)
+			webRoot = path.Join("/blog", name)
+		}
+
+		if err := mkdir(filepath.Join(blogDir, "posts")); err != nil {
+			return nil, err
+		}
+
+		for _, md := range blogs[name] {
+			if err := imp.importPost(srcDir, dstDir, blogDir, webRoot, md); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := imp.copyStatic(srcDir, dstDir); err != nil {
+		return nil, err
+	}
+
+	return imp, nil
+}
+
+func (imp *SiteImport) report(p, format string, args ...interface{}) {
+	imp.Issues = append(imp.Issues, Diagnosis{filepath.ToSlash(p), fmt.Sprintf(format, args...)})
+}
+
+// jekyllPosts finds the posts of a Jekyll site.
+func (imp *SiteImport) jekyllPosts(srcDir string) (map[string][]string, error) {
+	var posts []string
+	err := filepath.WalkDir(filepath.Join(srcDir, "_posts"), func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && isMarkdown(p) {
+			posts = append(posts, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error finding posts: %w", err)
+	}
+
+	entries, err := os.ReadDir(srcDir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %q: %w", srcDir, err)
+	}
+
+	for _, e := range entries {
+		switch name := e.Name(); {
+		case name == "_drafts":
+			imp.report(name, "drafts were not imported")
+		case name == "_layouts" || name == "_includes" || name == "_sass":
+			imp.report(name, "layouts and includes were not translated: add templates to tmpl/ or use the defaults")
+		case !e.IsDir() && isMarkdown(name):
+			imp.report(name, "pages are not supported and were not imported")
+		}
+	}
+
+	blogs := make(map[string][]string)
+	if len(posts) > 0 {
+		blogs[""] = posts
+	}
+
+	return blogs, nil
+}
+
+// hugoPosts finds the posts in each section of a Hugo site. Page
+// bundles (a directory with an index.md) are a single post.
+func (imp *SiteImport) hugoPosts(srcDir string) (map[string][]string, error) {
+	contentDir := filepath.Join(srcDir, "content")
+	entries, err := os.ReadDir(contentDir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %q: %w", contentDir, err)
+	}
+
+	blogs := make(map[string][]string)
+	for _, e := range entries {
+		if !e.IsDir() {
+			if isMarkdown(e.Name()) && !strings.HasPrefix(e.Name(), "_index.") {
+				imp.report(path.Join("content", e.Name()), "pages are not supported and were not imported")
+			}
+			continue
+		}
+
+		section := e.Name()
+		err := filepath.WalkDir(filepath.Join(contentDir, section), func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if d.IsDir() || !isMarkdown(p) || strings.HasPrefix(d.Name(), "_index.") {
+				return nil
+			}
+
+			// Only the index of a page bundle is a post
+			if !strings.HasPrefix(d.Name(), "index.") && hasIndex(filepath.Dir(p)) {
+				return nil
+			}
+
+			blogs[section] = append(blogs[section], p)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error finding posts: %w", err)
+		}
+	}
+
+	for _, dir := range []string{"layouts", "themes"} {
+		if isDir(filepath.Join(srcDir, dir)) {
+			imp.report(dir, "layouts and themes were not translated: add templates to tmpl/ or use the defaults")
+		}
+	}
+
+	return blogs, nil
+}
+
+func hasIndex(dir string) bool {
+	for _, ext := range []string{".md", ".markdown"} {
+		if exists(filepath.Join(dir, "index"+ext)) {
+			return true
+		}
+	}
+	return false
+}
+
+func isMarkdown(p string) bool {
+	ext := strings.ToLower(filepath.Ext(p))
+	return ext == ".md" || ext == ".markdown"
+}
+
+// importPost converts a post and writes it to blogDir.
+func (imp *SiteImport) importPost(srcDir, dstDir, blogDir, webRoot, md string) error {
+	rel, err := filepath.Rel(srcDir, md)
+	if err != nil {
+		return err
+	}
+
+	b, err := os.ReadFile(md)
+	if err != nil {
+		return fmt.Errorf("error reading %q: %w", md, err)
+	}
+
+	src := reLiquidHighlight.ReplaceAllString(string(b), "```$1")
+	src = reLiquidEndHighlight.ReplaceAllString(src, "```")
+	src = reHugoHighlight.ReplaceAllString(src, "```$1")
+	src = reHugoEndHighlight.ReplaceAllString(src, "```")
+
+	p, err := ConvertMarkdown(src)
+	if err != nil {
+		imp.report(rel, "%v", err)
+		return nil
+	}
+
+	name := strings.TrimSuffix(filepath.Base(md), filepath.Ext(md))
+	if name == "index" {
+		name = filepath.Base(filepath.Dir(md)) // A page bundle
+	}
+	if m := reDatedName.FindStringSubmatch(name); m != nil {
+		if p.Date.IsZero() {
+			p.Date, _ = parseFrontMatterDate(m[1])
+		}
+		name = m[2]
+	}
+	if p.Title == "" {
+		p.Title = strings.ReplaceAll(name, "-", " ")
+	}
+
+	if p.Front["draft"] == "true" {
+		imp.report(rel, "draft was not imported")
+		return nil
+	}
+	if p.Date.IsZero() {
+		imp.report(rel, "post has no date and was not imported")
+		return nil
+	}
+
+	var dropped []string
+	for key := range p.Front {
+		if !importedFrontMatter[key] {
+			dropped = append(dropped, key)
+		}
+	}
+	sort.Strings(dropped)
+	if len(dropped) > 0 {
+		imp.report(rel, "front matter was not translated: %s", strings.Join(dropped, ", "))
+	}
+
+	if reTemplateTag.MatchString(p.Body) {
+		imp.report(rel, "Liquid tags or shortcodes were left as-is: %s", reTemplateTag.FindString(p.Body))
+	}
+
+	slug := gml.Slugify(p.Title)
+	if slug == "" {
+		imp.report(rel, "post title %q has no usable characters for a file name and was not imported", p.Title)
+		return nil
+	}
+
+	postDir := filepath.Join(blogDir, "posts", slug)
+	if isDir(postDir) {
+		imp.report(rel, "another post is already named %q: not imported", slug)
+		return nil
+	}
+
+	gmlPath := filepath.Join(postDir, slug+".gml.txt")
+	if err := mkdir(postDir); err != nil {
+		return err
+	}
+	if err := os.WriteFile(gmlPath, []byte(p.GML()), 0644); err != nil {
+		return fmt.Errorf("error writing post: %w", err)
+	}
+
+	for _, a := range p.Assets {
+		if err := copyFile(filepath.Join(filepath.Dir(md), a), filepath.Join(postDir, a)); err != nil {
+			imp.report(rel, "missing asset %q was not copied", filepath.ToSlash(a))
+		}
+	}
+
+	dest, err := filepath.Rel(dstDir, gmlPath)
+	if err != nil {
+		return err
+	}
+
+	newURL := path.Dir((&post{title: p.Title, date: date{p.Date}}).url(webRoot)) + "/"
+	imp.Posts = append(imp.Posts, ImportedFile{
+		Source: filepath.ToSlash(rel),
+		Dest:   filepath.ToSlash(dest),
+		OldURL: imp.oldURL(md, name, p),
+		NewURL: filepath.ToSlash(newURL),
+	})
+
+	return nil
+}
+
+// oldURL returns the URL a post was published at by its generator,
+// assuming the default permalink style when the post doesn't set one.
+func (imp *SiteImport) oldURL(md, name string, p *ImportedPost) string {
+	for _, key := range []string{"permalink", "url"} {
+		if u := p.Front[key]; u != "" {
+			return u
+		}
+	}
+
+	if s := p.Front["slug"]; s != "" {
+		name = s
+	}
+
+	if imp.Generator == "jekyll" {
+		return "/" + p.Date.Format("2006/01/02") + "/" + name + ".html"
+	}
+
+	// Hugo: /<section>/<name>/
+	rel := filepath.ToSlash(md)
+	i := strings.Index(rel, "/content/")
+	section := ""
+	if i >= 0 {
+		section, _, _ = strings.Cut(rel[i+len("/content/"):], "/")
+	}
+
+	return path.Join("/", section, name) + "/"
+}
+
+// copyStatic copies the static files of the original site into www.
+// For Hugo that's the "static" directory; Jekyll copies every file and
+// directory not starting with "_" or ".".
+func (imp *SiteImport) copyStatic(srcDir, dstDir string) error {
+	www := filepath.Join(dstDir, "www")
+
+	if imp.Generator == "hugo" {
+		static := filepath.Join(srcDir, "static")
+		if !isDir(static) {
+			return nil
+		}
+		return copyTree(static, www)
+	}
+
+	entries, err := os.ReadDir(srcDir)
+	if err != nil {
+		return fmt.Errorf("error reading %q: %w", srcDir, err)
+	}
+
+	for _, e := range entries {
+		name := e.Name()
+		if strings.HasPrefix(name, "_") || strings.HasPrefix(name, ".") {
+			continue
+		}
+
+		switch name {
+		case "Gemfile", "Gemfile.lock", "vendor", "node_modules":
+			continue
+		}
+
+		if !e.IsDir() && (isMarkdown(name) || strings.HasSuffix(name, ".html")) {
+			continue // Pages are reported by jekyllPosts or rendered by layouts
+		}
+
+		src := filepath.Join(srcDir, name)
+		if e.IsDir() {
+			if err := copyTree(src, filepath.Join(www, name)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := copyFile(src, filepath.Join(www, name)); err != nil {
+			return fmt.Errorf("error copying %q: %w", src, err)
+		}
+	}
+
+	return nil
+}
+
+// copyTree copies every file in src into dst.
+func copyTree(src, dst string) error {
+	return filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+
+		if err := copyFile(p, filepath.Join(dst, rel)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("error copying %q: %w", p, err)
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,130 @@
+package gutenblog
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestImportSiteJekyll(t *testing.T) {
+	src := t.TempDir()
+	writeFiles(t, src, map[string]string{
+		"_config.yml":                    "title: Test\n",
+		"_posts/2022-03-21-hello.md":     "---\ntitle: Hello World\ncategories: news\n---\n{% highlight go %}\nx := 1\n{% endhighlight %}\n",
+		"_posts/2022-03-22-draft.md":     "---\ntitle: Draft\ndraft: true\n---\nSoon\n",
+		"_drafts/2022-04-01-wip.md":      "wip\n",
+		"about.md":                       "About me\n",
+		"assets/css/style.css":           "body {}\n",
+		"_posts/2022-03-23-permalink.md": "---\ntitle: Moved\npermalink: /moved/\n---\nText\n",
+	})
+
+	dst := filepath.Join(t.TempDir(), "site")
+	imp, err := ImportSite(src, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if imp.Generator != "jekyll" || imp.Multi {
+		t.Errorf("got generator %q, multi %v", imp.Generator, imp.Multi)
+	}
+
+	got := make(map[string]string)
+	for _, f := range imp.Posts {
+		got[f.OldURL] = f.NewURL
+	}
+	want := map[string]string{
+		"/2022/03/21/hello.html": "/2022/03/21/hello-world/",
+		"/moved/":                "/2022/03/23/moved/",
+	}
+	if len(got) != len(want) {
+		t.Errorf("got posts %v, want %v", got, want)
+	}
+	for old, u := range want {
+		if got[old] != u {
+			t.Errorf("%s: got %q, want %q", old, got[old], u)
+		}
+	}
+
+	var issues []string
+	for _, d := range imp.Issues {
+		issues = append(issues, d.String())
+	}
+	for _, want := range []string{"_drafts", "about.md", "categories", "2022-03-22-draft.md: draft"} {
+		if !strings.Contains(strings.Join(issues, "\n"), want) {
+			t.Errorf("issues don't mention %q: %q", want, issues)
+		}
+	}
+
+	b, err := os.ReadFile(filepath.Join(dst, "posts", "hello-world", "hello-world.gml.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "%pre\nx := 1") {
+		t.Errorf("highlight tag wasn't converted:\n%s", b)
+	}
+
+	if !exists(filepath.Join(dst, "www", "assets", "css", "style.css")) {
+		t.Error("static files weren't copied into www")
+	}
+
+	if _, err := New(dst, t.TempDir(), nil); err != nil {
+		t.Errorf("imported site doesn't load: %v", err)
+	}
+}
+
+func TestImportSiteHugo(t *testing.T) {
+	src := t.TempDir()
+	writeFiles(t, src, map[string]string{
+		"hugo.toml":                     "title = 'Test'\n",
+		"content/_index.md":             "Home\n",
+		"content/posts/first.md":        "+++\ntitle = 'First'\ndate = 2023-01-02T00:00:00Z\n+++\nHello\n",
+		"content/posts/bundle/index.md": "---\ntitle: Bundle\ndate: 2023-01-03\n---\n![pic](pic.png)\n",
+		"content/posts/bundle/pic.png":  "png",
+		"content/notes/note.md":         "---\ntitle: A Note\ndate: 2023-02-01\n---\nNote {{< ref \"x\" >}}\n",
+		"static/favicon.ico":            "ico",
+	})
+
+	dst := filepath.Join(t.TempDir(), "site")
+	imp, err := ImportSite(src, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if imp.Generator != "hugo" || !imp.Multi || len(imp.Posts) != 3 {
+		t.Fatalf("got generator %q, multi %v, posts %v", imp.Generator, imp.Multi, imp.Posts)
+	}
+
+	for _, f := range imp.Posts {
+		if f.OldURL == "/posts/bundle/" && f.NewURL != "/blog/posts/2023/01/03/bundle/" {
+			t.Errorf("got new URL %q for the bundle", f.NewURL)
+		}
+	}
+
+	if !exists(filepath.Join(dst, "blog", "posts", "posts", "bundle", "pic.png")) {
+		t.Error("bundle asset wasn't copied")
+	}
+	if !exists(filepath.Join(dst, "www", "favicon.ico")) {
+		t.Error("static files weren't copied into www")
+	}
+	if len(imp.Issues) != 1 || !strings.Contains(imp.Issues[0].Message, "shortcodes") {
+		t.Errorf("got issues %v", imp.Issues)
+	}
+
+	if _, err := New(dst, t.TempDir(), nil); err != nil {
+		t.Errorf("imported site doesn't load: %v", err)
+	}
+}
@@ -0,0 +1,108 @@
+package gutenblog
+
+import (
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// BrokenLink is an internal reference in the generated site that
+// doesn't resolve to a generated file.
+type BrokenLink struct {
+	Page   string // Generated page containing the reference (relative to outDir)
+	Source string // Source file that produced the page, if known
+	Target string // The unresolved href or src value
+}
+
+func (l BrokenLink) String() string {
+	if l.Source != "" {
+		return fmt.Sprintf("%s: broken link %q (from %s)", l.Page, l.Target, l.Source)
+	}
+
+	return fmt.Sprintf("%s: broken link %q", l.Page, l.Target)
+}
+
+var reLinkAttr = regexp.MustCompile(`(?:href|src|poster)="([^"]*)"`)
+
+// CheckLinks walks the generated HTML in outDir and reports every
+// internal href, src, or poster that doesn't resolve to a generated
+// file. It should be run after Build.
+func (s *Site) CheckLinks() ([]BrokenLink, error) {
+	var broken []BrokenLink
+
+	walkFn := func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() || !strings.HasSuffix(p, ".html") {
+			return nil
+		}
+
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return fmt.Errorf("error reading %q: %w", p, err)
+		}
+
+		page, err := filepath.Rel(s.outDir, p)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range reLinkAttr.FindAllStringSubmatch(string(b), -1) {
+			target := m[1]
+			if resolved, ok := s.resolveLink(p, target); ok && !exists(resolved) {
+				broken = append(broken, BrokenLink{
+					Page:   page,
+					Source: s.sources[p],
+					Target: target,
+				})
+			}
+		}
+
+		return nil
+	}
+
+	if err := filepath.WalkDir(s.outDir, walkFn); err != nil {
+		return nil, fmt.Errorf("error checking links in %q: %w", s.outDir, err)
+	}
+
+	sort.SliceStable(broken, func(i, j int) bool {
+		return broken[i].Page < broken[j].Page
+	})
+
+	return broken, nil
+}
+
+// resolveLink maps a link found in page to a path within outDir. It
+// returns false for links that point outside the site.
+func (s *Site) resolveLink(page, link string) (string, bool) {
+	u, err := url.Parse(link)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.Path == "" {
+		return "", false // External, same-page fragment, or unparseable
+	}
+
+	var p string
+	if strings.HasPrefix(u.Path, "/") {
+		p = filepath.Join(s.outDir, filepath.FromSlash(u.Path))
+	} else {
+		p = filepath.Join(filepath.Dir(page), filepath.FromSlash(u.Path))
+	}
+
+	if info, err := os.Stat(p); err == nil && info.IsDir() {
+		p = filepath.Join(p, "index.html")
+	}
+
+	return p, true
+}
+
+// exists reports whether a file exists at path
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,47 @@
+package gutenblog
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCheckLinks(t *testing.T) {
+	root := t.TempDir()
+	postDir := filepath.Join(root, "posts", "hello")
+	if err := os.MkdirAll(postDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(root, "www"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	postPath := filepath.Join(postDir, "hello.gml.txt")
+	src := "%title Hello\n%date 2022-03-21\n\nSee the [home page](/) and the [archive](/archive/).\n"
+	if err := os.WriteFile(postPath, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := New(root, t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Build(); err != nil {
+		t.Fatal(err)
+	}
+
+	broken, err := s.CheckLinks()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []BrokenLink{{
+		Page:   filepath.Join("2022", "03", "21", "hello", "index.html"),
+		Source: postPath,
+		Target: "/archive/",
+	}}
+	if !reflect.DeepEqual(broken, want) {
+		t.Errorf("want:\n%v\ngot:\n%v", want, broken)
+	}
+}
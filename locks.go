@@ -0,0 +1,173 @@
+package gutenblog
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path"
+	"sort"
+	"sync"
+	"time"
+)
+
+// PostLock is an advisory lock recording who is editing a post. Locks
+// expire so an abandoned editor doesn't block a post forever.
+type PostLock struct {
+	Path    string    `json:"path"` // URL path of the post
+	User    string    `json:"user"`
+	Expires time.Time `json:"expires"`
+}
+
+// ErrLocked is returned when a post is locked by someone else.
+type ErrLocked struct {
+	Lock PostLock
+}
+
+func (e *ErrLocked) Error() string {
+	return fmt.Sprintf("%q is being edited by %q until %s", e.Lock.Path, e.Lock.User, e.Lock.Expires.Format(time.Kitchen))
+}
+
+// lockTable holds the advisory locks for the posts being edited.
+type lockTable struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu    sync.Mutex
+	locks map[string]PostLock
+
+	logger *slog.Logger
+}
+
+func newLockTable(ttl time.Duration, logger *slog.Logger) *lockTable {
+	return &lockTable{
+		ttl:    ttl,
+		now:    time.Now,
+		locks:  make(map[string]PostLock),
+		logger: logger,
+	}
+}
+
+// setTTL changes how long newly acquired or renewed locks last.
+func (t *lockTable) setTTL(ttl time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.ttl = ttl
+}
+
+// acquire locks a post for user or renews user's existing lock.
+func (t *lockTable) acquire(postPath, user string) (PostLock, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	postPath = path.Clean("/" + postPath)
+	now := t.now()
+
+	if l, ok := t.locks[postPath]; ok && l.User != user && now.Before(l.Expires) {
+		return PostLock{}, &ErrLocked{l}
+	}
+
+	l := PostLock{Path: postPath, User: user, Expires: now.Add(t.ttl)}
+	t.locks[postPath] = l
+	return l, nil
+}
+
+// release removes user's lock on a post. Releasing a lock held by
+// someone else fails unless it has expired.
+func (t *lockTable) release(postPath, user string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	postPath = path.Clean("/" + postPath)
+	l, ok := t.locks[postPath]
+	if !ok {
+		return nil
+	}
+
+	if l.User != user && t.now().Before(l.Expires) {
+		return &ErrLocked{l}
+	}
+
+	delete(t.locks, postPath)
+	return nil
+}
+
+// check returns an error if the post is locked by someone other than user.
+func (t *lockTable) check(postPath, user string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	l, ok := t.locks[path.Clean("/"+postPath)]
+	if ok && l.User != user && t.now().Before(l.Expires) {
+		return &ErrLocked{l}
+	}
+
+	return nil
+}
+
+// list returns all unexpired locks sorted by path.
+func (t *lockTable) list() []PostLock {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	locks := make([]PostLock, 0, len(t.locks))
+	for p, l := range t.locks {
+		if !now.Before(l.Expires) {
+			delete(t.locks, p) // Clean up while we're here
+			continue
+		}
+		locks = append(locks, l)
+	}
+
+	sort.Slice(locks, func(i, j int) bool {
+		return locks[i].Path < locks[j].Path
+	})
+
+	return locks
+}
+
+// ServeHTTP exposes the lock table at /api/locks:
+//
+//	GET    /api/locks                        list active locks
+//	POST   /api/locks?path=<post>&user=<who> acquire or renew a lock
+//	DELETE /api/locks?path=<post>&user=<who> release a lock
+func (t *lockTable) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	postPath, user := q.Get("path"), q.Get("user")
+
+	if r.Method != http.MethodGet && (postPath == "" || user == "") {
+		http.Error(w, `"path" and "user" are required`, http.StatusBadRequest)
+		return
+	}
+
+	var (
+		v   interface{}
+		err error
+	)
+
+	switch r.Method {
+	case http.MethodGet:
+		v = t.list()
+	case http.MethodPost:
+		v, err = t.acquire(postPath, user)
+	case http.MethodDelete:
+		err = t.release(postPath, user)
+		v = struct{}{}
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		t.logger.Error("error writing locks", "err", err)
+	}
+}
@@ -0,0 +1,49 @@
+package gutenblog
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLockTable(t *testing.T) {
+	now := time.Date(2022, 3, 21, 12, 0, 0, 0, time.UTC)
+	locks := newLockTable(time.Minute, gutenlog)
+	locks.now = func() time.Time { return now }
+
+	if _, err := locks.acquire("/2022/03/21/hello-world/", "alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Renewing your own lock is fine
+	if _, err := locks.acquire("/2022/03/21/hello-world", "alice"); err != nil {
+		t.Errorf("renew: %v", err)
+	}
+
+	var locked *ErrLocked
+	if _, err := locks.acquire("/2022/03/21/hello-world", "bob"); !errors.As(err, &locked) {
+		t.Errorf("acquire: want *ErrLocked; got: %v", err)
+	}
+
+	if err := locks.release("/2022/03/21/hello-world", "bob"); !errors.As(err, &locked) {
+		t.Errorf("release: want *ErrLocked; got: %v", err)
+	}
+
+	if n := len(locks.list()); n != 1 {
+		t.Errorf("want 1 lock; got %d", n)
+	}
+
+	// Expired locks can be taken over
+	now = now.Add(2 * time.Minute)
+	if n := len(locks.list()); n != 0 {
+		t.Errorf("want 0 locks; got %d", n)
+	}
+
+	if _, err := locks.acquire("/2022/03/21/hello-world", "bob"); err != nil {
+		t.Errorf("acquire expired: %v", err)
+	}
+
+	if err := locks.release("/2022/03/21/hello-world", "bob"); err != nil {
+		t.Errorf("release: %v", err)
+	}
+}
@@ -0,0 +1,34 @@
+package gutenblog
+
+import (
+	"log/slog"
+	"os"
+)
+
+// LogLevel controls how much the default logger logs.
+type LogLevel int
+
+const (
+	LogQuiet   LogLevel = iota // Only warnings and errors
+	LogNormal                  // Progress for each blog, hook, and request
+	LogVerbose                 // Every file written or copied
+)
+
+// logLevel is the minimum level of the default logger
+var logLevel = new(slog.LevelVar)
+
+// gutenlog is the logger of sites created without one
+var gutenlog = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel}))
+
+// SetLogLevel sets the verbosity of gutenblog's default logger. The
+// default is LogNormal. Loggers passed to New use their own level.
+func SetLogLevel(level LogLevel) {
+	switch level {
+	case LogQuiet:
+		logLevel.Set(slog.LevelWarn)
+	case LogVerbose:
+		logLevel.Set(slog.LevelDebug)
+	default:
+		logLevel.Set(slog.LevelInfo)
+	}
+}
@@ -0,0 +1,588 @@
+package gutenblog
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ImportedPost is a post converted to GML from another format.
+type ImportedPost struct {
+	Title    string
+	Subtitle string
+	Author   string
+	Date     time.Time
+	Tags     []string
+
+	// Front holds every scalar front matter field by its key (e.g.
+	// "permalink" or "draft") for callers that need more than the
+	// fields above.
+	Front map[string]string
+
+	// Body is the post's content as GML blocks without metadata.
+	Body string
+
+	// Assets are the relative paths of local files the post links to.
+	Assets []string
+}
+
+// GML returns the post as a complete GML document.
+func (p *ImportedPost) GML() string {
+	var b strings.Builder
+	if p.Title != "" {
+		fmt.Fprintf(&b, "%%title %s\n", p.Title)
+	}
+	if p.Subtitle != "" {
+		fmt.Fprintf(&b, "%%subtitle %s\n", p.Subtitle)
+	}
+	if !p.Date.IsZero() {
+		fmt.Fprintf(&b, "%%date %s\n", p.Date.Format("2006-01-02"))
+	}
+	if p.Author != "" {
+		fmt.Fprintf(&b, "%%author %s\n", p.Author)
+	}
+	if len(p.Tags) > 0 {
+		fmt.Fprintf(&b, "%%tags %s\n", strings.Join(p.Tags, ", "))
+	}
+
+	if p.Body != "" {
+		b.WriteString("\n")
+		b.WriteString(p.Body)
+	}
+
+	return b.String()
+}
+
+// ConvertMarkdown converts a CommonMark document with optional YAML
+// (---) or TOML (+++) front matter to GML. GML has no nested blocks,
+// so nested lists are flattened and blank lines inside code blocks
+// are kept as lines holding a single space.
+func ConvertMarkdown(src string) (*ImportedPost, error) {
+	src = strings.ReplaceAll(src, "\r\n", "\n")
+
+	front, body, err := splitFrontMatter(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &ImportedPost{Front: front.scalars, Tags: front.lists["tags"]}
+	p.Title = front.scalars["title"]
+	p.Subtitle = front.scalars["subtitle"]
+	if p.Subtitle == "" {
+		p.Subtitle = front.scalars["description"]
+	}
+	p.Author = front.scalars["author"]
+
+	if d := front.scalars["date"]; d != "" {
+		if p.Date, err = parseFrontMatterDate(d); err != nil {
+			return nil, err
+		}
+	}
+
+	c := &mdConverter{footnotes: make(map[string]int)}
+	p.Body = c.convert(body)
+	p.Assets = c.assets
+
+	return p, nil
+}
+
+// frontMatter holds the scalar and list values of simple YAML or TOML
+// front matter. Nested maps aren't supported.
+type frontMatter struct {
+	scalars map[string]string
+	lists   map[string][]string
+}
+
+func splitFrontMatter(src string) (frontMatter, string, error) {
+	fm := frontMatter{scalars: make(map[string]string), lists: make(map[string][]string)}
+
+	delim := ""
+	switch {
+	case strings.HasPrefix(src, "---\n"):
+		delim = "---"
+	case strings.HasPrefix(src, "+++\n"):
+		delim = "+++"
+	default:
+		return fm, src, nil
+	}
+
+	lines := strings.Split(src, "\n")
+	end := -1
+	for i := 1; i < len(lines); i++ {
+		if strings.TrimSpace(lines[i]) == delim {
+			end = i
+			break
+		}
+	}
+	if end < 0 {
+		return fm, "", fmt.Errorf("front matter is missing its closing %q", delim)
+	}
+
+	sep := ":"
+	if delim == "+++" {
+		sep = "="
+	}
+
+	lastKey := ""
+	for _, line := range lines[1:end] {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		// YAML block list item belonging to the previous key
+		if item, ok := strings.CutPrefix(trimmed, "- "); ok && lastKey != "" {
+			fm.lists[lastKey] = append(fm.lists[lastKey], unquote(item))
+			continue
+		}
+
+		key, val, ok := strings.Cut(line, sep)
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		val = strings.TrimSpace(val)
+		lastKey = key
+
+		if strings.HasPrefix(val, "[") && strings.HasSuffix(val, "]") {
+			for _, item := range strings.Split(strings.Trim(val, "[]"), ",") {
+				if item = unquote(strings.TrimSpace(item)); item != "" {
+					fm.lists[key] = append(fm.lists[key], item)
+				}
+			}
+			continue
+		}
+
+		if val != "" {
+			fm.scalars[key] = unquote(val)
+		}
+	}
+
+	return fm, strings.Join(lines[end+1:], "\n"), nil
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+var reFrontMatterDate = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}`)
+
+// parseFrontMatterDate reads the day from a date or timestamp such as
+// "2022-03-21", "2022-03-21T10:00:00Z", or "2022-03-21 10:00:00 +0000".
+func parseFrontMatterDate(s string) (time.Time, error) {
+	day := reFrontMatterDate.FindString(s)
+	if day == "" {
+		return time.Time{}, fmt.Errorf("invalid date %q: want YYYY-MM-DD", s)
+	}
+
+	return time.Parse("2006-01-02", day)
+}
+
+// mdConverter converts Markdown blocks to GML blocks.
+type mdConverter struct {
+	blocks    []string
+	para      []string
+	footnotes map[string]int // Footnote label to number
+	notes     map[int]string // Footnote number to text
+	assets    []string
+}
+
+var (
+	reMdATXHeading = regexp.MustCompile(`^(#{1,6})\s+(.*?)(?:\s+#+)?\s*$`)
+	reMdFence      = regexp.MustCompile("^(```+|~~~+)\\s*(\\S*)")
+	reMdSetext     = regexp.MustCompile(`^(?:=+|-+)$`)
+	reMdRule       = regexp.MustCompile(`^(?:(?:\*\s*){3,}|(?:-\s*){3,}|(?:_\s*){3,})$`)
+	reMdListItem   = regexp.MustCompile(`^(\s*)([-*+]|\d+[.)])\s+(.*)$`)
+	reMdFootnote   = regexp.MustCompile(`^\[\^([^\]]+)\]:\s*(.*)$`)
+	reMdHTMLBlock  = regexp.MustCompile(`^<(?:[a-zA-Z][a-zA-Z0-9-]*|!--)[\s/>]`)
+	reMdFigure     = regexp.MustCompile(`^!\[([^\]]*)\]\(([^)\s]+)(?:\s+"([^"]*)")?\)$`)
+)
+
+func (c *mdConverter) flush() {
+	if len(c.para) == 0 {
+		return
+	}
+
+	text := strings.Join(c.para, "\n")
+	c.para = nil
+
+	if m := reMdFigure.FindStringSubmatch(text); m != nil {
+		c.figure(m[1], m[2], m[3])
+		return
+	}
+
+	c.blocks = append(c.blocks, c.inline(text))
+}
+
+func (c *mdConverter) figure(alt, src, title string) {
+	c.asset(src)
+
+	caption := title
+	if caption == "" {
+		caption = alt
+	}
+
+	fig := fmt.Sprintf("%%figure\n<img src=\"%s\" alt=\"%s\">", html.EscapeString(src), html.EscapeString(alt))
+	if caption != "" {
+		fig += "\n" + c.inline(caption)
+	}
+
+	c.blocks = append(c.blocks, fig)
+}
+
+// asset records a link to a local file.
+func (c *mdConverter) asset(link string) {
+	u, err := url.Parse(link)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.Path == "" || strings.HasPrefix(u.Path, "/") {
+		return
+	}
+
+	p := filepath.Clean(filepath.FromSlash(u.Path))
+	if strings.HasPrefix(p, "..") || path.Ext(p) == "" || path.Ext(p) == ".md" || path.Ext(p) == ".html" {
+		return
+	}
+
+	for _, a := range c.assets {
+		if a == p {
+			return
+		}
+	}
+	c.assets = append(c.assets, p)
+}
+
+func (c *mdConverter) convert(src string) string {
+	lines := strings.Split(src, "\n")
+	c.notes = make(map[int]string)
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case trimmed == "":
+			c.flush()
+
+		case reMdFence.MatchString(trimmed):
+			c.flush()
+			fence := reMdFence.FindStringSubmatch(trimmed)[1]
+
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), fence); i++ {
+				code = append(code, lines[i])
+			}
+			c.pre(code)
+
+		case len(c.para) > 0 && reMdSetext.MatchString(trimmed):
+			// Setext heading underlining the paragraph so far
+			level := "*"
+			if trimmed[0] == '-' {
+				level = "**"
+			}
+			text := strings.Join(c.para, " ")
+			c.para = nil
+			c.blocks = append(c.blocks, level+" "+c.inline(text))
+
+		case reMdATXHeading.MatchString(line):
+			c.flush()
+			m := reMdATXHeading.FindStringSubmatch(line)
+			level := len(m[1])
+			if level > 5 {
+				level = 5 // GML's deepest heading
+			}
+			c.blocks = append(c.blocks, strings.Repeat("*", level)+" "+c.inline(m[2]))
+
+		case reMdRule.MatchString(trimmed) && len(c.para) == 0:
+			c.blocks = append(c.blocks, "%html\n<hr>")
+
+		case strings.HasPrefix(trimmed, ">"):
+			c.flush()
+			var quote []string
+			for ; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), ">"); i++ {
+				l := strings.TrimPrefix(strings.TrimSpace(lines[i]), ">")
+				if l = strings.TrimSpace(l); l != "" {
+					quote = append(quote, l)
+				}
+			}
+			i--
+			if len(quote) > 0 {
+				c.blocks = append(c.blocks, "%blockquote\n"+c.inline(strings.Join(quote, "\n")))
+			}
+
+		case reMdFootnote.MatchString(trimmed) && len(c.para) == 0:
+			m := reMdFootnote.FindStringSubmatch(trimmed)
+			text := []string{m[2]}
+			for i+1 < len(lines) && strings.HasPrefix(lines[i+1], "    ") && strings.TrimSpace(lines[i+1]) != "" {
+				i++
+				text = append(text, strings.TrimSpace(lines[i]))
+			}
+			c.notes[c.footnote(m[1])] = strings.Join(text, " ")
+
+		case reMdListItem.MatchString(line) && len(c.para) == 0:
+			i = c.list(lines, i) - 1
+
+		case strings.HasPrefix(line, "    ") && len(c.para) == 0:
+			var code []string
+			for ; i < len(lines) && (strings.HasPrefix(lines[i], "    ") || strings.TrimSpace(lines[i]) == ""); i++ {
+				code = append(code, strings.TrimPrefix(lines[i], "    "))
+			}
+			i--
+			for len(code) > 0 && strings.TrimSpace(code[len(code)-1]) == "" {
+				code = code[:len(code)-1]
+			}
+			c.pre(code)
+
+		case reMdHTMLBlock.MatchString(trimmed) && len(c.para) == 0:
+			var block []string
+			for ; i < len(lines) && strings.TrimSpace(lines[i]) != ""; i++ {
+				block = append(block, lines[i])
+			}
+			i--
+			c.blocks = append(c.blocks, "%html\n"+strings.Join(block, "\n"))
+
+		default:
+			c.para = append(c.para, trimmed)
+		}
+	}
+	c.flush()
+
+	if len(c.notes) > 0 {
+		nums := make([]int, 0, len(c.notes))
+		for n := range c.notes {
+			nums = append(nums, n)
+		}
+		sort.Ints(nums)
+
+		var b strings.Builder
+		b.WriteString("%footnotes")
+		for _, n := range nums {
+			fmt.Fprintf(&b, "\n- [%d] %s", n, c.inline(c.notes[n]))
+		}
+		c.blocks = append(c.blocks, b.String())
+	}
+
+	if len(c.blocks) == 0 {
+		return ""
+	}
+
+	return strings.Join(c.blocks, "\n\n") + "\n"
+}
+
+// pre adds a code block. GML blocks end at an empty line so empty
+// lines are written as a single space.
+func (c *mdConverter) pre(code []string) {
+	lines := make([]string, len(code))
+	for i, l := range code {
+		if strings.TrimSpace(l) == "" {
+			l = " "
+		}
+		lines[i] = html.EscapeString(l)
+	}
+
+	if len(lines) == 0 {
+		lines = []string{" "}
+	}
+
+	c.blocks = append(c.blocks, "%pre\n"+strings.Join(lines, "\n"))
+}
+
+// list converts the list starting at lines[i] and returns the index
+// of the first line after it.
+func (c *mdConverter) list(lines []string, i int) int {
+	ordered := false
+	var items []string
+
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		if m := reMdListItem.FindStringSubmatch(line); m != nil {
+			isOrdered := m[2][0] >= '0' && m[2][0] <= '9'
+			if len(items) == 0 {
+				ordered = isOrdered
+			} else if isOrdered != ordered && m[1] == "" {
+				break // A new list
+			}
+			items = append(items, m[3])
+			continue
+		}
+
+		if strings.TrimSpace(line) == "" {
+			// A loose list continues after a blank line
+			if i+1 < len(lines) {
+				if m := reMdListItem.FindStringSubmatch(lines[i+1]); m != nil && (m[2][0] >= '0' && m[2][0] <= '9') == ordered {
+					continue
+				}
+			}
+			break
+		}
+
+		// Lazy or indented continuation of the last item
+		items[len(items)-1] += " " + strings.TrimSpace(line)
+	}
+
+	var b strings.Builder
+	for n, item := range items {
+		if n > 0 {
+			b.WriteString("\n")
+		}
+		if ordered {
+			fmt.Fprintf(&b, "%d. ", n+1)
+		} else {
+			b.WriteString("- ")
+		}
+		b.WriteString(c.inline(item))
+	}
+	c.blocks = append(c.blocks, b.String())
+
+	return i
+}
+
+// footnote returns the number of a footnote label, numbering labels
+// in the order they're first seen.
+func (c *mdConverter) footnote(label string) int {
+	if n, ok := c.footnotes[label]; ok {
+		return n
+	}
+
+	n := len(c.footnotes) + 1
+	c.footnotes[label] = n
+	return n
+}
+
+var (
+	reMdCode     = regexp.MustCompile("(`+)(.+?)`+")
+	reMdImage    = regexp.MustCompile(`!\[([^\]]*)\]\(([^)\s]+)(?:\s+"([^"]*)")?\)`)
+	reMdLink     = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)(?:\s+"([^"]*)")?\)`)
+	reMdAutolink = regexp.MustCompile(`<((?:https?|mailto):[^>\s]+)>`)
+	reMdFnRef    = regexp.MustCompile(`\[\^([^\]]+)\]`)
+	reMdStrong   = regexp.MustCompile(`\*\*(.+?)\*\*|__(.+?)__`)
+	reMdEm       = regexp.MustCompile(`\*([^*\s](?:[^*]*[^*\s])?)\*|\b_([^_\s](?:[^_]*[^_\s])?)_\b`)
+	reMdStrike   = regexp.MustCompile(`~~(.+?)~~`)
+	reMdBreak    = regexp.MustCompile(`(?: {2,}|\\)\n`)
+)
+
+// inline converts Markdown spans to GML's styled text, e.g. "**bold**"
+// to "*bold*". GML has no line breaks within a paragraph, so hard line
+// breaks become ordinary ones.
+func (c *mdConverter) inline(s string) string {
+	// Protect code spans from the other replacements
+	var codes []string
+	s = reMdCode.ReplaceAllStringFunc(s, func(m string) string {
+		sub := reMdCode.FindStringSubmatch(m)
+		codes = append(codes, "~"+strings.TrimSpace(sub[2])+"~")
+		return fmt.Sprintf("\x00%d\x00", len(codes)-1)
+	})
+
+	s = reMdImage.ReplaceAllStringFunc(s, func(m string) string {
+		sub := reMdImage.FindStringSubmatch(m)
+		c.asset(sub[2])
+		return fmt.Sprintf("![%s](%s)", sub[1], sub[2])
+	})
+
+	s = reMdLink.ReplaceAllStringFunc(s, func(m string) string {
+		sub := reMdLink.FindStringSubmatch(m)
+		c.asset(sub[2])
+		return fmt.Sprintf("[%s](%s)", sub[1], sub[2])
+	})
+
+	s = reMdAutolink.ReplaceAllString(s, "[[$1]]")
+	s = reMdFnRef.ReplaceAllStringFunc(s, func(m string) string {
+		return fmt.Sprintf("[fn:%d]", c.footnote(reMdFnRef.FindStringSubmatch(m)[1]))
+	})
+	s = reMdStrong.ReplaceAllString(s, "\x01$1$2\x01") // Not "*" until emphasis is replaced
+	s = reMdEm.ReplaceAllString(s, "/$1$2/")
+	s = strings.ReplaceAll(s, "\x01", "*")
+	s = reMdStrike.ReplaceAllString(s, "+$1+")
+	s = reMdBreak.ReplaceAllString(s, "\n")
+
+	for i, code := range codes {
+		s = strings.Replace(s, fmt.Sprintf("\x00%d\x00", i), code, 1)
+	}
+
+	return s
+}
+
+var reDatedName = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2})-(.+)$`)
+
+// ImportMarkdown converts the Markdown file at mdPath into a new post
+// of the named blog and copies the local files it links to into the
+// post's directory. Posts without a title or date in their front
+// matter get them from a Jekyll-style file name (e.g.
+// 2022-03-21-hello-world.md).
+func (s *Site) ImportMarkdown(blogName, mdPath string) (*PostFile, error) {
+	p, _, err := readMarkdownPost(mdPath)
+	if err != nil {
+		return nil, err
+	}
+
+	bl, err := s.findBlog(blogName)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := s.CreatePost(blogName, p.GML())
+	if err != nil {
+		return nil, fmt.Errorf("error importing %q: %w", mdPath, err)
+	}
+
+	postDir := filepath.Join(bl.name, "posts", path.Base(f.ID))
+	for _, a := range p.Assets {
+		src := filepath.Join(filepath.Dir(mdPath), a)
+		if err := copyFile(src, filepath.Join(postDir, a)); err != nil {
+			s.logger.Warn("skipping missing asset", "post", f.ID, "path", src, "error", err)
+		}
+	}
+
+	return f, nil
+}
+
+// readMarkdownPost converts the Markdown file at mdPath. It also
+// returns the file's name without its extension or date prefix, e.g.
+// "hello-world" for 2022-03-21-hello-world.md, which is used for the
+// title and date when the front matter doesn't have them.
+func readMarkdownPost(mdPath string) (*ImportedPost, string, error) {
+	b, err := os.ReadFile(mdPath)
+	if err != nil {
+		return nil, "", fmt.Errorf("error reading %q: %w", mdPath, err)
+	}
+
+	p, err := ConvertMarkdown(string(b))
+	if err != nil {
+		return nil, "", fmt.Errorf("error converting %q: %w", mdPath, err)
+	}
+
+	name := strings.TrimSuffix(filepath.Base(mdPath), filepath.Ext(mdPath))
+	if m := reDatedName.FindStringSubmatch(name); m != nil {
+		if p.Date.IsZero() {
+			p.Date, _ = time.Parse("2006-01-02", m[1])
+		}
+		name = m[2]
+	}
+	if p.Title == "" {
+		p.Title = strings.ReplaceAll(name, "-", " ")
+	}
+
+	return p, name, nil
+}
+
+// copyFile copies src to dst, creating dst's parent directories.
+func copyFile(src, dst string) error {
+	b, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+
+	if err := mkdir(filepath.Dir(dst)); err != nil {
+		return err
+	}
+
+	return os.WriteFile(dst, b, 0644)
+}
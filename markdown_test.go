@@ -0,0 +1,156 @@
+package gutenblog
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/anschwa/gutenblog/gml"
+)
+
+func TestConvertMarkdown(t *testing.T) {
+	src := "---\n" +
+		"title: \"Hello, World\"\n" +
+		"date: 2022-03-21T10:00:00Z\n" +
+		"tags: [go, blogging]\n" +
+		"---\n" +
+		"# Intro\n" +
+		"\n" +
+		"Some *emphasis*, **strong**, and `a < b` with a [link](/about/).[^note]\n" +
+		"\n" +
+		"- one\n" +
+		"- two\n" +
+		"  continued\n" +
+		"\n" +
+		"1. first\n" +
+		"2. second\n" +
+		"\n" +
+		"> quoted\n" +
+		"> text\n" +
+		"\n" +
+		"```go\n" +
+		"if a < b {\n" +
+		"\n" +
+		"}\n" +
+		"```\n" +
+		"\n" +
+		"![A cat](cat.jpg \"My cat\")\n" +
+		"\n" +
+		"[^note]: A footnote.\n"
+
+	p, err := ConvertMarkdown(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.Title != "Hello, World" || p.Date.Format("2006-01-02") != "2022-03-21" {
+		t.Errorf("got title %q and date %v", p.Title, p.Date)
+	}
+	if strings.Join(p.Tags, ",") != "go,blogging" {
+		t.Errorf("got tags %q", p.Tags)
+	}
+	if len(p.Assets) != 1 || p.Assets[0] != "cat.jpg" {
+		t.Errorf("got assets %q", p.Assets)
+	}
+
+	want := `* Intro
+
+Some /emphasis/, *strong*, and ~a < b~ with a [link](/about/).[fn:1]
+
+- one
+- two continued
+
+1. first
+2. second
+
+%blockquote
+quoted
+text
+
+%pre
+if a &lt; b {
+ 
+}
+
+%figure
+<img src="cat.jpg" alt="A cat">
+My cat
+
+%footnotes
+- [1] A footnote.
+`
+	if p.Body != want {
+		t.Errorf("got body:\n%s\nwant:\n%s", p.Body, want)
+	}
+
+	doc, err := gml.Parse(p.GML())
+	if err != nil {
+		t.Fatalf("converted post doesn't parse: %v", err)
+	}
+	if got := strings.Join(doc.Tags(), ","); got != "go,blogging" {
+		t.Errorf("got GML tags %q", got)
+	}
+
+	// Styled text renders without allowing inline HTML
+	want = `<p>Some <em>emphasis</em>, <strong>strong</strong>, and <code>a &lt; b</code> with a <a href="/about/">link</a>.`
+	if got := doc.HTML(nil); !strings.Contains(got, want) {
+		t.Errorf("want HTML containing:\n%s\ngot:\n%s", want, got)
+	}
+}
+
+func TestImportMarkdown(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "posts"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	mdDir := t.TempDir()
+	md := filepath.Join(mdDir, "2022-03-21-hello-world.md")
+	if err := os.WriteFile(md, []byte("Hello ![photo](img/photo.png)\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(mdDir, "img"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(mdDir, "img", "photo.png"), []byte("png"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := New(root, t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := s.ImportMarkdown("", md)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if f.URL != "/2022/03/21/hello-world/" {
+		t.Errorf("got URL %q", f.URL)
+	}
+
+	if !exists(filepath.Join(root, "posts", "hello-world", "img", "photo.png")) {
+		t.Error("asset wasn't copied into the post directory")
+	}
+}
+
+func TestConvertMarkdownInline(t *testing.T) {
+	tests := []struct {
+		md, want string
+	}{
+		{"**bold** and *em* and _em_", "*bold* and /em/ and /em/"},
+		{"~~gone~~ and `*code*`", "+gone+ and ~*code*~"},
+		{"see <https://example.com>", "see [[https://example.com]]"},
+		{"![alt](a.png) [**text**](b.html)", "![alt](a.png) [*text*](b.html)"},
+		{"line  \nbreak\\\nagain", "line\nbreak\nagain"},
+	}
+
+	for _, test := range tests {
+		c := &mdConverter{footnotes: make(map[string]int)}
+		if got := c.inline(test.md); got != test.want {
+			t.Errorf("%q:\nwant:\t%q\n got:\t%q", test.md, test.want, got)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package gutenblog
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// metrics collects server statistics and exposes them in the
+// Prometheus text format at /metrics.
+type metrics struct {
+	outDir string
+
+	mu              sync.Mutex
+	requests        map[requestKey]uint64
+	requestDuration *histogram
+	buildDuration   *histogram
+	buildFailures   uint64
+	generatedFiles  int
+}
+
+type requestKey struct {
+	method string
+	code   int
+}
+
+// histogram counts observations into cumulative buckets.
+type histogram struct {
+	bounds []float64 // Upper bounds in seconds
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(bounds ...float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds))}
+}
+
+func (h *histogram) observe(d time.Duration) {
+	v := d.Seconds()
+	for i, b := range h.bounds {
+		if v <= b {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+func (h *histogram) write(w io.Writer, name string) {
+	for i, b := range h.bounds {
+		fmt.Fprintf(w, "%s_bucket{le=%q} %d\n", name, strconv.FormatFloat(b, 'g', -1, 64), h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, h.count)
+	fmt.Fprintf(w, "%s_sum %g\n", name, h.sum)
+	fmt.Fprintf(w, "%s_count %d\n", name, h.count)
+}
+
+func newMetrics(outDir string) *metrics {
+	return &metrics{
+		outDir:          outDir,
+		requests:        make(map[requestKey]uint64),
+		requestDuration: newHistogram(0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10),
+		buildDuration:   newHistogram(0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60),
+	}
+}
+
+// instrument wraps next to count requests and time them.
+func (m *metrics) instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		m.requests[requestKey{requestMethod(r.Method), rec.status}]++
+		m.requestDuration.observe(time.Since(start))
+	})
+}
+
+// requestMethod returns the method a request is counted under. The
+// client chooses the method, so anything nonstandard is counted as
+// "other" to keep the number of series bounded.
+func requestMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+
+	return "other"
+}
+
+// build wraps a site build to time it, count failures, and count the
+// files in the output directory afterwards.
+func (m *metrics) build(build func() error) func() error {
+	return func() error {
+		start := time.Now()
+		err := build()
+		elapsed := time.Since(start)
+
+		m.mu.Lock()
+		m.buildDuration.observe(elapsed)
+		if err != nil {
+			m.buildFailures++
+		}
+		m.mu.Unlock()
+
+		if err == nil {
+			m.countFiles()
+		}
+
+		return err
+	}
+}
+
+// countFiles records the number of files in the output directory.
+func (m *metrics) countFiles() {
+	files := 0
+	filepath.WalkDir(m.outDir, func(p string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			files++
+		}
+		return nil
+	})
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.generatedFiles = files
+}
+
+func (m *metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.write(w)
+}
+
+// write writes every metric in the Prometheus text format.
+func (m *metrics) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := make([]requestKey, 0, len(m.requests))
+	for k := range m.requests {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].method != keys[j].method {
+			return keys[i].method < keys[j].method
+		}
+		return keys[i].code < keys[j].code
+	})
+
+	fmt.Fprintln(w, "# HELP gutenblog_http_requests_total Number of HTTP requests served.")
+	fmt.Fprintln(w, "# TYPE gutenblog_http_requests_total counter")
+	for _, k := range keys {
+		fmt.Fprintf(w, "gutenblog_http_requests_total{method=%q,code=\"%d\"} %d\n", k.method, k.code, m.requests[k])
+	}
+
+	fmt.Fprintln(w, "# HELP gutenblog_http_request_duration_seconds Time spent serving HTTP requests.")
+	fmt.Fprintln(w, "# TYPE gutenblog_http_request_duration_seconds histogram")
+	m.requestDuration.write(w, "gutenblog_http_request_duration_seconds")
+
+	fmt.Fprintln(w, "# HELP gutenblog_build_duration_seconds Time spent generating the site.")
+	fmt.Fprintln(w, "# TYPE gutenblog_build_duration_seconds histogram")
+	m.buildDuration.write(w, "gutenblog_build_duration_seconds")
+
+	fmt.Fprintln(w, "# HELP gutenblog_build_failures_total Number of site builds that failed.")
+	fmt.Fprintln(w, "# TYPE gutenblog_build_failures_total counter")
+	fmt.Fprintf(w, "gutenblog_build_failures_total %d\n", m.buildFailures)
+
+	fmt.Fprintln(w, "# HELP gutenblog_generated_files Number of files in the output directory after the last successful build.")
+	fmt.Fprintln(w, "# TYPE gutenblog_generated_files gauge")
+	fmt.Fprintf(w, "gutenblog_generated_files %d\n", m.generatedFiles)
+}
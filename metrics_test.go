@@ -0,0 +1,52 @@
+package gutenblog
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	outDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outDir, "index.html"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m := newMetrics(outDir)
+
+	h := m.instrument(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+		}
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/missing", nil))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("FOO", "/", nil))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("BAR", "/", nil))
+
+	m.build(func() error { return nil })()
+	m.build(func() error { return errors.New("broken") })()
+
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	got := w.Body.String()
+
+	for _, want := range []string{
+		`gutenblog_http_requests_total{method="GET",code="200"} 2`,
+		`gutenblog_http_requests_total{method="GET",code="404"} 1`,
+		`gutenblog_http_requests_total{method="other",code="200"} 2`,
+		`gutenblog_http_request_duration_seconds_count 5`,
+		`gutenblog_build_duration_seconds_bucket{le="+Inf"} 2`,
+		`gutenblog_build_failures_total 1`,
+		`gutenblog_generated_files 1`,
+	} {
+		if !strings.Contains(got, want+"\n") {
+			t.Errorf("missing %q in:\n%s", want, got)
+		}
+	}
+}
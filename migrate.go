@@ -0,0 +1,148 @@
+package gutenblog
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Rewrite is a literal find and replace applied to GML sources.
+type Rewrite struct {
+	Old string
+	New string
+}
+
+// ParseRewrite parses a rewrite rule of the form "old=>new".
+func ParseRewrite(rule string) (Rewrite, error) {
+	old, new, ok := strings.Cut(rule, "=>")
+	if !ok || old == "" {
+		return Rewrite{}, fmt.Errorf("invalid rewrite %q: want \"old=>new\"", rule)
+	}
+
+	return Rewrite{Old: old, New: new}, nil
+}
+
+// RewriteChange describes the edits a set of rewrites makes to one file.
+type RewriteChange struct {
+	Path  string
+	Lines []LineChange
+}
+
+// LineChange is a single modified line within a file.
+type LineChange struct {
+	Line int // 1-indexed
+	Old  string
+	New  string
+}
+
+// Diff formats the change as a simple line-oriented diff.
+func (c RewriteChange) Diff() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", c.Path, c.Path)
+	for _, l := range c.Lines {
+		fmt.Fprintf(&b, "@@ line %d @@\n-%s\n+%s\n", l.Line, l.Old, l.New)
+	}
+
+	return b.String()
+}
+
+// Migrate applies rewrites to the GML source of every post on the
+// site. Nothing is written unless apply is true, so callers can
+// preview the returned changes first. Rules are applied in order to
+// each line, and files are replaced atomically. Every rewritten post
+// must still parse; otherwise nothing is written.
+func (s *Site) Migrate(rewrites []Rewrite, apply bool) ([]RewriteChange, error) {
+	var (
+		changes  []RewriteChange
+		contents []string
+	)
+
+	for _, b := range s.blogs {
+		for _, p := range b.sortedPosts() {
+			change, content, err := rewriteFile(p.path, rewrites)
+			if err != nil {
+				return nil, err
+			}
+
+			if len(change.Lines) == 0 {
+				continue
+			}
+
+			if _, err := parsePost(p.path, content); err != nil {
+				return nil, fmt.Errorf("rewriting %q would break it: %w", p.path, err)
+			}
+
+			changes = append(changes, change)
+			contents = append(contents, content)
+		}
+	}
+
+	if apply {
+		for i, c := range changes {
+			if err := writeFileAtomic(c.Path, []byte(contents[i])); err != nil {
+				return nil, fmt.Errorf("error writing %q: %w", c.Path, err)
+			}
+		}
+	}
+
+	return changes, nil
+}
+
+// rewriteFile applies rewrites to each line of the file at path and
+// returns the resulting changes and content.
+func rewriteFile(path string, rewrites []Rewrite) (RewriteChange, string, error) {
+	change := RewriteChange{Path: path}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return change, "", fmt.Errorf("error reading %q: %w", path, err)
+	}
+
+	lines := strings.Split(string(b), "\n")
+	for i, line := range lines {
+		newLine := line
+		for _, r := range rewrites {
+			newLine = strings.ReplaceAll(newLine, r.Old, r.New)
+		}
+
+		if newLine != line {
+			change.Lines = append(change.Lines, LineChange{Line: i + 1, Old: line, New: newLine})
+			lines[i] = newLine
+		}
+	}
+
+	return change, strings.Join(lines, "\n"), nil
+}
+
+// writeFileAtomic replaces the file at path by writing to a temporary
+// file in the same directory and renaming it into place.
+func writeFileAtomic(path string, data []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name()) // No-op after a successful rename
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(f.Name(), info.Mode()&fs.ModePerm); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
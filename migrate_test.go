@@ -0,0 +1,85 @@
+package gutenblog
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseRewrite(t *testing.T) {
+	r, err := ParseRewrite("old.example.com=>new.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Old != "old.example.com" || r.New != "new.example.com" {
+		t.Errorf("unexpected rewrite: %#v", r)
+	}
+
+	for _, rule := range []string{"", "no-arrow", "=>new"} {
+		if _, err := ParseRewrite(rule); err == nil {
+			t.Errorf("ParseRewrite(%q): want error", rule)
+		}
+	}
+}
+
+func TestRewriteFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "post.gml.txt")
+	if err := os.WriteFile(path, []byte("%title foo\n\nsee http://old/a.png\nand http://old/b.png\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	change, content, err := rewriteFile(path, []Rewrite{{"http://old/", "https://new/"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "%title foo\n\nsee https://new/a.png\nand https://new/b.png\n"; content != want {
+		t.Errorf("want: %q; got: %q", want, content)
+	}
+
+	if len(change.Lines) != 2 || change.Lines[0].Line != 3 || change.Lines[1].Line != 4 {
+		t.Errorf("unexpected changes: %#v", change.Lines)
+	}
+}
+
+func TestMigrateRefusesBrokenRewrite(t *testing.T) {
+	root := t.TempDir()
+	postDir := filepath.Join(root, "posts", "hello")
+	if err := os.MkdirAll(postDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	postPath := filepath.Join(postDir, "hello.gml.txt")
+	src := "%title Hello\n%date 2022-03-21\n\nSee http://old/\n"
+	if err := os.WriteFile(postPath, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := New(root, t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Dates must be YYYY-MM-DD
+	if _, err := s.Migrate([]Rewrite{{"2022-03-21", "March 21, 2022"}}, true); err == nil || !strings.Contains(err.Error(), "would break it") {
+		t.Fatalf("want an error for a rewrite that breaks the post; got %v", err)
+	}
+
+	b, err := os.ReadFile(postPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != src {
+		t.Errorf("want the post left untouched; got %q", b)
+	}
+
+	// A rewrite that keeps the post valid is applied
+	if _, err := s.Migrate([]Rewrite{{"http://old/", "https://new/"}}, true); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(postPath); !strings.Contains(string(b), "https://new/") {
+		t.Errorf("want the rewrite applied; got %q", b)
+	}
+}
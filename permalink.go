@@ -0,0 +1,95 @@
+package gutenblog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// urlMapFile is written to outDir after each build and records the
+// URL of every post so the next build can tell when one has moved.
+const urlMapFile = "gutenblog-urls.json"
+
+type urlMap struct {
+	Build *BuildInfo    `json:"build,omitempty"`
+	Posts []urlMapEntry `json:"posts"`
+}
+
+type urlMapEntry struct {
+	Source string `json:"source"` // Source path relative to the site root
+	Hash   string `json:"hash"`   // SHA-256 of the source file
+	URL    string `json:"url"`
+}
+
+// checkPermalinks compares the URL of each post against the previous
+// build's URL map and warns about any that changed, which usually
+// means a retitled post just broke every existing link to it. Posts
+// are matched by source path first and by content hash second so
+// renamed source files are still recognized.
+func (s *Site) checkPermalinks() error {
+	path := filepath.Join(s.outDir, urlMapFile)
+
+	var prev urlMap
+	b, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("error reading %q: %w", path, err)
+	}
+	if err == nil {
+		// Older builds wrote a bare list of posts
+		if err := json.Unmarshal(b, &prev); err != nil {
+			if err := json.Unmarshal(b, &prev.Posts); err != nil {
+				return fmt.Errorf("error parsing %q: %w", path, err)
+			}
+		}
+	}
+
+	bySource := make(map[string]urlMapEntry, len(prev.Posts))
+	byHash := make(map[string]urlMapEntry, len(prev.Posts))
+	for _, e := range prev.Posts {
+		bySource[e.Source] = e
+		byHash[e.Hash] = e
+	}
+
+	var current []urlMapEntry
+	for _, bl := range s.blogs {
+		webRoot := s.webRoot(bl)
+		for _, p := range bl.posts {
+			source, err := filepath.Rel(s.rootDir, p.path)
+			if err != nil {
+				return err
+			}
+
+			e := urlMapEntry{Source: filepath.ToSlash(source), Hash: p.hash, URL: p.url(webRoot)}
+			current = append(current, e)
+
+			old, ok := bySource[e.Source]
+			if !ok {
+				old, ok = byHash[e.Hash]
+			}
+
+			if ok && old.URL != e.URL {
+				s.logger.Warn("post URL changed; existing links to it will break unless you restore the title or add a redirect",
+					"path", e.Source, "old", old.URL, "new", e.URL)
+			}
+		}
+	}
+
+	sort.Slice(current, func(i, j int) bool {
+		return current[i].Source < current[j].Source
+	})
+
+	b, err = json.MarshalIndent(urlMap{Build: s.build, Posts: current}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		return fmt.Errorf("error writing %q: %w", path, err)
+	}
+
+	return nil
+}
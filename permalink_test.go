@@ -0,0 +1,83 @@
+package gutenblog
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckPermalinks(t *testing.T) {
+	const (
+		source = "posts/hello-world/hello-world.gml.txt"
+		url    = "/2022/03/21/hello-world/index.html"
+		oldURL = "/2022/03/21/hi/index.html"
+	)
+
+	tests := []struct {
+		name string
+		prev string // Previous URL map; "" for the first build
+		warn bool
+		err  string
+	}{
+		{name: "first build"},
+		{name: "unchanged", prev: `{"posts": [{"source": "` + source + `", "hash": "x", "url": "` + url + `"}]}`},
+		{name: "retitled", prev: `{"posts": [{"source": "` + source + `", "hash": "x", "url": "` + oldURL + `"}]}`, warn: true},
+		{name: "renamed source", prev: `{"posts": [{"source": "posts/hi.gml.txt", "hash": "HASH", "url": "` + oldURL + `"}]}`, warn: true},
+		{name: "other post", prev: `{"posts": [{"source": "posts/hi.gml.txt", "hash": "x", "url": "` + oldURL + `"}]}`},
+		{name: "bare list", prev: `[{"source": "` + source + `", "hash": "x", "url": "` + oldURL + `"}]`, warn: true},
+		{name: "invalid", prev: `{"posts": "` + url + `"}`, err: "error parsing"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			s, err := New("examples/solo-blog", t.TempDir(), slog.New(slog.NewTextHandler(&buf, nil)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			path := filepath.Join(s.outDir, urlMapFile)
+			if tt.prev != "" {
+				prev := strings.ReplaceAll(tt.prev, "HASH", s.blogs[0].sortedPosts()[0].hash)
+				if err := os.WriteFile(path, []byte(prev), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err = s.checkPermalinks()
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("want an error containing %q; got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if warned := strings.Contains(buf.String(), "post URL changed"); warned != tt.warn {
+				t.Errorf("want warning %v; got log:\n%s", tt.warn, buf.String())
+			}
+			if tt.warn && !strings.Contains(buf.String(), "old="+oldURL) {
+				t.Errorf("want the old URL in the warning; got:\n%s", buf.String())
+			}
+
+			// The map is replaced with this build's URLs
+			b, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var m urlMap
+			if err := json.Unmarshal(b, &m); err != nil {
+				t.Fatal(err)
+			}
+			if len(m.Posts) != 1 || m.Posts[0].Source != source || m.Posts[0].URL != url {
+				t.Errorf("want the current URL map; got %+v", m.Posts)
+			}
+		})
+	}
+}
@@ -0,0 +1,326 @@
+package gutenblog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/anschwa/gutenblog/gml"
+)
+
+// PostFile is a post's source as exchanged with the web editor.
+type PostFile struct {
+	ID     string `json:"id"`             // Source directory relative to the posts directory, e.g. "hello-world"
+	Blog   string `json:"blog,omitempty"` // Blog name on multi-blog sites
+	URL    string `json:"url,omitempty"`  // Site path of the post's page
+	Source string `json:"source"`         // GML source
+}
+
+// validatePost parses the source of the post at path (empty for a new
+// post) and checks that it has the metadata needed to publish it.
+func validatePost(path, source string) (gml.Document, error) {
+	doc, err := parsePost(path, source)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing post: %w", err)
+	}
+
+	if doc.Title() == "" {
+		return nil, fmt.Errorf("post is missing a %%title")
+	}
+	if doc.Date().IsZero() {
+		return nil, fmt.Errorf("post is missing a %%date")
+	}
+
+	return doc, nil
+}
+
+// findBlog returns the blog with the given name. A solo blog is
+// returned for an empty name.
+func (s *Site) findBlog(name string) (*blog, error) {
+	if !s.multi && name == "" {
+		return s.blogs[0], nil
+	}
+
+	for _, b := range s.blogs {
+		if filepath.Base(b.name) == name {
+			return b, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no blog named %q: %w", name, fs.ErrNotExist)
+}
+
+// findPostByID returns the post whose source directory matches id.
+func (s *Site) findPostByID(id string) (*blog, *post, error) {
+	blogName, dir := "", id
+	if s.multi {
+		blogName, dir, _ = strings.Cut(id, "/")
+	}
+
+	b, err := s.findBlog(blogName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	postsDir := filepath.Join(b.name, "posts")
+	for _, p := range b.posts {
+		if rel, err := filepath.Rel(postsDir, filepath.Dir(p.path)); err == nil && filepath.ToSlash(rel) == dir {
+			return b, p, nil
+		}
+	}
+
+	return nil, nil, fmt.Errorf("no post with id %q: %w", id, fs.ErrNotExist)
+}
+
+// CreatePost writes a new post's source to the named blog's posts
+// directory. The post's directory and file are named after the slug
+// of its title, e.g. posts/hello-world/hello-world.gml.txt. The site
+// must be regenerated to publish the post.
+func (s *Site) CreatePost(blogName, source string) (*PostFile, error) {
+	doc, err := validatePost("", source)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := s.findBlog(blogName)
+	if err != nil {
+		return nil, err
+	}
+
+	slug := gml.Slugify(doc.Title())
+	if slug == "" {
+		return nil, fmt.Errorf("post title %q has no usable characters for a file name", doc.Title())
+	}
+
+	dir := filepath.Join(b.name, "posts", slug)
+	if err := os.Mkdir(dir, 0755); err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return nil, fmt.Errorf("post %q already exists: %w", slug, err)
+		}
+		return nil, fmt.Errorf("error creating post directory: %w", err)
+	}
+
+	src := filepath.Join(dir, slug+".gml.txt")
+	if err := os.WriteFile(src, []byte(source), 0644); err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("error writing post: %w", err)
+	}
+
+	s.logger.Info("created post", "path", src)
+
+	p := &post{title: doc.Title(), date: date{doc.Date()}}
+	f := &PostFile{ID: slug, URL: path.Dir(p.url(s.webRoot(b))) + "/", Source: source}
+	if s.multi {
+		f.Blog = filepath.Base(b.name)
+		f.ID = f.Blog + "/" + slug
+	}
+
+	return f, nil
+}
+
+// handlePosts serves the web editor's posts API:
+//
+//	POST /api/posts       create a post from {"blog": ..., "source": ...}
+//	GET  /api/posts/<id>  get a post's source
+//	PUT  /api/posts/<id>  replace a post's source with {"source": ...}
+//
+// Requests with a body must be sent as application/json, which a form
+// on another site can't do. Saving a post fails if someone else holds
+// its lock. The saved function is called after each write, e.g. to
+// rebuild the site.
+func (s *Site) handlePosts(w http.ResponseWriter, r *http.Request, locks *lockTable, saved func() error) {
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/posts"), "/")
+
+	if r.Method == http.MethodPost || r.Method == http.MethodPut {
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+			http.Error(w, "request body must be application/json", http.StatusUnsupportedMediaType)
+			return
+		}
+	}
+
+	var (
+		f      *PostFile
+		status = http.StatusOK
+		err    error
+	)
+
+	switch {
+	case id == "" && r.Method == http.MethodPost:
+		var req PostFile
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("error decoding request: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		f, err = s.CreatePost(req.Blog, req.Source)
+		status = http.StatusCreated
+	case id != "" && r.Method == http.MethodGet:
+		f, err = s.postFile(id)
+	case id != "" && r.Method == http.MethodPut:
+		var req PostFile
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("error decoding request: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		f, err = s.updatePost(id, req.Source, locks, authUser(r))
+	default:
+		if id == "" {
+			w.Header().Set("Allow", "POST")
+		} else {
+			w.Header().Set("Allow", "GET, PUT")
+		}
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var locked *ErrLocked
+	switch {
+	case errors.As(err, &locked), errors.Is(err, fs.ErrExist):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case errors.Is(err, fs.ErrNotExist):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		if err := saved(); err != nil {
+			s.logger.Error("error rebuilding site", "err", err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if status == http.StatusCreated {
+		w.Header().Set("Location", "/api/posts/"+f.ID)
+	}
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(f); err != nil {
+		s.logger.Error("error writing post", "err", err)
+	}
+}
+
+// postFile returns the source of the post with the given id.
+func (s *Site) postFile(id string) (*PostFile, error) {
+	b, p, err := s.findPostByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	source, err := os.ReadFile(p.path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading post: %w", err)
+	}
+
+	f := &PostFile{ID: id, URL: path.Dir(p.url(s.webRoot(b))) + "/", Source: string(source)}
+	if s.multi {
+		f.Blog = filepath.Base(b.name)
+	}
+
+	return f, nil
+}
+
+// updatePost replaces the source of the post with the given id unless
+// someone other than user has it locked.
+func (s *Site) updatePost(id, source string, locks *lockTable, user string) (*PostFile, error) {
+	b, p, err := s.findPostByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	urlPath := path.Dir(p.url(s.webRoot(b))) + "/"
+	if err := locks.check(urlPath, user); err != nil {
+		return nil, err
+	}
+
+	if _, err := validatePost(p.path, source); err != nil {
+		return nil, err
+	}
+
+	if err := writeFileAtomic(p.path, []byte(source)); err != nil {
+		return nil, fmt.Errorf("error writing post: %w", err)
+	}
+
+	s.logger.Info("saved post", "path", p.path)
+
+	f := &PostFile{ID: id, URL: urlPath, Source: source}
+	if s.multi {
+		f.Blog = filepath.Base(b.name)
+	}
+
+	return f, nil
+}
+
+// authUser returns the basic auth username of the request, if any.
+func authUser(r *http.Request) string {
+	user, _, _ := r.BasicAuth()
+	return user
+}
+
+// requireAuth only lets authenticated requests through to next. When
+// the server has no basic auth configured, requests are only allowed
+// from the local machine.
+func requireAuth(auth *BasicAuth, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if auth != nil {
+			next(w, r) // The server's auth middleware already checked the credentials
+			return
+		}
+
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if ip := net.ParseIP(host); err != nil || ip == nil || !ip.IsLoopback() {
+			http.Error(w, "editing requires basic auth when serving remote clients", http.StatusForbidden)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// requireSameOrigin only lets requests that change something through
+// to next when they come from the site's own pages. Otherwise any page
+// a user visits could submit a form to their local server. Requests
+// from tools like curl have neither an Origin nor a Sec-Fetch-Site
+// header and are let through.
+func requireSameOrigin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead && !sameOrigin(r) {
+			http.Error(w, "cross-site requests are not allowed", http.StatusForbidden)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// sameOrigin reports whether r was sent by a page of the site itself,
+// going by the Sec-Fetch-Site and Origin headers that browsers send.
+func sameOrigin(r *http.Request) bool {
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "", "same-origin", "none":
+	default:
+		return false
+	}
+
+	if origin := r.Header.Get("Origin"); origin != "" {
+		u, err := url.Parse(origin)
+		if err != nil || u.Host != r.Host {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,147 @@
+package gutenblog
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPostsAPI(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "posts"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	var saves int
+	saved := func() error {
+		saves++
+		return nil
+	}
+
+	locks := newLockTable(time.Minute, gutenlog)
+
+	do := func(method, target, body string, user string) *httptest.ResponseRecorder {
+		// Reload the site like the dev server does for each request
+		s, err := New(root, t.TempDir(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		if body != "" {
+			r.Header.Set("Content-Type", "application/json; charset=utf-8")
+		}
+		if user != "" {
+			r.SetBasicAuth(user, "")
+		}
+
+		w := httptest.NewRecorder()
+		s.handlePosts(w, r, locks, saved)
+		return w
+	}
+
+	w := do("POST", "/api/posts", `{"source": "%title Hello World\n%date 2022-03-21\n\nHi\n"}`, "")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: got %d: %s", w.Code, w.Body)
+	}
+
+	var f PostFile
+	if err := json.Unmarshal(w.Body.Bytes(), &f); err != nil {
+		t.Fatal(err)
+	}
+	if f.ID != "hello-world" || f.URL != "/2022/03/21/hello-world/" {
+		t.Errorf("create: got %+v", f)
+	}
+	if got := w.Header().Get("Location"); got != "/api/posts/hello-world" {
+		t.Errorf("create: got Location %q", got)
+	}
+
+	if _, err := os.Stat(filepath.Join(root, "posts", "hello-world", "hello-world.gml.txt")); err != nil {
+		t.Errorf("create: %v", err)
+	}
+
+	if w := do("POST", "/api/posts", `{"source": "%title Hello World\n%date 2022-03-22\n"}`, ""); w.Code != http.StatusConflict {
+		t.Errorf("create duplicate: got %d, want %d", w.Code, http.StatusConflict)
+	}
+
+	if w := do("POST", "/api/posts", `{"source": "%title No date\n"}`, ""); w.Code != http.StatusBadRequest {
+		t.Errorf("create invalid: got %d, want %d", w.Code, http.StatusBadRequest)
+	}
+
+	// A form on another site can send JSON, but only as text/plain
+	s, err := New(root, t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest("POST", "/api/posts", strings.NewReader(`{"source": "%title Form\n%date 2022-03-21\n"}`))
+	r.Header.Set("Content-Type", "text/plain")
+	w = httptest.NewRecorder()
+	s.handlePosts(w, r, locks, saved)
+	if w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("create as text/plain: got %d, want %d", w.Code, http.StatusUnsupportedMediaType)
+	}
+
+	const edited = "%title Hello World\n%date 2022-03-21\n\nEdited\n"
+	body, _ := json.Marshal(PostFile{Source: edited})
+
+	if _, err := locks.acquire(f.URL, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if w := do("PUT", "/api/posts/hello-world", string(body), "bob"); w.Code != http.StatusConflict {
+		t.Errorf("update locked: got %d, want %d", w.Code, http.StatusConflict)
+	}
+	if w := do("PUT", "/api/posts/hello-world", string(body), "alice"); w.Code != http.StatusOK {
+		t.Errorf("update: got %d: %s", w.Code, w.Body)
+	}
+
+	w = do("GET", "/api/posts/hello-world", "", "")
+	if err := json.Unmarshal(w.Body.Bytes(), &f); err != nil {
+		t.Fatal(err)
+	}
+	if f.Source != edited {
+		t.Errorf("get: got %q, want %q", f.Source, edited)
+	}
+
+	if w := do("PUT", "/api/posts/missing", string(body), ""); w.Code != http.StatusNotFound {
+		t.Errorf("update missing: got %d, want %d", w.Code, http.StatusNotFound)
+	}
+
+	if saves != 2 {
+		t.Errorf("got %d saves, want 2", saves)
+	}
+}
+
+func TestRequireSameOrigin(t *testing.T) {
+	tests := []struct {
+		method string
+		header map[string]string
+		want   int
+	}{
+		{"POST", nil, http.StatusOK},
+		{"POST", map[string]string{"Sec-Fetch-Site": "same-origin", "Origin": "http://localhost:8080"}, http.StatusOK},
+		{"POST", map[string]string{"Sec-Fetch-Site": "cross-site"}, http.StatusForbidden},
+		{"POST", map[string]string{"Sec-Fetch-Site": "same-site"}, http.StatusForbidden},
+		{"PUT", map[string]string{"Origin": "https://evil.example"}, http.StatusForbidden},
+		{"POST", map[string]string{"Origin": "null"}, http.StatusForbidden},
+		{"GET", map[string]string{"Sec-Fetch-Site": "cross-site"}, http.StatusOK},
+	}
+
+	handler := requireSameOrigin(func(w http.ResponseWriter, r *http.Request) {})
+	for _, test := range tests {
+		r := httptest.NewRequest(test.method, "http://localhost:8080/preview", nil)
+		for k, v := range test.header {
+			r.Header.Set(k, v)
+		}
+
+		w := httptest.NewRecorder()
+		handler(w, r)
+		if w.Code != test.want {
+			t.Errorf("%s %v: got %d, want %d", test.method, test.header, w.Code, test.want)
+		}
+	}
+}
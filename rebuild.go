@@ -0,0 +1,122 @@
+package gutenblog
+
+import (
+	"sync"
+	"time"
+)
+
+// rebuilder serializes site rebuilds and debounces the requests for
+// them: a build starts once no request has arrived for the quiet
+// period, and requests made while a build is running are coalesced
+// into the one that follows it. Callers always wait for a build that
+// started after they asked for one, so they never see stale output.
+type rebuilder struct {
+	build func() error
+	quiet time.Duration
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	running  bool
+	pending  bool // Another build was requested while one was running
+	started  int  // Number of builds started
+	finished int  // Number of builds finished
+	timer    *time.Timer
+	gen      int   // Identifies the current timer so stale ones are ignored
+	err      error // Result of the most recently finished build
+}
+
+func newRebuilder(quiet time.Duration, build func() error) *rebuilder {
+	r := &rebuilder{build: build, quiet: quiet}
+	r.cond = sync.NewCond(&r.mu)
+	return r
+}
+
+// rebuild blocks until the site has been rebuilt and returns the
+// result of that build.
+func (r *rebuilder) rebuild() error {
+	return r.wait(false)
+}
+
+// force is like rebuild but starts the build right away instead of
+// waiting for the quiet period.
+func (r *rebuilder) force() error {
+	return r.wait(true)
+}
+
+// setQuiet changes the quiet period used by later rebuilds.
+func (r *rebuilder) setQuiet(quiet time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.quiet = quiet
+}
+
+func (r *rebuilder) wait(force bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Wait for the next build to start. Every request restarts the
+	// quiet period, so a burst of them shares one build.
+	target := r.started + 1
+
+	delay := r.quiet
+	if force {
+		delay = 0
+	}
+	r.schedule(delay)
+
+	for r.finished < target {
+		r.cond.Wait()
+	}
+
+	return r.err
+}
+
+// schedule starts a build after delay, replacing any build that is
+// already scheduled. r.mu must be held.
+func (r *rebuilder) schedule(delay time.Duration) {
+	if r.timer != nil {
+		r.timer.Stop()
+	}
+
+	r.gen++
+	gen := r.gen
+	r.timer = time.AfterFunc(delay, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		if gen != r.gen {
+			return // Replaced by a later request
+		}
+		r.timer = nil
+
+		if r.running {
+			r.pending = true // Build again as soon as this one is done
+			return
+		}
+		r.run()
+	})
+}
+
+// run builds the site until no more builds are pending. r.mu must be
+// held; it is released while building.
+func (r *rebuilder) run() {
+	for {
+		r.running = true
+		r.started++
+		r.mu.Unlock()
+
+		err := r.build()
+
+		r.mu.Lock()
+		r.running = false
+		r.finished++
+		r.err = err
+		r.cond.Broadcast()
+
+		if !r.pending {
+			return
+		}
+		r.pending = false
+	}
+}
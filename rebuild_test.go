@@ -0,0 +1,89 @@
+package gutenblog
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRebuilderCoalesces(t *testing.T) {
+	var builds int32
+	release := make(chan struct{})
+
+	r := newRebuilder(0, func() error {
+		atomic.AddInt32(&builds, 1)
+		<-release
+		return nil
+	})
+
+	// Start one build and queue up several more while it runs
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		r.rebuild()
+	}()
+
+	for atomic.LoadInt32(&builds) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.rebuild()
+		}()
+	}
+
+	time.Sleep(10 * time.Millisecond) // Let the queued requests start waiting
+	close(release)
+	wg.Wait()
+
+	if got := atomic.LoadInt32(&builds); got != 2 {
+		t.Errorf("want 2 builds; got %d", got)
+	}
+}
+
+func TestRebuilderQuietPeriod(t *testing.T) {
+	var (
+		source atomic.Int32 // What an editor last saved
+		output atomic.Int32 // What the last build generated
+		builds atomic.Int32
+	)
+
+	r := newRebuilder(20*time.Millisecond, func() error {
+		builds.Add(1)
+		output.Store(source.Load())
+		return nil
+	})
+
+	// A burst of saves, each closer together than the quiet period,
+	// is built once after the last of them
+	var wg sync.WaitGroup
+	for i := int32(1); i <= 3; i++ {
+		source.Store(i)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.rebuild()
+		}()
+		time.Sleep(5 * time.Millisecond)
+	}
+	wg.Wait()
+
+	if got := builds.Load(); got != 1 {
+		t.Errorf("want 1 build; got %d", got)
+	}
+	if got := output.Load(); got != 3 {
+		t.Errorf("want the last save built; got %d", got)
+	}
+
+	// An edit right after a build is still built
+	source.Store(4)
+	r.rebuild()
+	if got := output.Load(); got != 4 {
+		t.Errorf("want the edit made inside the quiet period built; got %d", got)
+	}
+}
@@ -0,0 +1,351 @@
+package gutenblog
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/anschwa/gutenblog/gml"
+)
+
+// Template files expected in each blog's "tmpl" directory
+const (
+	baseTmpl = "base.html.tmpl"
+	homeTmpl = "home.html.tmpl"
+	postTmpl = "post.html.tmpl"
+)
+
+// SetTemplates replaces the on-disk "tmpl" directory of the named blog
+// with fsys, which must contain base.html.tmpl, home.html.tmpl, and
+// post.html.tmpl. The blog name is the name of the blog's directory;
+// an empty name applies fsys to every blog without its own templates.
+// This lets applications embedding gutenblog swap templates in memory
+// (e.g. with fstest.MapFS or embed.FS) and re-render with RenderPage.
+func (s *Site) SetTemplates(blog string, fsys fs.FS) {
+	if s.templates == nil {
+		s.templates = make(map[string]fs.FS)
+	}
+	s.templates[blog] = fsys
+}
+
+// SetWebFS replaces the on-disk "www" directory with fsys.
+func (s *Site) SetWebFS(fsys fs.FS) {
+	s.www = fsys
+}
+
+// defaultTemplates is a minimal layout used for blogs without a
+// "tmpl" directory so they still produce a browsable site.
+//
+//go:embed defaults/*.tmpl
+var defaultTemplates embed.FS
+
+// defaultTmplWarned holds the missing tmpl directories that have been
+// warned about. The dev server builds a new Site for every request, so
+// this is kept for the life of the process rather than per Site.
+var defaultTmplWarned sync.Map
+
+// templateFS returns the templates used to render a blog.
+func (s *Site) templateFS(b *blog) fs.FS {
+	if fsys, ok := s.templates[filepath.Base(b.name)]; ok {
+		return fsys
+	}
+
+	if fsys, ok := s.templates[""]; ok {
+		return fsys
+	}
+
+	dir := filepath.Join(s.rootDir, s.webRoot(b), "tmpl")
+	if _, err := os.Stat(dir); errors.Is(err, fs.ErrNotExist) {
+		if _, warned := defaultTmplWarned.LoadOrStore(dir, true); !warned {
+			s.logger.Warn("tmpl directory does not exist: using default templates", "blog", b.name, "path", dir)
+		}
+
+		fsys, err := fs.Sub(defaultTemplates, "defaults")
+		if err != nil {
+			panic("unreachable: embedded defaults are missing")
+		}
+		return fsys
+	}
+
+	return os.DirFS(dir)
+}
+
+// tmplFuncs returns the helper functions available to every template.
+// Posts are rendered with opts.
+func tmplFuncs(opts *gml.HTMLOptions) template.FuncMap {
+	return template.FuncMap{
+		// excerptHTML renders the first n blocks of a post, e.g. {{excerptHTML .Post 2}}
+		"excerptHTML": func(doc gml.Document, n int) (template.HTML, error) {
+			var b strings.Builder
+			if _, err := doc.WriteExcerptHTML(&b, n, opts); err != nil {
+				return "", err
+			}
+			return template.HTML(b.String()), nil
+		},
+	}
+}
+
+// htmlOptions returns the options posts are rendered with.
+func (s *Site) htmlOptions() *gml.HTMLOptions {
+	return &gml.HTMLOptions{Minified: true, InlineHTML: s.config.InlineHTML}
+}
+
+// renderHome writes a blog's home page to w.
+func (s *Site) renderHome(w io.Writer, b *blog) error {
+	tmpl, err := template.New(baseTmpl).Funcs(tmplFuncs(s.htmlOptions())).ParseFS(s.templateFS(b), baseTmpl, homeTmpl)
+	if err != nil {
+		return fmt.Errorf("error parsing templates: %w", err)
+	}
+
+	homeData := struct {
+		DocumentTitle string
+		WebRoot       string
+		Posts         map[date]*post
+		Archive       TmplArchive
+	}{
+		DocumentTitle: "",
+		WebRoot:       s.webRoot(b),
+		Posts:         b.posts,
+		Archive:       b.tmplArchive(s.webRoot(b)),
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, "base", homeData); err != nil {
+		return fmt.Errorf("error executing template %q: %w", homeTmpl, err)
+	}
+	_, err = w.Write(s.inject(buf.Bytes()))
+	return err
+}
+
+// renderPost writes a post's page to w given the post's rendered HTML
+// and the options templates render more of it with. The "post" template
+// writes the HTML as-is; it's data, not a template, so a "{{" in a code
+// sample is just text.
+func (s *Site) renderPost(w io.Writer, b *blog, p *post, postHTML string, opts *gml.HTMLOptions) error {
+	funcs := tmplFuncs(opts)
+	funcs["postHTML"] = func() template.HTML { return template.HTML(postHTML) }
+
+	// Templates call {{template "post"}} without passing the page's
+	// data, so the HTML comes from a function instead of {{.PostHTML}}.
+	tmpl, err := template.New("post").Funcs(funcs).Parse(`{{postHTML}}`)
+	if err != nil {
+		return fmt.Errorf("error parsing post: %w", err)
+	}
+
+	tmpl, err = tmpl.ParseFS(s.templateFS(b), baseTmpl, postTmpl)
+	if err != nil {
+		return fmt.Errorf("error parsing templates: %w", err)
+	}
+
+	postData := struct {
+		DocumentTitle string
+		WebRoot       string
+		Post          gml.Document
+		PostHTML      template.HTML
+		Posts         map[date]*post
+		Archive       TmplArchive
+	}{
+		DocumentTitle: p.title,
+		WebRoot:       s.webRoot(b),
+		Post:          p.body,
+		PostHTML:      template.HTML(postHTML),
+		Posts:         b.posts,
+		Archive:       b.tmplArchive(s.webRoot(b)),
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, "base", postData); err != nil {
+		return fmt.Errorf("error executing template %q: %w", postTmpl, err)
+	}
+
+	_, err = w.Write(s.inject(buf.Bytes()))
+	return err
+}
+
+// inject inserts the configured head and body snippets (and the
+// highlight stylesheet link, math scripts, and build comment) into a
+// page just before its closing </head> and </body> tags.
+func (s *Site) inject(page []byte) []byte {
+	page = insertBefore(page, "</head>", s.buildComment())
+	if s.config.Highlight.Style != "" {
+		page = insertBefore(page, "</head>", `<link rel="stylesheet" href="/`+highlightCSSFile+`">`)
+	}
+	page = insertBefore(page, "</head>", mathScripts[s.config.Math.Renderer])
+
+	page = insertBefore(page, "</head>", s.config.Inject.Head)
+	page = insertBefore(page, "</body>", s.config.Inject.Body)
+	return page
+}
+
+// mathScripts maps each math renderer to the tags that load it. Both
+// typeset the \(...\) and \[...\] delimiters that gml writes math in.
+var mathScripts = map[string]string{
+	"katex": `<link rel="stylesheet" href="https://cdn.jsdelivr.net/npm/katex@0.16.11/dist/katex.min.css">` +
+		`<script defer src="https://cdn.jsdelivr.net/npm/katex@0.16.11/dist/katex.min.js"></script>` +
+		`<script defer src="https://cdn.jsdelivr.net/npm/katex@0.16.11/dist/contrib/auto-render.min.js" onload="renderMathInElement(document.body)"></script>`,
+	"mathjax": `<script defer src="https://cdn.jsdelivr.net/npm/mathjax@3/es5/tex-chtml.js"></script>`,
+}
+
+// highlightCSSFile is the stylesheet for highlighted code written to
+// outDir when a highlight style is configured.
+const highlightCSSFile = "highlight.css"
+
+// writeHighlightCSS writes the stylesheet for the configured highlight style.
+func (s *Site) writeHighlightCSS() error {
+	css, err := gml.HighlightCSS(s.config.Highlight.Style)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(s.outDir, highlightCSSFile)
+	if err := os.WriteFile(path, []byte(css), 0644); err != nil {
+		return fmt.Errorf("error writing %q: %w", path, err)
+	}
+
+	return nil
+}
+
+// insertBefore inserts snippet before the last case-insensitive
+// occurrence of tag in page. The page is returned unchanged if the tag
+// isn't found.
+func insertBefore(page []byte, tag, snippet string) []byte {
+	if snippet == "" {
+		return page
+	}
+
+	// Only lowercase ASCII so the index still lines up with page
+	lower := make([]byte, len(page))
+	for i, c := range page {
+		if 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		lower[i] = c
+	}
+
+	i := bytes.LastIndex(lower, []byte(tag))
+	if i < 0 {
+		return page
+	}
+
+	out := make([]byte, 0, len(page)+len(snippet)+1)
+	out = append(out, page[:i]...)
+	out = append(out, snippet...)
+	out = append(out, '\n')
+	return append(out, page[i:]...)
+}
+
+// RenderPage renders the home or post page served at the given URL
+// path (e.g. "/2022/03/21/hello-world/") without writing anything to
+// disk. It returns an error wrapping fs.ErrNotExist when no page
+// matches the path.
+func (s *Site) RenderPage(urlPath string) ([]byte, error) {
+	b, p, err := s.findPage(urlPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if p == nil {
+		if err := s.renderHome(&buf, b); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	opts := s.htmlOptions()
+	if err := s.renderPost(&buf, b, p, p.body.HTML(opts), opts); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// RenderPreview renders GML source as a post page of the named blog
+// (empty for a solo blog) without writing anything to disk. The source
+// may come from anyone who can reach the server, so its HTML is
+// sanitized.
+func (s *Site) RenderPreview(blogName, source string) ([]byte, error) {
+	b, err := s.findBlog(blogName)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := gml.Parse(source)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing post: %w", err)
+	}
+
+	p := &post{
+		title: doc.Title(),
+		date:  date{doc.Date()},
+		tags:  doc.Tags(),
+		body:  doc,
+	}
+
+	opts := s.htmlOptions()
+	opts.Sanitize = true
+
+	var buf bytes.Buffer
+	if err := s.renderPost(&buf, b, p, doc.HTML(opts), opts); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// findPage finds the blog and post served at urlPath. The post is nil
+// when urlPath is the blog's home page.
+func (s *Site) findPage(urlPath string) (*blog, *post, error) {
+	urlPath = path.Clean("/" + strings.TrimSuffix(urlPath, "index.html"))
+
+	for _, b := range s.blogs {
+		webRoot := s.webRoot(b)
+		if urlPath == path.Clean(webRoot) {
+			return b, nil, nil
+		}
+
+		for _, p := range b.posts {
+			if urlPath == path.Dir(p.url(webRoot)) {
+				return b, p, nil
+			}
+		}
+	}
+
+	return nil, nil, fmt.Errorf("no page at %q: %w", urlPath, fs.ErrNotExist)
+}
+
+// cpfs copies the contents of fsys into dst. Unlike cpdir, every file
+// is copied each time because an in-memory filesystem may change
+// between builds without its paths changing.
+func cpfs(fsys fs.FS, dst string) error {
+	return fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			return nil
+		}
+
+		b, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return err
+		}
+
+		newPath := filepath.Join(dst, filepath.FromSlash(p))
+		if err := mkdir(filepath.Dir(newPath)); err != nil {
+			return err
+		}
+
+		return os.WriteFile(newPath, b, 0644)
+	})
+}
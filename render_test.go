@@ -0,0 +1,202 @@
+package gutenblog
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestRenderPage(t *testing.T) {
+	s, err := New("examples/solo-blog", t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.SetTemplates("", fstest.MapFS{
+		baseTmpl: {Data: []byte(`{{define "base"}}<title>{{.DocumentTitle}}</title>{{template "content" .}}{{end}}`)},
+		homeTmpl: {Data: []byte(`{{define "content"}}{{range .Archive}}{{range .Posts}}{{.URL}}{{end}}{{end}}{{end}}`)},
+		postTmpl: {Data: []byte(`{{define "content"}}post{{end}}`)},
+	})
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/", "<title></title>/2022/03/21/hello-world/index.html"},
+		{"/index.html", "<title></title>/2022/03/21/hello-world/index.html"},
+		{"/2022/03/21/hello-world/", "<title>Hello world</title>post"},
+		{"2022/03/21/hello-world/index.html", "<title>Hello world</title>post"},
+	}
+
+	for _, test := range tests {
+		b, err := s.RenderPage(test.path)
+		if err != nil {
+			t.Errorf("%s: %v", test.path, err)
+			continue
+		}
+
+		if got := strings.TrimSpace(string(b)); got != test.want {
+			t.Errorf("%s:\nwant:\t%q\n got:\t%q", test.path, test.want, got)
+		}
+	}
+
+	if _, err := s.RenderPage("/missing/"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("want fs.ErrNotExist; got: %v", err)
+	}
+}
+
+func TestRenderPreview(t *testing.T) {
+	s, err := New("examples/solo-blog", t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.SetTemplates("", fstest.MapFS{
+		baseTmpl: {Data: []byte(`{{define "base"}}<title>{{.DocumentTitle}}</title>{{template "content" .}}{{end}}`)},
+		homeTmpl: {Data: []byte(`{{define "content"}}home{{end}}`)},
+		postTmpl: {Data: []byte(`{{define "content"}}{{.PostHTML}}{{end}}`)},
+	})
+
+	b, err := s.RenderPreview("", "%title Draft\n\nWork in progress")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := string(b); !strings.HasPrefix(got, "<title>Draft</title>") || !strings.Contains(got, "Work in progress") {
+		t.Errorf("got %q", got)
+	}
+
+	// Anyone who can reach the server can preview a post
+	b, err = s.RenderPreview("", "%title Draft\n\n%html\n<p onclick=\"steal()\">Hi<script>steal()</script></p>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(b); strings.Contains(got, "steal()") || !strings.Contains(got, "<p>Hi</p>") {
+		t.Errorf("want sanitized HTML; got %q", got)
+	}
+
+	if _, err := s.RenderPreview("", "%date tomorrow"); err == nil {
+		t.Error("want error previewing a post that doesn't parse")
+	}
+
+	if _, err := s.RenderPreview("missing", "%title Draft"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("want fs.ErrNotExist; got: %v", err)
+	}
+}
+
+func TestRenderPostNotTemplate(t *testing.T) {
+	s, err := New("examples/solo-blog", t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.SetTemplates("", fstest.MapFS{
+		baseTmpl: {Data: []byte(`{{define "base"}}{{template "content" .}}{{end}}`)},
+		homeTmpl: {Data: []byte(`{{define "content"}}home{{end}}`)},
+		postTmpl: {Data: []byte(`{{define "content"}}{{template "post"}}|{{.PostHTML}}{{end}}`)},
+	})
+
+	b, err := s.RenderPreview("", "%title Draft\n\n%pre\n{{.Title}} {{template \"base\"}}\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `<pre>{{.Title}} {{template "base"}}</pre>`
+	if got := string(b); strings.Count(got, want) != 2 {
+		t.Errorf("want %q twice; got %q", want, got)
+	}
+}
+
+func TestExcerptHTMLFunc(t *testing.T) {
+	s, err := New("examples/solo-blog", t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.SetTemplates("", fstest.MapFS{
+		baseTmpl: {Data: []byte(`{{define "base"}}{{template "content" .}}{{end}}`)},
+		homeTmpl: {Data: []byte(`{{define "content"}}{{range .Archive}}{{range .Posts}}{{excerptHTML .Post 1}}{{end}}{{end}}{{end}}`)},
+		postTmpl: {Data: []byte(`{{define "content"}}{{excerptHTML .Post 1}}{{end}}`)},
+	})
+
+	want := `<h2 id="heading" class="heading">Heading <a class="heading-ref" href="#heading">¶</a></h2>`
+	for _, path := range []string{"/", "/2022/03/21/hello-world/"} {
+		b, err := s.RenderPage(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := string(b); got != want {
+			t.Errorf("%s:\nwant:\t%q\n got:\t%q", path, want, got)
+		}
+	}
+}
+
+func TestInsertBefore(t *testing.T) {
+	tests := []struct {
+		page, tag, snippet, want string
+	}{
+		{"<head></head><body></body>", "</head>", "<script></script>", "<head><script></script>\n</head><body></body>"},
+		{"<HEAD></HEAD>", "</head>", "x", "<HEAD>x\n</HEAD>"},
+		{"<p>no head</p>", "</head>", "x", "<p>no head</p>"},
+		{"<body></body>", "</body>", "", "<body></body>"},
+	}
+
+	for _, test := range tests {
+		if got := string(insertBefore([]byte(test.page), test.tag, test.snippet)); got != test.want {
+			t.Errorf("want: %q; got: %q", test.want, got)
+		}
+	}
+}
+
+func TestInjectMath(t *testing.T) {
+	s := &Site{config: &Config{Math: MathConfig{Renderer: "mathjax"}}}
+
+	got := string(s.inject([]byte("<head></head><body></body>")))
+	if !strings.Contains(got, "mathjax") || !strings.HasSuffix(got, "</head><body></body>") {
+		t.Errorf("want the MathJax script in the head; got %q", got)
+	}
+
+	s.config.Math.Renderer = ""
+	if got := string(s.inject([]byte("<head></head>"))); got != "<head></head>" {
+		t.Errorf("want no math scripts; got %q", got)
+	}
+}
+
+func TestDefaultTemplatesWarnOnce(t *testing.T) {
+	root := t.TempDir()
+	postDir := filepath.Join(root, "posts", "hello")
+	if err := os.MkdirAll(postDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(root, "www"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(postDir, "hello.gml.txt"), []byte("%title Hello\n%date 2022-03-21\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+
+	// Like the dev server, build a new site for every rebuild
+	for i := 0; i < 2; i++ {
+		s, err := New(root, t.TempDir(), logger)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Build(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := strings.Count(buf.String(), "tmpl directory does not exist"); n != 1 {
+		t.Errorf("want the missing tmpl directory logged once; got %d times:\n%s", n, buf.String())
+	}
+}
@@ -0,0 +1,507 @@
+package gutenblog
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// ServeOptions configures the built-in HTTP server. The zero value
+// serves a development site that is regenerated on each request.
+type ServeOptions struct {
+	// Production serves the site in outDir as-is, without regenerating
+	// it, with caching headers and precompressed (.br and .gz) variants.
+	// The site should be built before serving it this way.
+	Production bool
+
+	// CertFile and KeyFile are paths to a TLS certificate and its
+	// private key. When both are set the site is served over HTTPS.
+	CertFile string
+	KeyFile  string
+
+	// TLSConfig optionally configures the HTTPS server. It may provide
+	// the certificates itself (e.g. with GetCertificate) instead of
+	// CertFile and KeyFile.
+	TLSConfig *tls.Config
+
+	// Autocert obtains and renews certificates from Let's Encrypt
+	// instead of reading them from CertFile and KeyFile. The rest of
+	// TLSConfig, if any, still applies.
+	Autocert *AutocertOptions
+
+	// Auth requires HTTP basic authentication for every request, e.g.
+	// to preview drafts on a public URL.
+	Auth *BasicAuth
+
+	// AccessLogFormat is the format of the access log: AccessLogDefault,
+	// AccessLogCommon, AccessLogCombined, or AccessLogJSON.
+	AccessLogFormat string
+
+	// AccessLog is where text and JSON access logs are written.
+	// Defaults to os.Stderr.
+	AccessLog io.Writer
+
+	// OnListen is called with the bound address once the server is
+	// listening, e.g. to find the port chosen for "127.0.0.1:0".
+	OnListen func(addr net.Addr)
+
+	// OpenBrowser opens the site in the default web browser once the
+	// server is listening.
+	OpenBrowser bool
+
+	// Context shuts the server down gracefully once it is done, just
+	// like an interrupt, e.g. to stop a server started by a test or by
+	// a program embedding gutenblog.
+	Context context.Context
+}
+
+// AutocertOptions configures automatic HTTPS with Let's Encrypt.
+type AutocertOptions struct {
+	// Hosts are the hostnames certificates may be requested for.
+	Hosts []string
+
+	// CacheDir is where certificates and the ACME account key are
+	// stored between runs. It should stay out of the site's root
+	// directory, which is often under version control. Defaults to
+	// "gutenblog/autocert" in the user's cache directory (see
+	// os.UserCacheDir).
+	CacheDir string
+
+	// Email is an optional contact address for the ACME account.
+	Email string
+
+	// HTTPAddr is the address of the plain HTTP listener that answers
+	// HTTP-01 challenges and redirects everything else to HTTPS.
+	// Defaults to ":80".
+	HTTPAddr string
+}
+
+// tls reports whether the options call for serving HTTPS.
+func (o *ServeOptions) tls() bool {
+	return o.CertFile != "" || o.KeyFile != "" || o.TLSConfig != nil || o.Autocert != nil
+}
+
+// Serve regenerates and serves the site over HTTP until interrupted.
+func (s *Site) Serve(addr string) {
+	if err := s.ListenAndServe(addr, nil); err != nil {
+		s.logger.Error("error starting server", "err", err)
+		os.Exit(1)
+	}
+}
+
+// ListenAndServe serves the site on addr until interrupted or until
+// opts.Context is done. The
+// address is a TCP address (e.g. "localhost:8080") or a unix domain
+// socket path prefixed with "unix:" (e.g. "unix:/run/gutenblog.sock").
+// If opts is nil then the default options are used instead.
+func (s *Site) ListenAndServe(addr string, opts *ServeOptions) error {
+	l, err := listen(addr)
+	if err != nil {
+		return err
+	}
+
+	return s.ServeListener(l, opts)
+}
+
+// listen opens a listener for a TCP address or a "unix:" socket path.
+func listen(addr string) (net.Listener, error) {
+	network := "tcp"
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		network, addr = "unix", path
+
+		// Remove a socket left behind by a previous run, but only when
+		// nothing is listening on it anymore
+		if info, err := os.Stat(addr); err == nil && info.Mode()&fs.ModeSocket != 0 {
+			conn, err := net.Dial("unix", addr)
+			if err == nil {
+				conn.Close()
+				return nil, fmt.Errorf("error listening on %q: address already in use", addr)
+			}
+			if !errors.Is(err, syscall.ECONNREFUSED) {
+				return nil, fmt.Errorf("error checking socket %q: %w", addr, err)
+			}
+
+			if err := os.Remove(addr); err != nil {
+				return nil, fmt.Errorf("error removing stale socket %q: %w", addr, err)
+			}
+		}
+	}
+
+	l, err := net.Listen(network, addr)
+	if err != nil {
+		return nil, fmt.Errorf("error listening on %q: %w", addr, err)
+	}
+
+	return l, nil
+}
+
+// ServeListener serves the site on l (e.g. a listener from systemd
+// socket activation) until interrupted or until opts.Context is done.
+// The listener is closed when
+// ServeListener returns. If opts is nil then the default options are
+// used instead.
+func (s *Site) ServeListener(l net.Listener, opts *ServeOptions) error {
+	if opts == nil {
+		opts = &ServeOptions{}
+	}
+
+	// Adapted from:
+	// - https://pkg.go.dev/net/http#ServeMux
+	// - https://pkg.go.dev/net/http#Server.Shutdown
+	var err error
+	m := newMetrics(s.outDir)
+	handler, reload := s.handler(opts, m)
+	if opts.Auth != nil {
+		if handler, err = opts.Auth.middleware(handler); err != nil {
+			l.Close()
+			return err
+		}
+	}
+	handler = m.instrument(handler) // Count rejected requests too
+
+	handler, err = accessLog(handler, opts.AccessLogFormat, opts.AccessLog, s.logger)
+	if err != nil {
+		l.Close()
+		return err
+	}
+
+	srv := &http.Server{
+		Handler:   handler,
+		TLSConfig: opts.TLSConfig,
+	}
+
+	var redirect *http.Server
+	if opts.Autocert != nil {
+		m, err := s.autocertManager(opts.Autocert)
+		if err != nil {
+			l.Close()
+			return err
+		}
+		srv.TLSConfig = autocertTLSConfig(opts.TLSConfig, m)
+
+		redirect = &http.Server{
+			Addr:    opts.Autocert.HTTPAddr,
+			Handler: m.HTTPHandler(nil), // Redirects non-challenge requests to HTTPS
+		}
+		if redirect.Addr == "" {
+			redirect.Addr = ":80"
+		}
+
+		go func() {
+			s.logger.Info("starting HTTP redirect server", "addr", redirect.Addr)
+			if err := redirect.ListenAndServe(); err != http.ErrServerClosed {
+				s.logger.Error("error starting HTTP redirect server", "err", err)
+			}
+		}()
+	}
+
+	ctx := opts.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	idleConns := make(chan struct{})
+	go func() {
+		sigint := make(chan os.Signal, 1)
+		signal.Notify(sigint, os.Interrupt)
+		select {
+		case <-sigint:
+		case <-ctx.Done():
+		}
+		signal.Stop(sigint)
+
+		if redirect != nil {
+			if err := redirect.Shutdown(context.Background()); err != nil {
+				s.logger.Error("error shutting down HTTP redirect server", "err", err)
+			}
+		}
+
+		if err := srv.Shutdown(context.Background()); err != nil {
+			s.logger.Error("error shutting down server", "err", err)
+		}
+		close(idleConns)
+	}()
+
+	// Reload the config and rebuild everything on SIGHUP while
+	// continuing to serve requests.
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	defer func() {
+		signal.Stop(sighup)
+		close(sighup) // Nothing is sent after Stop, so end the loop below
+	}()
+	go func() {
+		for range sighup {
+			s.logger.Info("reloading site", "root", s.rootDir)
+			if err := reload(); err != nil {
+				s.logger.Error("error reloading site", "err", err)
+				continue
+			}
+			s.logger.Info("reloaded site", "root", s.rootDir)
+		}
+	}()
+
+	s.logger.Info("starting server", "addr", l.Addr().String(), "dir", s.outDir, "production", opts.Production, "tls", opts.tls(), "auth", opts.Auth != nil)
+
+	if opts.OnListen != nil {
+		opts.OnListen(l.Addr())
+	}
+
+	if _, ok := l.Addr().(*net.TCPAddr); ok && opts.OpenBrowser {
+		if err := openBrowser(siteURL(l.Addr(), opts.tls())); err != nil {
+			s.logger.Warn("error opening browser", "err", err)
+		}
+	}
+
+	if opts.tls() {
+		err = srv.ServeTLS(l, opts.CertFile, opts.KeyFile)
+	} else {
+		err = srv.Serve(l)
+	}
+	if err != http.ErrServerClosed {
+		return err
+	}
+
+	<-idleConns
+	return nil
+}
+
+// siteURL returns the URL of a server listening on addr.
+func siteURL(addr net.Addr, tls bool) string {
+	scheme := "http"
+	if tls {
+		scheme = "https"
+	}
+
+	host := addr.String()
+	if tcp, ok := addr.(*net.TCPAddr); ok && tcp.IP.IsUnspecified() {
+		host = net.JoinHostPort("localhost", strconv.Itoa(tcp.Port))
+	}
+
+	return scheme + "://" + host + "/"
+}
+
+// openBrowser opens url with the platform's default browser.
+func openBrowser(url string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+
+	return cmd.Start()
+}
+
+// autocertManager returns a certificate manager for opts.
+func (s *Site) autocertManager(opts *AutocertOptions) (*autocert.Manager, error) {
+	if len(opts.Hosts) == 0 {
+		return nil, fmt.Errorf("autocert: at least one host is required")
+	}
+
+	dir := opts.CacheDir
+	if dir == "" {
+		cache, err := os.UserCacheDir()
+		if err != nil {
+			return nil, fmt.Errorf("autocert: error finding certificate cache: %w", err)
+		}
+		dir = filepath.Join(cache, "gutenblog", "autocert")
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("error creating certificate cache %q: %w", dir, err)
+	}
+
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(opts.Hosts...),
+		Cache:      autocert.DirCache(dir),
+		Email:      opts.Email,
+	}, nil
+}
+
+// autocertTLSConfig returns a copy of cfg that gets its certificates
+// from m, keeping the caller's other settings (e.g. MinVersion or
+// ClientAuth).
+func autocertTLSConfig(cfg *tls.Config, m *autocert.Manager) *tls.Config {
+	mc := m.TLSConfig()
+	if cfg == nil {
+		return mc
+	}
+
+	cfg = cfg.Clone()
+	cfg.GetCertificate = mc.GetCertificate
+	cfg.NextProtos = mc.NextProtos
+	return cfg
+}
+
+// handler returns the server's root handler and a function that
+// re-reads the site config and forces a full rebuild. Builds are
+// recorded in m, which is served at /metrics.
+func (s *Site) handler(opts *ServeOptions, m *metrics) (http.Handler, func() error) {
+	if opts.Production {
+		static := newStaticHandler(s.outDir)
+		build := m.build(s.Build)
+		m.countFiles() // The site was built before serving it
+		reload := func() error {
+			if err := s.reloadConfig(); err != nil {
+				return err
+			}
+
+			cpdirCache.reset()
+			defer static.reset()
+			return build()
+		}
+
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", m)
+		mux.Handle("/", static)
+
+		return mux, reload
+	}
+
+	fs := http.FileServer(http.Dir(s.outDir))
+
+	// Regenerate the blog on with each request, but coalesce the
+	// rebuilds triggered by a burst of requests (e.g. a page and all
+	// of its assets) into one.
+	var (
+		full   atomic.Bool
+		latest atomic.Pointer[Site] // The most recently generated site
+	)
+	rb := newRebuilder(s.config.Serve.RebuildQuietPeriod.Duration, m.build(func() error {
+		site, err := New(s.rootDir, s.outDir, s.logger)
+		if err != nil {
+			return fmt.Errorf("error getting latest blog entries: %w", err)
+		}
+
+		if full.Swap(false) {
+			cpdirCache.reset() // Copy every file again
+		}
+
+		if err := site.generate(); err != nil {
+			return fmt.Errorf("error generating blog: %w", err)
+		}
+
+		latest.Store(site)
+		return nil
+	}))
+
+	locks := newLockTable(s.config.lockTTL(), s.logger)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m)
+	mux.HandleFunc("/api/locks", requireAuth(opts.Auth, requireSameOrigin(locks.ServeHTTP)))
+	mux.HandleFunc("/api/preview-diff", requireAuth(opts.Auth, requireSameOrigin(func(w http.ResponseWriter, r *http.Request) {
+		site, err := New(s.rootDir, s.outDir, s.logger)
+		if err != nil {
+			s.logger.Error("error getting latest blog entries", "err", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		site.handlePreviewDiff(w, r)
+	})))
+	mux.HandleFunc("/preview", requireAuth(opts.Auth, requireSameOrigin(func(w http.ResponseWriter, r *http.Request) {
+		site, err := New(s.rootDir, s.outDir, s.logger)
+		if err != nil {
+			s.logger.Error("error getting latest blog entries", "err", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		site.handlePreview(w, r)
+	})))
+	posts := requireAuth(opts.Auth, requireSameOrigin(func(w http.ResponseWriter, r *http.Request) {
+		site, err := New(s.rootDir, s.outDir, s.logger)
+		if err != nil {
+			s.logger.Error("error getting latest blog entries", "err", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		site.handlePosts(w, r, locks, rb.force)
+	}))
+	mux.HandleFunc("/api/posts", posts)
+	mux.HandleFunc("/api/posts/", posts)
+	mux.HandleFunc("/_edit", requireAuth(opts.Auth, requireSameOrigin(func(w http.ResponseWriter, r *http.Request) {
+		site, err := New(s.rootDir, s.outDir, s.logger)
+		if err != nil {
+			s.logger.Error("error getting latest blog entries", "err", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		site.handleEdit(w, r, locks, rb.force)
+	})))
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if err := rb.rebuild(); err != nil {
+			s.logger.Error("error rebuilding site", "err", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		// No caching during development
+		w.Header().Set("Expires", time.Unix(0, 0).Format(time.RFC1123))
+		w.Header().Set("Cache-Control", "no-cache, private, max-age=0")
+
+		// Add an edit link to post pages
+		if site := latest.Load(); site != nil && strings.HasSuffix(r.URL.Path, "/") {
+			if _, p, err := site.findPage(r.URL.Path); err == nil && p != nil {
+				page, err := os.ReadFile(filepath.Join(s.outDir, filepath.FromSlash(r.URL.Path), "index.html"))
+				if err == nil {
+					w.Header().Set("Content-Type", "text/html; charset=utf-8")
+					w.Write(insertBefore(page, "</body>", editLink(r.URL.Path)))
+					return
+				}
+			}
+		}
+
+		fs.ServeHTTP(w, r)
+	})
+
+	reload := func() error {
+		if err := s.reloadConfig(); err != nil {
+			return err
+		}
+
+		rb.setQuiet(s.config.Serve.RebuildQuietPeriod.Duration)
+		locks.setTTL(s.config.lockTTL())
+
+		full.Store(true)
+		return rb.force()
+	}
+
+	return mux, reload
+}
+
+// reloadConfig re-reads the site config from disk.
+func (s *Site) reloadConfig() error {
+	cfg, err := loadConfig(s.rootDir)
+	if err != nil {
+		return fmt.Errorf("error loading config: %w", err)
+	}
+
+	s.config = cfg
+	return nil
+}
@@ -0,0 +1,275 @@
+package gutenblog
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+func TestListenUnix(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "gutenblog.sock")
+
+	l, err := listen("unix:" + sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := l.Addr().Network(); got != "unix" {
+		t.Errorf("network: got %q, want %q", got, "unix")
+	}
+
+	// A live server keeps its socket
+	if _, err := listen("unix:" + sock); err == nil || !strings.Contains(err.Error(), "address already in use") {
+		t.Errorf("want an address in use error; got %v", err)
+	}
+	if _, err := os.Stat(sock); err != nil {
+		t.Fatalf("want the live socket kept: %v", err)
+	}
+
+	// Leave a stale socket behind like a crashed server would
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close()
+
+	l, err = listen("unix:" + sock)
+	if err != nil {
+		t.Fatalf("error replacing stale socket: %v", err)
+	}
+	l.Close()
+}
+
+func TestServeEphemeralPort(t *testing.T) {
+	s, err := New("examples/solo-blog", t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(s.outDir, "index.html"), []byte("home"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+
+	addrs := make(chan net.Addr, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- s.ListenAndServe("127.0.0.1:0", &ServeOptions{
+			Production: true,
+			OnListen:   func(addr net.Addr) { addrs <- addr },
+			Context:    ctx,
+		})
+	}()
+
+	var addr net.Addr
+	select {
+	case addr = <-addrs:
+	case err := <-done:
+		t.Fatalf("server exited: %v", err)
+	}
+
+	if port := addr.(*net.TCPAddr).Port; port == 0 {
+		t.Fatal("want a bound port")
+	}
+
+	resp, err := http.Get(siteURL(addr, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if string(body) != "home" {
+		t.Errorf("got %q, want %q", body, "home")
+	}
+
+	stop()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAutocertCacheDir(t *testing.T) {
+	cache := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", cache)
+	t.Setenv("HOME", cache) // os.UserCacheDir on macOS
+
+	s, err := New("examples/solo-blog", t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.autocertManager(&AutocertOptions{Hosts: []string{"example.com"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := os.UserCacheDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(want, "gutenblog", "autocert")); err != nil {
+		t.Errorf("want the certificate cache in the user cache directory: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(s.rootDir, ".gutenblog-certs")); err == nil {
+		t.Error("want no certificate cache in the site's root directory")
+	}
+}
+
+func TestHandlerBrokenPost(t *testing.T) {
+	root := t.TempDir()
+	postDir := filepath.Join(root, "posts", "hello")
+	if err := os.MkdirAll(postDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	postPath := filepath.Join(postDir, "hello.gml.txt")
+	if err := os.WriteFile(postPath, []byte("%title Hello\n%date 2022-03-21\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := New(root, t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, _ := s.handler(&ServeOptions{}, newMetrics(s.outDir))
+
+	// Break the post after the server started
+	if err := os.WriteFile(postPath, []byte("%title Hello\n%date 2022-03-21\n\n%nope\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"/preview", "/api/posts", "/_edit", "/api/preview-diff"} {
+		r := httptest.NewRequest("GET", path, nil)
+		r.RemoteAddr = "127.0.0.1:1234"
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if w.Code != http.StatusInternalServerError {
+			t.Errorf("%s: want status %d; got %d", path, http.StatusInternalServerError, w.Code)
+		}
+	}
+}
+
+func TestHandlerEditorAPIs(t *testing.T) {
+	s, err := New("examples/solo-blog", t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, _ := s.handler(&ServeOptions{}, newMetrics(s.outDir))
+
+	tests := []struct {
+		method, target string
+		remote         string
+		header         map[string]string
+		want           int
+	}{
+		{"POST", "/api/locks?path=/a/&user=me", "127.0.0.1:1234", nil, http.StatusOK},
+		{"POST", "/api/locks?path=/a/&user=me", "192.0.2.1:1234", nil, http.StatusForbidden},
+		{"POST", "/api/locks?path=/a/&user=me", "127.0.0.1:1234", map[string]string{"Sec-Fetch-Site": "cross-site"}, http.StatusForbidden},
+		{"DELETE", "/api/locks?path=/a/&user=me", "127.0.0.1:1234", map[string]string{"Origin": "https://evil.example"}, http.StatusForbidden},
+		{"POST", "/api/preview-diff?path=/2022/03/21/hello-world/", "127.0.0.1:1234", nil, http.StatusOK},
+		{"POST", "/api/preview-diff?path=/2022/03/21/hello-world/", "192.0.2.1:1234", nil, http.StatusForbidden},
+		{"POST", "/api/preview-diff?path=/2022/03/21/hello-world/", "127.0.0.1:1234", map[string]string{"Sec-Fetch-Site": "cross-site"}, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.target, nil)
+		r.RemoteAddr = tt.remote
+		for k, v := range tt.header {
+			r.Header.Set(k, v)
+		}
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("%s %s from %s %v: want %d; got %d", tt.method, tt.target, tt.remote, tt.header, tt.want, w.Code)
+		}
+	}
+}
+
+func TestServeCountsRejectedRequests(t *testing.T) {
+	s, err := New("examples/solo-blog", t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+
+	addrs := make(chan net.Addr, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- s.ListenAndServe("127.0.0.1:0", &ServeOptions{
+			Production: true,
+			Auth:       &BasicAuth{Username: "me", Password: "secret"},
+			OnListen:   func(addr net.Addr) { addrs <- addr },
+			Context:    ctx,
+		})
+	}()
+
+	var addr net.Addr
+	select {
+	case addr = <-addrs:
+	case err := <-done:
+		t.Fatalf("server exited: %v", err)
+	}
+
+	resp, err := http.Get(siteURL(addr, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("want %d; got %d", http.StatusUnauthorized, resp.StatusCode)
+	}
+
+	r, err := http.NewRequest("GET", siteURL(addr, false)+"metrics", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.SetBasicAuth("me", "secret")
+	resp, err = http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if want := `gutenblog_http_requests_total{method="GET",code="401"} 1`; !strings.Contains(string(body), want) {
+		t.Errorf("want %q in:\n%s", want, body)
+	}
+
+	stop()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAutocertTLSConfig(t *testing.T) {
+	m := &autocert.Manager{Prompt: autocert.AcceptTOS}
+
+	user := &tls.Config{MinVersion: tls.VersionTLS13, ClientAuth: tls.RequestClientCert}
+	cfg := autocertTLSConfig(user, m)
+
+	if cfg.MinVersion != tls.VersionTLS13 || cfg.ClientAuth != tls.RequestClientCert {
+		t.Errorf("want the caller's settings kept; got MinVersion %x, ClientAuth %v", cfg.MinVersion, cfg.ClientAuth)
+	}
+	if cfg.GetCertificate == nil || !slices.Contains(cfg.NextProtos, acme.ALPNProto) {
+		t.Error("want certificates and ALPN challenges from the manager")
+	}
+	if user.GetCertificate != nil || user.NextProtos != nil {
+		t.Error("want the caller's config left unchanged")
+	}
+
+	if cfg := autocertTLSConfig(nil, m); cfg.GetCertificate == nil {
+		t.Error("want the manager's config without a caller's config")
+	}
+}
@@ -0,0 +1,165 @@
+package gutenblog
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// staticHandler serves a built site for production. Unlike
+// http.FileServer it sets an ETag from each file's content hash, sets
+// Cache-Control, and serves precompressed .br or .gz variants of a
+// file when they exist and the client accepts them.
+type staticHandler struct {
+	dir      string
+	fallback http.Handler
+
+	mu     sync.Mutex
+	hashes map[string]fileHash
+}
+
+type fileHash struct {
+	modTime time.Time
+	size    int64
+	etag    string
+}
+
+// Precompressed variants in order of preference
+var encodings = []struct {
+	name string
+	ext  string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+func newStaticHandler(dir string) *staticHandler {
+	return &staticHandler{
+		dir:      dir,
+		fallback: http.FileServer(http.Dir(dir)),
+		hashes:   make(map[string]fileHash),
+	}
+}
+
+func (h *staticHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := filepath.Join(h.dir, filepath.FromSlash(path.Clean("/"+r.URL.Path)))
+
+	info, err := os.Stat(name)
+	if err == nil && info.IsDir() && strings.HasSuffix(r.URL.Path, "/") {
+		name = filepath.Join(name, "index.html")
+		info, err = os.Stat(name)
+	}
+
+	// Let http.FileServer handle errors, redirects, and directory listings
+	if err != nil || info.IsDir() || strings.HasSuffix(r.URL.Path, "/index.html") {
+		h.fallback.ServeHTTP(w, r)
+		return
+	}
+
+	w.Header().Add("Vary", "Accept-Encoding")
+
+	ctype := mime.TypeByExtension(filepath.Ext(name))
+	if ctype == "" {
+		ctype = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", ctype)
+
+	if strings.HasSuffix(name, ".html") {
+		w.Header().Set("Cache-Control", "public, no-cache") // Always revalidate pages
+	} else {
+		w.Header().Set("Cache-Control", "public, max-age=86400")
+	}
+
+	servePath, servedInfo := name, info
+	for _, enc := range encodings {
+		if !acceptsEncoding(r, enc.name) {
+			continue
+		}
+
+		if vi, err := os.Stat(name + enc.ext); err == nil && vi.Mode().IsRegular() {
+			servePath, servedInfo = name+enc.ext, vi
+			w.Header().Set("Content-Encoding", enc.name)
+			break
+		}
+	}
+
+	etag, err := h.etag(servePath, servedInfo)
+	if err != nil {
+		http.Error(w, "500 Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("ETag", etag)
+
+	f, err := os.Open(servePath)
+	if err != nil {
+		http.Error(w, "500 Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	// ServeContent handles Last-Modified, If-None-Match, and ranges
+	http.ServeContent(w, r, name, info.ModTime(), f)
+}
+
+// reset forgets every cached file hash.
+func (h *staticHandler) reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.hashes = make(map[string]fileHash)
+}
+
+// etag returns a strong ETag for the file at name, caching the hash
+// until the file's size or modification time changes.
+func (h *staticHandler) etag(name string, info os.FileInfo) (string, error) {
+	h.mu.Lock()
+	cached, ok := h.hashes[name]
+	h.mu.Unlock()
+
+	if ok && cached.modTime.Equal(info.ModTime()) && cached.size == info.Size() {
+		return cached.etag, nil
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	etag := fmt.Sprintf(`"%x"`, hash.Sum(nil)[:16])
+
+	h.mu.Lock()
+	h.hashes[name] = fileHash{modTime: info.ModTime(), size: info.Size(), etag: etag}
+	h.mu.Unlock()
+
+	return etag, nil
+}
+
+// acceptsEncoding reports whether the request's Accept-Encoding header
+// allows the named content coding.
+func acceptsEncoding(r *http.Request, name string) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(coding), name) {
+			continue
+		}
+
+		// Respect explicit refusals such as "gzip;q=0"
+		q := strings.ReplaceAll(params, " ", "")
+		return q != "q=0" && q != "q=0.0" && q != "q=0.00" && q != "q=0.000"
+	}
+
+	return false
+}
@@ -0,0 +1,81 @@
+package gutenblog
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStaticHandler(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"index.html":      "<p>home</p>",
+		"style.css":       "body {}",
+		"style.css.gz":    "gzipped",
+		"post/index.html": "<p>post</p>",
+	}
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h := newStaticHandler(dir)
+
+	get := func(path string, header map[string]string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", path, nil)
+		for k, v := range header {
+			r.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := get("/post/", nil)
+	if w.Code != http.StatusOK || w.Body.String() != "<p>post</p>" {
+		t.Fatalf("GET /post/: got %d %q", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Cache-Control"); got != "public, no-cache" {
+		t.Errorf("Cache-Control: got %q", got)
+	}
+	if w.Header().Get("Last-Modified") == "" {
+		t.Error("missing Last-Modified")
+	}
+
+	etag := w.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("missing ETag")
+	}
+
+	w = get("/post/", map[string]string{"If-None-Match": etag})
+	if w.Code != http.StatusNotModified {
+		t.Errorf("conditional GET: got %d, want %d", w.Code, http.StatusNotModified)
+	}
+
+	w = get("/style.css", map[string]string{"Accept-Encoding": "br, gzip"})
+	if w.Body.String() != "gzipped" || w.Header().Get("Content-Encoding") != "gzip" {
+		t.Errorf("precompressed: got %q (encoding %q)", w.Body.String(), w.Header().Get("Content-Encoding"))
+	}
+	if got := w.Header().Get("Content-Type"); got != "text/css; charset=utf-8" {
+		t.Errorf("Content-Type: got %q", got)
+	}
+	if got := w.Header().Get("Cache-Control"); got != "public, max-age=86400" {
+		t.Errorf("Cache-Control: got %q", got)
+	}
+
+	w = get("/style.css", map[string]string{"Accept-Encoding": "gzip;q=0"})
+	if w.Body.String() != "body {}" || w.Header().Get("Content-Encoding") != "" {
+		t.Errorf("uncompressed: got %q (encoding %q)", w.Body.String(), w.Header().Get("Content-Encoding"))
+	}
+
+	if w = get("/missing.html", nil); w.Code != http.StatusNotFound {
+		t.Errorf("missing file: got %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,167 @@
+package gutenblog
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Deleted files are moved into a trash directory in the site root
+// instead of being removed because a static blog's sources are often
+// the only copy. Each deletion gets its own timestamped entry:
+//
+//	.gutenblog-trash/<id>/path         original path relative to the site root
+//	.gutenblog-trash/<id>/files/<path> the trashed file or directory
+const trashDir = ".gutenblog-trash"
+
+// trashIDFormat sorts lexically in chronological order
+const trashIDFormat = "20060102T150405.000000000"
+
+// TrashEntry is a file or directory that was moved to the trash.
+type TrashEntry struct {
+	ID   string // When the entry was trashed
+	Path string // Original path relative to the site root
+}
+
+// Trash moves the file or directory at path into the site's trash. The
+// path may be absolute or relative to the site root but must be within it.
+func (s *Site) Trash(path string) (TrashEntry, error) {
+	rel, err := s.relPath(path)
+	if err != nil {
+		return TrashEntry{}, err
+	}
+
+	entry := TrashEntry{ID: time.Now().UTC().Format(trashIDFormat), Path: rel}
+	entryDir := filepath.Join(s.rootDir, trashDir, entry.ID)
+	src := filepath.Join(s.rootDir, rel)
+	dst := filepath.Join(entryDir, "files", rel)
+
+	if _, err := os.Stat(src); err != nil {
+		return TrashEntry{}, err
+	}
+
+	if err := mkdir(filepath.Dir(dst)); err != nil {
+		return TrashEntry{}, err
+	}
+
+	if err := os.WriteFile(filepath.Join(entryDir, "path"), []byte(filepath.ToSlash(rel)), 0644); err != nil {
+		return TrashEntry{}, fmt.Errorf("error writing trash entry: %w", err)
+	}
+
+	if err := os.Rename(src, dst); err != nil {
+		return TrashEntry{}, fmt.Errorf("error moving %q to trash: %w", rel, err)
+	}
+
+	s.logger.Info("moved to trash", "path", rel, "id", entry.ID)
+	return entry, nil
+}
+
+// ListTrash returns every entry in the trash, oldest first.
+func (s *Site) ListTrash() ([]TrashEntry, error) {
+	root := filepath.Join(s.rootDir, trashDir)
+
+	ids, err := os.ReadDir(root)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading trash: %w", err)
+	}
+
+	var entries []TrashEntry
+	for _, id := range ids {
+		if !id.IsDir() {
+			continue
+		}
+
+		b, err := os.ReadFile(filepath.Join(root, id.Name(), "path"))
+		if err != nil {
+			return nil, fmt.Errorf("error reading trash entry %q: %w", id.Name(), err)
+		}
+
+		entries = append(entries, TrashEntry{ID: id.Name(), Path: filepath.FromSlash(string(b))})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ID < entries[j].ID
+	})
+
+	return entries, nil
+}
+
+// Restore moves a trashed entry back to its original location. It
+// refuses to overwrite anything that has since been created there.
+func (s *Site) Restore(id string) (TrashEntry, error) {
+	entries, err := s.ListTrash()
+	if err != nil {
+		return TrashEntry{}, err
+	}
+
+	for _, e := range entries {
+		if e.ID != id {
+			continue
+		}
+
+		if _, err := s.relPath(e.Path); err != nil {
+			return TrashEntry{}, fmt.Errorf("invalid trash entry %q: %w", e.ID, err)
+		}
+
+		src := filepath.Join(s.rootDir, trashDir, e.ID, "files", e.Path)
+		dst := filepath.Join(s.rootDir, e.Path)
+
+		if _, err := os.Stat(dst); err == nil {
+			return TrashEntry{}, fmt.Errorf("cannot restore %q: %q already exists", e.ID, e.Path)
+		}
+
+		if err := mkdir(filepath.Dir(dst)); err != nil {
+			return TrashEntry{}, err
+		}
+
+		if err := os.Rename(src, dst); err != nil {
+			return TrashEntry{}, fmt.Errorf("error restoring %q: %w", e.Path, err)
+		}
+
+		if err := os.RemoveAll(filepath.Join(s.rootDir, trashDir, e.ID)); err != nil {
+			return TrashEntry{}, fmt.Errorf("error removing trash entry %q: %w", e.ID, err)
+		}
+
+		s.logger.Info("restored from trash", "path", e.Path, "id", e.ID)
+		return e, nil
+	}
+
+	return TrashEntry{}, fmt.Errorf("no trash entry %q", id)
+}
+
+// relPath returns path relative to the site root, failing if it is
+// outside of the site root or is the site root itself.
+func (s *Site) relPath(path string) (string, error) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(s.rootDir, path)
+	}
+
+	root, err := filepath.Abs(s.rootDir)
+	if err != nil {
+		return "", err
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	rel, err := filepath.Rel(root, abs)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%q is not within the site root", path)
+	}
+
+	if rel == trashDir || strings.HasPrefix(rel, trashDir+string(filepath.Separator)) {
+		return "", fmt.Errorf("%q is already in the trash", path)
+	}
+
+	return rel, nil
+}
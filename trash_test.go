@@ -0,0 +1,59 @@
+package gutenblog
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTrashAndRestore(t *testing.T) {
+	root := t.TempDir()
+	postDir := filepath.Join(root, "posts", "hello")
+	if err := os.MkdirAll(postDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	postPath := filepath.Join(postDir, "hello.gml.txt")
+	if err := os.WriteFile(postPath, []byte("%title Hello\n%date 2022-03-21\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := New(root, t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Trash("../outside"); err == nil {
+		t.Error("want error trashing a path outside the site root")
+	}
+
+	e, err := s.Trash(filepath.Join("posts", "hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(postDir); !os.IsNotExist(err) {
+		t.Errorf("want %q to be removed; got: %v", postDir, err)
+	}
+
+	entries, err := s.ListTrash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 1 || entries[0] != e {
+		t.Fatalf("want [%v]; got: %v", e, entries)
+	}
+
+	if _, err := s.Restore(e.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(postPath); err != nil {
+		t.Errorf("want %q to be restored: %v", postPath, err)
+	}
+
+	if entries, _ := s.ListTrash(); len(entries) != 0 {
+		t.Errorf("want empty trash; got: %v", entries)
+	}
+}